@@ -66,6 +66,9 @@ func main() {
 	// Start cleanup loop
 	cleanupCancel, cleanupDone := server.StartCleanupLoop()
 
+	// Start scheduled backups
+	backupCancel, backupDone := server.StartBackupLoop()
+
 	// Create reverse proxy to internal server
 	targetURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", port))
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
@@ -103,6 +106,8 @@ func main() {
 			server.HTTP.Shutdown(context.Background())
 			cleanupCancel()
 			<-cleanupDone
+			backupCancel()
+			<-backupDone
 			server.Cleanup()
 			log.Println("Shutdown complete")
 		},
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/lyallcooper/kuron/internal/app"
+	"github.com/lyallcooper/kuron/internal/cli"
 	"github.com/lyallcooper/kuron/internal/webfs"
 )
 
@@ -20,6 +21,11 @@ var (
 )
 
 func main() {
+	// Any command other than serve is run by the command-line interface
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr, cli.Version{Version: version, Commit: commit}))
+	}
+
 	// Create server using shared app package
 	server, err := app.CreateServer(app.ServerConfig{
 		Version: version,
@@ -34,6 +40,9 @@ func main() {
 	// Start cleanup loop
 	cleanupCancel, cleanupDone := server.StartCleanupLoop()
 
+	// Start scheduled backups
+	backupCancel, backupDone := server.StartBackupLoop()
+
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -56,9 +65,11 @@ func main() {
 		log.Println("Shutting down...")
 	}
 
-	// Cancel cleanup goroutine and wait for it
+	// Cancel cleanup and backup goroutines and wait for them
 	cleanupCancel()
 	<-cleanupDone
+	backupCancel()
+	<-backupDone
 
 	// Shutdown server with timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -0,0 +1,221 @@
+// Package api defines the JSON types of kuron's HTTP API, shared by the
+// server's handlers and the command-line client.
+package api
+
+import (
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+// Error is the body of an API error response
+type Error struct {
+	Error string `json:"error"`
+}
+
+// ScanRequest starts a scan. Sizes are written as in the web forms, e.g. "1 MB".
+type ScanRequest struct {
+	Paths           []string `json:"paths"`
+	MinSize         string   `json:"min_size,omitempty"`
+	MaxSize         string   `json:"max_size,omitempty"`
+	IncludePatterns []string `json:"include_patterns,omitempty"`
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	IncludeHidden   bool     `json:"include_hidden,omitempty"`
+	FollowLinks     bool     `json:"follow_links,omitempty"`
+	OneFileSystem   bool     `json:"one_file_system,omitempty"`
+	NoIgnore        bool     `json:"no_ignore,omitempty"`
+	IgnoreCase      bool     `json:"ignore_case,omitempty"`
+	MaxDepth        *int     `json:"max_depth,omitempty"`
+	NamePatterns    []string `json:"name_patterns,omitempty"`
+	MatchName       bool     `json:"match_name,omitempty"`
+	Isolate         bool     `json:"isolate,omitempty"`
+	MatchLinks      bool     `json:"match_links,omitempty"`
+	RFOver          int      `json:"rf_over,omitempty"`
+	RFUnder         int      `json:"rf_under,omitempty"`
+}
+
+// Run is a scan run
+type Run struct {
+	ID              int64      `json:"id"`
+	JobID           *int64     `json:"job_id,omitempty"`
+	Paths           []string   `json:"paths"`
+	Status          string     `json:"status"`
+	StartedAt       time.Time  `json:"started_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	FilesScanned    int64      `json:"files_scanned"`
+	BytesScanned    int64      `json:"bytes_scanned"`
+	DuplicateGroups int64      `json:"duplicate_groups"`
+	DuplicateFiles  int64      `json:"duplicate_files"`
+	WastedBytes     int64      `json:"wasted_bytes"`
+	Audit           bool       `json:"audit,omitempty"`
+	Imported        bool       `json:"imported,omitempty"`
+	Pinned          bool       `json:"pinned,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// NewRun converts a scan run for the API
+func NewRun(r *db.ScanRun) Run {
+	run := Run{
+		ID:              r.ID,
+		JobID:           r.ScheduledJobID,
+		Paths:           r.Paths,
+		Status:          string(r.Status),
+		StartedAt:       r.StartedAt,
+		CompletedAt:     r.CompletedAt,
+		FilesScanned:    r.FilesScanned,
+		BytesScanned:    r.BytesScanned,
+		DuplicateGroups: r.DuplicateGroups,
+		DuplicateFiles:  r.DuplicateFiles,
+		WastedBytes:     r.WastedBytes,
+		Audit:           r.IsAudit(),
+		Imported:        r.IsImported(),
+		Pinned:          r.Pinned,
+	}
+	if r.ErrorMessage != nil {
+		run.Error = *r.ErrorMessage
+	}
+	return run
+}
+
+// Done reports whether the run has finished, successfully or not
+func (r Run) Done() bool {
+	return r.Status != string(db.ScanRunStatusRunning)
+}
+
+// Group is a duplicate group, or for audit runs a file with too few copies
+type Group struct {
+	ID          int64    `json:"id"`
+	FileHash    string   `json:"file_hash"`
+	FileSize    int64    `json:"file_size"`
+	FileCount   int      `json:"file_count"`
+	LinkedFiles int      `json:"linked_files"` // Paths hardlinked to another file of the group
+	WastedBytes int64    `json:"wasted_bytes"`
+	Status      string   `json:"status"`
+	Files       []string `json:"files"`
+}
+
+// NewGroup converts a duplicate group for the API
+func NewGroup(g *db.DuplicateGroup) Group {
+	return Group{
+		ID:          g.ID,
+		FileHash:    g.FileHash,
+		FileSize:    g.FileSize,
+		FileCount:   g.FileCount,
+		LinkedFiles: g.LinkedFiles(),
+		WastedBytes: g.WastedBytes,
+		Status:      string(g.Status),
+		Files:       g.Files,
+	}
+}
+
+// GroupPage is a page of a run's groups matching a filter
+type GroupPage struct {
+	Total  int     `json:"total"`
+	Groups []Group `json:"groups"`
+}
+
+// Action is an action taken on a run's groups
+type Action struct {
+	ID              int64      `json:"id"`
+	ScanRunID       int64      `json:"scan_run_id"`
+	ActionType      string     `json:"action_type"`
+	Status          string     `json:"status"`
+	StartedAt       time.Time  `json:"started_at"`
+	CompletedAt     *time.Time `json:"completed_at"`
+	GroupsProcessed int        `json:"groups_processed"`
+	FilesProcessed  int        `json:"files_processed"`
+	BytesSaved      int64      `json:"bytes_saved"`                 // Estimated from file sizes
+	BytesMeasured   *int64     `json:"bytes_measured,omitempty"`    // Measured on disk after the action
+	FreeSpaceChange *int64     `json:"free_space_change,omitempty"` // Change in free space of the filesystems changed
+	Command         string     `json:"command,omitempty"`
+	ErrorMessage    string     `json:"error_message,omitempty"`
+	GroupIDs        []int64    `json:"group_ids"`
+	Files           []string   `json:"files"`
+}
+
+// NewAction converts an action for the API
+func NewAction(a *db.Action) Action {
+	action := Action{
+		ID:              a.ID,
+		ScanRunID:       a.ScanRunID,
+		ActionType:      string(a.ActionType),
+		Status:          string(a.Status),
+		StartedAt:       a.StartedAt,
+		CompletedAt:     a.CompletedAt,
+		GroupsProcessed: a.GroupsProcessed,
+		FilesProcessed:  a.FilesProcessed,
+		BytesSaved:      a.BytesSaved,
+		BytesMeasured:   a.BytesMeasured,
+		FreeSpaceChange: a.FreeSpaceChange,
+		GroupIDs:        a.GroupIDs,
+		Files:           a.Files,
+	}
+	if a.Command != nil {
+		action.Command = *a.Command
+	}
+	if a.ErrorMessage != nil {
+		action.ErrorMessage = *a.ErrorMessage
+	}
+	return action
+}
+
+// ActionRequest runs or previews an action on a run's groups
+type ActionRequest struct {
+	Action   string  `json:"action"`              // hardlink, reflink or remove
+	GroupIDs []int64 `json:"group_ids,omitempty"` // Groups to act on
+	All      bool    `json:"all,omitempty"`       // Act on every group matching Filter instead
+	Filter   string  `json:"filter,omitempty"`    // Group filter as a query string, e.g. "dir=/a&ext=jpg"
+	Priority string  `json:"priority,omitempty"`  // Which file remove keeps, e.g. "newest"
+	Apply    bool    `json:"apply,omitempty"`     // Change files; otherwise only preview
+
+	// ConfirmTransform must be set to apply an action to a run matched on
+	// transformed content, whose files may not be byte-identical
+	ConfirmTransform bool `json:"confirm_transform,omitempty"`
+}
+
+// ActionResult is the outcome of an action request
+type ActionResult struct {
+	DryRun bool    `json:"dry_run"`
+	Output string  `json:"output"`
+	Action *Action `json:"action,omitempty"` // Recorded action, when files were changed
+	Error  string  `json:"error,omitempty"`
+}
+
+// Job is a scheduled job
+type Job struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Paths     []string   `json:"paths"`
+	Schedule  string     `json:"schedule"`
+	Timezone  string     `json:"timezone,omitempty"`
+	Action    string     `json:"action"`
+	Steps     int        `json:"steps"` // Pipeline steps, or 0 for a single action
+	Enabled   bool       `json:"enabled"`
+	Managed   bool       `json:"managed,omitempty"` // Provisioned from the server's jobs file
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+}
+
+// NewJob converts a scheduled job for the API
+func NewJob(j *db.ScheduledJob) Job {
+	return Job{
+		ID:        j.ID,
+		Name:      j.Name,
+		Paths:     j.Paths,
+		Schedule:  j.CronExpression,
+		Timezone:  j.Timezone,
+		Action:    j.Action,
+		Steps:     len(j.Steps),
+		Enabled:   j.Enabled,
+		Managed:   j.Managed,
+		LastRunAt: j.LastRunAt,
+		NextRunAt: j.NextRunAt,
+	}
+}
+
+// JobRun is a started or finished run of a job
+type JobRun struct {
+	JobID int64 `json:"job_id"`
+	RunID int64 `json:"run_id,omitempty"` // Scan run of the job's latest scan, once known
+	Done  bool  `json:"done"`             // The job's pipeline has finished
+}
@@ -6,16 +6,20 @@ import (
 	"context"
 	"embed"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lyallcooper/kuron/internal/backup"
 	"github.com/lyallcooper/kuron/internal/config"
 	"github.com/lyallcooper/kuron/internal/db"
 	"github.com/lyallcooper/kuron/internal/fclones"
 	"github.com/lyallcooper/kuron/internal/handlers"
+	"github.com/lyallcooper/kuron/internal/jobconfig"
 	"github.com/lyallcooper/kuron/internal/scheduler"
 	"github.com/lyallcooper/kuron/internal/services"
 )
@@ -44,6 +48,10 @@ type ServerConfig struct {
 	// DisableCSRF disables CSRF protection. Use for desktop mode where
 	// the server only accepts local connections and CSRF isn't a concern.
 	DisableCSRF bool
+
+	// DisableScheduler leaves scheduled jobs alone. Use for one-off command
+	// line use of the local database, where jobs only run when asked to.
+	DisableScheduler bool
 }
 
 // Server wraps the HTTP server and associated resources.
@@ -77,15 +85,24 @@ func CreateServer(cfg ServerConfig) (*Server, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// Reconcile jobs provisioned by KURON_JOBS_FILE or KURON_JOBS
+	if err := provisionJobs(database, appCfg); err != nil {
+		database.Close()
+		return nil, err
+	}
+
 	// Load retention from DB if not set via env var
 	if !appCfg.RetentionDaysFromEnv {
 		if val, err := database.GetSetting("retention_days"); err == nil && val != "" {
-			if days, err := strconv.Atoi(val); err == nil && days >= 1 && days <= 365 {
+			if days, err := strconv.Atoi(val); err == nil && days >= 1 && days <= 9999 {
 				appCfg.RetentionDays = days
 			}
 		}
 	}
 	log.Printf("  Retention: %d days", appCfg.RetentionDays)
+	if appCfg.BackupInterval > 0 {
+		log.Printf("  Backups: every %s to %s (keeping %d)", appCfg.BackupInterval, appCfg.BackupDir, appCfg.BackupKeep)
+	}
 
 	// Initialize fclones executor
 	executor := fclones.NewExecutor()
@@ -105,16 +122,31 @@ func CreateServer(cfg ServerConfig) (*Server, error) {
 
 	// Initialize scanner service
 	scanner := services.NewScanner(database, executor, appCfg.ScanTimeout, appCfg.FclonesCacheEnabled)
+	if appCfg.HooksEnabled {
+		scanner.EnableHooks(appCfg.HookTimeout)
+		log.Printf("  Job hooks: enabled (timeout %s)", appCfg.HookTimeout)
+	}
 
 	// Initialize scheduler
 	sched := scheduler.New(database, scanner)
-	sched.Start()
+	if appCfg.MaintenanceWindow != "" {
+		window, err := scheduler.ParseMaintenanceWindow(appCfg.MaintenanceWindow)
+		if err != nil {
+			database.Close()
+			return nil, fmt.Errorf("invalid KURON_MAINTENANCE_WINDOW: %w", err)
+		}
+		sched.SetMaintenanceWindow(window)
+		log.Printf("  Maintenance window: %s", window)
+	}
+	if !cfg.DisableScheduler {
+		sched.Start()
+	}
 
 	// Build version string
 	versionStr := buildVersionString(cfg.Version, cfg.Commit)
 
 	// Initialize handlers
-	h, err := handlers.New(database, appCfg, executor, scanner, cfg.WebFS, versionStr, cfg.DisableCSRF)
+	h, err := handlers.New(database, appCfg, executor, scanner, sched, cfg.WebFS, versionStr, cfg.DisableCSRF)
 	if err != nil {
 		sched.Stop()
 		database.Close()
@@ -175,10 +207,7 @@ func (s *Server) StartCleanupLoop() (cancel func(), done <-chan struct{}) {
 			case <-cleanupCtx.Done():
 				return
 			case <-ticker.C:
-				log.Printf("Running cleanup (retention: %d days)", s.Config.RetentionDays)
-				if err := s.Database.CleanupOldData(s.Config.RetentionDays); err != nil {
-					log.Printf("Cleanup error: %v", err)
-				}
+				s.cleanup()
 			}
 		}
 	}()
@@ -186,6 +215,145 @@ func (s *Server) StartCleanupLoop() (cancel func(), done <-chan struct{}) {
 	return cleanupCancel, cleanupDone
 }
 
+// cleanup removes data older than the retention policy, then vacuums the
+// database if it's been VacuumInterval since the last time and nothing is
+// writing to it
+func (s *Server) cleanup() {
+	policy, err := s.Database.GetRetentionPolicy()
+	if err != nil {
+		log.Printf("Cleanup error: %v", err)
+		return
+	}
+	// Scan run retention may come from KURON_RETENTION_DAYS rather than the settings
+	policy.RunDays = s.Config.RetentionDays
+
+	log.Printf("Running cleanup (retention: %d days)", policy.RunDays)
+	result, err := s.Database.CleanupOldData(policy)
+	if err != nil {
+		log.Printf("Cleanup error: %v", err)
+		return
+	}
+	log.Printf("Cleanup removed %d scan runs, %d groups, %d actions and %d days of stats",
+		result.Runs, result.Groups, result.Actions, result.Stats)
+
+	if s.Config.VacuumInterval <= 0 {
+		return
+	}
+	if val, _ := s.Database.GetSetting("last_vacuum_at"); val != "" {
+		if last, err := time.Parse(time.RFC3339, val); err == nil && time.Since(last) < s.Config.VacuumInterval {
+			return
+		}
+	}
+	// VACUUM holds the write lock throughout, which would fail a scan or
+	// action's writes; try again at the next cleanup
+	if s.Scanner.HasActiveScans() || s.Scanner.HasActiveActions() {
+		log.Printf("Vacuum postponed while scans or actions are running")
+		return
+	}
+	start := time.Now()
+	if err := s.Database.Vacuum(); err != nil {
+		log.Printf("Vacuum error: %v", err)
+		return
+	}
+	if err := s.Database.SetSetting("last_vacuum_at", start.UTC().Format(time.RFC3339)); err != nil {
+		log.Printf("Vacuum error: %v", err)
+	}
+	log.Printf("Vacuumed database in %s", time.Since(start).Round(time.Millisecond))
+}
+
+// StartBackupLoop starts a background goroutine that backs up the database
+// every BackupInterval, keeping the newest BackupKeep backups. The first backup
+// is due an interval after the newest existing one, or right away if there are
+// none, so frequent restarts don't postpone backups indefinitely.
+// Returns a cancel function and a done channel.
+func (s *Server) StartBackupLoop() (cancel func(), done <-chan struct{}) {
+	backupDone := make(chan struct{})
+	backupCtx, backupCancel := context.WithCancel(context.Background())
+
+	interval := s.Config.BackupInterval
+	if interval <= 0 {
+		close(backupDone)
+		return backupCancel, backupDone
+	}
+
+	go func() {
+		defer close(backupDone)
+
+		var wait time.Duration
+		if files, err := backup.List(s.Config.BackupDir); err != nil {
+			log.Printf("Backup error: %v", err)
+		} else if len(files) > 0 {
+			wait = max(time.Until(files[0].CreatedAt.Add(interval)), 0)
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-backupCtx.Done():
+				return
+			case <-timer.C:
+				if f, err := backup.Create(s.Database, s.Config.BackupDir, s.Config.BackupKeep); err != nil {
+					log.Printf("Backup error: %v", err)
+				} else {
+					log.Printf("Backed up database to %s", f.Path)
+				}
+				timer.Reset(interval)
+			}
+		}
+	}()
+
+	return backupCancel, backupDone
+}
+
+// provisionJobs reconciles the jobs in the configured jobs file or variable
+// into the database, or releases previously managed jobs if neither is set
+func provisionJobs(database *db.DB, cfg *config.Config) error {
+	var source string
+	var r io.Reader
+	switch {
+	case cfg.JobsFile != "" && cfg.Jobs != "":
+		return fmt.Errorf("set either KURON_JOBS_FILE or KURON_JOBS, not both")
+	case cfg.JobsFile != "":
+		f, err := os.Open(cfg.JobsFile)
+		if err != nil {
+			return fmt.Errorf("failed to open KURON_JOBS_FILE: %w", err)
+		}
+		defer f.Close()
+		source, r = cfg.JobsFile, f
+	case cfg.Jobs != "":
+		source, r = "KURON_JOBS", strings.NewReader(cfg.Jobs)
+	default:
+		released, err := jobconfig.Release(database)
+		if err != nil {
+			return fmt.Errorf("failed to release managed jobs: %w", err)
+		}
+		if released > 0 {
+			log.Printf("  Jobs: no jobs file set, released %d managed jobs for editing", released)
+		}
+		return nil
+	}
+
+	f, err := jobconfig.Read(r)
+	if err != nil {
+		return fmt.Errorf("failed to read jobs from %s: %w", source, err)
+	}
+	opts := jobconfig.Options{
+		IsPathAllowed: cfg.IsPathAllowed,
+		HooksEnabled:  cfg.HooksEnabled,
+	}
+	if cfg.RetentionDaysFromEnv {
+		opts.LockedSettings = []string{"retention_days"}
+	}
+	result, err := jobconfig.Provision(database, f, opts, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to provision jobs from %s: %w", source, err)
+	}
+	log.Printf("  Jobs: %d from %s (%d created, %d updated, %d disabled)",
+		len(f.Jobs), source, result.Created, result.Updated, result.Disabled)
+	return nil
+}
+
 func buildVersionString(version, commit string) string {
 	if strings.HasPrefix(version, "v") {
 		return version
@@ -0,0 +1,137 @@
+// Package backup keeps rotated backups of the kuron database in a directory.
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+// Backup files are named kuron-YYYYMMDD-HHMMSS.db, so names sort by age
+const (
+	filePrefix = "kuron-"
+	fileSuffix = ".db"
+	timeLayout = "20060102-150405"
+)
+
+// File is a backup in the backup directory
+type File struct {
+	Name      string
+	Path      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+// FileName returns the name of a backup taken at t
+func FileName(t time.Time) string {
+	return filePrefix + t.UTC().Format(timeLayout) + fileSuffix
+}
+
+// parseFileName returns the time a backup was taken from its name
+func parseFileName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(timeLayout, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+	return t.Local(), err == nil
+}
+
+// Create backs up the database into dir, then removes all but the newest keep
+// backups. A keep of 0 or less keeps every backup.
+func Create(database *db.DB, dir string, keep int) (*File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Backups are named by the second, so move past a name already taken
+	now := time.Now()
+	path := filepath.Join(dir, FileName(now))
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		now = now.Add(time.Second)
+		path = filepath.Join(dir, FileName(now))
+	}
+
+	if err := database.Backup(path); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if keep > 0 {
+		if err := prune(dir, keep); err != nil {
+			return nil, fmt.Errorf("backed up, but failed to remove old backups: %w", err)
+		}
+	}
+
+	return &File{Name: filepath.Base(path), Path: path, Size: info.Size(), CreatedAt: now.Truncate(time.Second)}, nil
+}
+
+// List returns the backups in dir, newest first. A missing directory has none.
+func List(dir string) ([]File, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+	for _, entry := range entries {
+		created, ok := parseFileName(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, File{
+			Name:      entry.Name(),
+			Path:      filepath.Join(dir, entry.Name()),
+			Size:      info.Size(),
+			CreatedAt: created,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name > files[j].Name })
+	return files, nil
+}
+
+// Find returns the backup in dir with the given name. Names that aren't
+// backups, including any with a directory, aren't found.
+func Find(dir, name string) (*File, error) {
+	files, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Name == name {
+			return &f, nil
+		}
+	}
+	return nil, fmt.Errorf("backup not found: %s", name)
+}
+
+// prune removes all but the newest keep backups in dir
+func prune(dir string, keep int) error {
+	files, err := List(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files[min(keep, len(files)):] {
+		if err := os.Remove(f.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+func TestCreate_Rotates(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "kuron.db"))
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	defer database.Close()
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	var created []string
+	for range 3 {
+		f, err := Create(database, dir, 2)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if _, err := db.CheckBackup(f.Path); err != nil {
+			t.Errorf("backup %s is invalid: %v", f.Name, err)
+		}
+		created = append(created, f.Name)
+	}
+
+	files, err := List(dir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != created[2] || files[1].Name != created[1] {
+		t.Errorf("List = %+v, want the two newest of %v, newest first", files, created)
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"kuron-20260101-120000.db",
+		"kuron-20260301-080000.db",
+		"kuron-20260201-000000.db",
+		"kuron-latest.db",              // Not a backup name
+		"other.db",                     // Not a backup name
+		"kuron-20260101-120000.db.tmp", // Incomplete backup
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := List(dir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	want := []string{"kuron-20260301-080000.db", "kuron-20260201-000000.db", "kuron-20260101-120000.db"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Errorf("List = %v, want %v", names, want)
+	}
+	if !files[0].CreatedAt.Equal(time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("CreatedAt = %v, want 2026-03-01 08:00 UTC", files[0].CreatedAt)
+	}
+
+	if files, err := List(filepath.Join(dir, "missing")); err != nil || len(files) != 0 {
+		t.Errorf("List(missing dir) = %v, %v; want no backups", files, err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	name := FileName(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if name != "kuron-20260102-030405.db" {
+		t.Errorf("FileName = %q", name)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := Find(dir, name); err != nil || f.Path != filepath.Join(dir, name) {
+		t.Errorf("Find(%q) = %v, %v", name, f, err)
+	}
+	for _, bad := range []string{"../" + name, "other.db", ""} {
+		if _, err := Find(dir, bad); err == nil {
+			t.Errorf("Find(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Package cli implements kuron's command-line interface. Commands use the
+// JSON API, either of a running server given by --server or KURON_SERVER, or
+// served in the same process from the local database.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// Version identifies the build, as shown by the version command
+type Version struct {
+	Version string
+	Commit  string
+}
+
+const usage = `Usage: kuron [--server URL] [--verbose] COMMAND [ARGS]
+
+Without a command, kuron runs the web server.
+
+Commands:
+  serve                      Run the web server
+  scan [OPTIONS] PATH...     Scan paths for duplicates and wait for the results
+  status RUN                 Show a scan run
+  cancel RUN                 Cancel a running scan
+  runs                       List recent scan runs
+  groups RUN                 List a scan run's duplicate groups
+  export RUN                 Export a scan run's groups
+  action RUN TYPE            Preview or apply hardlink, reflink or remove
+  jobs [list]                List scheduled jobs
+  jobs run|enable|disable|delete JOB
+                             Run or manage a scheduled job
+  version                    Print the version
+
+Commands use the database configured by KURON_DB_PATH, or the server at
+--server or KURON_SERVER if set. Run 'kuron COMMAND --help' for a command's
+options.
+`
+
+// errUsage reports a usage error whose message has already been printed
+var errUsage = errors.New("usage error")
+
+// command is a subcommand and its output streams
+type command struct {
+	client *client
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// Run runs the command line in args, excluding the program name, and returns
+// the process exit code
+func Run(args []string, stdout, stderr io.Writer, version Version) int {
+	global := flag.NewFlagSet("kuron", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	global.Usage = func() { fmt.Fprint(stderr, usage) }
+	server := global.String("server", os.Getenv("KURON_SERVER"), "URL of a running kuron server")
+	verbose := global.Bool("verbose", false, "log server messages")
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	args = global.Args()
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	name, args := args[0], args[1:]
+	var run func(c *command, ctx context.Context, args []string) error
+	switch name {
+	case "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	case "version":
+		fmt.Fprintf(stdout, "kuron %s (%s)\n", version.Version, version.Commit)
+		return exitOK
+	case "scan":
+		run = (*command).scan
+	case "status":
+		run = (*command).status
+	case "cancel":
+		run = (*command).cancel
+	case "runs":
+		run = (*command).runs
+	case "groups":
+		run = (*command).groups
+	case "export":
+		run = (*command).export
+	case "action":
+		run = (*command).action
+	case "jobs":
+		run = (*command).jobs
+	default:
+		fmt.Fprintf(stderr, "kuron: unknown command %q\n\n%s", name, usage)
+		return exitUsage
+	}
+
+	quietLogs(*verbose, stderr)
+	var (
+		c   *client
+		err error
+	)
+	if *server != "" {
+		c, err = newRemoteClient(*server)
+	} else {
+		c, err = newLocalClient(version)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "kuron: %v\n", err)
+		return exitError
+	}
+	defer c.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = run(&command{client: c, stdout: stdout, stderr: stderr}, ctx, args)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	default:
+		fmt.Fprintf(stderr, "kuron %s: %v\n", name, err)
+		return exitError
+	}
+}
+
+// newFlagSet returns a flag set for a subcommand, printing its usage on errors
+func (c *command) newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: kuron %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses flags mixed with positional arguments, as in
+// "kuron groups 12 --ext jpg", and returns the positional arguments.
+// Arguments after "--" are all positional.
+func parseArgs(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	if len(positional) < minArgs || (maxArgs >= 0 && len(positional) > maxArgs) {
+		fs.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// parseID parses a run or job ID argument
+func parseID(kind, s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid %s ID %q", kind, s)
+	}
+	return id, nil
+}
+
+// stringList is a flag that may be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// writeJSON writes v as indented JSON
+func (c *command) writeJSON(v any) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lyallcooper/kuron/internal/api"
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+// testDBPath creates a database with one completed run of two groups and one
+// job, and points the local client at it
+func testDBPath(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kuron.db")
+	database, err := db.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	defer database.Close()
+
+	run, err := database.CreateScanRun(nil, nil, []string{"/photos"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = database.CreateDuplicateGroups([]*db.DuplicateGroup{
+		{ScanRunID: run.ID, FileHash: "aaa", FileSize: 2000, FileCount: 2, WastedBytes: 2000,
+			Status: db.DuplicateGroupStatusPending, Files: []string{"/photos/a.jpg", "/photos/b.jpg"}},
+		{ScanRunID: run.ID, FileHash: "bbb", FileSize: 500, FileCount: 3, WastedBytes: 1000,
+			Status: db.DuplicateGroupStatusPending, Files: []string{"/photos/c.txt", "/photos/d.txt", "/photos/e.txt"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.UpdateScanRunProgress(run.ID, 5, 4500, 2, 3, 3000); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CompleteScanRun(run.ID, db.ScanRunStatusCompleted, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name: "Nightly", Paths: []string{"/photos"}, CronExpression: "0 3 * * *", Action: "scan", Enabled: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("KURON_DB_PATH", path)
+	t.Setenv("KURON_SERVER", "")
+}
+
+// runCLI runs a command line, returning its exit code and output
+func runCLI(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Run(args, &stdout, &stderr, Version{Version: "test", Commit: "abc"})
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_Local(t *testing.T) {
+	testDBPath(t)
+
+	code, out, errOut := runCLI(t, "runs")
+	if code != exitOK {
+		t.Fatalf("runs exited %d: %s", code, errOut)
+	}
+	if !strings.Contains(out, "completed") || !strings.Contains(out, "/photos") || !strings.Contains(out, "3.0 KB") {
+		t.Errorf("runs output = %q, want the completed run", out)
+	}
+
+	code, out, errOut = runCLI(t, "groups", "1", "--ext", "jpg", "--json")
+	if code != exitOK {
+		t.Fatalf("groups exited %d: %s", code, errOut)
+	}
+	var page api.GroupPage
+	if err := json.Unmarshal([]byte(out), &page); err != nil {
+		t.Fatalf("groups --json output isn't JSON: %v", err)
+	}
+	if page.Total != 1 || len(page.Groups) != 1 || page.Groups[0].FileHash != "aaa" {
+		t.Errorf("groups --ext jpg = %+v, want only the jpg group", page)
+	}
+
+	code, out, _ = runCLI(t, "groups", "--limit", "1", "1")
+	if code != exitOK || strings.Count(out, "\n") != 2 {
+		t.Errorf("groups --limit 1 output = %q, want a header and one group", out)
+	}
+
+	code, out, _ = runCLI(t, "export", "1", "--format", "csv", "--sort", "hash", "--order", "asc")
+	wantLines := []string{
+		"group_id,file_hash,file_size,file_count,wasted_bytes,status,path",
+		"1,aaa,2000,2,2000,pending,/photos/a.jpg",
+	}
+	if code != exitOK || !strings.HasPrefix(out, strings.Join(wantLines, "\n")) || strings.Count(out, "\n") != 6 {
+		t.Errorf("export output = %q", out)
+	}
+
+	code, out, _ = runCLI(t, "jobs")
+	if code != exitOK || !strings.Contains(out, "Nightly") || !strings.Contains(out, "0 3 * * *") {
+		t.Errorf("jobs output = %q, want the job", out)
+	}
+
+	code, out, _ = runCLI(t, "jobs", "disable", "1")
+	if code != exitOK || !strings.Contains(out, "disabled") {
+		t.Errorf("jobs disable output = %q", out)
+	}
+	code, out, _ = runCLI(t, "jobs", "--json")
+	var jobs []api.Job
+	if code != exitOK || json.Unmarshal([]byte(out), &jobs) != nil || len(jobs) != 1 || jobs[0].Enabled {
+		t.Errorf("jobs after disable = %q, want the job disabled", out)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	testDBPath(t)
+
+	tests := []struct {
+		args    []string
+		code    int
+		wantErr string
+	}{
+		{[]string{}, exitUsage, "Usage: kuron"},
+		{[]string{"frobnicate"}, exitUsage, `unknown command "frobnicate"`},
+		{[]string{"groups"}, exitUsage, "Usage: kuron groups"},
+		{[]string{"groups", "--bogus", "1"}, exitUsage, "flag provided but not defined"},
+		{[]string{"groups", "99"}, exitError, "scan run not found"},
+		{[]string{"status", "abc"}, exitError, `invalid run ID "abc"`},
+		{[]string{"action", "1", "hardlink"}, exitError, "select groups with --group or --all"},
+		{[]string{"action", "1", "shred", "--all"}, exitError, `unknown action "shred"`},
+		{[]string{"scan", "--no-wait", "/photos"}, exitError, "--no-wait requires --server"},
+		{[]string{"jobs", "frob"}, exitUsage, `unknown command "frob"`},
+		{[]string{"--server", "localhost:8080", "runs"}, exitError, "invalid server URL"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			code, _, errOut := runCLI(t, tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+			if !strings.Contains(errOut, tt.wantErr) {
+				t.Errorf("stderr = %q, want to contain %q", errOut, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantPos  []string
+		wantFlag string
+	}{
+		{[]string{"12"}, []string{"12"}, ""},
+		{[]string{"12", "--ext", "jpg"}, []string{"12"}, "jpg"},
+		{[]string{"--ext", "jpg", "12", "34"}, []string{"12", "34"}, "jpg"},
+		{[]string{"12", "--", "--ext"}, []string{"12", "--ext"}, ""},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		ext := fs.String("ext", "", "")
+		pos, err := parseArgs(fs, tt.args, 0, -1)
+		if err != nil {
+			t.Errorf("parseArgs(%q) error = %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(pos, tt.wantPos) || *ext != tt.wantFlag {
+			t.Errorf("parseArgs(%q) = %q with ext %q, want %q with ext %q", tt.args, pos, *ext, tt.wantPos, tt.wantFlag)
+		}
+	}
+}
+
+func TestHandlerTransport(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/created", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	c := &http.Client{Transport: handlerTransport{handler: mux}}
+
+	resp, err := c.Post(localBaseURL+"/created", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("X-Test") != "yes" || string(body) != "hello" {
+		t.Errorf("response = %d %v %q, want 201 with the header and echoed body", resp.StatusCode, resp.Header, body)
+	}
+
+	resp, err = c.Get(localBaseURL + "/empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("empty response status = %d, want 200", resp.StatusCode)
+	}
+
+	resp, err = c.Get(localBaseURL + "/panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || err == nil {
+		t.Errorf("panicking handler = %d with read error %v, want 500 and an error", resp.StatusCode, err)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{0: "0 B", 999: "999 B", 1000: "1.0 KB", 1500000: "1.5 MB", 3e12: "3.0 TB"}
+	for in, want := range tests {
+		if got := formatBytes(in); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
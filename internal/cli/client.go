@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lyallcooper/kuron/internal/api"
+	"github.com/lyallcooper/kuron/internal/app"
+	"github.com/lyallcooper/kuron/internal/webfs"
+)
+
+// localBaseURL is the placeholder host of requests served in this process
+const localBaseURL = "http://kuron.local"
+
+// client calls the kuron API, either of a running server or served in this
+// process from the local database
+type client struct {
+	http    *http.Client
+	baseURL string
+	local   bool   // Scans run in this process, so they stop when the command exits
+	cleanup func() // Releases the local database, if open
+}
+
+// newRemoteClient returns a client for the server at serverURL
+func newRemoteClient(serverURL string) (*client, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q", serverURL)
+	}
+	return &client{
+		http:    &http.Client{},
+		baseURL: strings.TrimSuffix(u.String(), "/"),
+		cleanup: func() {},
+	}, nil
+}
+
+// newLocalClient opens the database configured by the environment, as the
+// server would, and serves the API in this process. The scheduler isn't
+// started, so jobs only run when asked to.
+func newLocalClient(version Version) (*client, error) {
+	server, err := app.CreateServer(app.ServerConfig{
+		Version:          version.Version,
+		Commit:           version.Commit,
+		WebFS:            webfs.FS,
+		DisableCSRF:      true,
+		DisableScheduler: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &client{
+		http:    &http.Client{Transport: handlerTransport{handler: server.HTTP.Handler}},
+		baseURL: localBaseURL,
+		local:   true,
+		cleanup: server.Cleanup,
+	}, nil
+}
+
+// Close releases the client's resources
+func (c *client) Close() {
+	c.cleanup()
+}
+
+// do sends a request with a JSON body, if any, and decodes the JSON
+// response into out, if set. Error responses are returned as errors.
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from server: %w", err)
+	}
+	return nil
+}
+
+// send sends a request and returns the response if it succeeded
+func (c *client) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	} else if method != http.MethodGet {
+		reader = strings.NewReader("{}")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// responseError returns the error described by an error response
+func responseError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var apiErr api.Error
+	if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+		return fmt.Errorf("%s", apiErr.Error)
+	}
+	if msg := strings.TrimSpace(string(data)); msg != "" && !strings.HasPrefix(msg, "<") {
+		return fmt.Errorf("%s", msg)
+	}
+	return fmt.Errorf("server returned %s", resp.Status)
+}
+
+// download writes the body of a GET response to w
+func (c *client) download(ctx context.Context, path string, w io.Writer) error {
+	resp, err := c.send(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *client) startScan(ctx context.Context, req api.ScanRequest) (*api.Run, error) {
+	var run api.Run
+	return &run, c.do(ctx, http.MethodPost, "/api/scans", req, &run)
+}
+
+func (c *client) getRun(ctx context.Context, id int64) (*api.Run, error) {
+	var run api.Run
+	return &run, c.do(ctx, http.MethodGet, "/api/runs/"+strconv.FormatInt(id, 10), nil, &run)
+}
+
+func (c *client) cancelRun(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodPost, "/api/runs/"+strconv.FormatInt(id, 10)+"/cancel", nil, nil)
+}
+
+func (c *client) listRuns(ctx context.Context, limit int) ([]api.Run, error) {
+	var runs []api.Run
+	return runs, c.do(ctx, http.MethodGet, "/api/runs?limit="+strconv.Itoa(limit), nil, &runs)
+}
+
+func (c *client) listGroups(ctx context.Context, runID int64, query url.Values) (*api.GroupPage, error) {
+	var page api.GroupPage
+	path := "/api/runs/" + strconv.FormatInt(runID, 10) + "/groups?" + query.Encode()
+	return &page, c.do(ctx, http.MethodGet, path, nil, &page)
+}
+
+func (c *client) runAction(ctx context.Context, runID int64, req api.ActionRequest) (*api.ActionResult, error) {
+	var result api.ActionResult
+	return &result, c.do(ctx, http.MethodPost, "/api/runs/"+strconv.FormatInt(runID, 10)+"/actions", req, &result)
+}
+
+func (c *client) listJobs(ctx context.Context) ([]api.Job, error) {
+	var jobs []api.Job
+	return jobs, c.do(ctx, http.MethodGet, "/api/jobs", nil, &jobs)
+}
+
+func (c *client) runJob(ctx context.Context, id int64, wait bool) (*api.JobRun, error) {
+	var run api.JobRun
+	path := "/api/jobs/" + strconv.FormatInt(id, 10) + "/run"
+	if wait {
+		path += "?wait=1"
+	}
+	return &run, c.do(ctx, http.MethodPost, path, nil, &run)
+}
+
+func (c *client) setJobEnabled(ctx context.Context, id int64, enabled bool) (*api.Job, error) {
+	var job api.Job
+	path := "/api/jobs/" + strconv.FormatInt(id, 10) + "/disable"
+	if enabled {
+		path = "/api/jobs/" + strconv.FormatInt(id, 10) + "/enable"
+	}
+	return &job, c.do(ctx, http.MethodPost, path, nil, &job)
+}
+
+func (c *client) deleteJob(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/jobs/"+strconv.FormatInt(id, 10), nil, nil)
+}
+
+// quietLogs discards log output unless verbose is set, since the server logs
+// its startup and each scan
+func quietLogs(verbose bool, w io.Writer) {
+	if verbose {
+		log.SetOutput(w)
+	} else {
+		log.SetOutput(io.Discard)
+	}
+}
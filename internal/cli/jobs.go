@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// jobs lists scheduled jobs, or runs or manages one
+func (c *command) jobs(ctx context.Context, args []string) error {
+	sub := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+
+	switch sub {
+	case "list":
+		return c.listJobs(ctx, args)
+	case "run":
+		return c.runJob(ctx, args)
+	case "enable", "disable":
+		return c.setJobEnabled(ctx, sub, args)
+	case "delete":
+		return c.deleteJob(ctx, args)
+	default:
+		fmt.Fprintf(c.stderr, "kuron jobs: unknown command %q\n", sub)
+		return errUsage
+	}
+}
+
+func (c *command) listJobs(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("jobs list", "[--json]")
+	jsonOut := fs.Bool("json", false, "print jobs as JSON")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	jobs, err := c.client.listJobs(ctx)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		return c.writeJSON(jobs)
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSCHEDULE\tACTION\tENABLED\tNEXT RUN\tPATHS")
+	for _, job := range jobs {
+		action := job.Action
+		if job.Steps > 0 {
+			action = fmt.Sprintf("pipeline (%d steps)", job.Steps)
+		}
+		next := "-"
+		if job.Enabled && job.NextRunAt != nil {
+			next = job.NextRunAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%t\t%s\t%s\n",
+			job.ID, job.Name, job.Schedule, action, job.Enabled, next, strings.Join(job.Paths, ", "))
+	}
+	return tw.Flush()
+}
+
+// runJob runs a job now. Locally, the job runs in this process, so it's
+// always waited for.
+func (c *command) runJob(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("jobs run", "[--no-wait] JOB")
+	noWait := fs.Bool("no-wait", false, "return once the job has started (requires --server)")
+	pos, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("job", pos[0])
+	if err != nil {
+		return err
+	}
+	if *noWait && c.client.local {
+		return errors.New("--no-wait requires --server, since local jobs stop when kuron exits")
+	}
+
+	if !*noWait {
+		fmt.Fprintf(c.stderr, "Running job %d...\n", id)
+	}
+	started := time.Now()
+	jobRun, err := c.client.runJob(ctx, id, !*noWait)
+	if err != nil {
+		return err
+	}
+	if *noWait {
+		if jobRun.RunID != 0 {
+			fmt.Fprintf(c.stdout, "Started job %d: scan run %d\n", id, jobRun.RunID)
+		} else {
+			fmt.Fprintf(c.stdout, "Started job %d\n", id)
+		}
+		return nil
+	}
+
+	if jobRun.RunID == 0 {
+		fmt.Fprintf(c.stdout, "Job %d finished without a scan run\n", id)
+		return nil
+	}
+	run, err := c.client.getRun(ctx, jobRun.RunID)
+	if err != nil {
+		return err
+	}
+	if run.StartedAt.Before(started.Add(-time.Second)) {
+		// The job didn't get as far as starting a scan, e.g. outside its
+		// maintenance window, so its last run is an earlier one
+		fmt.Fprintf(c.stdout, "Job %d finished without a new scan run\n", id)
+		return nil
+	}
+	c.printRun(run)
+	if run.Status != "completed" {
+		return fmt.Errorf("run %d %s", run.ID, run.Status)
+	}
+	return nil
+}
+
+func (c *command) setJobEnabled(ctx context.Context, sub string, args []string) error {
+	fs := c.newFlagSet("jobs "+sub, "JOB")
+	pos, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("job", pos[0])
+	if err != nil {
+		return err
+	}
+
+	job, err := c.client.setJobEnabled(ctx, id, sub == "enable")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "Job %d (%s) %sd\n", job.ID, job.Name, sub)
+	return nil
+}
+
+func (c *command) deleteJob(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("jobs delete", "JOB")
+	pos, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("job", pos[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.client.deleteJob(ctx, id); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "Job %d deleted\n", id)
+	return nil
+}
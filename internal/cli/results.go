@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/lyallcooper/kuron/internal/api"
+)
+
+// groupFilterFlags are the group filters of the results page, as flags
+type groupFilterFlags struct {
+	status, path, dir, ext string
+	minSize, maxSize       string
+	minFiles, maxFiles     string
+	sort, order            string
+}
+
+func (f *groupFilterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.status, "status", "", "only groups with `STATUS` (pending, processed or ignored)")
+	fs.StringVar(&f.path, "path", "", "only groups with a file path containing `TEXT`")
+	fs.StringVar(&f.dir, "dir", "", "only groups with a file in `DIR`")
+	fs.StringVar(&f.ext, "ext", "", "only groups of files with extension `EXT`")
+	fs.StringVar(&f.minSize, "min-size", "", "only groups of files at least `SIZE`")
+	fs.StringVar(&f.maxSize, "max-size", "", "only groups of files at most `SIZE`")
+	fs.StringVar(&f.minFiles, "min-files", "", "only groups with at least `N` files")
+	fs.StringVar(&f.maxFiles, "max-files", "", "only groups with at most `N` files")
+	fs.StringVar(&f.sort, "sort", "", "sort by `FIELD` (wasted, size, count, hash or status)")
+	fs.StringVar(&f.order, "order", "", "sort `ORDER` (asc or desc)")
+}
+
+// values returns the filters as query parameters of the results page
+func (f *groupFilterFlags) values() url.Values {
+	v := url.Values{}
+	for key, value := range map[string]string{
+		"status":    f.status,
+		"path":      f.path,
+		"dir":       f.dir,
+		"ext":       f.ext,
+		"min_size":  f.minSize,
+		"max_size":  f.maxSize,
+		"min_files": f.minFiles,
+		"max_files": f.maxFiles,
+		"sort":      f.sort,
+		"order":     f.order,
+	} {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	return v
+}
+
+// groups lists a run's groups matching the filters
+func (c *command) groups(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("groups", "[OPTIONS] RUN")
+	var filter groupFilterFlags
+	filter.register(fs)
+	limit := fs.Int("limit", 50, "number of groups to list")
+	offset := fs.Int("offset", 0, "number of groups to skip")
+	files := fs.Bool("files", false, "list each group's files")
+	jsonOut := fs.Bool("json", false, "print groups as JSON")
+	pos, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	runID, err := parseID("run", pos[0])
+	if err != nil {
+		return err
+	}
+
+	query := filter.values()
+	query.Set("limit", strconv.Itoa(*limit))
+	query.Set("offset", strconv.Itoa(*offset))
+	page, err := c.client.listGroups(ctx, runID, query)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		return c.writeJSON(page)
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tFILES\tSIZE\tWASTED\tSTATUS\tPATH")
+	for _, g := range page.Groups {
+		first := ""
+		if len(g.Files) > 0 {
+			first = g.Files[0]
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\n",
+			g.ID, g.FileCount, formatBytes(g.FileSize), formatBytes(g.WastedBytes), g.Status, first)
+		if *files && len(g.Files) > 1 {
+			for _, f := range g.Files[1:] {
+				fmt.Fprintf(tw, "\t\t\t\t\t%s\n", f)
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if shown := *offset + len(page.Groups); shown < page.Total {
+		fmt.Fprintf(c.stderr, "Showing %d-%d of %d groups; use --limit and --offset for more\n",
+			min(*offset+1, shown), shown, page.Total)
+	}
+	return nil
+}
+
+// export writes a run's groups matching the filters to stdout or a file
+func (c *command) export(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("export", "[OPTIONS] RUN")
+	var filter groupFilterFlags
+	filter.register(fs)
+	format := fs.String("format", "csv", "`FORMAT`: csv, json, fclones-json or fclones-text")
+	output := fs.String("o", "", "write to `FILE` instead of standard output")
+	pos, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	runID, err := parseID("run", pos[0])
+	if err != nil {
+		return err
+	}
+
+	query := filter.values()
+	query.Set("format", *format)
+	path := "/api/runs/" + strconv.FormatInt(runID, 10) + "/export?" + query.Encode()
+
+	if *output == "" {
+		return c.client.download(ctx, path, c.stdout)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := c.client.download(ctx, path, f); err != nil {
+		f.Close()
+		os.Remove(*output)
+		return err
+	}
+	return f.Close()
+}
+
+// action previews or applies an action to a run's groups
+func (c *command) action(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("action", "[OPTIONS] RUN hardlink|reflink|remove")
+	var filter groupFilterFlags
+	filter.register(fs)
+	var groupArgs stringList
+	fs.Var(&groupArgs, "group", "act on group `ID` (repeatable)")
+	all := fs.Bool("all", false, "act on every group matching the filters")
+	priority := fs.String("priority", "", "which file remove keeps, e.g. newest or least-nested")
+	apply := fs.Bool("apply", false, "change files; without this the action is only previewed")
+	confirmTransform := fs.Bool("confirm-transform", false, "allow applying to groups matched on transformed content")
+	jsonOut := fs.Bool("json", false, "print the result as JSON")
+	pos, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	runID, err := parseID("run", pos[0])
+	if err != nil {
+		return err
+	}
+
+	req := api.ActionRequest{
+		Action:           pos[1],
+		All:              *all,
+		Priority:         *priority,
+		Apply:            *apply,
+		ConfirmTransform: *confirmTransform,
+	}
+	for _, s := range groupArgs {
+		id, err := parseID("group", s)
+		if err != nil {
+			return err
+		}
+		req.GroupIDs = append(req.GroupIDs, id)
+	}
+	if *all {
+		if len(req.GroupIDs) > 0 {
+			return errors.New("use either --group or --all, not both")
+		}
+		req.Filter = filter.values().Encode()
+	} else if len(req.GroupIDs) == 0 {
+		return errors.New("select groups with --group or --all")
+	}
+
+	result, err := c.client.runAction(ctx, runID, req)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		return c.writeJSON(result)
+	}
+
+	io.WriteString(c.stdout, result.Output)
+	if result.DryRun {
+		fmt.Fprintln(c.stderr, "Dry run: no files were changed. Use --apply to run the action.")
+	} else if a := result.Action; a != nil {
+		saved := formatBytes(a.BytesSaved) + " saved"
+		if a.BytesMeasured != nil {
+			saved += fmt.Sprintf(" (%s measured)", formatBytes(*a.BytesMeasured))
+		}
+		fmt.Fprintf(c.stderr, "Action %d %s: %d groups, %d files, %s\n",
+			a.ID, a.Status, a.GroupsProcessed, a.FilesProcessed, saved)
+		if a.ErrorMessage != "" {
+			fmt.Fprintln(c.stderr, "Warning: "+a.ErrorMessage)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/api"
+)
+
+// pollInterval is how often a waiting command checks on a scan
+const pollInterval = time.Second
+
+// cancelWait bounds how long an interrupted command waits for its scan to stop
+const cancelWait = 10 * time.Second
+
+// scan starts a scan and, unless --no-wait, waits for it and prints the results
+func (c *command) scan(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("scan", "[OPTIONS] PATH...")
+	var req api.ScanRequest
+	var include, exclude, names stringList
+	fs.StringVar(&req.MinSize, "min", "", "minimum file size, e.g. 1MB")
+	fs.StringVar(&req.MaxSize, "max", "", "maximum file size")
+	fs.Var(&include, "include", "only scan files matching `PATTERN` (repeatable)")
+	fs.Var(&exclude, "exclude", "skip files matching `PATTERN` (repeatable)")
+	fs.Var(&names, "name", "only scan files whose name matches `PATTERN` (repeatable)")
+	fs.BoolVar(&req.IncludeHidden, "hidden", false, "include hidden files")
+	fs.BoolVar(&req.FollowLinks, "follow-links", false, "follow symbolic links")
+	fs.BoolVar(&req.OneFileSystem, "one-fs", false, "don't cross file system boundaries")
+	fs.BoolVar(&req.NoIgnore, "no-ignore", false, "don't respect .gitignore and .fdignore files")
+	fs.BoolVar(&req.IgnoreCase, "ignore-case", false, "match patterns case-insensitively")
+	depth := fs.Int("depth", -1, "maximum directory depth")
+	fs.BoolVar(&req.MatchName, "match-name", false, "only match files with the same name")
+	fs.BoolVar(&req.Isolate, "isolate", false, "only match files in different scanned paths")
+	fs.BoolVar(&req.MatchLinks, "match-links", false, "treat hard links to the same file as duplicates")
+	fs.IntVar(&req.RFOver, "rf-over", 0, "find files with more than `N` copies")
+	fs.IntVar(&req.RFUnder, "rf-under", 0, "find files with fewer than `N` copies (audit)")
+	noWait := fs.Bool("no-wait", false, "print the run ID and return without waiting (requires --server)")
+	jsonOut := fs.Bool("json", false, "print the run as JSON")
+	paths, err := parseArgs(fs, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	if *noWait && c.client.local {
+		return errors.New("--no-wait requires --server, since local scans stop when kuron exits")
+	}
+
+	req.Paths = paths
+	req.IncludePatterns = include
+	req.ExcludePatterns = exclude
+	req.NamePatterns = names
+	if *depth >= 0 {
+		req.MaxDepth = depth
+	}
+
+	run, err := c.client.startScan(ctx, req)
+	if err != nil {
+		return err
+	}
+	if *noWait {
+		if *jsonOut {
+			return c.writeJSON(run)
+		}
+		fmt.Fprintln(c.stdout, run.ID)
+		return nil
+	}
+
+	fmt.Fprintf(c.stderr, "Started scan run %d\n", run.ID)
+	return c.waitAndReport(ctx, run.ID, *jsonOut)
+}
+
+// status prints a scan run, optionally waiting for it to finish
+func (c *command) status(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("status", "[--wait] [--json] RUN")
+	wait := fs.Bool("wait", false, "wait for the run to finish")
+	jsonOut := fs.Bool("json", false, "print the run as JSON")
+	pos, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("run", pos[0])
+	if err != nil {
+		return err
+	}
+
+	if *wait {
+		return c.waitAndReport(ctx, id, *jsonOut)
+	}
+	run, err := c.client.getRun(ctx, id)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		return c.writeJSON(run)
+	}
+	c.printRun(run)
+	return nil
+}
+
+// cancel cancels a running scan
+func (c *command) cancel(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("cancel", "RUN")
+	pos, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("run", pos[0])
+	if err != nil {
+		return err
+	}
+	return c.client.cancelRun(ctx, id)
+}
+
+// runs lists recent scan runs
+func (c *command) runs(ctx context.Context, args []string) error {
+	fs := c.newFlagSet("runs", "[--limit N] [--json]")
+	limit := fs.Int("limit", 20, "number of runs to list")
+	jsonOut := fs.Bool("json", false, "print runs as JSON")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	runs, err := c.client.listRuns(ctx, *limit)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		return c.writeJSON(runs)
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tSTARTED\tGROUPS\tWASTED\tPATHS")
+	for _, run := range runs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n",
+			run.ID, run.Status, run.StartedAt.Local().Format("2006-01-02 15:04"),
+			run.DuplicateGroups, formatBytes(run.WastedBytes), strings.Join(run.Paths, ", "))
+	}
+	return tw.Flush()
+}
+
+// waitAndReport waits for a run to finish, printing progress, then prints it.
+// If interrupted, it cancels the scan. A run that didn't complete is an error.
+func (c *command) waitAndReport(ctx context.Context, id int64, jsonOut bool) error {
+	run, err := c.waitForRun(ctx, id, true)
+	if err != nil {
+		if ctx.Err() == nil {
+			return err
+		}
+		// Interrupted: stop the scan rather than leave it orphaned
+		cancelCtx, cancel := context.WithTimeout(context.Background(), cancelWait)
+		defer cancel()
+		if err := c.client.cancelRun(cancelCtx, id); err != nil {
+			return fmt.Errorf("interrupted, and failed to cancel run %d: %w", id, err)
+		}
+		c.waitForRun(cancelCtx, id, false)
+		return fmt.Errorf("interrupted; cancelled run %d", id)
+	}
+
+	if jsonOut {
+		if err := c.writeJSON(run); err != nil {
+			return err
+		}
+	} else {
+		c.printRun(run)
+	}
+	if run.Status != "completed" {
+		return fmt.Errorf("run %d %s", run.ID, run.Status)
+	}
+	return nil
+}
+
+// waitForRun polls a run until it has finished
+func (c *command) waitForRun(ctx context.Context, id int64, progress bool) (*api.Run, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	lastFiles := int64(-1)
+	for {
+		run, err := c.client.getRun(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if run.Done() {
+			return run, nil
+		}
+		if progress && run.FilesScanned != lastFiles {
+			fmt.Fprintf(c.stderr, "Scanning: %d files (%s)\n", run.FilesScanned, formatBytes(run.BytesScanned))
+			lastFiles = run.FilesScanned
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// printRun prints a run's details
+func (c *command) printRun(run *api.Run) {
+	tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Run:\t%d\n", run.ID)
+	fmt.Fprintf(tw, "Status:\t%s\n", run.Status)
+	fmt.Fprintf(tw, "Paths:\t%s\n", strings.Join(run.Paths, ", "))
+	fmt.Fprintf(tw, "Started:\t%s\n", run.StartedAt.Local().Format(time.DateTime))
+	if run.CompletedAt != nil {
+		fmt.Fprintf(tw, "Duration:\t%s\n", run.CompletedAt.Sub(run.StartedAt).Round(time.Second))
+	}
+	if !run.Imported {
+		fmt.Fprintf(tw, "Scanned:\t%d files (%s)\n", run.FilesScanned, formatBytes(run.BytesScanned))
+	}
+	if run.Audit {
+		fmt.Fprintf(tw, "At risk:\t%d files (%s)\n", run.DuplicateGroups, formatBytes(run.WastedBytes))
+	} else {
+		fmt.Fprintf(tw, "Duplicates:\t%d groups, %d files\n", run.DuplicateGroups, run.DuplicateFiles)
+		fmt.Fprintf(tw, "Wasted:\t%s\n", formatBytes(run.WastedBytes))
+	}
+	if run.Error != "" {
+		fmt.Fprintf(tw, "Error:\t%s\n", run.Error)
+	}
+	tw.Flush()
+}
+
+// formatBytes formats a size with decimal units to match fclones output, as
+// the web interface does
+func formatBytes(b int64) string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// handlerTransport serves requests with an http.Handler in this process, so
+// the command line can use the local database through the same API as a
+// running server. Responses are streamed as the handler writes them.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+
+	pr, pw := io.Pipe()
+	rw := &pipeResponseWriter{header: make(http.Header), body: pw, ready: make(chan struct{})}
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				rw.WriteHeader(http.StatusInternalServerError)
+				pw.CloseWithError(fmt.Errorf("handler panic: %v", p))
+				return
+			}
+			rw.WriteHeader(http.StatusOK)
+			pw.Close()
+		}()
+		t.handler.ServeHTTP(rw, req)
+	}()
+
+	<-rw.ready
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", rw.status, http.StatusText(rw.status)),
+		StatusCode: rw.status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     rw.sent,
+		Body:       pr,
+		Request:    req,
+	}, nil
+}
+
+// pipeResponseWriter passes a handler's response to the reader of a pipe.
+// The response is ready once the handler writes its header or body, or returns.
+type pipeResponseWriter struct {
+	header http.Header
+	body   *io.PipeWriter
+
+	once   sync.Once
+	ready  chan struct{}
+	status int
+	sent   http.Header // Header as of when the status was written
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(status int) {
+	w.once.Do(func() {
+		w.status = status
+		w.sent = w.header.Clone()
+		close(w.ready)
+	})
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
@@ -16,21 +16,40 @@ type Config struct {
 	RetentionDays        int
 	RetentionDaysFromEnv bool // true if set via KURON_RETENTION_DAYS env var
 	ScanTimeout          time.Duration
-	AllowedPaths         []string // Restrict scanning/autocomplete to these paths (empty = unrestricted)
-	FclonesCacheEnabled  bool     // Enable fclones hash caching (KURON_FCLONES_CACHE)
+	AllowedPaths         []string      // Restrict scanning/autocomplete to these paths (empty = unrestricted)
+	FclonesCacheEnabled  bool          // Enable fclones hash caching (KURON_FCLONES_CACHE)
+	HooksEnabled         bool          // Allow jobs to run hook commands (KURON_HOOKS_ENABLED)
+	HookTimeout          time.Duration // Maximum run time of a single hook command (KURON_HOOK_TIMEOUT)
+	MaintenanceWindow    string        // Times scheduled runs may start for jobs without their own window (KURON_MAINTENANCE_WINDOW)
+	BackupDir            string        // Directory of database backups (KURON_BACKUP_DIR)
+	BackupInterval       time.Duration // Time between scheduled backups, 0 to disable (KURON_BACKUP_INTERVAL)
+	BackupKeep           int           // Number of scheduled backups to keep (KURON_BACKUP_KEEP)
+	VacuumInterval       time.Duration // Minimum time between VACUUMs after cleanup, 0 to disable (KURON_VACUUM_INTERVAL)
+	JobsFile             string        // JSON or YAML file of jobs provisioned at startup (KURON_JOBS_FILE)
+	Jobs                 string        // Jobs provisioned at startup, as JSON or YAML (KURON_JOBS)
 }
 
 // Load reads configuration from environment variables
 func Load() *Config {
 	retentionFromEnv := os.Getenv("KURON_RETENTION_DAYS") != ""
+	dbPath := getEnv("KURON_DB_PATH", "./data/kuron.db")
 	return &Config{
 		Port:                 getEnvInt("KURON_PORT", 8080),
-		DBPath:               getEnv("KURON_DB_PATH", "./data/kuron.db"),
+		DBPath:               dbPath,
 		RetentionDays:        getEnvInt("KURON_RETENTION_DAYS", 30),
 		RetentionDaysFromEnv: retentionFromEnv,
 		ScanTimeout:          getEnvDuration("KURON_SCAN_TIMEOUT", 30*time.Minute),
 		AllowedPaths:         getEnvPaths("KURON_ALLOWED_PATHS"),
 		FclonesCacheEnabled:  getEnvBool("KURON_FCLONES_CACHE", true),
+		HooksEnabled:         getEnvBool("KURON_HOOKS_ENABLED", false),
+		HookTimeout:          getEnvDuration("KURON_HOOK_TIMEOUT", 10*time.Minute),
+		MaintenanceWindow:    getEnv("KURON_MAINTENANCE_WINDOW", ""),
+		BackupDir:            ExpandPath(getEnv("KURON_BACKUP_DIR", filepath.Join(filepath.Dir(dbPath), "backups"))),
+		BackupInterval:       getEnvDuration("KURON_BACKUP_INTERVAL", 24*time.Hour),
+		BackupKeep:           getEnvInt("KURON_BACKUP_KEEP", 7),
+		VacuumInterval:       getEnvDuration("KURON_VACUUM_INTERVAL", 7*24*time.Hour),
+		JobsFile:             ExpandPath(getEnv("KURON_JOBS_FILE", "")),
+		Jobs:                 getEnv("KURON_JOBS", ""),
 	}
 }
 
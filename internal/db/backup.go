@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Backup writes a consistent copy of the database to path, which must not
+// exist. Unlike copying the file, this is safe while the database is in use.
+func (db *DB) Backup(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file already exists: %s", path)
+	}
+
+	// Write to a temporary file first so a failed backup never looks complete
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := db.Exec("VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// CheckBackup checks that the file at path is an intact kuron database that
+// this version can restore, and returns its schema version
+func CheckBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return 0, fmt.Errorf("not a valid database: %w", err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("database is corrupt: %s", result)
+	}
+
+	var version int
+	if err := conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, errors.New("not a kuron database")
+	}
+	if version == 0 {
+		return 0, errors.New("not a kuron database")
+	}
+	if latest := LatestSchemaVersion(); version > latest {
+		return version, fmt.Errorf("backup is from a newer version of kuron (schema version %d, this version supports up to %d)", version, latest)
+	}
+	return version, nil
+}
+
+// Restore replaces the database's contents with those of the backup at path,
+// after checking it with CheckBackup. Backups from older versions are migrated
+// first. The backup file itself is left unchanged, and the contents are
+// replaced in a single transaction, so readers never see a partial restore.
+func (db *DB) Restore(ctx context.Context, path string) error {
+	if _, err := CheckBackup(path); err != nil {
+		return err
+	}
+
+	// Migrate a copy of the backup to the current schema
+	tmp, err := copyToTemp(path)
+	if err != nil {
+		return err
+	}
+	defer removeDatabaseFiles(tmp)
+	migrated, err := Open(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to migrate backup: %w", err)
+	}
+	if err := migrated.Close(); err != nil {
+		return err
+	}
+
+	// ATTACH applies to a single connection, so hold one for the restore
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS backup", tmp); err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE backup")
+
+	tables, err := restoreTables(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for table, columns := range tables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM main."`+table+`"`); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO main."%s" (%s) SELECT %[2]s FROM backup."%[1]s"`, table, columns)); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// restoreTables returns the tables to restore, with their quoted column lists.
+// The backup was migrated to the same schema, so both have the same tables.
+func restoreTables(ctx context.Context, conn *sql.Conn) (map[string]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT m.name, group_concat('"' || c.name || '"', ', ')
+		FROM main.sqlite_master m, pragma_table_info(m.name, 'main') c
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+		GROUP BY m.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := make(map[string]string)
+	for rows.Next() {
+		var name, columns string
+		if err := rows.Scan(&name, &columns); err != nil {
+			return nil, err
+		}
+		if strings.Contains(name, `"`) {
+			return nil, fmt.Errorf("unexpected table name %q", name)
+		}
+		tables[name] = columns
+	}
+	return tables, rows.Err()
+}
+
+// copyToTemp copies a file to a new temporary file and returns its path
+func copyToTemp(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp("", "kuron-restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return filepath.Clean(dst.Name()), nil
+}
+
+// removeDatabaseFiles removes a database file and its WAL files
+func removeDatabaseFiles(path string) {
+	os.Remove(path)
+	os.Remove(path + "-wal")
+	os.Remove(path + "-shm")
+}
@@ -10,6 +10,7 @@ import (
 // DB wraps the SQLite database connection
 type DB struct {
 	*sql.DB
+	tx *sql.Tx // Transaction the queries run in, within Transaction
 }
 
 // Open creates a new database connection and runs migrations
@@ -36,7 +37,7 @@ func Open(dbPath string) (*DB, error) {
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(5)
 
-	wrapper := &DB{db}
+	wrapper := &DB{DB: db}
 
 	// Run migrations
 	if err := wrapper.Migrate(); err != nil {
@@ -51,3 +52,45 @@ func Open(dbPath string) (*DB, error) {
 func (db *DB) Close() error {
 	return db.DB.Close()
 }
+
+// Transaction runs fn with a DB whose queries are part of one transaction,
+// committed if fn returns nil and rolled back otherwise. fn mustn't call
+// methods that begin a transaction of their own.
+func (db *DB) Transaction(fn func(tx *DB) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&DB{DB: db.DB, tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Exec runs a statement, in the transaction if there is one
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.Exec(query, args...)
+	}
+	return db.DB.Exec(query, args...)
+}
+
+// Query runs a query, in the transaction if there is one
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.Query(query, args...)
+	}
+	return db.DB.Query(query, args...)
+}
+
+// QueryRow runs a query for one row, in the transaction if there is one
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRow(query, args...)
+	}
+	return db.DB.QueryRow(query, args...)
+}
@@ -4,6 +4,42 @@ import (
 	"fmt"
 )
 
+// migrations are the schema changes applied in order by Migrate
+var migrations = []struct {
+	version int
+	sql     string
+}{
+	{1, migration001},
+	{2, migration002},
+	{3, migration003},
+	{4, migration004},
+	{5, migration005},
+	{6, migration006},
+	{7, migration007},
+	{8, migration008},
+	{9, migration009},
+	{10, migration010},
+	{11, migration011},
+	{12, migration012},
+	{13, migration013},
+	{14, migration014},
+	{15, migration015},
+	{16, migration016},
+	{17, migration017},
+	{18, migration018},
+	{19, migration019},
+	{20, migration020},
+	{21, migration021},
+	{22, migration022},
+	{23, migration023},
+	{24, migration024},
+}
+
+// LatestSchemaVersion returns the schema version Migrate brings a database to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
 // Migrate runs all database migrations
 func (db *DB) Migrate() error {
 	// Create migrations table if not exists
@@ -25,21 +61,6 @@ func (db *DB) Migrate() error {
 	}
 
 	// Run migrations
-	migrations := []struct {
-		version int
-		sql     string
-	}{
-		{1, migration001},
-		{2, migration002},
-		{3, migration003},
-		{4, migration004},
-		{5, migration005},
-		{6, migration006},
-		{7, migration007},
-		{8, migration008},
-		{9, migration009},
-	}
-
 	for _, m := range migrations {
 		if m.version <= currentVersion {
 			continue
@@ -256,3 +277,247 @@ const migration009 = `
 -- group_ids: JSON array of group IDs that were processed
 ALTER TABLE actions ADD COLUMN group_ids TEXT;
 `
+
+const migration010 = `
+-- Add scheduling policies to scheduled_jobs
+-- missed_run_policy: 'skip' or 'run_once'
+-- overlap_policy: 'forbid', 'queue' or 'allow'
+ALTER TABLE scheduled_jobs ADD COLUMN missed_run_policy TEXT NOT NULL DEFAULT 'run_once';
+ALTER TABLE scheduled_jobs ADD COLUMN overlap_policy TEXT NOT NULL DEFAULT 'forbid';
+
+-- Scheduling decisions made for each job (shown in the job's run history)
+CREATE TABLE job_events (
+    id INTEGER PRIMARY KEY,
+    job_id INTEGER NOT NULL,
+    event TEXT NOT NULL,
+    scheduled_for DATETIME,
+    scan_run_id INTEGER,
+    message TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_job_events_job_id ON job_events(job_id, created_at);
+`
+
+const migration011 = `
+-- Add per-job timezone for cron schedules
+-- timezone: IANA name (e.g. 'Europe/Berlin'), empty for server local time
+ALTER TABLE scheduled_jobs ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+`
+
+const migration012 = `
+-- Add pipeline steps to scheduled_jobs
+-- steps: JSON array of step definitions (empty = scan, then the job's action)
+ALTER TABLE scheduled_jobs ADD COLUMN steps TEXT NOT NULL DEFAULT '[]';
+
+-- Outcome of each pipeline step, grouped by the job event that started the run
+CREATE TABLE job_step_runs (
+    id INTEGER PRIMARY KEY,
+    job_event_id INTEGER NOT NULL,
+    job_id INTEGER NOT NULL,
+    step_index INTEGER NOT NULL,
+    step_type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    scan_run_id INTEGER,
+    action_id INTEGER,
+    message TEXT NOT NULL DEFAULT '',
+    started_at DATETIME NOT NULL,
+    completed_at DATETIME
+);
+
+CREATE INDEX idx_job_step_runs_event ON job_step_runs(job_event_id, step_index);
+CREATE INDEX idx_job_step_runs_job ON job_step_runs(job_id);
+`
+
+const migration013 = `
+-- Add hook commands to scheduled_jobs
+ALTER TABLE scheduled_jobs ADD COLUMN pre_scan_hook TEXT NOT NULL DEFAULT '';
+ALTER TABLE scheduled_jobs ADD COLUMN pre_action_hook TEXT NOT NULL DEFAULT '';
+ALTER TABLE scheduled_jobs ADD COLUMN post_action_hook TEXT NOT NULL DEFAULT '';
+
+-- Output of the pre-scan hook run before a scan
+ALTER TABLE scan_runs ADD COLUMN hook_output TEXT;
+`
+
+const migration014 = `
+-- Add maintenance window and resource limits to scheduled_jobs
+ALTER TABLE scheduled_jobs ADD COLUMN maintenance_window TEXT NOT NULL DEFAULT '';
+ALTER TABLE scheduled_jobs ADD COLUMN threads INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_jobs ADD COLUMN nice INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_jobs ADD COLUMN io_class TEXT NOT NULL DEFAULT '';
+`
+
+const migration015 = `
+-- Add fclones matching modes to scheduled_jobs and scan_runs
+ALTER TABLE scheduled_jobs ADD COLUMN name_patterns TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE scheduled_jobs ADD COLUMN match_name BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_jobs ADD COLUMN isolate BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_jobs ADD COLUMN match_links BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_jobs ADD COLUMN rf_over INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_jobs ADD COLUMN rf_under INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scan_runs ADD COLUMN name_patterns TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE scan_runs ADD COLUMN match_name BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE scan_runs ADD COLUMN isolate BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE scan_runs ADD COLUMN match_links BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE scan_runs ADD COLUMN rf_over INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scan_runs ADD COLUMN rf_under INTEGER NOT NULL DEFAULT 0;
+`
+
+const migration016 = `
+-- Add content transform command to scheduled_jobs and scan_runs
+ALTER TABLE scheduled_jobs ADD COLUMN transform TEXT NOT NULL DEFAULT '';
+ALTER TABLE scan_runs ADD COLUMN transform TEXT NOT NULL DEFAULT '';
+`
+
+const migration017 = `
+-- Files in duplicate groups, one row per file instead of a JSON array on the group
+CREATE TABLE group_files (
+    id INTEGER PRIMARY KEY,
+    group_id INTEGER NOT NULL,
+    scan_run_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    size INTEGER NOT NULL DEFAULT 0,
+    mtime DATETIME,
+    inode INTEGER,
+    device INTEGER,
+    role TEXT NOT NULL DEFAULT 'redundant',
+    action_id INTEGER,
+    action_status TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_group_files_group_id ON group_files(group_id, position);
+CREATE INDEX idx_group_files_scan_run_path ON group_files(scan_run_id, path);
+CREATE INDEX idx_group_files_path ON group_files(path);
+
+-- The first file of each existing group is the one actions keep by default
+INSERT INTO group_files (group_id, scan_run_id, position, path, size, role)
+SELECT g.id, COALESCE(g.scan_run_id, 0), f.key, f.value, g.file_size,
+    CASE WHEN f.key = 0 THEN 'keeper' ELSE 'redundant' END
+FROM duplicate_groups g, json_each(g.files) f
+WHERE json_valid(g.files);
+
+ALTER TABLE duplicate_groups DROP COLUMN files;
+
+-- Files processed by actions
+CREATE TABLE action_files (
+    action_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    PRIMARY KEY (action_id, position)
+);
+
+INSERT INTO action_files (action_id, position, path)
+SELECT a.id, f.key, f.value
+FROM actions a, json_each(a.files) f
+WHERE a.files IS NOT NULL AND json_valid(a.files);
+
+ALTER TABLE actions DROP COLUMN files;
+`
+
+const migration018 = `
+-- fclones command line of scan runs imported from a report
+ALTER TABLE scan_runs ADD COLUMN imported_command TEXT;
+`
+
+const migration019 = `
+-- Jobs provisioned from KURON_JOBS_FILE or KURON_JOBS, which can't be edited in the UI
+ALTER TABLE scheduled_jobs ADD COLUMN managed BOOLEAN NOT NULL DEFAULT 0;
+`
+
+const migration020 = `
+-- Daily stats per job (job_id 0 for quick scans and imports), backfilled from
+-- the scan runs and actions still in the database
+DROP TABLE daily_stats;
+CREATE TABLE daily_stats (
+    date DATE NOT NULL,
+    job_id INTEGER NOT NULL DEFAULT 0,
+    scans_run INTEGER NOT NULL DEFAULT 0,
+    groups_found INTEGER NOT NULL DEFAULT 0,
+    files_found INTEGER NOT NULL DEFAULT 0,
+    bytes_wasted INTEGER NOT NULL DEFAULT 0,
+    bytes_saved INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (date, job_id)
+);
+
+INSERT INTO daily_stats (date, job_id, scans_run, groups_found, files_found, bytes_wasted)
+SELECT date(completed_at, 'localtime'), COALESCE(scheduled_job_id, 0), COUNT(*),
+    SUM(CASE WHEN status = 'completed' AND rf_under = 0 THEN duplicate_groups ELSE 0 END),
+    SUM(CASE WHEN status = 'completed' AND rf_under = 0 THEN duplicate_files ELSE 0 END),
+    SUM(CASE WHEN status = 'completed' AND rf_under = 0 THEN wasted_bytes ELSE 0 END)
+FROM scan_runs
+WHERE status != 'running' AND completed_at IS NOT NULL
+GROUP BY 1, 2;
+
+INSERT INTO daily_stats (date, job_id, bytes_saved)
+SELECT date(a.completed_at, 'localtime'), COALESCE(r.scheduled_job_id, 0), SUM(a.bytes_saved)
+FROM actions a
+LEFT JOIN scan_runs r ON r.id = a.scan_run_id
+WHERE a.completed_at IS NOT NULL AND a.bytes_saved > 0
+GROUP BY 1, 2
+ON CONFLICT (date, job_id) DO UPDATE SET bytes_saved = excluded.bytes_saved;
+`
+
+const migration021 = `
+-- Scan runs kept by retention cleanup
+ALTER TABLE scan_runs ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT 0;
+`
+
+const migration022 = `
+-- Outcome of an action for each of its files
+ALTER TABLE action_files ADD COLUMN status TEXT NOT NULL DEFAULT '';
+ALTER TABLE action_files ADD COLUMN error TEXT;
+`
+
+const migration023 = `
+-- Space reclaimed by actions as measured on disk, alongside the estimate
+ALTER TABLE actions ADD COLUMN bytes_measured INTEGER;
+ALTER TABLE actions ADD COLUMN free_space_change INTEGER;
+`
+
+const migration024 = `
+-- Paths hardlinked to the same data aren't redundant copies of each other.
+-- Work out how much each run overcounted before fixing its groups.
+CREATE TEMP TABLE linked_waste AS
+SELECT g.scan_run_id, SUM(c.paths - c.copies) AS files,
+	SUM(g.wasted_bytes - g.file_size * (c.copies - 1)) AS bytes
+FROM duplicate_groups g
+JOIN (
+	SELECT group_id, COUNT(*) AS paths,
+		COUNT(DISTINCT COALESCE(device || ':' || inode, 'path:' || path)) AS copies
+	FROM group_files GROUP BY group_id
+) c ON c.group_id = g.id
+WHERE g.scan_run_id NOT IN (SELECT id FROM scan_runs WHERE rf_under > 0)
+	AND c.paths > c.copies
+GROUP BY g.scan_run_id;
+
+UPDATE scan_runs SET
+	duplicate_files = MAX(0, duplicate_files - (SELECT files FROM linked_waste WHERE scan_run_id = scan_runs.id)),
+	wasted_bytes = MAX(0, wasted_bytes - (SELECT bytes FROM linked_waste WHERE scan_run_id = scan_runs.id))
+WHERE id IN (SELECT scan_run_id FROM linked_waste);
+
+-- Daily stats count the totals of completed runs on the day they finished
+CREATE TEMP TABLE linked_stats AS
+SELECT date(r.completed_at, 'localtime') AS date, COALESCE(r.scheduled_job_id, 0) AS job_id,
+	SUM(l.files) AS files, SUM(l.bytes) AS bytes
+FROM linked_waste l
+JOIN scan_runs r ON r.id = l.scan_run_id
+WHERE r.status = 'completed' AND r.completed_at IS NOT NULL
+GROUP BY 1, 2;
+
+UPDATE daily_stats SET
+	files_found = MAX(0, files_found - (SELECT files FROM linked_stats s
+		WHERE s.date = daily_stats.date AND s.job_id = daily_stats.job_id)),
+	bytes_wasted = MAX(0, bytes_wasted - (SELECT bytes FROM linked_stats s
+		WHERE s.date = daily_stats.date AND s.job_id = daily_stats.job_id))
+WHERE EXISTS (SELECT 1 FROM linked_stats s WHERE s.date = daily_stats.date AND s.job_id = daily_stats.job_id);
+
+UPDATE duplicate_groups SET wasted_bytes = file_size * ((
+	SELECT COUNT(DISTINCT COALESCE(device || ':' || inode, 'path:' || path))
+	FROM group_files WHERE group_id = duplicate_groups.id) - 1)
+WHERE scan_run_id NOT IN (SELECT id FROM scan_runs WHERE rf_under > 0)
+	AND id IN (SELECT group_id FROM group_files WHERE inode IS NOT NULL);
+
+DROP TABLE linked_waste;
+DROP TABLE linked_stats;
+`
@@ -1,6 +1,9 @@
 package db
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
 // ScheduledJob represents a scheduled scan job with all configuration
 type ScheduledJob struct {
@@ -12,7 +15,8 @@ type ScheduledJob struct {
 	IncludePatterns []string // Glob patterns to include
 	ExcludePatterns []string // Glob patterns to exclude
 	CronExpression  string
-	Action          string // 'scan', 'scan_hardlink', 'scan_reflink'
+	Timezone        string // IANA timezone the schedule is evaluated in ("" = server local time)
+	Action          string // 'scan', 'scan_hardlink', 'scan_reflink', 'audit'
 	Enabled         bool
 	LastRunAt       *time.Time
 	NextRunAt       *time.Time
@@ -25,6 +29,148 @@ type ScheduledJob struct {
 	NoIgnore      bool // Don't respect .gitignore/.fdignore
 	IgnoreCase    bool // Case-insensitive pattern matching
 	MaxDepth      *int // Recursion depth limit (nil = unlimited)
+
+	// Matching modes
+	NamePatterns []string // Glob patterns file names must match
+	MatchName    bool     // Only group files that also share a file name
+	Isolate      bool     // Only count duplicates found under different paths
+	MatchLinks   bool     // Treat hard links to the same file as duplicates
+	RFOver       int      // Report files with more than this many copies (0 = default of 1)
+	RFUnder      int      // Report files with fewer than this many copies (0 = off)
+	Transform    string   // Command that transforms file contents before matching (empty = none)
+
+	// Scheduling policies
+	MissedRunPolicy   MissedRunPolicy // What to do when runs were missed (e.g. during downtime)
+	OverlapPolicy     OverlapPolicy   // What to do when the previous run is still active
+	MaintenanceWindow string          // Times scheduled runs may start, e.g. "Mon-Fri 22:00-06:00" ("" = global window)
+
+	// Resource limits applied to the job's scans
+	Threads int     // fclones thread count (0 = fclones default)
+	Nice    int     // CPU niceness, 0-19 (0 = unchanged)
+	IOClass IOClass // I/O scheduling class ("" = unchanged)
+
+	// Pipeline steps run in order (empty = scan Paths, then apply Action)
+	Steps []JobStep
+
+	// Hook commands run by the shell around the job's scans and actions
+	PreScanHook    string // Before each scan; failure aborts the scan
+	PreActionHook  string // Before each action; failure aborts the action
+	PostActionHook string // After each action, whether or not it succeeded
+
+	// Managed jobs are provisioned from a jobs file at startup and can't be edited in the UI
+	Managed bool
+}
+
+// PipelineSteps returns the steps a run of the job executes. Jobs without
+// explicit steps scan their paths and then apply their Action, if any.
+// Audit jobs only report, so they never apply an action.
+func (j *ScheduledJob) PipelineSteps() []JobStep {
+	if len(j.Steps) > 0 {
+		return j.Steps
+	}
+
+	steps := []JobStep{{Type: JobStepScan}}
+	switch j.Action {
+	case "scan_hardlink":
+		steps = append(steps, JobStep{Type: JobStepAction, ActionType: ActionTypeHardlink})
+	case "scan_reflink":
+		steps = append(steps, JobStep{Type: JobStepAction, ActionType: ActionTypeReflink})
+	}
+	return steps
+}
+
+// JobStepType identifies what a pipeline step does
+type JobStepType string
+
+const (
+	JobStepScan       JobStepType = "scan"         // Scan for duplicates
+	JobStepAction     JobStepType = "action"       // Hardlink/reflink the duplicates found by the previous scan step
+	JobStepNotify     JobStepType = "notify"       // Send a summary of the run so far to a webhook
+	JobStepWaitForJob JobStepType = "wait_for_job" // Wait for another job's latest run to succeed
+)
+
+// JobStep is a single step of a job pipeline
+type JobStep struct {
+	Type       JobStepType `json:"type"`
+	Paths      []string    `json:"paths,omitempty"`       // scan: paths to scan (empty = the job's paths)
+	ActionType ActionType  `json:"action_type,omitempty"` // action: hardlink or reflink
+	WebhookURL string      `json:"webhook_url,omitempty"` // notify: URL the summary is POSTed to (empty = log only)
+	JobID      int64       `json:"job_id,omitempty"`      // wait_for_job: the job to wait for
+}
+
+// JobStepRunStatus represents the outcome of a pipeline step
+type JobStepRunStatus string
+
+const (
+	JobStepRunRunning   JobStepRunStatus = "running"
+	JobStepRunCompleted JobStepRunStatus = "completed"
+	JobStepRunFailed    JobStepRunStatus = "failed"
+	JobStepRunSkipped   JobStepRunStatus = "skipped" // Not run because an earlier step failed
+)
+
+// JobStepRun records the execution of one pipeline step during a job run
+type JobStepRun struct {
+	ID          int64
+	JobEventID  int64 // The event that started the run
+	JobID       int64
+	StepIndex   int
+	StepType    JobStepType
+	Status      JobStepRunStatus
+	ScanRunID   *int64 // Scan run started by a scan step
+	ActionID    *int64 // Action created by an action step
+	Message     string
+	StartedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// MissedRunPolicy controls how the scheduler handles runs that were missed
+type MissedRunPolicy string
+
+const (
+	MissedRunPolicySkip    MissedRunPolicy = "skip"     // Skip missed runs and wait for the next scheduled time
+	MissedRunPolicyRunOnce MissedRunPolicy = "run_once" // Run once to catch up, regardless of how many were missed
+)
+
+// OverlapPolicy controls how the scheduler handles a run that is due while the previous run is still active
+type OverlapPolicy string
+
+const (
+	OverlapPolicyForbid OverlapPolicy = "forbid" // Skip the new run
+	OverlapPolicyQueue  OverlapPolicy = "queue"  // Start the new run once the active run finishes
+	OverlapPolicyAllow  OverlapPolicy = "allow"  // Start the new run alongside the active run
+)
+
+// IOClass is the I/O scheduling class (ionice) a job's scans run with
+type IOClass string
+
+const (
+	IOClassDefault    IOClass = ""            // Inherit kuron's I/O priority
+	IOClassBestEffort IOClass = "best-effort" // Normal I/O at the lowest best-effort priority
+	IOClassIdle       IOClass = "idle"        // Only use the disk when no other process needs it
+)
+
+// JobEventType represents a scheduling decision made for a job
+type JobEventType string
+
+const (
+	JobEventStarted        JobEventType = "started"         // Scheduled run started on time
+	JobEventCaughtUp       JobEventType = "caught_up"       // Missed run(s) caught up with a single run
+	JobEventSkippedMissed  JobEventType = "skipped_missed"  // Missed run(s) skipped
+	JobEventSkippedOverlap JobEventType = "skipped_overlap" // Run skipped because the previous run was still active
+	JobEventQueued         JobEventType = "queued"          // Run queued behind the active run
+	JobEventManual         JobEventType = "manual"          // Run started manually
+	JobEventDeferred       JobEventType = "deferred"        // Run deferred until the maintenance window opens
+)
+
+// JobEvent records a scheduling decision for a job
+type JobEvent struct {
+	ID           int64
+	JobID        int64
+	Event        JobEventType
+	ScheduledFor *time.Time // The scheduled time the decision applies to (nil for manual runs)
+	ScanRunID    *int64     // The scan run that was started, if any
+	Message      string
+	CreatedAt    time.Time
 }
 
 // ScanRunStatus represents the status of a scan run
@@ -52,6 +198,9 @@ type ScanRun struct {
 	DuplicateFiles  int64
 	WastedBytes     int64
 	ErrorMessage    *string
+	HookOutput      *string // Output of the pre-scan hook, if one ran
+	ImportedCommand *string // fclones command line, if imported from a report
+	Pinned          bool    // Kept by retention cleanup
 
 	// Scan options (recorded at scan time)
 	MinSize         int64
@@ -64,6 +213,31 @@ type ScanRun struct {
 	NoIgnore        bool
 	IgnoreCase      bool
 	MaxDepth        *int
+	NamePatterns    []string
+	MatchName       bool
+	Isolate         bool
+	MatchLinks      bool
+	RFOver          int
+	RFUnder         int
+	Transform       string
+}
+
+// IsImported reports whether the run was imported from an fclones report
+// rather than scanned by kuron
+func (r *ScanRun) IsImported() bool {
+	return r.ImportedCommand != nil
+}
+
+// IsAudit reports whether the run was an under-replication audit, whose
+// groups are at-risk files with too few copies rather than duplicates
+func (r *ScanRun) IsAudit() bool {
+	return r.RFUnder > 0
+}
+
+// IsTransformed reports whether files were matched on transformed content,
+// so files in a group may differ byte-for-byte
+func (r *ScanRun) IsTransformed() bool {
+	return r.Transform != ""
 }
 
 // DuplicateGroupStatus represents the status of a duplicate group
@@ -72,6 +246,8 @@ type DuplicateGroupStatus string
 const (
 	DuplicateGroupStatusPending   DuplicateGroupStatus = "pending"
 	DuplicateGroupStatusProcessed DuplicateGroupStatus = "processed"
+	DuplicateGroupStatusPartial   DuplicateGroupStatus = "partial" // An action changed only some of its files
+	DuplicateGroupStatusFailed    DuplicateGroupStatus = "failed"  // An action changed none of its files
 	DuplicateGroupStatusIgnored   DuplicateGroupStatus = "ignored"
 )
 
@@ -84,7 +260,139 @@ type DuplicateGroup struct {
 	FileCount   int
 	WastedBytes int64 // (count-1) * size
 	Status      DuplicateGroupStatus
-	Files       []string // Paths of duplicate files
+	Files       []string     // Paths of duplicate files
+	Links       []string     // Identity of each file's data on disk, in the same order as Files ("" = unknown)
+	FileDetails []*GroupFile // Optional per-file metadata, in the same order as Files (create only)
+}
+
+// FileCopy is a copy of a group's data on disk and the paths linked to it
+type FileCopy struct {
+	Path  string
+	Links []string // Other paths hardlinked to the same data
+}
+
+// FileLink returns the identity of a file's data on disk from its inode and
+// device numbers, or "" if they're unknown. Paths with the same identity are
+// hardlinked together.
+func FileLink(inode, device *int64) string {
+	if inode == nil || device == nil {
+		return ""
+	}
+	return strconv.FormatInt(*device, 10) + ":" + strconv.FormatInt(*inode, 10)
+}
+
+// Copies returns the group's files with paths hardlinked together collapsed
+// into one copy, in order of first appearance. Files whose identity isn't
+// known are copies of their own.
+func (g *DuplicateGroup) Copies() []FileCopy {
+	copies := make([]FileCopy, 0, len(g.Files))
+	seen := make(map[string]int)
+	for i, path := range g.Files {
+		var link string
+		if i < len(g.Links) {
+			link = g.Links[i]
+		}
+		if j, ok := seen[link]; ok && link != "" {
+			copies[j].Links = append(copies[j].Links, path)
+			continue
+		}
+		seen[link] = len(copies)
+		copies = append(copies, FileCopy{Path: path})
+	}
+	return copies
+}
+
+// LinkedFiles returns the number of the group's paths hardlinked to an earlier one
+func (g *DuplicateGroup) LinkedFiles() int {
+	return len(g.Files) - len(g.Copies())
+}
+
+// FileRole is a file's role within its duplicate group
+type FileRole string
+
+const (
+	FileRoleKeeper    FileRole = "keeper"    // The copy actions keep by default
+	FileRoleRedundant FileRole = "redundant" // A copy actions replace or remove
+)
+
+// FileActionStatus is the outcome of an action for a single file
+type FileActionStatus string
+
+const (
+	FileActionNone    FileActionStatus = ""        // Not touched by an action
+	FileActionDone    FileActionStatus = "done"    // Linked, deduplicated or removed
+	FileActionDeleted FileActionStatus = "deleted" // Deleted manually from the results page
+	FileActionFailed  FileActionStatus = "failed"  // The action failed for this file
+	FileActionUnknown FileActionStatus = "unknown" // The action's outcome couldn't be confirmed
+)
+
+// GroupFile is a file in a duplicate group
+type GroupFile struct {
+	ID           int64
+	GroupID      int64
+	ScanRunID    int64
+	Path         string
+	Size         int64
+	ModTime      *time.Time
+	Inode        *int64 // nil where the platform doesn't report it
+	Device       *int64
+	Role         FileRole
+	ActionID     *int64 // Last action that touched the file
+	ActionStatus FileActionStatus
+}
+
+// DirectoryPair is two directories holding copies of the same files. Files
+// in subdirectories are counted, and only files of the scan's pending groups.
+type DirectoryPair struct {
+	DirA        string
+	DirB        string
+	Groups      int   // Duplicate groups with a file in both directories
+	FilesA      int   // Files of those groups in DirA
+	FilesB      int   // Files of those groups in DirB
+	TotalA      int   // Files of any pending group in DirA
+	TotalB      int   // Files of any pending group in DirB
+	SharedBytes int64 // Size of one copy of each shared group
+}
+
+// CoverageA returns the percentage of DirA's duplicate files with a copy in DirB
+func (p *DirectoryPair) CoverageA() int {
+	return coverage(p.FilesA, p.TotalA)
+}
+
+// CoverageB returns the percentage of DirB's duplicate files with a copy in DirA
+func (p *DirectoryPair) CoverageB() int {
+	return coverage(p.FilesB, p.TotalB)
+}
+
+// covers reports whether p, the pair of other's parent directories, covers at
+// least as much of each side as other does
+func (p *DirectoryPair) covers(other *DirectoryPair) bool {
+	filesA, totalA := p.side(parentDir(other.DirA))
+	filesB, totalB := p.side(parentDir(other.DirB))
+	return filesA*other.TotalA >= other.FilesA*totalA && filesB*other.TotalB >= other.FilesB*totalB
+}
+
+// side returns the shared and total files of one of the pair's directories
+func (p *DirectoryPair) side(dir string) (files, total int) {
+	if dir == p.DirA {
+		return p.FilesA, p.TotalA
+	}
+	return p.FilesB, p.TotalB
+}
+
+// coverage returns files as a percentage of total, rounded down
+func coverage(files, total int) int {
+	if total == 0 || files >= total {
+		return 100
+	}
+	return files * 100 / total
+}
+
+// DirectoryWaste is the redundant data held directly in a directory
+type DirectoryWaste struct {
+	Dir         string
+	Files       int   // Files of duplicate groups in the directory
+	WastedBytes int64 // The directory's share of its groups' redundant bytes
 }
 
 // ActionStatus represents the status of an action
@@ -113,7 +421,9 @@ type Action struct {
 	ActionType      ActionType
 	GroupsProcessed int
 	FilesProcessed  int
-	BytesSaved      int64
+	BytesSaved      int64  // Estimated from the sizes of the files changed
+	BytesMeasured   *int64 // Measured from the files' inodes after the action (nil = not measured)
+	FreeSpaceChange *int64 // Change in free space of the filesystems changed, including other activity
 	StartedAt       time.Time
 	CompletedAt     *time.Time
 	Status          ActionStatus
@@ -129,17 +439,46 @@ type ActionCompletion struct {
 	GroupsProcessed int
 	FilesProcessed  int
 	BytesSaved      int64
+	BytesMeasured   *int64
+	FreeSpaceChange *int64
 	Status          ActionStatus
 	ErrorMessage    *string
 	Output          *string
 	Files           []string
 	Command         *string
 	GroupIDs        []int64
+	Results         []ActionFile // Outcome of the files in Files, matched by path (optional)
+}
+
+// ActionFile is a file an action processed, with the action's outcome for it
+type ActionFile struct {
+	Path   string
+	Status FileActionStatus // FileActionNone where the outcome wasn't recorded
+	Error  string           // Why the action failed for the file
+}
+
+// RetentionPolicy says how long CleanupOldData keeps each kind of data, in
+// days. Zero keeps that data indefinitely.
+type RetentionPolicy struct {
+	RunDays    int // Scan runs, with their groups, and job events
+	GroupDays  int // Duplicate groups, if they should go before their runs
+	ActionDays int // Actions and the files they processed
+	StatsDays  int // Daily stats
+	KeepRuns   int // Newest completed runs of each job kept regardless of age
+}
+
+// CleanupResult counts what CleanupOldData removed
+type CleanupResult struct {
+	Runs    int64
+	Groups  int64
+	Actions int64
+	Stats   int64 // Rows of daily stats
 }
 
 // DailyStats represents aggregated daily statistics
 type DailyStats struct {
 	Date        time.Time
+	JobID       int64 // 0 for quick scans and imports, and totals across jobs
 	ScansRun    int
 	GroupsFound int
 	FilesFound  int
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -32,6 +34,13 @@ type ScanRunOptions struct {
 	NoIgnore        bool
 	IgnoreCase      bool
 	MaxDepth        *int
+	NamePatterns    []string
+	MatchName       bool
+	Isolate         bool
+	MatchLinks      bool
+	RFOver          int
+	RFUnder         int
+	Transform       string
 }
 
 // CreateScanRun creates a new scan run
@@ -54,15 +63,21 @@ func (db *DB) CreateScanRun(configID *int64, jobID *int64, paths []string, opts
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal exclude patterns: %w", err)
 	}
+	namePatternsJSON, err := json.Marshal(opts.NamePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal name patterns: %w", err)
+	}
 
 	result, err := db.Exec(`
 		INSERT INTO scan_runs (scan_config_id, scheduled_job_id, paths, status, started_at,
 			min_size, max_size, include_patterns, exclude_patterns,
-			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth,
+			name_patterns, match_name, isolate, match_links, rf_over, rf_under, transform)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		configID, jobID, string(pathsJSON), ScanRunStatusRunning, time.Now(),
 		opts.MinSize, opts.MaxSize, string(includePatternsJSON), string(excludePatternsJSON),
 		opts.IncludeHidden, opts.FollowLinks, opts.OneFileSystem, opts.NoIgnore, opts.IgnoreCase, opts.MaxDepth,
+		string(namePatternsJSON), opts.MatchName, opts.Isolate, opts.MatchLinks, opts.RFOver, opts.RFUnder, opts.Transform,
 	)
 	if err != nil {
 		return nil, err
@@ -80,9 +95,10 @@ func (db *DB) CreateScanRun(configID *int64, jobID *int64, paths []string, opts
 func (db *DB) GetScanRun(id int64) (*ScanRun, error) {
 	row := db.QueryRow(`
 		SELECT id, scan_config_id, scheduled_job_id, paths, status, started_at, completed_at,
-			files_scanned, bytes_scanned, duplicate_groups, duplicate_files, wasted_bytes, error_message,
+			files_scanned, bytes_scanned, duplicate_groups, duplicate_files, wasted_bytes, error_message, hook_output, imported_command, pinned,
 			min_size, max_size, include_patterns, exclude_patterns,
-			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth
+			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth,
+			name_patterns, match_name, isolate, match_links, rf_over, rf_under, transform
 		FROM scan_runs WHERE id = ?`, id)
 	return scanScanRun(row)
 }
@@ -91,9 +107,10 @@ func (db *DB) GetScanRun(id int64) (*ScanRun, error) {
 func (db *DB) ListScanRuns(limit, offset int) ([]*ScanRun, error) {
 	rows, err := db.Query(`
 		SELECT id, scan_config_id, scheduled_job_id, paths, status, started_at, completed_at,
-			files_scanned, bytes_scanned, duplicate_groups, duplicate_files, wasted_bytes, error_message,
+			files_scanned, bytes_scanned, duplicate_groups, duplicate_files, wasted_bytes, error_message, hook_output, imported_command, pinned,
 			min_size, max_size, include_patterns, exclude_patterns,
-			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth
+			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth,
+			name_patterns, match_name, isolate, match_links, rf_over, rf_under, transform
 		FROM scan_runs ORDER BY started_at DESC LIMIT ? OFFSET ?`, limit, offset)
 	if err != nil {
 		return nil, err
@@ -120,9 +137,10 @@ func (db *DB) GetRecentScanRuns(limit int) ([]*ScanRun, error) {
 func (db *DB) GetLastRunForJob(jobID int64) (*ScanRun, error) {
 	row := db.QueryRow(`
 		SELECT id, scan_config_id, scheduled_job_id, paths, status, started_at, completed_at,
-			files_scanned, bytes_scanned, duplicate_groups, duplicate_files, wasted_bytes, error_message,
+			files_scanned, bytes_scanned, duplicate_groups, duplicate_files, wasted_bytes, error_message, hook_output, imported_command, pinned,
 			min_size, max_size, include_patterns, exclude_patterns,
-			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth
+			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth,
+			name_patterns, match_name, isolate, match_links, rf_over, rf_under, transform
 		FROM scan_runs WHERE scheduled_job_id = ? ORDER BY started_at DESC LIMIT 1`, jobID)
 	return scanScanRun(row)
 }
@@ -186,32 +204,93 @@ func (db *DB) UpdateScanRunProgress(id int64, filesScanned, bytesScanned, groups
 	return err
 }
 
-// CompleteScanRun marks a scan run as completed
+// CompleteScanRun marks a scan run as completed, and adds it to the daily
+// stats the first time it finishes
 func (db *DB) CompleteScanRun(id int64, status ScanRunStatus, errorMsg *string) error {
-	_, err := db.Exec(`
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var prev ScanRunStatus
+	var jobID sql.NullInt64
+	var groups, files, wasted int64
+	var rfUnder int
+	err = tx.QueryRow(`
+		SELECT status, scheduled_job_id, duplicate_groups, duplicate_files, wasted_bytes, rf_under
+		FROM scan_runs WHERE id = ?`, id,
+	).Scan(&prev, &jobID, &groups, &files, &wasted, &rfUnder)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec(`
 		UPDATE scan_runs SET status = ?, completed_at = ?, error_message = ?
 		WHERE id = ?`,
-		status, time.Now(), errorMsg, id,
+		status, now, errorMsg, id,
+	); err != nil {
+		return err
+	}
+
+	if prev == ScanRunStatusRunning {
+		stats := &DailyStats{Date: now, JobID: jobID.Int64, ScansRun: 1}
+		// Only completed duplicate scans find waste; audits report at-risk files
+		if status == ScanRunStatusCompleted && rfUnder == 0 {
+			stats.GroupsFound = int(groups)
+			stats.FilesFound = int(files)
+			stats.BytesWasted = wasted
+		}
+		if err := addDailyStats(tx, stats); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SetScanRunHookOutput records the output of the hook run before a scan
+func (db *DB) SetScanRunHookOutput(id int64, output string) error {
+	_, err := db.Exec("UPDATE scan_runs SET hook_output = ? WHERE id = ?", output, id)
+	return err
+}
+
+// SetScanRunImported records that a scan run came from an fclones report,
+// with the report's command line and the time fclones ran
+func (db *DB) SetScanRunImported(id int64, command string, at time.Time) error {
+	_, err := db.Exec(`
+		UPDATE scan_runs SET imported_command = ?, started_at = ?, completed_at = ?
+		WHERE id = ?`,
+		command, at, at, id,
 	)
 	return err
 }
 
+// SetScanRunPinned pins a scan run, so retention cleanup keeps it and its
+// actions, or unpins it
+func (db *DB) SetScanRunPinned(id int64, pinned bool) error {
+	_, err := db.Exec("UPDATE scan_runs SET pinned = ? WHERE id = ?", pinned, id)
+	return err
+}
+
 // scanScanRunFrom scans a ScanRun from any Scanner (sql.Row or sql.Rows)
 func scanScanRunFrom(s Scanner) (*ScanRun, error) {
 	var r ScanRun
 	var configID, jobID sql.NullInt64
 	var pathsJSON string
 	var completedAt sql.NullTime
-	var errorMsg sql.NullString
+	var errorMsg, hookOutput, importedCommand sql.NullString
 	var maxSize sql.NullInt64
-	var includePatternsJSON, excludePatternsJSON string
+	var includePatternsJSON, excludePatternsJSON, namePatternsJSON string
 	var maxDepth sql.NullInt64
 
 	err := s.Scan(&r.ID, &configID, &jobID, &pathsJSON, &r.Status, &r.StartedAt, &completedAt,
 		&r.FilesScanned, &r.BytesScanned, &r.DuplicateGroups, &r.DuplicateFiles,
-		&r.WastedBytes, &errorMsg,
+		&r.WastedBytes, &errorMsg, &hookOutput, &importedCommand, &r.Pinned,
 		&r.MinSize, &maxSize, &includePatternsJSON, &excludePatternsJSON,
-		&r.IncludeHidden, &r.FollowLinks, &r.OneFileSystem, &r.NoIgnore, &r.IgnoreCase, &maxDepth)
+		&r.IncludeHidden, &r.FollowLinks, &r.OneFileSystem, &r.NoIgnore, &r.IgnoreCase, &maxDepth,
+		&namePatternsJSON, &r.MatchName, &r.Isolate, &r.MatchLinks, &r.RFOver, &r.RFUnder, &r.Transform)
 	if err != nil {
 		return nil, err
 	}
@@ -231,6 +310,12 @@ func scanScanRunFrom(s Scanner) (*ScanRun, error) {
 	if errorMsg.Valid {
 		r.ErrorMessage = &errorMsg.String
 	}
+	if hookOutput.Valid {
+		r.HookOutput = &hookOutput.String
+	}
+	if importedCommand.Valid {
+		r.ImportedCommand = &importedCommand.String
+	}
 	if maxSize.Valid {
 		r.MaxSize = &maxSize.Int64
 	}
@@ -240,6 +325,9 @@ func scanScanRunFrom(s Scanner) (*ScanRun, error) {
 	if err := json.Unmarshal([]byte(excludePatternsJSON), &r.ExcludePatterns); err != nil {
 		log.Printf("db: failed to unmarshal exclude_patterns JSON for scan run %d: %v", r.ID, err)
 	}
+	if err := json.Unmarshal([]byte(namePatternsJSON), &r.NamePatterns); err != nil {
+		log.Printf("db: failed to unmarshal name_patterns JSON for scan run %d: %v", r.ID, err)
+	}
 	if maxDepth.Valid {
 		d := int(maxDepth.Int64)
 		r.MaxDepth = &d
@@ -258,54 +346,500 @@ func scanScanRunRow(rows *sql.Rows) (*ScanRun, error) {
 
 // DuplicateGroup queries
 
+// duplicateGroupColumns are the columns scanned by scanDuplicateGroupFrom,
+// with the group's file paths and their identities (as made by FileLink)
+// aggregated from group_files as JSON arrays
+const duplicateGroupColumns = `id, scan_run_id, file_hash, file_size, file_count, wasted_bytes, status,
+	(SELECT json_group_array(path ORDER BY position) FROM group_files WHERE group_id = duplicate_groups.id),
+	(SELECT json_group_array(COALESCE(device || ':' || inode, '') ORDER BY position) FROM group_files
+		WHERE group_id = duplicate_groups.id)`
+
 // CreateDuplicateGroup creates a new duplicate group
 func (db *DB) CreateDuplicateGroup(g *DuplicateGroup) (*DuplicateGroup, error) {
-	// Validate required fields
+	if err := db.CreateDuplicateGroups([]*DuplicateGroup{g}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// CreateDuplicateGroups creates a batch of duplicate groups and their files
+// in a single transaction, setting each group's ID. Either all groups are
+// stored or none.
+func (db *DB) CreateDuplicateGroups(groups []*DuplicateGroup) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	groupStmt, err := tx.Prepare(`
+		INSERT INTO duplicate_groups (scan_run_id, file_hash, file_size, file_count, wasted_bytes, status)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer groupStmt.Close()
+
+	fileStmt, err := tx.Prepare(`
+		INSERT INTO group_files (group_id, scan_run_id, position, path, size, mtime, inode, device, role)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer fileStmt.Close()
+
+	for _, g := range groups {
+		if err := validateDuplicateGroup(g); err != nil {
+			return err
+		}
+		result, err := groupStmt.Exec(g.ScanRunID, g.FileHash, g.FileSize, g.FileCount, g.WastedBytes, g.Status)
+		if err != nil {
+			return err
+		}
+		if g.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		for i, path := range g.Files {
+			f := &GroupFile{Size: g.FileSize}
+			if i < len(g.FileDetails) && g.FileDetails[i] != nil {
+				f = g.FileDetails[i]
+			}
+			role := f.Role
+			if role == "" {
+				role = FileRoleRedundant
+				if i == 0 {
+					role = FileRoleKeeper
+				}
+			}
+			if _, err := fileStmt.Exec(g.ID, g.ScanRunID, i, path, f.Size, f.ModTime, f.Inode, f.Device, role); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteDuplicateGroups deletes all duplicate groups of a scan run and their files
+func (db *DB) DeleteDuplicateGroups(scanRunID int64) error {
+	if _, err := db.Exec("DELETE FROM group_files WHERE scan_run_id = ?", scanRunID); err != nil {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM duplicate_groups WHERE scan_run_id = ?", scanRunID)
+	return err
+}
+
+// validateDuplicateGroup checks a group's required fields
+func validateDuplicateGroup(g *DuplicateGroup) error {
 	if g.ScanRunID == 0 {
-		return nil, errors.New("db: scan_run_id is required")
+		return errors.New("db: scan_run_id is required")
 	}
 	if g.FileHash == "" {
-		return nil, errors.New("db: file_hash is required")
+		return errors.New("db: file_hash is required")
 	}
 	if len(g.Files) == 0 {
-		return nil, errors.New("db: files list is required")
+		return errors.New("db: files list is required")
 	}
+	return nil
+}
 
-	filesJSON, err := json.Marshal(g.Files)
+// ListGroupFiles returns the files of a duplicate group with their metadata, in order
+func (db *DB) ListGroupFiles(groupID int64) ([]*GroupFile, error) {
+	rows, err := db.Query(`
+		SELECT id, group_id, scan_run_id, path, size, mtime, inode, device, role, action_id, action_status
+		FROM group_files WHERE group_id = ? ORDER BY position`, groupID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	result, err := db.Exec(`
-		INSERT INTO duplicate_groups (scan_run_id, file_hash, file_size, file_count, wasted_bytes, status, files)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		g.ScanRunID, g.FileHash, g.FileSize, g.FileCount, g.WastedBytes, g.Status, string(filesJSON),
-	)
+	var files []*GroupFile
+	for rows.Next() {
+		var f GroupFile
+		var mtime sql.NullTime
+		var inode, device, actionID sql.NullInt64
+		if err := rows.Scan(&f.ID, &f.GroupID, &f.ScanRunID, &f.Path, &f.Size, &mtime, &inode, &device,
+			&f.Role, &actionID, &f.ActionStatus); err != nil {
+			return nil, err
+		}
+		if mtime.Valid {
+			f.ModTime = &mtime.Time
+		}
+		if inode.Valid {
+			f.Inode = &inode.Int64
+		}
+		if device.Valid {
+			f.Device = &device.Int64
+		}
+		if actionID.Valid {
+			f.ActionID = &actionID.Int64
+		}
+		files = append(files, &f)
+	}
+	return files, rows.Err()
+}
+
+// SetGroupFilesActionStatus records an action's outcome for files of the given groups
+func (db *DB) SetGroupFilesActionStatus(groupIDs []int64, paths []string, actionID int64, status FileActionStatus) error {
+	if len(groupIDs) == 0 || len(paths) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		UPDATE group_files SET action_id = ?, action_status = ?
+		WHERE path = ? AND group_id IN (?` + strings.Repeat(",?", len(groupIDs)-1) + `)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	args := make([]any, 0, len(groupIDs)+3)
+	args = append(args, actionID, status, "")
+	for _, id := range groupIDs {
+		args = append(args, id)
+	}
+	for _, path := range paths {
+		args[2] = path
+		if _, err := stmt.Exec(args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// pendingGroupFile is a file of a pending group, for the directory analysis
+type pendingGroupFile struct {
+	groupID int64
+	path    string
+	size    int64
+}
+
+// listPendingGroupFiles returns the files not yet deleted of a scan run's
+// pending groups, ordered by group
+func (db *DB) listPendingGroupFiles(scanRunID int64) ([]pendingGroupFile, error) {
+	rows, err := db.Query(`
+		SELECT f.group_id, f.path, g.file_size
+		FROM group_files f JOIN duplicate_groups g ON g.id = f.group_id
+		WHERE f.scan_run_id = ? AND g.status = 'pending' AND f.action_status != 'deleted'
+		ORDER BY f.group_id, f.position`, scanRunID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	id, err := result.LastInsertId()
+	var files []pendingGroupFile
+	for rows.Next() {
+		var f pendingGroupFile
+		if err := rows.Scan(&f.groupID, &f.path, &f.size); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// eachGroup calls fn with the files of each group in turn
+func eachGroup(files []pendingGroupFile, fn func([]pendingGroupFile)) {
+	for start := 0; start < len(files); {
+		end := start + 1
+		for end < len(files) && files[end].groupID == files[start].groupID {
+			end++
+		}
+		fn(files[start:end])
+		start = end
+	}
+}
+
+// ListDirectoryPairs returns the directory pairs sharing the most duplicate
+// bytes in a scan run's pending groups. Copies are paired directory by
+// directory up their trees, so two copied trees show as one pair of their
+// top directories rather than a pair per subdirectory; a pair is left out
+// when the pair of its parents covers at least as much of both sides.
+func (db *DB) ListDirectoryPairs(scanRunID int64, limit int) ([]*DirectoryPair, error) {
+	files, err := db.listPendingGroupFiles(scanRunID)
 	if err != nil {
 		return nil, err
 	}
 
-	g.ID = id
-	return g, nil
+	// Count every directory's files, including its subdirectories'
+	totals := make(map[string]int)
+	for _, f := range files {
+		for dir := fileDir(f.path); ; dir = parentDir(dir) {
+			totals[dir]++
+			if dir == "/" {
+				break
+			}
+		}
+	}
+
+	type sides struct{ a, b map[string]bool } // Directories of each side's files
+	pairs := make(map[[2]string]*DirectoryPair)
+	eachGroup(files, func(group []pendingGroupFile) {
+		counts := make(map[string]int) // Files per directory
+		var dirs []string
+		for _, f := range group {
+			dir := fileDir(f.path)
+			if counts[dir] == 0 {
+				dirs = append(dirs, dir)
+			}
+			counts[dir]++
+		}
+
+		shared := make(map[[2]string]*sides)
+		for i, dirA := range dirs {
+			for _, dirB := range dirs[i+1:] {
+				// Walk up both trees together until they meet
+				for a, b := dirA, dirB; a != b && !isUnderDir(a, b) && !isUnderDir(b, a); a, b = parentDir(a), parentDir(b) {
+					key, fromA, fromB := [2]string{a, b}, dirA, dirB
+					if b < a {
+						key, fromA, fromB = [2]string{b, a}, dirB, dirA
+					}
+					s := shared[key]
+					if s == nil {
+						s = &sides{a: make(map[string]bool), b: make(map[string]bool)}
+						shared[key] = s
+					}
+					s.a[fromA] = true
+					s.b[fromB] = true
+				}
+			}
+		}
+
+		for key, s := range shared {
+			p := pairs[key]
+			if p == nil {
+				p = &DirectoryPair{DirA: key[0], DirB: key[1], TotalA: totals[key[0]], TotalB: totals[key[1]]}
+				pairs[key] = p
+			}
+			p.Groups++
+			p.SharedBytes += group[0].size
+			for dir := range s.a {
+				p.FilesA += counts[dir]
+			}
+			for dir := range s.b {
+				p.FilesB += counts[dir]
+			}
+		}
+	})
+
+	var result []*DirectoryPair
+	for key, p := range pairs {
+		a, b := parentDir(key[0]), parentDir(key[1])
+		if b < a {
+			a, b = b, a
+		}
+		if parent := pairs[[2]string{a, b}]; parent != nil && parent.covers(p) {
+			continue
+		}
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.SharedBytes != b.SharedBytes {
+			return a.SharedBytes > b.SharedBytes
+		}
+		if a.DirA != b.DirA {
+			return a.DirA < b.DirA
+		}
+		return a.DirB < b.DirB
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// ListDirectoryPairFiles returns the files under dir whose pending group also
+// has a file under otherDir, with the IDs of those groups. The directories
+// mustn't contain one another.
+func (db *DB) ListDirectoryPairFiles(scanRunID int64, dir, otherDir string) ([]string, []int64, error) {
+	dir, otherDir = trimDirSlash(dir), trimDirSlash(otherDir)
+	if dir == otherDir || isUnderDir(dir, otherDir) || isUnderDir(otherDir, dir) {
+		return nil, nil, fmt.Errorf("directories %s and %s overlap", dir, otherDir)
+	}
+
+	files, err := db.listPendingGroupFiles(scanRunID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var paths []string
+	var groupIDs []int64
+	eachGroup(files, func(group []pendingGroupFile) {
+		var here []string
+		var kept bool
+		for _, f := range group {
+			switch d := fileDir(f.path); {
+			case d == dir || isUnderDir(d, dir):
+				here = append(here, f.path)
+			case d == otherDir || isUnderDir(d, otherDir):
+				kept = true
+			}
+		}
+		if kept && len(here) > 0 {
+			paths = append(paths, here...)
+			groupIDs = append(groupIDs, group[0].groupID)
+		}
+	})
+	return paths, groupIDs, nil
+}
+
+// fileDir returns the directory of a file, without a trailing slash
+func fileDir(path string) string {
+	return trimDirSlash(path[:strings.LastIndex(path, "/")+1])
+}
+
+// parentDir returns the parent of a directory; the root is its own parent
+func parentDir(dir string) string {
+	if i := strings.LastIndex(dir, "/"); i > 0 {
+		return dir[:i]
+	}
+	return "/"
+}
+
+// isUnderDir reports whether dir is a subdirectory of ancestor
+func isUnderDir(dir, ancestor string) bool {
+	return dir != ancestor && strings.HasPrefix(dir, withDirSlash(ancestor))
+}
+
+// ListWasteByDirectory returns the redundant bytes of a scan run's pending
+// groups per directory, so space already reclaimed isn't counted. Each file
+// carries an equal share of its group's redundant bytes, since any copy could
+// be the one kept.
+func (db *DB) ListWasteByDirectory(scanRunID int64) ([]*DirectoryWaste, error) {
+	rows, err := db.Query(`
+		SELECT rtrim(f.path, replace(f.path, '/', '')) AS dir, COUNT(*),
+			CAST(ROUND(SUM(CAST(g.wasted_bytes AS REAL) / g.file_count)) AS INTEGER)
+		FROM group_files f JOIN duplicate_groups g ON g.id = f.group_id
+		WHERE f.scan_run_id = ? AND g.status = ? AND g.file_count > 0
+		GROUP BY dir
+		ORDER BY dir`, scanRunID, DuplicateGroupStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dirs []*DirectoryWaste
+	for rows.Next() {
+		var d DirectoryWaste
+		if err := rows.Scan(&d.Dir, &d.Files, &d.WastedBytes); err != nil {
+			return nil, err
+		}
+		d.Dir = trimDirSlash(d.Dir)
+		dirs = append(dirs, &d)
+	}
+	return dirs, rows.Err()
+}
+
+// trimDirSlash removes the trailing slash from a directory, except from the root
+func trimDirSlash(dir string) string {
+	if len(dir) > 1 {
+		return strings.TrimSuffix(dir, "/")
+	}
+	return dir
+}
+
+// withDirSlash adds the trailing slash the directory queries compare against
+func withDirSlash(dir string) string {
+	if strings.HasSuffix(dir, "/") {
+		return dir
+	}
+	return dir + "/"
 }
 
 // GetDuplicateGroup retrieves a duplicate group by ID
 func (db *DB) GetDuplicateGroup(id int64) (*DuplicateGroup, error) {
-	row := db.QueryRow(`
-		SELECT id, scan_run_id, file_hash, file_size, file_count, wasted_bytes, status, files
-		FROM duplicate_groups WHERE id = ?`, id)
+	row := db.QueryRow("SELECT "+duplicateGroupColumns+" FROM duplicate_groups WHERE id = ?", id)
 	return scanDuplicateGroup(row)
 }
 
+// DuplicateGroupFilter narrows the duplicate groups of a scan run. The path,
+// directory and extension filters must all match the same file of a group.
+type DuplicateGroupFilter struct {
+	Status   string // filter by status (empty = all)
+	Path     string // path substring, or a glob if it contains *, ? or [
+	Dir      string // directory the file is under
+	Ext      string // file extension, with or without the leading dot
+	MinSize  int64  // minimum file size in bytes (0 = no limit)
+	MaxSize  int64  // maximum file size in bytes (0 = no limit)
+	MinFiles int    // minimum files in the group (0 = no limit)
+	MaxFiles int    // maximum files in the group (0 = no limit)
+}
+
+// where returns the WHERE clause selecting a scan run's groups that match the filter
+func (f DuplicateGroupFilter) where(scanRunID int64) (string, []any) {
+	clause := " WHERE scan_run_id = ?"
+	args := []any{scanRunID}
+
+	if f.Status != "" {
+		clause += " AND status = ?"
+		args = append(args, f.Status)
+	}
+	if f.MinSize > 0 {
+		clause += " AND file_size >= ?"
+		args = append(args, f.MinSize)
+	}
+	if f.MaxSize > 0 {
+		clause += " AND file_size <= ?"
+		args = append(args, f.MaxSize)
+	}
+	if f.MinFiles > 0 {
+		clause += " AND file_count >= ?"
+		args = append(args, f.MinFiles)
+	}
+	if f.MaxFiles > 0 {
+		clause += " AND file_count <= ?"
+		args = append(args, f.MaxFiles)
+	}
+
+	// Path conditions are checked against the group's files
+	var fileConds []string
+	if f.Path != "" {
+		if strings.ContainsAny(f.Path, "*?[") {
+			// Globs match the whole path, so anchor relative ones at any directory
+			pattern := f.Path
+			if !strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "*") {
+				pattern = "*" + pattern
+			}
+			fileConds = append(fileConds, "path GLOB ?")
+			args = append(args, pattern)
+		} else {
+			fileConds = append(fileConds, `path LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escapeLike(f.Path)+"%")
+		}
+	}
+	if dir := strings.TrimRight(f.Dir, "/"); f.Dir != "" {
+		fileConds = append(fileConds, `path LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(dir)+"/%")
+	}
+	if ext := strings.TrimPrefix(f.Ext, "."); ext != "" {
+		fileConds = append(fileConds, `path LIKE ? ESCAPE '\'`)
+		args = append(args, "%."+escapeLike(ext))
+	}
+	if len(fileConds) > 0 {
+		clause += " AND EXISTS (SELECT 1 FROM group_files WHERE group_id = duplicate_groups.id AND " +
+			strings.Join(fileConds, " AND ") + ")"
+	}
+
+	return clause, args
+}
+
+// escapeLike escapes the LIKE wildcards in s, for use with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 // DuplicateGroupQuery holds query parameters for listing duplicate groups
 type DuplicateGroupQuery struct {
 	ScanRunID int64
-	Status    string // filter by status (empty = all)
+	DuplicateGroupFilter
 	SortBy    string // "wasted", "size", "count", "hash"
 	SortOrder string // "asc" or "desc"
 	Limit     int
@@ -315,25 +849,18 @@ type DuplicateGroupQuery struct {
 // ListDuplicateGroups returns duplicate groups for a scan run (unpaginated, for backwards compat)
 func (db *DB) ListDuplicateGroups(scanRunID int64, status string) ([]*DuplicateGroup, error) {
 	return db.ListDuplicateGroupsPaginated(DuplicateGroupQuery{
-		ScanRunID: scanRunID,
-		Status:    status,
-		SortBy:    "wasted",
-		SortOrder: "desc",
-		Limit:     0, // no limit
+		ScanRunID:            scanRunID,
+		DuplicateGroupFilter: DuplicateGroupFilter{Status: status},
+		SortBy:               "wasted",
+		SortOrder:            "desc",
+		Limit:                0, // no limit
 	})
 }
 
 // ListDuplicateGroupsPaginated returns duplicate groups with sorting and pagination
 func (db *DB) ListDuplicateGroupsPaginated(q DuplicateGroupQuery) ([]*DuplicateGroup, error) {
-	query := `
-		SELECT id, scan_run_id, file_hash, file_size, file_count, wasted_bytes, status, files
-		FROM duplicate_groups WHERE scan_run_id = ?`
-	args := []any{q.ScanRunID}
-
-	if q.Status != "" {
-		query += " AND status = ?"
-		args = append(args, q.Status)
-	}
+	where, args := q.DuplicateGroupFilter.where(q.ScanRunID)
+	query := "SELECT " + duplicateGroupColumns + " FROM duplicate_groups" + where
 
 	// Determine sort column
 	sortCol := "wasted_bytes"
@@ -354,7 +881,8 @@ func (db *DB) ListDuplicateGroupsPaginated(q DuplicateGroupQuery) ([]*DuplicateG
 		sortOrder = "ASC"
 	}
 
-	query += " ORDER BY " + sortCol + " " + sortOrder
+	// Break ties by ID so pages don't overlap
+	query += " ORDER BY " + sortCol + " " + sortOrder + ", id"
 
 	// Add pagination
 	if q.Limit > 0 {
@@ -379,32 +907,20 @@ func (db *DB) ListDuplicateGroupsPaginated(q DuplicateGroupQuery) ([]*DuplicateG
 	return groups, rows.Err()
 }
 
-// CountDuplicateGroups returns the total count of duplicate groups for a scan run
-func (db *DB) CountDuplicateGroups(scanRunID int64, status string) (int, error) {
-	query := "SELECT COUNT(*) FROM duplicate_groups WHERE scan_run_id = ?"
-	args := []any{scanRunID}
-
-	if status != "" {
-		query += " AND status = ?"
-		args = append(args, status)
-	}
+// CountDuplicateGroups returns the count of a scan run's duplicate groups matching the filter
+func (db *DB) CountDuplicateGroups(scanRunID int64, f DuplicateGroupFilter) (int, error) {
+	where, args := f.where(scanRunID)
 
 	var count int
-	err := db.QueryRow(query, args...).Scan(&count)
+	err := db.QueryRow("SELECT COUNT(*) FROM duplicate_groups"+where, args...).Scan(&count)
 	return count, err
 }
 
-// GetDuplicateGroupIDs returns all group IDs for a scan run (for bulk operations)
-func (db *DB) GetDuplicateGroupIDs(scanRunID int64, status string) ([]int64, error) {
-	query := "SELECT id FROM duplicate_groups WHERE scan_run_id = ?"
-	args := []any{scanRunID}
+// GetDuplicateGroupIDs returns the IDs of a scan run's groups matching the filter (for bulk operations)
+func (db *DB) GetDuplicateGroupIDs(scanRunID int64, f DuplicateGroupFilter) ([]int64, error) {
+	where, args := f.where(scanRunID)
 
-	if status != "" {
-		query += " AND status = ?"
-		args = append(args, status)
-	}
-
-	rows, err := db.Query(query, args...)
+	rows, err := db.Query("SELECT id FROM duplicate_groups"+where, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -444,8 +960,8 @@ func (db *DB) GetDuplicateGroupsByIDs(ids []int64) ([]*DuplicateGroup, error) {
 		return nil, nil
 	}
 
-	query := `SELECT id, scan_run_id, file_hash, file_size, file_count, wasted_bytes, status, files
-		FROM duplicate_groups WHERE id IN (?` + strings.Repeat(",?", len(ids)-1) + `) ORDER BY wasted_bytes DESC`
+	query := "SELECT " + duplicateGroupColumns + " FROM duplicate_groups WHERE id IN (?" +
+		strings.Repeat(",?", len(ids)-1) + ") ORDER BY wasted_bytes DESC"
 	args := make([]any, len(ids))
 	for i, id := range ids {
 		args[i] = id
@@ -471,10 +987,10 @@ func (db *DB) GetDuplicateGroupsByIDs(ids []int64) ([]*DuplicateGroup, error) {
 // scanDuplicateGroupFrom scans a DuplicateGroup from any Scanner (sql.Row or sql.Rows)
 func scanDuplicateGroupFrom(s Scanner) (*DuplicateGroup, error) {
 	var g DuplicateGroup
-	var filesJSON string
+	var filesJSON, linksJSON string
 
 	err := s.Scan(&g.ID, &g.ScanRunID, &g.FileHash, &g.FileSize, &g.FileCount,
-		&g.WastedBytes, &g.Status, &filesJSON)
+		&g.WastedBytes, &g.Status, &filesJSON, &linksJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -482,6 +998,9 @@ func scanDuplicateGroupFrom(s Scanner) (*DuplicateGroup, error) {
 	if err := json.Unmarshal([]byte(filesJSON), &g.Files); err != nil {
 		log.Printf("db: failed to unmarshal files JSON for group %d: %v", g.ID, err)
 	}
+	if err := json.Unmarshal([]byte(linksJSON), &g.Links); err != nil {
+		log.Printf("db: failed to unmarshal links JSON for group %d: %v", g.ID, err)
+	}
 	return &g, nil
 }
 
@@ -507,15 +1026,33 @@ func (db *DB) CreateScheduledJob(job *ScheduledJob) (*ScheduledJob, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal exclude patterns: %w", err)
 	}
+	stepsJSON, err := json.Marshal(job.Steps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal steps: %w", err)
+	}
+	nameJSON, err := json.Marshal(job.NamePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal name patterns: %w", err)
+	}
+
+	missedPolicy, overlapPolicy := jobPolicies(job)
 
 	result, err := db.Exec(`
 		INSERT INTO scheduled_jobs (name, paths, min_size, max_size, include_patterns, exclude_patterns,
 			cron_expression, action, enabled, next_run_at,
-			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth,
+			missed_run_policy, overlap_policy, timezone, steps,
+			pre_scan_hook, pre_action_hook, post_action_hook,
+			maintenance_window, threads, nice, io_class,
+			name_patterns, match_name, isolate, match_links, rf_over, rf_under, transform, managed)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		job.Name, string(pathsJSON), job.MinSize, job.MaxSize, string(includeJSON), string(excludeJSON),
 		job.CronExpression, job.Action, job.Enabled, job.NextRunAt,
 		job.IncludeHidden, job.FollowLinks, job.OneFileSystem, job.NoIgnore, job.IgnoreCase, job.MaxDepth,
+		missedPolicy, overlapPolicy, job.Timezone, string(stepsJSON),
+		job.PreScanHook, job.PreActionHook, job.PostActionHook,
+		job.MaintenanceWindow, job.Threads, job.Nice, job.IOClass,
+		string(nameJSON), job.MatchName, job.Isolate, job.MatchLinks, job.RFOver, job.RFUnder, job.Transform, job.Managed,
 	)
 	if err != nil {
 		return nil, err
@@ -534,7 +1071,11 @@ func (db *DB) GetScheduledJob(id int64) (*ScheduledJob, error) {
 	row := db.QueryRow(`
 		SELECT id, name, paths, min_size, max_size, include_patterns, exclude_patterns,
 			cron_expression, action, enabled, last_run_at, next_run_at, created_at,
-			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth
+			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth,
+			missed_run_policy, overlap_policy, timezone, steps,
+			pre_scan_hook, pre_action_hook, post_action_hook,
+			maintenance_window, threads, nice, io_class,
+			name_patterns, match_name, isolate, match_links, rf_over, rf_under, transform, managed
 		FROM scheduled_jobs WHERE id = ?`, id)
 	return scanScheduledJob(row)
 }
@@ -544,7 +1085,11 @@ func (db *DB) ListScheduledJobs() ([]*ScheduledJob, error) {
 	rows, err := db.Query(`
 		SELECT id, name, paths, min_size, max_size, include_patterns, exclude_patterns,
 			cron_expression, action, enabled, last_run_at, next_run_at, created_at,
-			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth
+			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth,
+			missed_run_policy, overlap_policy, timezone, steps,
+			pre_scan_hook, pre_action_hook, post_action_hook,
+			maintenance_window, threads, nice, io_class,
+			name_patterns, match_name, isolate, match_links, rf_over, rf_under, transform, managed
 		FROM scheduled_jobs ORDER BY name`)
 	if err != nil {
 		return nil, err
@@ -567,7 +1112,11 @@ func (db *DB) GetEnabledJobs() ([]*ScheduledJob, error) {
 	rows, err := db.Query(`
 		SELECT id, name, paths, min_size, max_size, include_patterns, exclude_patterns,
 			cron_expression, action, enabled, last_run_at, next_run_at, created_at,
-			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth
+			include_hidden, follow_links, one_file_system, no_ignore, ignore_case, max_depth,
+			missed_run_policy, overlap_policy, timezone, steps,
+			pre_scan_hook, pre_action_hook, post_action_hook,
+			maintenance_window, threads, nice, io_class,
+			name_patterns, match_name, isolate, match_links, rf_over, rf_under, transform, managed
 		FROM scheduled_jobs WHERE enabled = 1 ORDER BY next_run_at`)
 	if err != nil {
 		return nil, err
@@ -599,21 +1148,66 @@ func (db *DB) UpdateScheduledJob(job *ScheduledJob) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal exclude patterns: %w", err)
 	}
+	stepsJSON, err := json.Marshal(job.Steps)
+	if err != nil {
+		return fmt.Errorf("failed to marshal steps: %w", err)
+	}
+	nameJSON, err := json.Marshal(job.NamePatterns)
+	if err != nil {
+		return fmt.Errorf("failed to marshal name patterns: %w", err)
+	}
+
+	missedPolicy, overlapPolicy := jobPolicies(job)
 
 	_, err = db.Exec(`
 		UPDATE scheduled_jobs SET
 			name = ?, paths = ?, min_size = ?, max_size = ?, include_patterns = ?, exclude_patterns = ?,
 			cron_expression = ?, action = ?, enabled = ?, next_run_at = ?,
-			include_hidden = ?, follow_links = ?, one_file_system = ?, no_ignore = ?, ignore_case = ?, max_depth = ?
+			include_hidden = ?, follow_links = ?, one_file_system = ?, no_ignore = ?, ignore_case = ?, max_depth = ?,
+			missed_run_policy = ?, overlap_policy = ?, timezone = ?, steps = ?,
+			pre_scan_hook = ?, pre_action_hook = ?, post_action_hook = ?,
+			maintenance_window = ?, threads = ?, nice = ?, io_class = ?,
+			name_patterns = ?, match_name = ?, isolate = ?, match_links = ?, rf_over = ?, rf_under = ?, transform = ?,
+			managed = ?
 		WHERE id = ?`,
 		job.Name, string(pathsJSON), job.MinSize, job.MaxSize, string(includeJSON), string(excludeJSON),
 		job.CronExpression, job.Action, job.Enabled, job.NextRunAt,
 		job.IncludeHidden, job.FollowLinks, job.OneFileSystem, job.NoIgnore, job.IgnoreCase, job.MaxDepth,
-		job.ID,
+		missedPolicy, overlapPolicy, job.Timezone, string(stepsJSON),
+		job.PreScanHook, job.PreActionHook, job.PostActionHook,
+		job.MaintenanceWindow, job.Threads, job.Nice, job.IOClass,
+		string(nameJSON), job.MatchName, job.Isolate, job.MatchLinks, job.RFOver, job.RFUnder, job.Transform,
+		job.Managed, job.ID,
 	)
 	return err
 }
 
+// jobPolicies returns the job's scheduling policies, falling back to defaults for unset values
+func jobPolicies(job *ScheduledJob) (MissedRunPolicy, OverlapPolicy) {
+	missed := job.MissedRunPolicy
+	if missed == "" {
+		missed = MissedRunPolicyRunOnce
+	}
+	overlap := job.OverlapPolicy
+	if overlap == "" {
+		overlap = OverlapPolicyForbid
+	}
+	return missed, overlap
+}
+
+// UpdateJobNextRun updates only the next run time (used when a run is due)
+func (db *DB) UpdateJobNextRun(id int64, nextRun time.Time) error {
+	_, err := db.Exec("UPDATE scheduled_jobs SET next_run_at = ? WHERE id = ?", nextRun, id)
+	return err
+}
+
+// UpdateJobLastRunAt updates only the last run time (used when the schedule
+// was advanced as the run was started)
+func (db *DB) UpdateJobLastRunAt(id int64, lastRun time.Time) error {
+	_, err := db.Exec("UPDATE scheduled_jobs SET last_run_at = ? WHERE id = ?", lastRun, id)
+	return err
+}
+
 // UpdateJobLastRun updates the last run time and next run time
 func (db *DB) UpdateJobLastRun(id int64, lastRun, nextRun time.Time) error {
 	_, err := db.Exec(`
@@ -630,8 +1224,14 @@ func (db *DB) SetJobEnabled(id int64, enabled bool) error {
 	return err
 }
 
-// DeleteScheduledJob deletes a scheduled job
+// DeleteScheduledJob deletes a scheduled job and its run history
 func (db *DB) DeleteScheduledJob(id int64) error {
+	if _, err := db.Exec("DELETE FROM job_step_runs WHERE job_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM job_events WHERE job_id = ?", id); err != nil {
+		return err
+	}
 	_, err := db.Exec("DELETE FROM scheduled_jobs WHERE id = ?", id)
 	return err
 }
@@ -639,13 +1239,17 @@ func (db *DB) DeleteScheduledJob(id int64) error {
 // scanScheduledJobFrom scans a ScheduledJob from any Scanner (sql.Row or sql.Rows)
 func scanScheduledJobFrom(s Scanner) (*ScheduledJob, error) {
 	var j ScheduledJob
-	var pathsJSON, includeJSON, excludeJSON string
+	var pathsJSON, includeJSON, excludeJSON, stepsJSON, nameJSON string
 	var maxSize, maxDepth sql.NullInt64
 	var lastRun, nextRun sql.NullTime
 
 	err := s.Scan(&j.ID, &j.Name, &pathsJSON, &j.MinSize, &maxSize, &includeJSON, &excludeJSON,
 		&j.CronExpression, &j.Action, &j.Enabled, &lastRun, &nextRun, &j.CreatedAt,
-		&j.IncludeHidden, &j.FollowLinks, &j.OneFileSystem, &j.NoIgnore, &j.IgnoreCase, &maxDepth)
+		&j.IncludeHidden, &j.FollowLinks, &j.OneFileSystem, &j.NoIgnore, &j.IgnoreCase, &maxDepth,
+		&j.MissedRunPolicy, &j.OverlapPolicy, &j.Timezone, &stepsJSON,
+		&j.PreScanHook, &j.PreActionHook, &j.PostActionHook,
+		&j.MaintenanceWindow, &j.Threads, &j.Nice, &j.IOClass,
+		&nameJSON, &j.MatchName, &j.Isolate, &j.MatchLinks, &j.RFOver, &j.RFUnder, &j.Transform, &j.Managed)
 	if err != nil {
 		return nil, err
 	}
@@ -659,6 +1263,12 @@ func scanScheduledJobFrom(s Scanner) (*ScheduledJob, error) {
 	if err := json.Unmarshal([]byte(excludeJSON), &j.ExcludePatterns); err != nil {
 		log.Printf("db: failed to unmarshal exclude patterns JSON for job %d: %v", j.ID, err)
 	}
+	if err := json.Unmarshal([]byte(stepsJSON), &j.Steps); err != nil {
+		log.Printf("db: failed to unmarshal steps JSON for job %d: %v", j.ID, err)
+	}
+	if err := json.Unmarshal([]byte(nameJSON), &j.NamePatterns); err != nil {
+		log.Printf("db: failed to unmarshal name patterns JSON for job %d: %v", j.ID, err)
+	}
 	if maxSize.Valid {
 		j.MaxSize = &maxSize.Int64
 	}
@@ -684,6 +1294,161 @@ func scanScheduledJobRow(rows *sql.Rows) (*ScheduledJob, error) {
 	return scanScheduledJobFrom(rows)
 }
 
+// JobEvent queries
+
+// CreateJobEvent records a scheduling decision for a job
+func (db *DB) CreateJobEvent(e *JobEvent) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	result, err := db.Exec(`
+		INSERT INTO job_events (job_id, event, scheduled_for, scan_run_id, message, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		e.JobID, e.Event, e.ScheduledFor, e.ScanRunID, e.Message, e.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListJobEvents returns the most recent scheduling decisions for a job
+func (db *DB) ListJobEvents(jobID int64, limit int) ([]*JobEvent, error) {
+	rows, err := db.Query(`
+		SELECT id, job_id, event, scheduled_for, scan_run_id, message, created_at
+		FROM job_events WHERE job_id = ? ORDER BY created_at DESC, id DESC LIMIT ?`, jobID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*JobEvent
+	for rows.Next() {
+		var e JobEvent
+		var scheduledFor sql.NullTime
+		var scanRunID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.JobID, &e.Event, &scheduledFor, &scanRunID, &e.Message, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if scheduledFor.Valid {
+			e.ScheduledFor = &scheduledFor.Time
+		}
+		if scanRunID.Valid {
+			e.ScanRunID = &scanRunID.Int64
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// SetJobEventScanRun links an event to the scan run it started
+func (db *DB) SetJobEventScanRun(eventID, scanRunID int64) error {
+	_, err := db.Exec("UPDATE job_events SET scan_run_id = ? WHERE id = ?", scanRunID, eventID)
+	return err
+}
+
+// JobStepRun queries
+
+// CreateJobStepRun records the start of a pipeline step
+func (db *DB) CreateJobStepRun(r *JobStepRun) error {
+	if r.StartedAt.IsZero() {
+		r.StartedAt = time.Now()
+	}
+	if r.Status == "" {
+		r.Status = JobStepRunRunning
+	}
+	result, err := db.Exec(`
+		INSERT INTO job_step_runs (job_event_id, job_id, step_index, step_type, status,
+			scan_run_id, action_id, message, started_at, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.JobEventID, r.JobID, r.StepIndex, r.StepType, r.Status,
+		r.ScanRunID, r.ActionID, r.Message, r.StartedAt, r.CompletedAt,
+	)
+	if err != nil {
+		return err
+	}
+	r.ID, err = result.LastInsertId()
+	return err
+}
+
+// UpdateJobStepRun updates a step's status, outputs and completion time
+func (db *DB) UpdateJobStepRun(r *JobStepRun) error {
+	_, err := db.Exec(`
+		UPDATE job_step_runs SET status = ?, scan_run_id = ?, action_id = ?, message = ?, completed_at = ?
+		WHERE id = ?`,
+		r.Status, r.ScanRunID, r.ActionID, r.Message, r.CompletedAt, r.ID,
+	)
+	return err
+}
+
+// ListJobStepRuns returns the step runs for the given events, keyed by event ID
+func (db *DB) ListJobStepRuns(eventIDs []int64) (map[int64][]*JobStepRun, error) {
+	result := make(map[int64][]*JobStepRun)
+	if len(eventIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(eventIDs))
+	placeholders = placeholders[:len(placeholders)-1] // remove trailing comma
+
+	args := make([]interface{}, len(eventIDs))
+	for i, id := range eventIDs {
+		args[i] = id
+	}
+
+	rows, err := db.Query(`
+		SELECT id, job_event_id, job_id, step_index, step_type, status,
+			scan_run_id, action_id, message, started_at, completed_at
+		FROM job_step_runs WHERE job_event_id IN (`+placeholders+`)
+		ORDER BY job_event_id, step_index`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r JobStepRun
+		var scanRunID, actionID sql.NullInt64
+		var completedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.JobEventID, &r.JobID, &r.StepIndex, &r.StepType, &r.Status,
+			&scanRunID, &actionID, &r.Message, &r.StartedAt, &completedAt); err != nil {
+			return nil, err
+		}
+		if scanRunID.Valid {
+			r.ScanRunID = &scanRunID.Int64
+		}
+		if actionID.Valid {
+			r.ActionID = &actionID.Int64
+		}
+		if completedAt.Valid {
+			r.CompletedAt = &completedAt.Time
+		}
+		result[r.JobEventID] = append(result[r.JobEventID], &r)
+	}
+	return result, rows.Err()
+}
+
+// GetRunningScanRunIDsForJob returns the IDs of scan runs for a job that are marked as running
+func (db *DB) GetRunningScanRunIDsForJob(jobID int64) ([]int64, error) {
+	rows, err := db.Query("SELECT id FROM scan_runs WHERE scheduled_job_id = ? AND status = ?",
+		jobID, ScanRunStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 // Action queries
 
 // CreateAction creates a new action record
@@ -705,11 +1470,16 @@ func (db *DB) CreateAction(a *Action) (*Action, error) {
 	return db.GetAction(id)
 }
 
+// actionFilesSQL selects an action's processed file paths as a JSON array, or
+// NULL if it has none
+const actionFilesSQL = `(SELECT json_group_array(path ORDER BY position) FROM action_files
+			WHERE action_id = actions.id HAVING COUNT(*) > 0)`
+
 // GetAction retrieves an action by ID
 func (db *DB) GetAction(id int64) (*Action, error) {
 	row := db.QueryRow(`
 		SELECT id, scan_run_id, action_type, groups_processed, files_processed, bytes_saved,
-			started_at, completed_at, status, error_message, output, files, command, group_ids
+			bytes_measured, free_space_change, started_at, completed_at, status, error_message, output, `+actionFilesSQL+`, command, group_ids
 		FROM actions WHERE id = ?`, id)
 	return scanAction(row)
 }
@@ -718,8 +1488,8 @@ func (db *DB) GetAction(id int64) (*Action, error) {
 func (db *DB) ListActions(limit, offset int) ([]*Action, error) {
 	rows, err := db.Query(`
 		SELECT id, scan_run_id, action_type, groups_processed, files_processed, bytes_saved,
-			started_at, completed_at, status, error_message, output, files, command, group_ids
-		FROM actions ORDER BY started_at DESC LIMIT ? OFFSET ?`, limit, offset)
+			bytes_measured, free_space_change, started_at, completed_at, status, error_message, output, `+actionFilesSQL+`, command, group_ids
+		FROM actions ORDER BY started_at DESC, id DESC LIMIT ? OFFSET ?`, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -740,7 +1510,7 @@ func (db *DB) ListActions(limit, offset int) ([]*Action, error) {
 func (db *DB) ListActionsByScanRun(scanRunID int64) ([]*Action, error) {
 	rows, err := db.Query(`
 		SELECT id, scan_run_id, action_type, groups_processed, files_processed, bytes_saved,
-			started_at, completed_at, status, error_message, output, files, command, group_ids
+			bytes_measured, free_space_change, started_at, completed_at, status, error_message, output, `+actionFilesSQL+`, command, group_ids
 		FROM actions WHERE scan_run_id = ? ORDER BY started_at DESC`, scanRunID)
 	if err != nil {
 		return nil, err
@@ -760,15 +1530,6 @@ func (db *DB) ListActionsByScanRun(scanRunID int64) ([]*Action, error) {
 
 // CompleteAction marks an action as completed with the given results
 func (db *DB) CompleteAction(id int64, c *ActionCompletion) error {
-	var filesJSON *string
-	if len(c.Files) > 0 {
-		b, err := json.Marshal(c.Files)
-		if err == nil {
-			s := string(b)
-			filesJSON = &s
-		}
-	}
-
 	var groupIDsJSON *string
 	if len(c.GroupIDs) > 0 {
 		b, err := json.Marshal(c.GroupIDs)
@@ -778,16 +1539,98 @@ func (db *DB) CompleteAction(id int64, c *ActionCompletion) error {
 		}
 	}
 
-	_, err := db.Exec(`
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var prev ActionStatus
+	var jobID sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT a.status, r.scheduled_job_id
+		FROM actions a LEFT JOIN scan_runs r ON r.id = a.scan_run_id
+		WHERE a.id = ?`, id,
+	).Scan(&prev, &jobID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
 		UPDATE actions SET
 			groups_processed = ?, files_processed = ?, bytes_saved = ?,
+			bytes_measured = ?, free_space_change = ?,
 			completed_at = ?, status = ?, error_message = ?, output = ?,
-			files = ?, command = ?, group_ids = ?
+			command = ?, group_ids = ?
 		WHERE id = ?`,
-		c.GroupsProcessed, c.FilesProcessed, c.BytesSaved, time.Now(), c.Status,
-		c.ErrorMessage, c.Output, filesJSON, c.Command, groupIDsJSON, id,
+		c.GroupsProcessed, c.FilesProcessed, c.BytesSaved, c.BytesMeasured, c.FreeSpaceChange, now, c.Status,
+		c.ErrorMessage, c.Output, c.Command, groupIDsJSON, id,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Stats count the measured savings where there are any
+	saved := c.BytesSaved
+	if c.BytesMeasured != nil {
+		saved = *c.BytesMeasured
+	}
+	if prev == ActionStatusRunning && saved > 0 {
+		if err := addDailyStats(tx, &DailyStats{Date: now, JobID: jobID.Int64, BytesSaved: saved}); err != nil {
+			return err
+		}
+	}
+
+	// Record the processed files
+	if _, err := tx.Exec("DELETE FROM action_files WHERE action_id = ?", id); err != nil {
+		return err
+	}
+	if len(c.Files) > 0 {
+		results := make(map[string]ActionFile, len(c.Results))
+		for _, r := range c.Results {
+			results[r.Path] = r
+		}
+
+		stmt, err := tx.Prepare("INSERT INTO action_files (action_id, position, path, status, error) VALUES (?, ?, ?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i, path := range c.Files {
+			r := results[path]
+			var errMsg *string
+			if r.Error != "" {
+				errMsg = &r.Error
+			}
+			if _, err := stmt.Exec(id, i, path, r.Status, errMsg); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListActionFiles returns the files an action processed with its outcome for each, in order
+func (db *DB) ListActionFiles(actionID int64) ([]*ActionFile, error) {
+	rows, err := db.Query(`
+		SELECT path, status, COALESCE(error, '')
+		FROM action_files WHERE action_id = ? ORDER BY position`, actionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*ActionFile
+	for rows.Next() {
+		var f ActionFile
+		if err := rows.Scan(&f.Path, &f.Status, &f.Error); err != nil {
+			return nil, err
+		}
+		files = append(files, &f)
+	}
+	return files, rows.Err()
 }
 
 // scanActionFrom scans an Action from any Scanner (sql.Row or sql.Rows)
@@ -795,13 +1638,22 @@ func scanActionFrom(s Scanner) (*Action, error) {
 	var a Action
 	var completedAt sql.NullTime
 	var errorMsg, output, filesJSON, command, groupIDsJSON sql.NullString
+	var measured, freeChange sql.NullInt64
 
 	err := s.Scan(&a.ID, &a.ScanRunID, &a.ActionType, &a.GroupsProcessed, &a.FilesProcessed,
-		&a.BytesSaved, &a.StartedAt, &completedAt, &a.Status, &errorMsg, &output, &filesJSON, &command, &groupIDsJSON)
+		&a.BytesSaved, &measured, &freeChange, &a.StartedAt, &completedAt, &a.Status, &errorMsg, &output,
+		&filesJSON, &command, &groupIDsJSON)
 	if err != nil {
 		return nil, err
 	}
 
+	if measured.Valid {
+		a.BytesMeasured = &measured.Int64
+	}
+	if freeChange.Valid {
+		a.FreeSpaceChange = &freeChange.Int64
+	}
+
 	if completedAt.Valid {
 		a.CompletedAt = &completedAt.Time
 	}
@@ -840,14 +1692,17 @@ func scanActionRow(rows *sql.Rows) (*Action, error) {
 
 // GetDashboardStats returns aggregate statistics
 func (db *DB) GetDashboardStats() (totalSaved int64, pendingGroups int, recentScans int, err error) {
-	// Total bytes saved
-	row := db.QueryRow("SELECT COALESCE(SUM(bytes_saved), 0) FROM actions WHERE status = ?", ActionStatusCompleted)
+	// Total bytes saved, from the daily stats so it outlives the actions
+	row := db.QueryRow("SELECT COALESCE(SUM(bytes_saved), 0) FROM daily_stats")
 	if err = row.Scan(&totalSaved); err != nil {
 		return
 	}
 
-	// Pending duplicate groups
-	row = db.QueryRow("SELECT COUNT(*) FROM duplicate_groups WHERE status = ?", DuplicateGroupStatusPending)
+	// Pending duplicate groups (audit scans report at-risk files, not duplicates)
+	row = db.QueryRow(`
+		SELECT COUNT(*) FROM duplicate_groups
+		WHERE status = ? AND scan_run_id NOT IN (SELECT id FROM scan_runs WHERE rf_under > 0)`,
+		DuplicateGroupStatusPending)
 	if err = row.Scan(&pendingGroups); err != nil {
 		return
 	}
@@ -858,41 +1713,239 @@ func (db *DB) GetDashboardStats() (totalSaved int64, pendingGroups int, recentSc
 	return
 }
 
-// UpdateDailyStats updates or inserts daily statistics
-func (db *DB) UpdateDailyStats(date time.Time, scans, groups, files int, wasted, saved int64) error {
-	dateStr := date.Format("2006-01-02")
-	_, err := db.Exec(`
-		INSERT INTO daily_stats (date, scans_run, groups_found, files_found, bytes_wasted, bytes_saved)
-		VALUES (?, ?, ?, ?, ?, ?)
-		ON CONFLICT(date) DO UPDATE SET
+// GetAtRiskStats totals the at-risk files found by the latest completed audit
+// scan of each job (quick scans count as one job), and the number of such scans
+func (db *DB) GetAtRiskStats() (files int64, bytes int64, audits int, err error) {
+	row := db.QueryRow(`
+		SELECT COUNT(DISTINCT r.id), COALESCE(SUM(g.file_count), 0), COALESCE(SUM(g.file_size * g.file_count), 0)
+		FROM scan_runs r
+		LEFT JOIN duplicate_groups g ON g.scan_run_id = r.id AND g.status = ?
+		WHERE r.id IN (
+			SELECT MAX(id) FROM scan_runs
+			WHERE rf_under > 0 AND status = ?
+			GROUP BY scheduled_job_id
+		)`, DuplicateGroupStatusPending, ScanRunStatusCompleted)
+	err = row.Scan(&audits, &files, &bytes)
+	return
+}
+
+// GetAtRiskBytes returns the total size of the at-risk files found by an audit scan
+func (db *DB) GetAtRiskBytes(runID int64) (int64, error) {
+	var total int64
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(file_size * file_count), 0) FROM duplicate_groups WHERE scan_run_id = ?`,
+		runID).Scan(&total)
+	return total, err
+}
+
+// addDailyStats adds to the stats for a day and job
+func addDailyStats(tx *sql.Tx, s *DailyStats) error {
+	_, err := tx.Exec(`
+		INSERT INTO daily_stats (date, job_id, scans_run, groups_found, files_found, bytes_wasted, bytes_saved)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(date, job_id) DO UPDATE SET
 			scans_run = scans_run + excluded.scans_run,
 			groups_found = groups_found + excluded.groups_found,
 			files_found = files_found + excluded.files_found,
 			bytes_wasted = bytes_wasted + excluded.bytes_wasted,
 			bytes_saved = bytes_saved + excluded.bytes_saved`,
-		dateStr, scans, groups, files, wasted, saved,
+		s.Date.Format("2006-01-02"), s.JobID, s.ScansRun, s.GroupsFound, s.FilesFound, s.BytesWasted, s.BytesSaved,
 	)
 	return err
 }
 
-// CleanupOldData removes data older than the retention period
-func (db *DB) CleanupOldData(retentionDays int) error {
-	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+// ListDailyStats returns the stats for each day with activity from from to to
+// inclusive, oldest first. Days are totalled across jobs unless jobID is set;
+// job ID 0 selects quick scans and imports.
+func (db *DB) ListDailyStats(from, to time.Time, jobID *int64) ([]*DailyStats, error) {
+	query := `
+		SELECT CAST(date AS TEXT), SUM(scans_run), SUM(groups_found), SUM(files_found), SUM(bytes_wasted), SUM(bytes_saved)
+		FROM daily_stats WHERE date >= ? AND date <= ?`
+	args := []any{from.Format("2006-01-02"), to.Format("2006-01-02")}
+	if jobID != nil {
+		query += " AND job_id = ?"
+		args = append(args, *jobID)
+	}
+	query += " GROUP BY date ORDER BY date"
 
-	// Delete old scan runs (cascades to duplicate_groups)
-	_, err := db.Exec("DELETE FROM scan_runs WHERE completed_at < ? AND status != ?", cutoff, ScanRunStatusRunning)
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Delete old actions
-	_, err = db.Exec("DELETE FROM actions WHERE completed_at < ?", cutoff)
+	var stats []*DailyStats
+	for rows.Next() {
+		var s DailyStats
+		var date string
+		if err := rows.Scan(&date, &s.ScansRun, &s.GroupsFound, &s.FilesFound, &s.BytesWasted, &s.BytesSaved); err != nil {
+			return nil, err
+		}
+		if s.Date, err = time.ParseInLocation("2006-01-02", date, time.Local); err != nil {
+			return nil, err
+		}
+		if jobID != nil {
+			s.JobID = *jobID
+		}
+		stats = append(stats, &s)
+	}
+	return stats, rows.Err()
+}
+
+// FirstDailyStatsDate returns the earliest day with stats, or the zero time if
+// there are none
+func (db *DB) FirstDailyStatsDate() (time.Time, error) {
+	var date sql.NullString
+	if err := db.QueryRow("SELECT MIN(date) FROM daily_stats").Scan(&date); err != nil || !date.Valid {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation("2006-01-02", date.String, time.Local)
+}
+
+// DefaultRetentionPolicy is the retention policy before any is configured
+var DefaultRetentionPolicy = RetentionPolicy{RunDays: 30, ActionDays: 365, KeepRuns: 1}
+
+// retentionSettings maps the settings of the retention policy to its fields
+func retentionSettings(p *RetentionPolicy) map[string]*int {
+	return map[string]*int{
+		"retention_days":        &p.RunDays,
+		"group_retention_days":  &p.GroupDays,
+		"action_retention_days": &p.ActionDays,
+		"stats_retention_days":  &p.StatsDays,
+		"keep_runs_per_job":     &p.KeepRuns,
+	}
+}
+
+// GetRetentionPolicy returns the retention policy stored in the settings,
+// with defaults for any that aren't set
+func (db *DB) GetRetentionPolicy() (RetentionPolicy, error) {
+	p := DefaultRetentionPolicy
+	for key, field := range retentionSettings(&p) {
+		val, err := db.GetSetting(key)
+		if err != nil {
+			return p, err
+		}
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			*field = n
+		}
+	}
+	return p, nil
+}
+
+// CleanupOldData removes data older than the retention policy allows. Pinned
+// scan runs and their actions are always kept. Groups and their files are
+// removed with their runs, and anything left behind by earlier cleanups is
+// removed too.
+func (db *DB) CleanupOldData(p RetentionPolicy) (*CleanupResult, error) {
+	now := time.Now()
+	result := &CleanupResult{}
+
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exec := func(n *int64, query string, args ...any) error {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		if n != nil {
+			count, _ := res.RowsAffected()
+			*n += count
+		}
+		return nil
 	}
 
-	// Delete old daily stats
-	_, err = db.Exec("DELETE FROM daily_stats WHERE date < ?", cutoff.Format("2006-01-02"))
+	// Old scan runs with their groups, and old job events with their step runs
+	if p.RunDays > 0 {
+		cutoff := now.AddDate(0, 0, -p.RunDays)
+		runs, args := expiredRunsQuery(cutoff, p.KeepRuns)
+		if err := exec(nil, "DELETE FROM group_files WHERE scan_run_id IN ("+runs+")", args...); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.Groups, "DELETE FROM duplicate_groups WHERE scan_run_id IN ("+runs+")", args...); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.Runs, "DELETE FROM scan_runs WHERE id IN ("+runs+")", args...); err != nil {
+			return nil, err
+		}
+		if err := exec(nil, "DELETE FROM job_step_runs WHERE started_at < ?", cutoff); err != nil {
+			return nil, err
+		}
+		if err := exec(nil, "DELETE FROM job_events WHERE created_at < ?", cutoff); err != nil {
+			return nil, err
+		}
+	}
+
+	// Groups of runs kept longer than their groups
+	if p.GroupDays > 0 {
+		runs, args := expiredRunsQuery(now.AddDate(0, 0, -p.GroupDays), p.KeepRuns)
+		if err := exec(nil, "DELETE FROM group_files WHERE scan_run_id IN ("+runs+")", args...); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.Groups, "DELETE FROM duplicate_groups WHERE scan_run_id IN ("+runs+")", args...); err != nil {
+			return nil, err
+		}
+	}
+
+	// Old actions and their files
+	if p.ActionDays > 0 {
+		actions := `
+			SELECT a.id FROM actions a LEFT JOIN scan_runs r ON r.id = a.scan_run_id
+			WHERE a.completed_at < ? AND NOT COALESCE(r.pinned, 0)`
+		cutoff := now.AddDate(0, 0, -p.ActionDays)
+		if err := exec(nil, "DELETE FROM action_files WHERE action_id IN ("+actions+")", cutoff); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.Actions, "DELETE FROM actions WHERE id IN ("+actions+")", cutoff); err != nil {
+			return nil, err
+		}
+	}
+
+	// Rows whose run, group or action is gone
+	if err := exec(&result.Groups, "DELETE FROM duplicate_groups WHERE scan_run_id NOT IN (SELECT id FROM scan_runs)"); err != nil {
+		return nil, err
+	}
+	if err := exec(nil, "DELETE FROM group_files WHERE group_id NOT IN (SELECT id FROM duplicate_groups)"); err != nil {
+		return nil, err
+	}
+	if err := exec(nil, "DELETE FROM action_files WHERE action_id NOT IN (SELECT id FROM actions)"); err != nil {
+		return nil, err
+	}
+
+	// Daily stats, which are otherwise kept so trends can span more than the run retention
+	if p.StatsDays > 0 {
+		cutoff := now.AddDate(0, 0, -p.StatsDays).Format("2006-01-02")
+		if err := exec(&result.Stats, "DELETE FROM daily_stats WHERE date < ?", cutoff); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// expiredRunsQuery returns a query of the IDs of the finished, unpinned scan
+// runs completed before cutoff, other than the newest keep completed runs of
+// each job (quick scans count as one job), and its arguments
+func expiredRunsQuery(cutoff time.Time, keep int) (string, []any) {
+	return `
+		SELECT id FROM scan_runs
+		WHERE completed_at < ? AND status != ? AND NOT pinned AND id NOT IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY scheduled_job_id ORDER BY started_at DESC, id DESC) AS n
+				FROM scan_runs WHERE status = ?
+			) WHERE n <= ?
+		)`, []any{cutoff, ScanRunStatusRunning, ScanRunStatusCompleted, keep}
+}
+
+// Vacuum rebuilds the database file to reclaim the space of deleted rows
+func (db *DB) Vacuum() error {
+	_, err := db.Exec("VACUUM")
 	return err
 }
 
@@ -1,8 +1,11 @@
 package db
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -1041,6 +1044,10 @@ func TestCleanupOldData(t *testing.T) {
 		t.Fatalf("failed to backdate scan run: %v", err)
 	}
 
+	oldGroup := &DuplicateGroup{ScanRunID: oldRun.ID, FileHash: "old", FileSize: 1, FileCount: 2,
+		Status: DuplicateGroupStatusPending, Files: []string{"/old/a", "/old/b"}}
+	db.CreateDuplicateGroup(oldGroup)
+
 	// Create recent scan run (should be kept)
 	recentRun, _ := db.CreateScanRun(nil, nil, []string{"/recent"}, nil)
 	db.CompleteScanRun(recentRun.ID, ScanRunStatusCompleted, nil)
@@ -1053,7 +1060,7 @@ func TestCleanupOldData(t *testing.T) {
 	db.CreateAction(oldAction)
 
 	// Run cleanup with 30 day retention
-	err = db.CleanupOldData(30)
+	_, err = db.CleanupOldData(RetentionPolicy{RunDays: 30})
 	if err != nil {
 		t.Fatalf("CleanupOldData failed: %v", err)
 	}
@@ -1064,6 +1071,11 @@ func TestCleanupOldData(t *testing.T) {
 		t.Error("old scan run should have been deleted")
 	}
 
+	// Verify the old run's group files were deleted
+	if files, _ := db.ListGroupFiles(oldGroup.ID); len(files) != 0 {
+		t.Errorf("old group files should have been deleted, got %d", len(files))
+	}
+
 	// Verify recent run still exists
 	_, err = db.GetScanRun(recentRun.ID)
 	if err != nil {
@@ -1071,6 +1083,142 @@ func TestCleanupOldData(t *testing.T) {
 	}
 }
 
+func TestCleanupOldData_Policy(t *testing.T) {
+	db := testDB(t)
+
+	job, _ := db.CreateScheduledJob(&ScheduledJob{Name: "Nightly", Paths: []string{"/data"}, CronExpression: "0 3 * * *", Action: "scan"})
+	newRun := func(jobID *int64, daysAgo int) *ScanRun {
+		t.Helper()
+		run, _ := db.CreateScanRun(nil, jobID, []string{"/data"}, nil)
+		db.CompleteScanRun(run.ID, ScanRunStatusCompleted, nil)
+		db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: run.ID, FileHash: "h", FileSize: 1, FileCount: 2,
+			Status: DuplicateGroupStatusPending, Files: []string{"/data/a", "/data/b"}})
+		if _, err := db.Exec(`UPDATE scan_runs SET started_at = datetime('now', ?), completed_at = datetime('now', ?) WHERE id = ?`,
+			fmt.Sprintf("-%d days", daysAgo), fmt.Sprintf("-%d days", daysAgo), run.ID); err != nil {
+			t.Fatalf("failed to backdate scan run: %v", err)
+		}
+		return run
+	}
+	newAction := func(runID int64, daysAgo int) *Action {
+		t.Helper()
+		action, _ := db.CreateAction(&Action{ScanRunID: runID, ActionType: ActionTypeHardlink})
+		db.CompleteAction(action.ID, &ActionCompletion{Status: ActionStatusCompleted, Files: []string{"/data/b"}})
+		if _, err := db.Exec(`UPDATE actions SET completed_at = datetime('now', ?) WHERE id = ?`,
+			fmt.Sprintf("-%d days", daysAgo), action.ID); err != nil {
+			t.Fatalf("failed to backdate action: %v", err)
+		}
+		return action
+	}
+
+	olderJobRun := newRun(&job.ID, 90)
+	latestJobRun := newRun(&job.ID, 60) // Kept as the job's latest run
+	oldQuickRun := newRun(nil, 60)
+	pinnedRun := newRun(nil, 60)
+	db.SetScanRunPinned(pinnedRun.ID, true)
+	groupsExpiredRun := newRun(nil, 20)
+	recentRun := newRun(nil, 1)
+
+	oldAction := newAction(recentRun.ID, 60)
+	pinnedAction := newAction(pinnedRun.ID, 60)
+	recentAction := newAction(recentRun.ID, 1)
+
+	// A group and files left behind by a run deleted without them
+	if _, err := db.Exec(`
+		INSERT INTO duplicate_groups (id, scan_run_id, file_hash, file_size, file_count, wasted_bytes, status)
+		VALUES (999, 999, 'orphan', 1, 2, 1, 'pending');
+		INSERT INTO group_files (group_id, scan_run_id, position, path) VALUES (999, 999, 0, '/gone');
+		INSERT INTO daily_stats (date, job_id, scans_run) VALUES (date('now', '-400 days'), 0, 1);
+	`); err != nil {
+		t.Fatalf("failed to insert orphans: %v", err)
+	}
+
+	result, err := db.CleanupOldData(RetentionPolicy{RunDays: 30, GroupDays: 10, ActionDays: 30, StatsDays: 365, KeepRuns: 1})
+	if err != nil {
+		t.Fatalf("CleanupOldData failed: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		run  *ScanRun
+		kept bool
+	}{
+		{"older job run", olderJobRun, false},
+		{"latest job run", latestJobRun, true},
+		{"old quick scan", oldQuickRun, false},
+		{"pinned run", pinnedRun, true},
+		{"run with expired groups", groupsExpiredRun, true},
+		{"recent run", recentRun, true},
+	} {
+		_, err := db.GetScanRun(tt.run.ID)
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("%s kept = %v, want %v", tt.name, kept, tt.kept)
+		}
+	}
+
+	groupCount := func(runID int64) int {
+		var n int
+		db.QueryRow("SELECT COUNT(*) FROM duplicate_groups WHERE scan_run_id = ?", runID).Scan(&n)
+		return n
+	}
+	if groupCount(groupsExpiredRun.ID) != 0 {
+		t.Error("groups older than the group retention should be deleted")
+	}
+	if groupCount(latestJobRun.ID) != 1 || groupCount(pinnedRun.ID) != 1 || groupCount(recentRun.ID) != 1 {
+		t.Error("groups of kept and recent runs should be kept")
+	}
+	var orphans int
+	db.QueryRow(`SELECT (SELECT COUNT(*) FROM duplicate_groups WHERE scan_run_id NOT IN (SELECT id FROM scan_runs))
+		+ (SELECT COUNT(*) FROM group_files WHERE group_id NOT IN (SELECT id FROM duplicate_groups))`).Scan(&orphans)
+	if orphans != 0 {
+		t.Errorf("%d orphaned groups and files left", orphans)
+	}
+
+	if _, err := db.GetAction(oldAction.ID); err == nil {
+		t.Error("old action should be deleted")
+	}
+	if _, err := db.GetAction(pinnedAction.ID); err != nil {
+		t.Error("action of a pinned run should be kept")
+	}
+	if _, err := db.GetAction(recentAction.ID); err != nil {
+		t.Error("recent action should be kept")
+	}
+
+	var statsDays int
+	db.QueryRow("SELECT COUNT(*) FROM daily_stats WHERE date < date('now', '-365 days')").Scan(&statsDays)
+	if statsDays != 0 {
+		t.Errorf("%d days of stats older than the stats retention left", statsDays)
+	}
+
+	// 2 runs, their groups, the expired groups and the orphan
+	want := CleanupResult{Runs: 2, Groups: 4, Actions: 1, Stats: 1}
+	if *result != want {
+		t.Errorf("result = %+v, want %+v", *result, want)
+	}
+}
+
+func TestGetRetentionPolicy(t *testing.T) {
+	db := testDB(t)
+
+	// retention_days is seeded by the first migration
+	policy, err := db.GetRetentionPolicy()
+	if err != nil {
+		t.Fatalf("GetRetentionPolicy failed: %v", err)
+	}
+	if policy != DefaultRetentionPolicy {
+		t.Errorf("policy = %+v, want defaults %+v", policy, DefaultRetentionPolicy)
+	}
+
+	db.SetSetting("retention_days", "14")
+	db.SetSetting("action_retention_days", "0")
+	db.SetSetting("keep_runs_per_job", "3")
+	db.SetSetting("stats_retention_days", "bogus")
+	policy, _ = db.GetRetentionPolicy()
+	want := RetentionPolicy{RunDays: 14, ActionDays: 0, KeepRuns: 3}
+	if policy != want {
+		t.Errorf("policy = %+v, want %+v", policy, want)
+	}
+}
+
 func TestPagination(t *testing.T) {
 	db := testDB(t)
 
@@ -1170,7 +1318,7 @@ func TestCountDuplicateGroups(t *testing.T) {
 	db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: run.ID, FileHash: "c", FileSize: 100, FileCount: 2, WastedBytes: 100, Status: DuplicateGroupStatusProcessed, Files: []string{"/e", "/f"}})
 
 	// Count all
-	count, err := db.CountDuplicateGroups(run.ID, "")
+	count, err := db.CountDuplicateGroups(run.ID, DuplicateGroupFilter{})
 	if err != nil {
 		t.Fatalf("CountDuplicateGroups failed: %v", err)
 	}
@@ -1179,7 +1327,7 @@ func TestCountDuplicateGroups(t *testing.T) {
 	}
 
 	// Count pending only
-	count, err = db.CountDuplicateGroups(run.ID, "pending")
+	count, err = db.CountDuplicateGroups(run.ID, DuplicateGroupFilter{Status: "pending"})
 	if err != nil {
 		t.Fatalf("CountDuplicateGroups failed: %v", err)
 	}
@@ -1188,7 +1336,7 @@ func TestCountDuplicateGroups(t *testing.T) {
 	}
 
 	// Count processed only
-	count, err = db.CountDuplicateGroups(run.ID, "processed")
+	count, err = db.CountDuplicateGroups(run.ID, DuplicateGroupFilter{Status: "processed"})
 	if err != nil {
 		t.Fatalf("CountDuplicateGroups failed: %v", err)
 	}
@@ -1286,3 +1434,1210 @@ func TestGetDashboardStats(t *testing.T) {
 		t.Errorf("recentScans = %d, want 1", recentScans)
 	}
 }
+
+func TestDailyStats_RecordedOnCompletion(t *testing.T) {
+	db := testDB(t)
+
+	job, err := db.CreateScheduledJob(&ScheduledJob{Name: "Nightly", Paths: []string{"/data"}, CronExpression: "0 3 * * *", Action: "scan"})
+	if err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+
+	// A completed job scan counts its waste, once
+	run, _ := db.CreateScanRun(nil, &job.ID, []string{"/data"}, nil)
+	db.UpdateScanRunProgress(run.ID, 100, 5000, 2, 5, 3000)
+	if err := db.CompleteScanRun(run.ID, ScanRunStatusCompleted, nil); err != nil {
+		t.Fatalf("CompleteScanRun failed: %v", err)
+	}
+	db.CompleteScanRun(run.ID, ScanRunStatusCompleted, nil)
+
+	// Failed scans and audits count as scans without waste
+	failed, _ := db.CreateScanRun(nil, nil, []string{"/quick"}, nil)
+	db.UpdateScanRunProgress(failed.ID, 10, 100, 1, 2, 50)
+	db.CompleteScanRun(failed.ID, ScanRunStatusFailed, nil)
+	audit, _ := db.CreateScanRun(nil, &job.ID, []string{"/data"}, &ScanRunOptions{RFUnder: 2})
+	db.UpdateScanRunProgress(audit.ID, 10, 100, 4, 4, 400)
+	db.CompleteScanRun(audit.ID, ScanRunStatusCompleted, nil)
+
+	// Actions add the bytes saved to their scan's job
+	action, _ := db.CreateAction(&Action{ScanRunID: run.ID, ActionType: ActionTypeHardlink})
+	if err := db.CompleteAction(action.ID, &ActionCompletion{BytesSaved: 1200, Status: ActionStatusCompleted}); err != nil {
+		t.Fatalf("CompleteAction failed: %v", err)
+	}
+	db.CompleteAction(action.ID, &ActionCompletion{BytesSaved: 1200, Status: ActionStatusCompleted})
+
+	today := time.Now()
+	all, err := db.ListDailyStats(today.AddDate(0, 0, -1), today, nil)
+	if err != nil {
+		t.Fatalf("ListDailyStats failed: %v", err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("got %d days, want 1", len(all))
+	}
+	if got := all[0]; got.ScansRun != 3 || got.GroupsFound != 2 || got.FilesFound != 5 || got.BytesWasted != 3000 || got.BytesSaved != 1200 {
+		t.Errorf("overall stats = %+v", got)
+	}
+	if got := all[0].Date.Format("2006-01-02"); got != today.Format("2006-01-02") {
+		t.Errorf("date = %s, want today", got)
+	}
+
+	quick := int64(0)
+	byQuick, _ := db.ListDailyStats(today, today, &quick)
+	if len(byQuick) != 1 || byQuick[0].ScansRun != 1 || byQuick[0].BytesWasted != 0 {
+		t.Errorf("quick scan stats = %+v", byQuick)
+	}
+	byJob, _ := db.ListDailyStats(today, today, &job.ID)
+	if len(byJob) != 1 || byJob[0].ScansRun != 2 || byJob[0].BytesSaved != 1200 {
+		t.Errorf("job stats = %+v", byJob)
+	}
+	if none, _ := db.ListDailyStats(today.AddDate(0, 0, -10), today.AddDate(0, 0, -1), nil); len(none) != 0 {
+		t.Errorf("stats before today = %+v, want none", none)
+	}
+
+	// Stats outlive the runs they came from
+	db.Exec(`UPDATE scan_runs SET completed_at = datetime('now', '-60 days')`)
+	db.Exec(`UPDATE actions SET completed_at = datetime('now', '-60 days')`)
+	if _, err := db.CleanupOldData(RetentionPolicy{RunDays: 30, ActionDays: 30}); err != nil {
+		t.Fatalf("CleanupOldData failed: %v", err)
+	}
+	if all, _ := db.ListDailyStats(today, today, nil); len(all) != 1 {
+		t.Errorf("stats after cleanup = %+v, want kept", all)
+	}
+	if first, err := db.FirstDailyStatsDate(); err != nil || first.Format("2006-01-02") != today.Format("2006-01-02") {
+		t.Errorf("FirstDailyStatsDate = %v, %v; want today", first, err)
+	}
+}
+
+func TestMigration020_BackfillsDailyStats(t *testing.T) {
+	db := testDB(t)
+
+	_, err := db.Exec(`
+		ALTER TABLE scan_runs DROP COLUMN pinned;
+		ALTER TABLE action_files DROP COLUMN status;
+		ALTER TABLE action_files DROP COLUMN error;
+		ALTER TABLE actions DROP COLUMN bytes_measured;
+		ALTER TABLE actions DROP COLUMN free_space_change;
+		DROP TABLE daily_stats;
+		CREATE TABLE daily_stats (date DATE PRIMARY KEY, scans_run INTEGER DEFAULT 0, groups_found INTEGER DEFAULT 0,
+			files_found INTEGER DEFAULT 0, bytes_wasted INTEGER DEFAULT 0, bytes_saved INTEGER DEFAULT 0);
+		DELETE FROM schema_migrations WHERE version >= 20;
+		INSERT INTO scan_runs (id, paths, status, started_at, completed_at, duplicate_groups, duplicate_files, wasted_bytes)
+		VALUES (1, '["/a"]', 'completed', '2026-03-01 06:00:00', '2026-03-01 06:00:00', 2, 4, 500),
+			(2, '["/a"]', 'failed', '2026-03-01 06:10:00', '2026-03-01 06:10:00', 1, 2, 70),
+			(3, '["/a"]', 'running', '2026-03-02 11:00:00', NULL, 0, 0, 0);
+		INSERT INTO actions (id, scan_run_id, action_type, status, started_at, completed_at, bytes_saved)
+		VALUES (1, 1, 'hardlink', 'completed', '2026-03-01 06:20:00', '2026-03-01 06:20:00', 300);
+	`)
+	if err != nil {
+		t.Fatalf("failed to restore old schema: %v", err)
+	}
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	first, err := db.FirstDailyStatsDate()
+	if err != nil || first.IsZero() {
+		t.Fatalf("FirstDailyStatsDate = %v, %v", first, err)
+	}
+	stats, err := db.ListDailyStats(first, first.AddDate(0, 0, 2), nil)
+	if err != nil {
+		t.Fatalf("ListDailyStats failed: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("got %d days, want 1", len(stats))
+	}
+	if got := stats[0]; got.ScansRun != 2 || got.GroupsFound != 2 || got.BytesWasted != 500 || got.BytesSaved != 300 {
+		t.Errorf("backfilled stats = %+v", got)
+	}
+}
+
+func TestScheduledJob_ScheduleSettings(t *testing.T) {
+	db := testDB(t)
+
+	job, err := db.CreateScheduledJob(&ScheduledJob{
+		Name:           "Defaults",
+		Paths:          []string{"/tmp"},
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+	})
+	if err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+	if job.MissedRunPolicy != MissedRunPolicyRunOnce {
+		t.Errorf("MissedRunPolicy = %q, want %q", job.MissedRunPolicy, MissedRunPolicyRunOnce)
+	}
+	if job.OverlapPolicy != OverlapPolicyForbid {
+		t.Errorf("OverlapPolicy = %q, want %q", job.OverlapPolicy, OverlapPolicyForbid)
+	}
+
+	if job.Timezone != "" {
+		t.Errorf("Timezone = %q, want empty (server local time)", job.Timezone)
+	}
+
+	job.MissedRunPolicy = MissedRunPolicySkip
+	job.OverlapPolicy = OverlapPolicyQueue
+	job.Timezone = "Europe/Berlin"
+	if err := db.UpdateScheduledJob(job); err != nil {
+		t.Fatalf("UpdateScheduledJob failed: %v", err)
+	}
+	got, _ := db.GetScheduledJob(job.ID)
+	if got.MissedRunPolicy != MissedRunPolicySkip || got.OverlapPolicy != OverlapPolicyQueue {
+		t.Errorf("policies = %q/%q, want skip/queue", got.MissedRunPolicy, got.OverlapPolicy)
+	}
+	if got.Timezone != "Europe/Berlin" {
+		t.Errorf("Timezone = %q, want Europe/Berlin", got.Timezone)
+	}
+}
+
+func TestJobEvents(t *testing.T) {
+	db := testDB(t)
+
+	job, _ := db.CreateScheduledJob(&ScheduledJob{
+		Name:           "Events",
+		Paths:          []string{"/tmp"},
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+	})
+	run, _ := db.CreateScanRun(nil, &job.ID, []string{"/tmp"}, nil)
+
+	scheduledFor := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := db.CreateJobEvent(&JobEvent{
+		JobID:        job.ID,
+		Event:        JobEventSkippedMissed,
+		ScheduledFor: &scheduledFor,
+		Message:      "skipped",
+	}); err != nil {
+		t.Fatalf("CreateJobEvent failed: %v", err)
+	}
+	if err := db.CreateJobEvent(&JobEvent{
+		JobID:     job.ID,
+		Event:     JobEventManual,
+		ScanRunID: &run.ID,
+	}); err != nil {
+		t.Fatalf("CreateJobEvent failed: %v", err)
+	}
+
+	events, err := db.ListJobEvents(job.ID, 10)
+	if err != nil {
+		t.Fatalf("ListJobEvents failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	// Most recent first
+	if events[0].Event != JobEventManual || events[0].ScanRunID == nil || *events[0].ScanRunID != run.ID {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[1].ScheduledFor == nil || !events[1].ScheduledFor.Equal(scheduledFor) {
+		t.Errorf("ScheduledFor = %v, want %v", events[1].ScheduledFor, scheduledFor)
+	}
+	if events[1].ScanRunID != nil {
+		t.Error("ScanRunID should be nil for skipped event")
+	}
+
+	ids, err := db.GetRunningScanRunIDsForJob(job.ID)
+	if err != nil || len(ids) != 1 || ids[0] != run.ID {
+		t.Errorf("GetRunningScanRunIDsForJob = %v, %v; want [%d]", ids, err, run.ID)
+	}
+
+	// Deleting the job removes its events
+	if err := db.DeleteScheduledJob(job.ID); err != nil {
+		t.Fatalf("DeleteScheduledJob failed: %v", err)
+	}
+	events, _ = db.ListJobEvents(job.ID, 10)
+	if len(events) != 0 {
+		t.Errorf("expected events to be deleted with job, got %d", len(events))
+	}
+}
+
+func TestScheduledJob_Steps(t *testing.T) {
+	db := testDB(t)
+
+	steps := []JobStep{
+		{Type: JobStepScan, Paths: []string{"/a"}},
+		{Type: JobStepAction, ActionType: ActionTypeHardlink},
+		{Type: JobStepScan, Paths: []string{"/a", "/b"}},
+		{Type: JobStepNotify, WebhookURL: "https://example.com/hook"},
+		{Type: JobStepWaitForJob, JobID: 42},
+	}
+	job, err := db.CreateScheduledJob(&ScheduledJob{
+		Name:           "Pipeline",
+		Paths:          []string{"/a"},
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		Steps:          steps,
+	})
+	if err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+
+	got, _ := db.GetScheduledJob(job.ID)
+	if len(got.Steps) != len(steps) {
+		t.Fatalf("expected %d steps, got %d", len(steps), len(got.Steps))
+	}
+	if got.Steps[2].Paths[1] != "/b" || got.Steps[3].WebhookURL != "https://example.com/hook" || got.Steps[4].JobID != 42 {
+		t.Errorf("steps did not round-trip: %+v", got.Steps)
+	}
+}
+
+func TestScheduledJob_Hooks(t *testing.T) {
+	db := testDB(t)
+
+	job, err := db.CreateScheduledJob(&ScheduledJob{
+		Name:           "Hooks",
+		Paths:          []string{"/a"},
+		CronExpression: "0 * * * *",
+		Action:         "scan_hardlink",
+		PreScanHook:    "zfs snapshot tank@kuron",
+		PreActionHook:  "true",
+	})
+	if err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+
+	job.PreActionHook = ""
+	job.PostActionHook = "warm-cache /a"
+	if err := db.UpdateScheduledJob(job); err != nil {
+		t.Fatalf("UpdateScheduledJob failed: %v", err)
+	}
+
+	got, _ := db.GetScheduledJob(job.ID)
+	if got.PreScanHook != "zfs snapshot tank@kuron" || got.PreActionHook != "" || got.PostActionHook != "warm-cache /a" {
+		t.Errorf("hooks did not round-trip: %q %q %q", got.PreScanHook, got.PreActionHook, got.PostActionHook)
+	}
+
+	run, err := db.CreateScanRun(nil, &job.ID, []string{"/a"}, nil)
+	if err != nil {
+		t.Fatalf("CreateScanRun failed: %v", err)
+	}
+	if run, _ := db.GetScanRun(run.ID); run.HookOutput != nil {
+		t.Errorf("expected no hook output, got %q", *run.HookOutput)
+	}
+	if err := db.SetScanRunHookOutput(run.ID, "$ true\n"); err != nil {
+		t.Fatalf("SetScanRunHookOutput failed: %v", err)
+	}
+	if run, _ := db.GetScanRun(run.ID); run.HookOutput == nil || *run.HookOutput != "$ true\n" {
+		t.Errorf("hook output did not round-trip: %v", run.HookOutput)
+	}
+}
+
+func TestScheduledJob_WindowAndLimits(t *testing.T) {
+	db := testDB(t)
+
+	job, err := db.CreateScheduledJob(&ScheduledJob{
+		Name:              "Throttled",
+		Paths:             []string{"/a"},
+		CronExpression:    "0 * * * *",
+		Action:            "scan",
+		MaintenanceWindow: "Mon-Fri 22:00-06:00",
+		Threads:           2,
+		Nice:              10,
+		IOClass:           IOClassIdle,
+	})
+	if err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+
+	got, _ := db.GetScheduledJob(job.ID)
+	if got.MaintenanceWindow != "Mon-Fri 22:00-06:00" || got.Threads != 2 || got.Nice != 10 || got.IOClass != IOClassIdle {
+		t.Errorf("settings did not round-trip: %q %d %d %q", got.MaintenanceWindow, got.Threads, got.Nice, got.IOClass)
+	}
+
+	got.MaintenanceWindow = ""
+	got.IOClass = IOClassDefault
+	if err := db.UpdateScheduledJob(got); err != nil {
+		t.Fatalf("UpdateScheduledJob failed: %v", err)
+	}
+	got, _ = db.GetScheduledJob(job.ID)
+	if got.MaintenanceWindow != "" || got.IOClass != IOClassDefault || got.Threads != 2 {
+		t.Errorf("update did not round-trip: %q %d %q", got.MaintenanceWindow, got.Threads, got.IOClass)
+	}
+}
+
+func TestScanRun_MatchingModes(t *testing.T) {
+	db := testDB(t)
+
+	opts := &ScanRunOptions{
+		NamePatterns: []string{"*.jpg"},
+		MatchName:    true,
+		Isolate:      true,
+		MatchLinks:   true,
+		RFUnder:      2,
+	}
+	created, err := db.CreateScanRun(nil, nil, []string{"/a", "/b"}, opts)
+	if err != nil {
+		t.Fatalf("CreateScanRun failed: %v", err)
+	}
+
+	got, err := db.GetScanRun(created.ID)
+	if err != nil {
+		t.Fatalf("GetScanRun failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.NamePatterns, opts.NamePatterns) {
+		t.Errorf("NamePatterns = %v, want %v", got.NamePatterns, opts.NamePatterns)
+	}
+	if !got.MatchName || !got.Isolate || !got.MatchLinks || got.RFOver != 0 || got.RFUnder != 2 {
+		t.Errorf("matching modes did not round-trip: %+v", got)
+	}
+}
+
+func TestScheduledJob_MatchingModes(t *testing.T) {
+	db := testDB(t)
+
+	job, err := db.CreateScheduledJob(&ScheduledJob{
+		Name:           "Backups",
+		Paths:          []string{"/a", "/b"},
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		NamePatterns:   []string{"*.raw", "*.dng"},
+		Isolate:        true,
+		RFOver:         3,
+	})
+	if err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+
+	got, _ := db.GetScheduledJob(job.ID)
+	if !reflect.DeepEqual(got.NamePatterns, []string{"*.raw", "*.dng"}) || !got.Isolate || got.RFOver != 3 {
+		t.Errorf("matching modes did not round-trip: %v %v %d", got.NamePatterns, got.Isolate, got.RFOver)
+	}
+
+	got.NamePatterns = nil
+	got.Isolate = false
+	got.MatchLinks = true
+	got.MatchName = true
+	if err := db.UpdateScheduledJob(got); err != nil {
+		t.Fatalf("UpdateScheduledJob failed: %v", err)
+	}
+	got, _ = db.GetScheduledJob(job.ID)
+	if len(got.NamePatterns) != 0 || got.Isolate || !got.MatchLinks || !got.MatchName {
+		t.Errorf("update did not round-trip: %v %v %v %v", got.NamePatterns, got.Isolate, got.MatchLinks, got.MatchName)
+	}
+}
+
+func TestScheduledJob_PipelineSteps(t *testing.T) {
+	tests := []struct {
+		action string
+		want   []JobStepType
+	}{
+		{"scan", []JobStepType{JobStepScan}},
+		{"scan_hardlink", []JobStepType{JobStepScan, JobStepAction}},
+		{"scan_reflink", []JobStepType{JobStepScan, JobStepAction}},
+	}
+	for _, tt := range tests {
+		steps := (&ScheduledJob{Action: tt.action}).PipelineSteps()
+		if len(steps) != len(tt.want) {
+			t.Errorf("%s: got %d steps, want %d", tt.action, len(steps), len(tt.want))
+			continue
+		}
+		for i, step := range steps {
+			if step.Type != tt.want[i] {
+				t.Errorf("%s: step %d = %s, want %s", tt.action, i, step.Type, tt.want[i])
+			}
+		}
+	}
+
+	if steps := (&ScheduledJob{Action: "scan_reflink"}).PipelineSteps(); steps[1].ActionType != ActionTypeReflink {
+		t.Errorf("action step type = %s, want reflink", steps[1].ActionType)
+	}
+
+	// Explicit steps replace the scan and action
+	explicit := &ScheduledJob{Action: "scan_hardlink", Steps: []JobStep{{Type: JobStepNotify}}}
+	if steps := explicit.PipelineSteps(); len(steps) != 1 || steps[0].Type != JobStepNotify {
+		t.Errorf("explicit steps not used: %+v", steps)
+	}
+}
+
+func TestJobStepRuns(t *testing.T) {
+	db := testDB(t)
+
+	job, _ := db.CreateScheduledJob(&ScheduledJob{
+		Name:           "Pipeline",
+		Paths:          []string{"/tmp"},
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+	})
+	event := &JobEvent{JobID: job.ID, Event: JobEventManual}
+	if err := db.CreateJobEvent(event); err != nil {
+		t.Fatalf("CreateJobEvent failed: %v", err)
+	}
+	run, _ := db.CreateScanRun(nil, &job.ID, []string{"/tmp"}, nil)
+	if err := db.SetJobEventScanRun(event.ID, run.ID); err != nil {
+		t.Fatalf("SetJobEventScanRun failed: %v", err)
+	}
+
+	scan := &JobStepRun{JobEventID: event.ID, JobID: job.ID, StepIndex: 0, StepType: JobStepScan}
+	if err := db.CreateJobStepRun(scan); err != nil {
+		t.Fatalf("CreateJobStepRun failed: %v", err)
+	}
+	if scan.Status != JobStepRunRunning {
+		t.Errorf("new step status = %s, want running", scan.Status)
+	}
+
+	completedAt := time.Now()
+	scan.Status = JobStepRunCompleted
+	scan.ScanRunID = &run.ID
+	scan.Message = "Found 0 duplicate groups"
+	scan.CompletedAt = &completedAt
+	if err := db.UpdateJobStepRun(scan); err != nil {
+		t.Fatalf("UpdateJobStepRun failed: %v", err)
+	}
+	db.CreateJobStepRun(&JobStepRun{JobEventID: event.ID, JobID: job.ID, StepIndex: 1, StepType: JobStepAction, Status: JobStepRunSkipped})
+
+	byEvent, err := db.ListJobStepRuns([]int64{event.ID})
+	if err != nil {
+		t.Fatalf("ListJobStepRuns failed: %v", err)
+	}
+	steps := byEvent[event.ID]
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 step runs, got %d", len(steps))
+	}
+	if steps[0].Status != JobStepRunCompleted || steps[0].ScanRunID == nil || *steps[0].ScanRunID != run.ID || steps[0].CompletedAt == nil {
+		t.Errorf("unexpected first step run: %+v", steps[0])
+	}
+	if steps[1].Status != JobStepRunSkipped || steps[1].ScanRunID != nil {
+		t.Errorf("unexpected second step run: %+v", steps[1])
+	}
+
+	events, _ := db.ListJobEvents(job.ID, 1)
+	if events[0].ScanRunID == nil || *events[0].ScanRunID != run.ID {
+		t.Error("event should link to the scan run")
+	}
+
+	// Deleting the job removes its step runs
+	db.DeleteScheduledJob(job.ID)
+	byEvent, _ = db.ListJobStepRuns([]int64{event.ID})
+	if len(byEvent[event.ID]) != 0 {
+		t.Error("step runs should be deleted with the job")
+	}
+}
+
+func TestGetAtRiskStats(t *testing.T) {
+	db := testDB(t)
+
+	audit := &ScanRunOptions{RFUnder: 2}
+
+	// An older audit is superseded by the latest one from the same source
+	old, _ := db.CreateScanRun(nil, nil, []string{"/a"}, audit)
+	db.CompleteScanRun(old.ID, ScanRunStatusCompleted, nil)
+	db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: old.ID, FileHash: "old", FileSize: 500, FileCount: 1, Status: DuplicateGroupStatusPending, Files: []string{"/a/old"}})
+
+	latest, _ := db.CreateScanRun(nil, nil, []string{"/a"}, audit)
+	db.CompleteScanRun(latest.ID, ScanRunStatusCompleted, nil)
+	db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: latest.ID, FileHash: "x", FileSize: 1000, FileCount: 1, Status: DuplicateGroupStatusPending, Files: []string{"/a/x"}})
+	db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: latest.ID, FileHash: "y", FileSize: 200, FileCount: 1, Status: DuplicateGroupStatusPending, Files: []string{"/a/y"}})
+
+	// A regular duplicate scan doesn't count towards at-risk files
+	dup, _ := db.CreateScanRun(nil, nil, []string{"/a"}, nil)
+	db.CompleteScanRun(dup.ID, ScanRunStatusCompleted, nil)
+	db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: dup.ID, FileHash: "z", FileSize: 300, FileCount: 2, WastedBytes: 300, Status: DuplicateGroupStatusPending, Files: []string{"/a/z1", "/a/z2"}})
+
+	files, bytes, audits, err := db.GetAtRiskStats()
+	if err != nil {
+		t.Fatalf("GetAtRiskStats failed: %v", err)
+	}
+	if files != 2 || bytes != 1200 || audits != 1 {
+		t.Errorf("GetAtRiskStats = %d files, %d bytes, %d audits; want 2, 1200, 1", files, bytes, audits)
+	}
+
+	// Audit groups aren't pending duplicates
+	_, pendingGroups, _, err := db.GetDashboardStats()
+	if err != nil {
+		t.Fatalf("GetDashboardStats failed: %v", err)
+	}
+	if pendingGroups != 1 {
+		t.Errorf("pendingGroups = %d, want 1", pendingGroups)
+	}
+
+	runBytes, err := db.GetAtRiskBytes(latest.ID)
+	if err != nil {
+		t.Fatalf("GetAtRiskBytes failed: %v", err)
+	}
+	if runBytes != 1200 {
+		t.Errorf("GetAtRiskBytes = %d, want 1200", runBytes)
+	}
+}
+
+func TestScanRun_Transform(t *testing.T) {
+	db := testDB(t)
+
+	created, err := db.CreateScanRun(nil, nil, []string{"/photos"}, &ScanRunOptions{Transform: "exiftool -q -all= -o - $IN"})
+	if err != nil {
+		t.Fatalf("CreateScanRun failed: %v", err)
+	}
+	got, err := db.GetScanRun(created.ID)
+	if err != nil {
+		t.Fatalf("GetScanRun failed: %v", err)
+	}
+	if got.Transform != "exiftool -q -all= -o - $IN" || !got.IsTransformed() {
+		t.Errorf("Transform = %q, want the exiftool command", got.Transform)
+	}
+
+	plain, _ := db.CreateScanRun(nil, nil, []string{"/photos"}, nil)
+	if plain.IsTransformed() {
+		t.Error("scan without a transform should not be transformed")
+	}
+}
+
+func TestCreateDuplicateGroups(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/test"}, nil)
+	groups := []*DuplicateGroup{
+		{ScanRunID: run.ID, FileHash: "a", FileSize: 10, FileCount: 2, WastedBytes: 10, Status: DuplicateGroupStatusPending, Files: []string{"/a1", "/a2"}},
+		{ScanRunID: run.ID, FileHash: "b", FileSize: 20, FileCount: 2, WastedBytes: 20, Status: DuplicateGroupStatusPending, Files: []string{"/b1", "/b2"}},
+	}
+	if err := db.CreateDuplicateGroups(groups); err != nil {
+		t.Fatalf("CreateDuplicateGroups failed: %v", err)
+	}
+	for _, g := range groups {
+		if g.ID == 0 {
+			t.Error("group ID should be set")
+		}
+	}
+	got, err := db.GetDuplicateGroup(groups[1].ID)
+	if err != nil || got.FileHash != "b" || len(got.Files) != 2 {
+		t.Errorf("GetDuplicateGroup = %+v, %v", got, err)
+	}
+
+	// An invalid group rolls back the whole batch
+	err = db.CreateDuplicateGroups([]*DuplicateGroup{
+		{ScanRunID: run.ID, FileHash: "c", FileSize: 30, FileCount: 2, Status: DuplicateGroupStatusPending, Files: []string{"/c1", "/c2"}},
+		{ScanRunID: run.ID, FileHash: "", Files: []string{"/d"}},
+	})
+	if err == nil {
+		t.Error("batch with an invalid group should fail")
+	}
+	if count, _ := db.CountDuplicateGroups(run.ID, DuplicateGroupFilter{}); count != 2 {
+		t.Errorf("count = %d after failed batch, want 2", count)
+	}
+
+	if err := db.DeleteDuplicateGroups(run.ID); err != nil {
+		t.Fatalf("DeleteDuplicateGroups failed: %v", err)
+	}
+	if count, _ := db.CountDuplicateGroups(run.ID, DuplicateGroupFilter{}); count != 0 {
+		t.Errorf("count = %d after delete, want 0", count)
+	}
+}
+
+func TestListGroupFiles(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/test"}, nil)
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	inode, device := int64(42), int64(7)
+	groups := []*DuplicateGroup{
+		{ScanRunID: run.ID, FileHash: "a", FileSize: 10, FileCount: 2, Status: DuplicateGroupStatusPending,
+			Files: []string{"/a1", "/a2"}},
+		{ScanRunID: run.ID, FileHash: "b", FileSize: 20, FileCount: 2, Status: DuplicateGroupStatusPending,
+			Files: []string{"/b1", "/b2"},
+			FileDetails: []*GroupFile{
+				{Path: "/b1", Size: 20, ModTime: &mtime, Inode: &inode, Device: &device, Role: FileRoleRedundant},
+				{Path: "/b2", Size: 20, Role: FileRoleKeeper},
+			}},
+	}
+	if err := db.CreateDuplicateGroups(groups); err != nil {
+		t.Fatalf("CreateDuplicateGroups failed: %v", err)
+	}
+
+	// Without details, the first file is the keeper
+	files, err := db.ListGroupFiles(groups[0].ID)
+	if err != nil {
+		t.Fatalf("ListGroupFiles failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Path != "/a1" || files[0].Role != FileRoleKeeper || files[1].Role != FileRoleRedundant {
+		t.Fatalf("files = %+v", files)
+	}
+	if files[1].Size != 10 || files[1].ScanRunID != run.ID || files[1].ModTime != nil || files[1].Inode != nil {
+		t.Errorf("files[1] = %+v", files[1])
+	}
+
+	files, err = db.ListGroupFiles(groups[1].ID)
+	if err != nil {
+		t.Fatalf("ListGroupFiles failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Role != FileRoleRedundant || files[1].Role != FileRoleKeeper {
+		t.Fatalf("files = %+v", files)
+	}
+	if files[0].ModTime == nil || !files[0].ModTime.Equal(mtime) {
+		t.Errorf("ModTime = %v, want %v", files[0].ModTime, mtime)
+	}
+	if files[0].Inode == nil || *files[0].Inode != 42 || files[0].Device == nil || *files[0].Device != 7 {
+		t.Errorf("Inode/Device = %v/%v", files[0].Inode, files[0].Device)
+	}
+
+	// Action outcomes are recorded per file
+	if err := db.SetGroupFilesActionStatus([]int64{groups[1].ID}, []string{"/b1"}, 5, FileActionDeleted); err != nil {
+		t.Fatalf("SetGroupFilesActionStatus failed: %v", err)
+	}
+	files, _ = db.ListGroupFiles(groups[1].ID)
+	if files[0].ActionStatus != FileActionDeleted || files[0].ActionID == nil || *files[0].ActionID != 5 {
+		t.Errorf("files[0] = %+v, want deleted by action 5", files[0])
+	}
+	if files[1].ActionStatus != FileActionNone || files[1].ActionID != nil {
+		t.Errorf("files[1] = %+v, want no action", files[1])
+	}
+}
+
+func TestDuplicateGroup_Links(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/test"}, nil)
+	ino1, ino2, dev := int64(1), int64(2), int64(9)
+	g := &DuplicateGroup{ScanRunID: run.ID, FileHash: "h", FileSize: 10, FileCount: 4, WastedBytes: 10,
+		Status: DuplicateGroupStatusPending, Files: []string{"/a", "/b", "/c", "/d"},
+		FileDetails: []*GroupFile{
+			{Path: "/a", Size: 10, Inode: &ino1, Device: &dev},
+			{Path: "/b", Size: 10, Inode: &ino2, Device: &dev},
+			{Path: "/c", Size: 10, Inode: &ino1, Device: &dev},
+			{Path: "/d", Size: 10},
+		}}
+	if _, err := db.CreateDuplicateGroup(g); err != nil {
+		t.Fatalf("CreateDuplicateGroup failed: %v", err)
+	}
+
+	got, err := db.GetDuplicateGroup(g.ID)
+	if err != nil {
+		t.Fatalf("GetDuplicateGroup failed: %v", err)
+	}
+	wantLinks := []string{"9:1", "9:2", "9:1", ""}
+	if !reflect.DeepEqual(got.Links, wantLinks) {
+		t.Errorf("Links = %q, want %q", got.Links, wantLinks)
+	}
+	wantCopies := []FileCopy{{Path: "/a", Links: []string{"/c"}}, {Path: "/b"}, {Path: "/d"}}
+	if copies := got.Copies(); !reflect.DeepEqual(copies, wantCopies) {
+		t.Errorf("Copies() = %+v, want %+v", copies, wantCopies)
+	}
+	if got.LinkedFiles() != 1 {
+		t.Errorf("LinkedFiles() = %d, want 1", got.LinkedFiles())
+	}
+
+	// Files with unknown identities are never collapsed
+	unknown := &DuplicateGroup{Files: []string{"/x", "/y"}, Links: []string{"", ""}}
+	if unknown.LinkedFiles() != 0 {
+		t.Errorf("LinkedFiles() with unknown identities = %d, want 0", unknown.LinkedFiles())
+	}
+}
+
+func TestMigration024_ExcludesLinkedFiles(t *testing.T) {
+	db := testDB(t)
+
+	_, err := db.Exec(`
+		DELETE FROM schema_migrations WHERE version >= 24;
+		INSERT INTO scan_runs (id, paths, status, started_at, completed_at, duplicate_groups, duplicate_files, wasted_bytes)
+		VALUES (1, '["/a"]', 'completed', '2026-01-02 12:00:00', '2026-01-02 12:00:00', 2, 3, 300);
+		INSERT INTO daily_stats (date, job_id, scans_run, groups_found, files_found, bytes_wasted)
+		VALUES (date('2026-01-02 12:00:00', 'localtime'), 0, 1, 2, 3, 300);
+		INSERT INTO duplicate_groups (id, scan_run_id, file_hash, file_size, file_count, wasted_bytes, status)
+		VALUES (1, 1, 'linked', 100, 3, 200, 'pending'), (2, 1, 'unknown', 100, 2, 100, 'pending');
+		INSERT INTO group_files (group_id, scan_run_id, position, path, size, inode, device, role)
+		VALUES (1, 1, 0, '/a/1', 100, 5, 1, 'keeper'), (1, 1, 1, '/a/2', 100, 5, 1, 'redundant'),
+			(1, 1, 2, '/a/3', 100, 6, 1, 'redundant'),
+			(2, 1, 0, '/a/4', 100, NULL, NULL, 'keeper'), (2, 1, 1, '/a/5', 100, NULL, NULL, 'redundant');
+	`)
+	if err != nil {
+		t.Fatalf("failed to set up old data: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	for id, want := range map[int64]int64{1: 100, 2: 100} {
+		g, _ := db.GetDuplicateGroup(id)
+		if g.WastedBytes != want {
+			t.Errorf("group %d WastedBytes = %d, want %d", id, g.WastedBytes, want)
+		}
+	}
+
+	// The run's totals and its day's stats drop by the linked file
+	run, err := db.GetScanRun(1)
+	if err != nil {
+		t.Fatalf("GetScanRun failed: %v", err)
+	}
+	if run.DuplicateFiles != 2 || run.WastedBytes != 200 {
+		t.Errorf("run totals = %d files, %d bytes, want 2 files, 200 bytes", run.DuplicateFiles, run.WastedBytes)
+	}
+	var files, wasted int64
+	if err := db.QueryRow("SELECT files_found, bytes_wasted FROM daily_stats").Scan(&files, &wasted); err != nil {
+		t.Fatalf("failed to read daily stats: %v", err)
+	}
+	if files != 2 || wasted != 200 {
+		t.Errorf("daily stats = %d files, %d bytes, want 2 files, 200 bytes", files, wasted)
+	}
+}
+
+func TestAction_Files(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/test"}, nil)
+	action, err := db.CreateAction(&Action{ScanRunID: run.ID, ActionType: ActionTypeDelete})
+	if err != nil {
+		t.Fatalf("CreateAction failed: %v", err)
+	}
+
+	got, _ := db.GetAction(action.ID)
+	if len(got.Files) != 0 {
+		t.Errorf("Files = %v before completion, want none", got.Files)
+	}
+
+	files := []string{"/z", "/a", "/m"}
+	if err := db.CompleteAction(action.ID, &ActionCompletion{Status: ActionStatusCompleted, Files: files}); err != nil {
+		t.Fatalf("CompleteAction failed: %v", err)
+	}
+	got, _ = db.GetAction(action.ID)
+	if !reflect.DeepEqual(got.Files, files) {
+		t.Errorf("Files = %v, want %v", got.Files, files)
+	}
+}
+
+func TestCompleteAction_MeasuredSavings(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/test"}, nil)
+	measured, freeChange := int64(4096), int64(-1000)
+	action, _ := db.CreateAction(&Action{ScanRunID: run.ID, ActionType: ActionTypeHardlink})
+	err := db.CompleteAction(action.ID, &ActionCompletion{
+		Status:          ActionStatusCompleted,
+		BytesSaved:      10000,
+		BytesMeasured:   &measured,
+		FreeSpaceChange: &freeChange,
+	})
+	if err != nil {
+		t.Fatalf("CompleteAction failed: %v", err)
+	}
+	got, _ := db.GetAction(action.ID)
+	if got.BytesSaved != 10000 || got.BytesMeasured == nil || *got.BytesMeasured != 4096 ||
+		got.FreeSpaceChange == nil || *got.FreeSpaceChange != -1000 {
+		t.Errorf("saved = %d, measured = %v, free change = %v; want 10000, 4096, -1000",
+			got.BytesSaved, got.BytesMeasured, got.FreeSpaceChange)
+	}
+
+	// Unmeasured actions count their estimate
+	unmeasured, _ := db.CreateAction(&Action{ScanRunID: run.ID, ActionType: ActionTypeRemove})
+	db.CompleteAction(unmeasured.ID, &ActionCompletion{Status: ActionStatusCompleted, BytesSaved: 500})
+	if got, _ := db.GetAction(unmeasured.ID); got.BytesMeasured != nil || got.FreeSpaceChange != nil {
+		t.Errorf("unmeasured action has measured = %v, free change = %v", got.BytesMeasured, got.FreeSpaceChange)
+	}
+
+	totalSaved, _, _, err := db.GetDashboardStats()
+	if err != nil {
+		t.Fatalf("GetDashboardStats failed: %v", err)
+	}
+	if totalSaved != 4096+500 {
+		t.Errorf("total saved = %d, want measured plus estimated %d", totalSaved, 4096+500)
+	}
+}
+
+func TestListActionFiles_Results(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/test"}, nil)
+	action, _ := db.CreateAction(&Action{ScanRunID: run.ID, ActionType: ActionTypeHardlink})
+	err := db.CompleteAction(action.ID, &ActionCompletion{
+		Status: ActionStatusCompleted,
+		Files:  []string{"/a", "/b", "/c"},
+		Results: []ActionFile{
+			{Path: "/c", Status: FileActionFailed, Error: "not linked to /a"},
+			{Path: "/b", Status: FileActionDone},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CompleteAction failed: %v", err)
+	}
+
+	files, err := db.ListActionFiles(action.ID)
+	if err != nil {
+		t.Fatalf("ListActionFiles failed: %v", err)
+	}
+	want := []*ActionFile{
+		{Path: "/a"},
+		{Path: "/b", Status: FileActionDone},
+		{Path: "/c", Status: FileActionFailed, Error: "not linked to /a"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("ListActionFiles = %+v, want %+v", files, want)
+	}
+}
+
+func TestMigration017_ConvertsFiles(t *testing.T) {
+	db := testDB(t)
+
+	// Roll back to the JSON files columns
+	_, err := db.Exec(`
+		DROP TABLE group_files;
+		DROP TABLE action_files;
+		ALTER TABLE duplicate_groups ADD COLUMN files TEXT;
+		ALTER TABLE actions ADD COLUMN files TEXT;
+		ALTER TABLE scan_runs DROP COLUMN imported_command;
+		ALTER TABLE scheduled_jobs DROP COLUMN managed;
+		ALTER TABLE scan_runs DROP COLUMN pinned;
+		ALTER TABLE actions DROP COLUMN bytes_measured;
+		ALTER TABLE actions DROP COLUMN free_space_change;
+		DROP TABLE daily_stats;
+		CREATE TABLE daily_stats (date DATE PRIMARY KEY, scans_run INTEGER DEFAULT 0, groups_found INTEGER DEFAULT 0,
+			files_found INTEGER DEFAULT 0, bytes_wasted INTEGER DEFAULT 0, bytes_saved INTEGER DEFAULT 0);
+		DELETE FROM schema_migrations WHERE version >= 17;
+		INSERT INTO scan_runs (id, paths, status, started_at) VALUES (1, '["/test"]', 'completed', CURRENT_TIMESTAMP);
+		INSERT INTO duplicate_groups (id, scan_run_id, file_hash, file_size, file_count, wasted_bytes, status, files)
+		VALUES (1, 1, 'abc', 100, 3, 200, 'pending', '["/c","/a","/b"]');
+		INSERT INTO actions (id, scan_run_id, action_type, status, started_at, files)
+		VALUES (1, 1, 'delete', 'completed', CURRENT_TIMESTAMP, '["/a","/b"]');
+	`)
+	if err != nil {
+		t.Fatalf("failed to restore old schema: %v", err)
+	}
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	group, err := db.GetDuplicateGroup(1)
+	if err != nil {
+		t.Fatalf("GetDuplicateGroup failed: %v", err)
+	}
+	if !reflect.DeepEqual(group.Files, []string{"/c", "/a", "/b"}) {
+		t.Errorf("Files = %v", group.Files)
+	}
+	files, _ := db.ListGroupFiles(1)
+	if len(files) != 3 || files[0].Role != FileRoleKeeper || files[2].Role != FileRoleRedundant || files[2].Size != 100 {
+		t.Errorf("group files = %+v", files)
+	}
+
+	action, err := db.GetAction(1)
+	if err != nil {
+		t.Fatalf("GetAction failed: %v", err)
+	}
+	if !reflect.DeepEqual(action.Files, []string{"/a", "/b"}) {
+		t.Errorf("action Files = %v", action.Files)
+	}
+}
+
+func TestDuplicateGroupFilter(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/data"}, nil)
+	photo, _ := db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: run.ID, FileHash: "a", FileSize: 5000, FileCount: 2, Status: DuplicateGroupStatusPending,
+		Files: []string{"/data/photos/IMG_1.JPG", "/data/backup/IMG_1.JPG"}})
+	doc, _ := db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: run.ID, FileHash: "b", FileSize: 100, FileCount: 3, Status: DuplicateGroupStatusProcessed,
+		Files: []string{"/data/docs/report_v1.pdf", "/data/docs/report%.pdf", "/data/mail/report.pdf"}})
+
+	tests := []struct {
+		name   string
+		filter DuplicateGroupFilter
+		want   []int64
+	}{
+		{"none", DuplicateGroupFilter{}, []int64{photo.ID, doc.ID}},
+		{"status", DuplicateGroupFilter{Status: "processed"}, []int64{doc.ID}},
+		{"substring", DuplicateGroupFilter{Path: "backup"}, []int64{photo.ID}},
+		{"substring is case-insensitive", DuplicateGroupFilter{Path: "img_1"}, []int64{photo.ID}},
+		{"substring escapes wildcards", DuplicateGroupFilter{Path: "t%"}, []int64{doc.ID}},
+		{"underscore is literal", DuplicateGroupFilter{Path: "report_pdf"}, nil},
+		{"relative glob", DuplicateGroupFilter{Path: "docs/*.pdf"}, []int64{doc.ID}},
+		{"absolute glob", DuplicateGroupFilter{Path: "/data/*/IMG_?.JPG"}, []int64{photo.ID}},
+		{"directory", DuplicateGroupFilter{Dir: "/data/mail/"}, []int64{doc.ID}},
+		{"directory is not a prefix match", DuplicateGroupFilter{Dir: "/data/doc"}, nil},
+		{"extension", DuplicateGroupFilter{Ext: ".jpg"}, []int64{photo.ID}},
+		{"same file must match", DuplicateGroupFilter{Dir: "/data/mail", Path: "v1"}, nil},
+		{"size range", DuplicateGroupFilter{MinSize: 1000, MaxSize: 10000}, []int64{photo.ID}},
+		{"file count", DuplicateGroupFilter{MinFiles: 3}, []int64{doc.ID}},
+		{"max file count", DuplicateGroupFilter{MaxFiles: 2}, []int64{photo.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := db.GetDuplicateGroupIDs(run.ID, tt.filter)
+			if err != nil {
+				t.Fatalf("GetDuplicateGroupIDs failed: %v", err)
+			}
+			if len(ids) != len(tt.want) || (len(ids) > 0 && !reflect.DeepEqual(ids, tt.want)) {
+				t.Errorf("ids = %v, want %v", ids, tt.want)
+			}
+
+			count, err := db.CountDuplicateGroups(run.ID, tt.filter)
+			if err != nil || count != len(tt.want) {
+				t.Errorf("CountDuplicateGroups = %d, %v; want %d", count, err, len(tt.want))
+			}
+
+			groups, err := db.ListDuplicateGroupsPaginated(DuplicateGroupQuery{ScanRunID: run.ID, DuplicateGroupFilter: tt.filter})
+			if err != nil || len(groups) != len(tt.want) {
+				t.Errorf("ListDuplicateGroupsPaginated returned %d groups, %v; want %d", len(groups), err, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestListDirectoryPairs(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/data"}, nil)
+	add := func(size int64, status DuplicateGroupStatus, files ...string) *DuplicateGroup {
+		g, err := db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: run.ID, FileHash: files[0], FileSize: size,
+			FileCount: len(files), Status: status, Files: files})
+		if err != nil {
+			t.Fatalf("CreateDuplicateGroup failed: %v", err)
+		}
+		return g
+	}
+	a := add(100, DuplicateGroupStatusPending, "/data/photos/a.jpg", "/data/copy/a.jpg")
+	b := add(200, DuplicateGroupStatusPending, "/data/photos/b.jpg", "/data/copy/b.jpg", "/data/copy/b (1).jpg")
+	add(50, DuplicateGroupStatusPending, "/data/photos/c.jpg", "/data/other/c.jpg")
+	add(1000, DuplicateGroupStatusProcessed, "/data/photos/d.jpg", "/data/done/d.jpg")
+	add(10, DuplicateGroupStatusPending, "/a.txt", "/data/copy/a.txt")
+
+	pairs, err := db.ListDirectoryPairs(run.ID, 10)
+	if err != nil {
+		t.Fatalf("ListDirectoryPairs failed: %v", err)
+	}
+	if len(pairs) != 2 {
+		t.Fatalf("got %d pairs, want 2 (a directory isn't paired with its own subdirectory): %+v", len(pairs), pairs)
+	}
+	want := DirectoryPair{DirA: "/data/copy", DirB: "/data/photos", Groups: 2, FilesA: 3, FilesB: 2, TotalA: 4, TotalB: 3, SharedBytes: 300}
+	if *pairs[0] != want {
+		t.Errorf("pairs[0] = %+v, want %+v", *pairs[0], want)
+	}
+	if pairs[0].CoverageA() != 75 || pairs[0].CoverageB() != 66 {
+		t.Errorf("coverage = %d%%, %d%%; want 75%%, 66%%", pairs[0].CoverageA(), pairs[0].CoverageB())
+	}
+	if pairs[1].DirA != "/data/other" || pairs[1].SharedBytes != 50 {
+		t.Errorf("pairs[1] = %+v", *pairs[1])
+	}
+
+	paths, groupIDs, err := db.ListDirectoryPairFiles(run.ID, "/data/copy", "/data/photos/")
+	if err != nil {
+		t.Fatalf("ListDirectoryPairFiles failed: %v", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/data/copy/a.jpg", "/data/copy/b.jpg", "/data/copy/b (1).jpg"}) {
+		t.Errorf("paths = %v", paths)
+	}
+	if !reflect.DeepEqual(groupIDs, []int64{a.ID, b.ID}) {
+		t.Errorf("groupIDs = %v, want %v", groupIDs, []int64{a.ID, b.ID})
+	}
+	if _, _, err := db.ListDirectoryPairFiles(run.ID, "/data", "/data/photos"); err == nil {
+		t.Error("ListDirectoryPairFiles should refuse overlapping directories")
+	}
+
+	// Deleted files no longer count towards a pair
+	db.SetGroupFilesActionStatus([]int64{a.ID}, []string{"/data/copy/a.jpg"}, 1, FileActionDeleted)
+	pairs, _ = db.ListDirectoryPairs(run.ID, 1)
+	if len(pairs) != 1 || pairs[0].Groups != 1 || pairs[0].SharedBytes != 200 {
+		t.Errorf("after delete, pairs = %+v", pairs)
+	}
+}
+
+func TestListDirectoryPairs_CopiedTrees(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/"}, nil)
+	add := func(size int64, files ...string) {
+		if _, err := db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: run.ID, FileHash: files[0], FileSize: size,
+			FileCount: len(files), Status: DuplicateGroupStatusPending, Files: files}); err != nil {
+			t.Fatalf("CreateDuplicateGroup failed: %v", err)
+		}
+	}
+	add(1000, "/x/photos/2024/p1.jpg", "/y/photos/2024/p1.jpg")
+	add(500, "/x/photos/2023/p2.jpg", "/y/photos/2023/p2.jpg")
+	add(5, "/x/music/song.mp3", "/z/song.mp3")
+
+	pairs, err := db.ListDirectoryPairs(run.ID, 10)
+	if err != nil {
+		t.Fatalf("ListDirectoryPairs failed: %v", err)
+	}
+	var got []string
+	for _, p := range pairs {
+		got = append(got, fmt.Sprintf("%s %s %d%% %d%%", p.DirA, p.DirB, p.CoverageA(), p.CoverageB()))
+	}
+	// The year directories are covered by their parents' pair; /x also holds
+	// music, so /x and /y are only partly copies
+	want := []string{
+		"/x /y 66% 100%",
+		"/x/photos /y/photos 100% 100%",
+		"/x/music /z 100% 100%",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pairs = %q, want %q", got, want)
+	}
+	if pairs[1].Groups != 2 || pairs[1].SharedBytes != 1500 {
+		t.Errorf("photos pair = %+v", *pairs[1])
+	}
+
+	paths, _, err := db.ListDirectoryPairFiles(run.ID, "/y/photos", "/x/photos")
+	if err != nil {
+		t.Fatalf("ListDirectoryPairFiles failed: %v", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/y/photos/2024/p1.jpg", "/y/photos/2023/p2.jpg"}) {
+		t.Errorf("paths = %v, want the files in subdirectories", paths)
+	}
+}
+
+func TestListWasteByDirectory(t *testing.T) {
+	db := testDB(t)
+
+	run, _ := db.CreateScanRun(nil, nil, []string{"/data"}, nil)
+	db.CreateDuplicateGroup(&DuplicateGroup{ScanRunID: run.ID, FileHash: "a", FileSize: 100, FileCount: 2, WastedBytes: 100,
+		Status: DuplicateGroupStatusPending, Files: []string{"/data/photos/a.jpg", "/data/copy/a.jpg"}})
+	b := &DuplicateGroup{ScanRunID: run.ID, FileHash: "b", FileSize: 30, FileCount: 3, WastedBytes: 60,
+		Status: DuplicateGroupStatusPending, Files: []string{"/data/copy/b", "/data/copy/b2", "/b"}}
+	db.CreateDuplicateGroup(b)
+
+	check := func(want []DirectoryWaste) {
+		t.Helper()
+		dirs, err := db.ListWasteByDirectory(run.ID)
+		if err != nil {
+			t.Fatalf("ListWasteByDirectory failed: %v", err)
+		}
+		if len(dirs) != len(want) {
+			t.Fatalf("got %d directories, want %d", len(dirs), len(want))
+		}
+		for i := range want {
+			if *dirs[i] != want[i] {
+				t.Errorf("dirs[%d] = %+v, want %+v", i, *dirs[i], want[i])
+			}
+		}
+	}
+	check([]DirectoryWaste{
+		{Dir: "/", Files: 1, WastedBytes: 20},
+		{Dir: "/data/copy", Files: 3, WastedBytes: 90},
+		{Dir: "/data/photos", Files: 1, WastedBytes: 50},
+	})
+
+	// Once a group is processed its space is no longer waste
+	if err := db.UpdateDuplicateGroupStatus([]int64{b.ID}, DuplicateGroupStatusProcessed); err != nil {
+		t.Fatalf("UpdateDuplicateGroupStatus failed: %v", err)
+	}
+	check([]DirectoryWaste{
+		{Dir: "/data/copy", Files: 1, WastedBytes: 50},
+		{Dir: "/data/photos", Files: 1, WastedBytes: 50},
+	})
+}
+
+// ============================================================================
+// Backup Tests
+// ============================================================================
+
+func TestBackupRestore(t *testing.T) {
+	db := testDB(t)
+
+	job, err := db.CreateScheduledJob(&ScheduledJob{Name: "Before", Paths: []string{"/a"}, CronExpression: "0 3 * * *", Action: "scan"})
+	if err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+	if err := db.SetSetting("retention_days", "45"); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := db.Backup(path); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if err := db.Backup(path); err == nil {
+		t.Error("Backup over an existing file should fail")
+	}
+	if version, err := CheckBackup(path); err != nil || version != LatestSchemaVersion() {
+		t.Errorf("CheckBackup = %d, %v; want %d", version, err, LatestSchemaVersion())
+	}
+
+	// Change everything after the backup
+	if err := db.DeleteScheduledJob(job.ID); err != nil {
+		t.Fatalf("DeleteScheduledJob failed: %v", err)
+	}
+	if _, err := db.CreateScheduledJob(&ScheduledJob{Name: "After", Paths: []string{"/b"}, CronExpression: "0 4 * * *", Action: "scan"}); err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+	if err := db.SetSetting("retention_days", "10"); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+
+	if err := db.Restore(t.Context(), path); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	jobs, err := db.ListScheduledJobs()
+	if err != nil {
+		t.Fatalf("ListScheduledJobs failed: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != job.ID || jobs[0].Name != "Before" {
+		t.Errorf("jobs after restore = %+v, want only the job from the backup", jobs)
+	}
+	if val, _ := db.GetSetting("retention_days"); val != "45" {
+		t.Errorf("retention_days after restore = %q, want 45", val)
+	}
+}
+
+func TestRestore_MigratesOlderBackup(t *testing.T) {
+	db := testDB(t)
+
+	// A backup from before migration 18
+	old := testDB(t)
+	if _, err := old.Exec(`
+		ALTER TABLE scan_runs DROP COLUMN imported_command;
+		ALTER TABLE scheduled_jobs DROP COLUMN managed;
+		ALTER TABLE scan_runs DROP COLUMN pinned;
+		ALTER TABLE action_files DROP COLUMN status;
+		ALTER TABLE action_files DROP COLUMN error;
+		ALTER TABLE actions DROP COLUMN bytes_measured;
+		ALTER TABLE actions DROP COLUMN free_space_change;
+		DROP TABLE daily_stats;
+		CREATE TABLE daily_stats (date DATE PRIMARY KEY, scans_run INTEGER DEFAULT 0, groups_found INTEGER DEFAULT 0,
+			files_found INTEGER DEFAULT 0, bytes_wasted INTEGER DEFAULT 0, bytes_saved INTEGER DEFAULT 0);
+		DELETE FROM schema_migrations WHERE version >= 18;
+		INSERT INTO scan_runs (id, paths, status, started_at) VALUES (7, '["/old"]', 'completed', CURRENT_TIMESTAMP);
+	`); err != nil {
+		t.Fatalf("failed to create old schema: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "old.db")
+	if err := old.Backup(path); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	if version, err := CheckBackup(path); err != nil || version != 17 {
+		t.Errorf("CheckBackup = %d, %v; want 17", version, err)
+	}
+	if err := db.Restore(t.Context(), path); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	run, err := db.GetScanRun(7)
+	if err != nil {
+		t.Fatalf("GetScanRun failed: %v", err)
+	}
+	if run.Paths[0] != "/old" || run.IsImported() {
+		t.Errorf("restored run = %+v, want the run from the backup", run)
+	}
+
+	// The backup file itself isn't migrated
+	if version, _ := CheckBackup(path); version != 17 {
+		t.Errorf("backup schema version after restore = %d, want 17", version)
+	}
+}
+
+func TestCheckBackup_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	notDB := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notDB, []byte("not a database, just some text that is long enough"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckBackup(notDB); err == nil {
+		t.Error("CheckBackup should reject a file that isn't a database")
+	}
+
+	if _, err := CheckBackup(filepath.Join(dir, "missing.db")); err == nil {
+		t.Error("CheckBackup should reject a missing file")
+	}
+
+	// A database from a newer version of kuron
+	newer := testDB(t)
+	if _, err := newer.Exec("INSERT INTO schema_migrations (version) VALUES (?)", LatestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	newerPath := filepath.Join(dir, "newer.db")
+	if err := newer.Backup(newerPath); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if _, err := CheckBackup(newerPath); err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Errorf("CheckBackup(newer) error = %v, want a newer version error", err)
+	}
+	if err := testDB(t).Restore(t.Context(), newerPath); err == nil {
+		t.Error("Restore should refuse a backup from a newer version")
+	}
+}
@@ -0,0 +1,115 @@
+package fclones
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// groupValueFlags are the fclones group options that take a value, so the
+// value isn't mistaken for a path
+var groupValueFlags = map[string]bool{
+	"-s": true, "--min": true, "--max": true,
+	"-p": true, "--path": true, "-e": true, "--exclude": true,
+	"-n": true, "--name": true, "-d": true, "--depth": true,
+	"--rf-over": true, "--rf-under": true, "--transform": true,
+	"-f": true, "--format": true, "-o": true, "--output": true,
+	"-t": true, "--threads": true, "--hash-fn": true, "--base-dir": true,
+	"--max-prefix-size": true, "--max-suffix-size": true,
+}
+
+// ParseGroupCommand recovers the scan options from the command line recorded
+// in a report's header, such as ["fclones", "group", "--min", "1M", "/data"].
+// Relative paths are resolved against baseDir. Options kuron doesn't record
+// are ignored.
+func ParseGroupCommand(command []string, baseDir string) ScanOptions {
+	var opts ScanOptions
+
+	// Skip the program name and any global options before the subcommand
+	args := command
+	for i, arg := range command {
+		if arg == "group" {
+			args = command[i+1:]
+			break
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			for _, p := range args[i+1:] {
+				opts.Paths = append(opts.Paths, resolvePath(p, baseDir))
+			}
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			opts.Paths = append(opts.Paths, resolvePath(arg, baseDir))
+			continue
+		}
+
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if !hasValue && groupValueFlags[flag] && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+
+		switch flag {
+		case "-s", "--min":
+			opts.MinSize = parseBytes(value)
+		case "--max":
+			size := parseBytes(value)
+			opts.MaxSize = &size
+		case "-p", "--path":
+			opts.IncludePatterns = append(opts.IncludePatterns, value)
+		case "-e", "--exclude":
+			opts.ExcludePatterns = append(opts.ExcludePatterns, value)
+		case "-n", "--name":
+			opts.NamePatterns = append(opts.NamePatterns, value)
+		case "-d", "--depth":
+			if depth, err := strconv.Atoi(value); err == nil {
+				opts.MaxDepth = &depth
+			}
+		case "--rf-over":
+			opts.RFOver, _ = strconv.Atoi(value)
+		case "--rf-under":
+			opts.RFUnder, _ = strconv.Atoi(value)
+		case "--transform":
+			opts.Transform = value
+		case "--hash-fn":
+			opts.HashFunction = value
+		case "--hidden", "-.":
+			opts.IncludeHidden = true
+		case "--follow-links", "-L":
+			opts.FollowLinks = true
+		case "--one-fs":
+			opts.OneFileSystem = true
+		case "--no-ignore", "-A":
+			opts.NoIgnore = true
+		case "--ignore-case", "-i":
+			opts.IgnoreCase = true
+		case "--match-name":
+			opts.MatchName = true
+		case "-I", "--isolate":
+			opts.Isolate = true
+		case "-H", "--match-links":
+			opts.MatchLinks = true
+		}
+	}
+
+	return opts
+}
+
+// resolvePath makes a path from a report absolute, relative to baseDir
+func resolvePath(path, baseDir string) string {
+	if filepath.IsAbs(path) || baseDir == "" {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// ResolvePath makes a file path listed in a report absolute. fclones lists
+// files as they were reached, so they're relative to the report's base
+// directory when the scanned paths were.
+func (h *Header) ResolvePath(path string) string {
+	return resolvePath(path, h.BaseDir)
+}
@@ -0,0 +1,84 @@
+package fclones
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// DecodeGroups reads fclones group JSON output from r, calling onGroup for
+// each group as it's decoded so the full group list is never held in memory.
+// fclones writes the header before the groups, so the header's stats are
+// known by the time onGroup is first called if onHeader is set. It returns the
+// header; errors returned by onHeader or onGroup are returned unchanged.
+func DecodeGroups(r io.Reader, onHeader func(*Header) error, onGroup func(Group) error) (*Header, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	var header Header
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case "header":
+			if err := dec.Decode(&header); err != nil {
+				return nil, fmt.Errorf("invalid header: %w", err)
+			}
+			if onHeader != nil {
+				if err := onHeader(&header); err != nil {
+					return nil, err
+				}
+			}
+		case "groups":
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			if tok == nil {
+				continue // "groups": null
+			}
+			if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				return nil, fmt.Errorf("expected groups array, got %v", tok)
+			}
+			for dec.More() {
+				var g Group
+				if err := dec.Decode(&g); err != nil {
+					return nil, fmt.Errorf("invalid group: %w", err)
+				}
+				if err := onGroup(g); err != nil {
+					return nil, err
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return nil, err
+			}
+		default:
+			// Skip fields we don't use
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// expectDelim reads the next JSON token and checks it's the given delimiter
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
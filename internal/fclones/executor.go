@@ -2,7 +2,6 @@ package fclones
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -61,9 +60,119 @@ func (e *Executor) Version(ctx context.Context) (string, error) {
 	return version, nil
 }
 
-// Group runs fclones group and returns duplicate groups
+// Group runs fclones group and returns duplicate groups. If opts.OnGroup is
+// set, groups are streamed to it as fclones writes them instead of being
+// collected in the returned output, so memory use doesn't grow with the
+// number of groups.
 func (e *Executor) Group(ctx context.Context, opts ScanOptions, progressChan chan<- Progress) (*GroupOutput, error) {
-	args := []string{"--progress=true", "group", "--format", "json"}
+	// Stopped early if a group handler fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	name, args := priorityCommand(e.binaryPath, groupArgs(opts), opts.Nice, opts.IOClass)
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	// Get stdout for JSON output
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+
+	// Get stderr for progress output
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start fclones: %w", err)
+	}
+	if opts.OnStart != nil {
+		opts.OnStart(cmd.Process)
+	}
+
+	// Read stderr (progress) in a goroutine
+	var progress Progress
+	var lastSendTime time.Time
+	var errorLines []string
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errorLines = e.readProgress(stderr, &progress, progressChan, &lastSendTime)
+	}()
+
+	// Decode stdout (JSON output) as it arrives
+	var result GroupOutput
+	var handlerErr error
+	onGroup := func(g Group) error {
+		result.Groups = append(result.Groups, g)
+		return nil
+	}
+	if opts.OnGroup != nil {
+		onGroup = func(g Group) error {
+			handlerErr = opts.OnGroup(g)
+			return handlerErr
+		}
+	}
+	onHeader := func(h *Header) error {
+		if opts.OnHeader != nil {
+			handlerErr = opts.OnHeader(h)
+		}
+		return handlerErr
+	}
+	header, decodeErr := DecodeGroups(stdout, onHeader, onGroup)
+	if handlerErr != nil {
+		cancel()
+	}
+	// Drain anything left so fclones isn't blocked writing
+	io.Copy(io.Discard, stdout)
+
+	// Wait for stderr reading to complete
+	wg.Wait()
+	waitErr := cmd.Wait()
+
+	if handlerErr != nil {
+		return nil, handlerErr
+	}
+
+	// Check for context cancellation
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// Check the command finished successfully
+	if waitErr != nil {
+		// Include any error messages from stderr
+		if len(errorLines) > 0 {
+			return nil, fmt.Errorf("fclones failed: %s", strings.Join(errorLines, "\n"))
+		}
+		return nil, fmt.Errorf("fclones exited with error: %w", waitErr)
+	}
+
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to parse fclones output: %w", decodeErr)
+	}
+
+	result.Header = *header
+	return &result, nil
+}
+
+// groupArgs builds the fclones group command line for a scan
+func groupArgs(opts ScanOptions) []string {
+	return append([]string{"--progress=true", "group", "--format", "json"}, groupOptions(opts)...)
+}
+
+// GroupCommand returns the fclones group command line of a scan, without the
+// options kuron adds to read its output
+func GroupCommand(opts ScanOptions) []string {
+	return append([]string{"fclones", "group"}, groupOptions(opts)...)
+}
+
+// groupOptions builds the options and paths of an fclones group command line
+func groupOptions(opts ScanOptions) []string {
+	var args []string
 
 	// Add size filters
 	if opts.MinSize > 0 {
@@ -108,72 +217,41 @@ func (e *Executor) Group(ctx context.Context, opts ScanOptions, progressChan cha
 		args = append(args, "--depth", strconv.Itoa(*opts.MaxDepth))
 	}
 
-	// Hash caching (fclones uses $HOME/.cache/fclones on Linux)
-	if opts.UseCache {
-		args = append(args, "--cache")
+	// Matching modes
+	for _, pattern := range opts.NamePatterns {
+		args = append(args, "--name", pattern)
 	}
-
-	// Add paths
-	args = append(args, opts.Paths...)
-
-	cmd := exec.CommandContext(ctx, e.binaryPath, args...)
-
-	// Get stdout for JSON output
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	if opts.MatchName {
+		args = append(args, "--match-name")
 	}
-
-	// Get stderr for progress output
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	if opts.Isolate {
+		args = append(args, "--isolate")
 	}
-
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start fclones: %w", err)
+	if opts.MatchLinks {
+		args = append(args, "--match-links")
 	}
-
-	// Read stderr (progress) in a goroutine
-	var progress Progress
-	var lastSendTime time.Time
-	var errorLines []string
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		errorLines = e.readProgress(stderr, &progress, progressChan, &lastSendTime)
-	}()
-
-	// Read stdout (JSON output)
-	var jsonBuf bytes.Buffer
-	io.Copy(&jsonBuf, stdout)
-
-	// Wait for stderr reading to complete
-	wg.Wait()
-
-	// Check for context cancellation
-	if ctx.Err() != nil {
-		return nil, ctx.Err()
+	if opts.RFOver > 0 {
+		args = append(args, "--rf-over", strconv.Itoa(opts.RFOver))
+	}
+	if opts.RFUnder > 0 {
+		args = append(args, "--rf-under", strconv.Itoa(opts.RFUnder))
+	}
+	if opts.Transform != "" {
+		args = append(args, "--transform", opts.Transform)
 	}
 
-	// Wait for command to finish
-	if err := cmd.Wait(); err != nil {
-		// Include any error messages from stderr
-		if len(errorLines) > 0 {
-			return nil, fmt.Errorf("fclones failed: %s", strings.Join(errorLines, "\n"))
-		}
-		return nil, fmt.Errorf("fclones exited with error: %w", err)
+	// Hash caching (fclones uses $HOME/.cache/fclones on Linux)
+	if opts.UseCache {
+		args = append(args, "--cache")
 	}
 
-	// Parse JSON output
-	var result GroupOutput
-	if err := json.Unmarshal(jsonBuf.Bytes(), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse fclones output: %w (got: %s)", err, jsonBuf.String()[:min(200, jsonBuf.Len())])
+	// Thread count
+	if opts.Threads > 0 {
+		args = append(args, "--threads", strconv.Itoa(opts.Threads))
 	}
 
-	return &result, nil
+	// Add paths
+	return append(args, opts.Paths...)
 }
 
 // readProgress reads progress output from fclones stderr and sends updates.
@@ -284,6 +362,41 @@ func (e *Executor) Remove(ctx context.Context, input string, opts RemoveOptions)
 	return string(output), nil
 }
 
+// priorityCommand wraps a command in nice and ionice so it starts with the
+// given CPU and I/O priority. Wrapping (rather than adjusting the process
+// after it starts) ensures every thread fclones spawns inherits the priority.
+// Tools that aren't installed are skipped with a warning.
+func priorityCommand(name string, args []string, nice int, ioClass string) (string, []string) {
+	var prefix []string
+
+	switch ioClass {
+	case "best-effort", "idle":
+		if path, err := exec.LookPath("ionice"); err == nil {
+			prefix = append(prefix, path, "-c")
+			if ioClass == "idle" {
+				prefix = append(prefix, "3")
+			} else {
+				prefix = append(prefix, "2", "-n", "7")
+			}
+		} else {
+			log.Printf("fclones: ionice not found, ignoring I/O class %q", ioClass)
+		}
+	}
+
+	if nice != 0 {
+		if path, err := exec.LookPath("nice"); err == nil {
+			prefix = append(prefix, path, "-n", strconv.Itoa(nice))
+		} else {
+			log.Printf("fclones: nice not found, ignoring niceness %d", nice)
+		}
+	}
+
+	if len(prefix) == 0 {
+		return name, args
+	}
+	return prefix[0], append(append(prefix[1:], name), args...)
+}
+
 // GroupToInput converts groups to JSON format for link/dedupe commands
 func (e *Executor) GroupToInput(groups []Group) string {
 	// Filter out groups with less than 2 files and calculate stats
@@ -1,7 +1,16 @@
 package fclones
 
 import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseBytes(t *testing.T) {
@@ -221,3 +230,323 @@ func TestParseBytesRealWorldExamples(t *testing.T) {
 		})
 	}
 }
+
+func TestPriorityCommand(t *testing.T) {
+	// No limits leaves the command unchanged
+	name, args := priorityCommand("fclones", []string{"group", "/a"}, 0, "")
+	if name != "fclones" || strings.Join(args, " ") != "group /a" {
+		t.Errorf("got %s %v, want fclones [group /a]", name, args)
+	}
+
+	nicePath, err := exec.LookPath("nice")
+	if err != nil {
+		t.Skip("nice not installed")
+	}
+	name, args = priorityCommand("fclones", []string{"group", "/a"}, 10, "")
+	if name != nicePath || strings.Join(args, " ") != "-n 10 fclones group /a" {
+		t.Errorf("got %s %v, want %s [-n 10 fclones group /a]", name, args, nicePath)
+	}
+
+	ionicePath, err := exec.LookPath("ionice")
+	if err != nil {
+		t.Skip("ionice not installed")
+	}
+	name, args = priorityCommand("fclones", []string{"group"}, 5, "idle")
+	want := "-c 3 " + nicePath + " -n 5 fclones group"
+	if name != ionicePath || strings.Join(args, " ") != want {
+		t.Errorf("got %s %v, want %s [%s]", name, args, ionicePath, want)
+	}
+	_, args = priorityCommand("fclones", []string{"group"}, 0, "best-effort")
+	if strings.Join(args, " ") != "-c 2 -n 7 fclones group" {
+		t.Errorf("got %v, want [-c 2 -n 7 fclones group]", args)
+	}
+}
+
+func TestGroupArgsMatchingModes(t *testing.T) {
+	args := strings.Join(groupArgs(ScanOptions{
+		Paths:        []string{"/a", "/b"},
+		NamePatterns: []string{"*.jpg", "*.png"},
+		MatchName:    true,
+		Isolate:      true,
+		MatchLinks:   true,
+		RFUnder:      3,
+	}), " ")
+	for _, want := range []string{"--name *.jpg --name *.png", "--match-name", "--isolate", "--match-links", "--rf-under 3"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q missing %q", args, want)
+		}
+	}
+	if strings.Contains(args, "--rf-over") {
+		t.Errorf("args %q should not set --rf-over when unset", args)
+	}
+	if !strings.HasSuffix(args, " /a /b") {
+		t.Errorf("args %q should end with the paths", args)
+	}
+
+	args = strings.Join(groupArgs(ScanOptions{Paths: []string{"/a"}, RFOver: 2}), " ")
+	if !strings.Contains(args, "--rf-over 2") {
+		t.Errorf("args %q missing --rf-over 2", args)
+	}
+}
+
+func TestGroupArgsTransform(t *testing.T) {
+	args := groupArgs(ScanOptions{Paths: []string{"/a"}, Transform: "exiftool -all= -o - $IN"})
+	joined := strings.Join(args, "\x00")
+	if !strings.Contains(joined, "--transform\x00exiftool -all= -o - $IN") {
+		t.Errorf("args %q should pass the transform command as a single argument", args)
+	}
+
+	args = groupArgs(ScanOptions{Paths: []string{"/a"}})
+	for _, arg := range args {
+		if arg == "--transform" {
+			t.Errorf("args %q should not set --transform when unset", args)
+		}
+	}
+}
+
+func TestTransformPresets(t *testing.T) {
+	for _, preset := range TransformPresets {
+		cmd, ok := TransformPresetCommand(preset.Name)
+		if !ok || cmd != preset.Command {
+			t.Errorf("TransformPresetCommand(%q) = %q, %v", preset.Name, cmd, ok)
+		}
+		if !strings.Contains(preset.Command, "$IN") {
+			t.Errorf("preset %q command %q doesn't reference $IN", preset.Name, preset.Command)
+		}
+		if got := TransformPresetName(preset.Command); got != preset.Name {
+			t.Errorf("TransformPresetName(%q) = %q, want %q", preset.Command, got, preset.Name)
+		}
+	}
+
+	if _, ok := TransformPresetCommand("nope"); ok {
+		t.Error("unknown preset should not resolve")
+	}
+	if got := TransformPresetName("cat $IN"); got != "" {
+		t.Errorf("TransformPresetName(custom) = %q, want empty", got)
+	}
+}
+
+func TestDecodeGroups(t *testing.T) {
+	input := `{
+		"header": {"version": "0.35.0", "stats": {"group_count": 2, "redundant_file_count": 3}},
+		"extra": {"ignored": [1, 2]},
+		"groups": [
+			{"file_len": 10, "file_hash": "a", "files": ["/1", "/2"]},
+			{"file_len": 20, "file_hash": "b", "files": ["/3", "/4", "/5"]}
+		]
+	}`
+
+	var headerGroups int64 = -1
+	var got []Group
+	header, err := DecodeGroups(strings.NewReader(input), func(h *Header) error {
+		if len(got) > 0 {
+			t.Error("header should be reported before any group")
+		}
+		headerGroups = h.Stats.GroupCount
+		return nil
+	}, func(g Group) error {
+		got = append(got, g)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DecodeGroups failed: %v", err)
+	}
+	if header.Version != "0.35.0" || header.Stats.RedundantFileCount != 3 || headerGroups != 2 {
+		t.Errorf("header = %+v", header)
+	}
+	if len(got) != 2 || got[1].FileHash != "b" || len(got[1].Files) != 3 {
+		t.Errorf("groups = %+v", got)
+	}
+
+	// Handler errors stop decoding and are returned unchanged
+	stop := errors.New("stop")
+	calls := 0
+	_, err = DecodeGroups(strings.NewReader(input), nil, func(g Group) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("DecodeGroups = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+
+	if _, err := DecodeGroups(strings.NewReader(`{"header": {}, "groups": null}`), nil, func(Group) error { return nil }); err != nil {
+		t.Errorf("null groups should decode: %v", err)
+	}
+	if _, err := DecodeGroups(strings.NewReader(`{"header": {}, "groups": [{"file_len": 1,`), nil, func(Group) error { return nil }); err == nil {
+		t.Error("truncated output should fail to decode")
+	}
+}
+
+func TestGroupStreamsOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script in place of fclones")
+	}
+
+	script := filepath.Join(t.TempDir(), "fclones")
+	output := `{"header": {"stats": {"group_count": 2}}, "groups": [` +
+		`{"file_len": 10, "file_hash": "a", "files": ["/1", "/2"]},` +
+		`{"file_len": 20, "file_hash": "b", "files": ["/3", "/4"]}]}`
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho '"+output+"'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	e := NewExecutor()
+	e.SetBinaryPath(script)
+
+	// Without a handler, groups are collected
+	result, err := e.Group(context.Background(), ScanOptions{Paths: []string{"/"}}, nil)
+	if err != nil {
+		t.Fatalf("Group failed: %v", err)
+	}
+	if len(result.Groups) != 2 || result.Header.Stats.GroupCount != 2 {
+		t.Errorf("result = %+v", result)
+	}
+
+	// With a handler, groups are streamed and not collected
+	var streamed []string
+	result, err = e.Group(context.Background(), ScanOptions{
+		Paths: []string{"/"},
+		OnGroup: func(g Group) error {
+			streamed = append(streamed, g.FileHash)
+			return nil
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Group failed: %v", err)
+	}
+	if strings.Join(streamed, ",") != "a,b" || len(result.Groups) != 0 || result.Header.Stats.GroupCount != 2 {
+		t.Errorf("streamed %v, result %+v", streamed, result)
+	}
+
+	// A handler error fails the scan
+	stop := errors.New("disk full")
+	_, err = e.Group(context.Background(), ScanOptions{
+		Paths:   []string{"/"},
+		OnGroup: func(Group) error { return stop },
+	}, nil)
+	if err != stop {
+		t.Errorf("Group error = %v, want %v", err, stop)
+	}
+}
+
+func TestWriteTextReport(t *testing.T) {
+	var buf strings.Builder
+	header := ReportHeader{
+		Version:   "0.34.0",
+		Timestamp: time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC),
+		Command:   QuoteCommand(GroupCommand(ScanOptions{Paths: []string{"/a", "/b c"}, MinSize: 1000})),
+		BaseDir:   "/",
+	}
+	err := WriteTextReport(&buf, header, []Group{
+		{FileLen: 1500, FileHash: "abc", Files: []string{"/a/1", "/b/1"}},
+		{FileLen: 10, FileHash: "def", Files: []string{"/a/2", "/b/2", "/c/2"}},
+	})
+	if err != nil {
+		t.Fatalf("WriteTextReport: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"# Report by fclones 0.34.0\n# Timestamp: 2026-10-18 10:00:00.000 +0000\n",
+		"# Command: fclones group -s 1000 /a '/b c'\n# Base dir: /\n",
+		"# Total: 3030 B (3.0 KB) in 5 files in 2 groups\n",
+		"# Redundant: 1520 B (1.5 KB) in 3 files\n",
+		"abc, 1500 B (1.5 KB) * 2:\n    /a/1\n    /b/1\n",
+		"def, 10 B (10 B) * 3:\n    /a/2\n    /b/2\n    /c/2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGroupCommandRoundTrip(t *testing.T) {
+	maxSize := int64(5000)
+	opts := ScanOptions{
+		Paths:           []string{"/a", "/b c"},
+		MinSize:         1000,
+		MaxSize:         &maxSize,
+		ExcludePatterns: []string{"*.tmp"},
+		Isolate:         true,
+	}
+	command := GroupCommand(opts)
+	if got := QuoteCommand(command); got != "fclones group -s 1000 --max 5000 --exclude '*.tmp' --isolate /a '/b c'" {
+		t.Errorf("QuoteCommand() = %q", got)
+	}
+	if got := ParseGroupCommand(command, "/"); !reflect.DeepEqual(got, opts) {
+		t.Errorf("ParseGroupCommand(GroupCommand()) = %+v, want %+v", got, opts)
+	}
+	if got := QuoteCommand([]string{"it's", ""}); got != `'it'\''s' ''` {
+		t.Errorf("QuoteCommand() = %q", got)
+	}
+}
+
+func TestParseGroupCommand(t *testing.T) {
+	maxSize := int64(5000)
+	depth := 3
+	want := ScanOptions{
+		Paths:           []string{"/a", "/b c"},
+		MinSize:         1000,
+		MaxSize:         &maxSize,
+		IncludePatterns: []string{"/a/**"},
+		ExcludePatterns: []string{"*.tmp"},
+		IncludeHidden:   true,
+		FollowLinks:     true,
+		OneFileSystem:   true,
+		NoIgnore:        true,
+		IgnoreCase:      true,
+		MaxDepth:        &depth,
+		NamePatterns:    []string{"*.jpg"},
+		MatchName:       true,
+		Isolate:         true,
+		MatchLinks:      true,
+		RFUnder:         3,
+		Transform:       "exiftool -q -all= -o - $IN",
+	}
+
+	// Options kuron passes round-trip through the recorded command line
+	command := append([]string{"fclones"}, groupArgs(ScanOptions{
+		Paths:           want.Paths,
+		MinSize:         want.MinSize,
+		MaxSize:         want.MaxSize,
+		IncludePatterns: want.IncludePatterns,
+		ExcludePatterns: want.ExcludePatterns,
+		IncludeHidden:   true,
+		FollowLinks:     true,
+		OneFileSystem:   true,
+		NoIgnore:        true,
+		IgnoreCase:      true,
+		MaxDepth:        want.MaxDepth,
+		NamePatterns:    want.NamePatterns,
+		MatchName:       true,
+		Isolate:         true,
+		MatchLinks:      true,
+		RFUnder:         3,
+		Transform:       want.Transform,
+		UseCache:        true,
+		Threads:         4,
+	})...)
+	if got := ParseGroupCommand(command, "/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseGroupCommand(%q) = %+v, want %+v", command, got, want)
+	}
+
+	// Short and --flag=value forms, with relative paths resolved against the base dir
+	got := ParseGroupCommand([]string{"fclones", "group", "-s=1M", "-o", "out.json", "photos", "-f", "json", "/mnt/b"}, "/home/me")
+	if got.MinSize != 1_000_000 {
+		t.Errorf("MinSize = %d, want 1000000", got.MinSize)
+	}
+	if wantPaths := []string{"/home/me/photos", "/mnt/b"}; !reflect.DeepEqual(got.Paths, wantPaths) {
+		t.Errorf("Paths = %q, want %q", got.Paths, wantPaths)
+	}
+}
+
+func TestErrorLines(t *testing.T) {
+	output := `ln /data/a /data/b
+[2026-10-18 10:00:00.000] fclones: error: Failed to link /data/a -> /data/c: Permission denied
+[2026-10-18 10:00:00.000] fclones:  warn: Skipping /data/d: file was modified
+[2026-10-18 10:00:00.000] fclones:  info: Processed 1 files
+`
+	got := ErrorLines(output)
+	if len(got) != 2 || !strings.Contains(got[0], "/data/c") || !strings.Contains(got[1], "/data/d") {
+		t.Errorf("ErrorLines() = %q, want the error and warning", got)
+	}
+}
@@ -0,0 +1,17 @@
+package fclones
+
+import (
+	"strings"
+)
+
+// ErrorLines returns the error and warning messages fclones logged in the
+// output of an action
+func ErrorLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "error:") || strings.Contains(line, "warn:") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,76 @@
+package fclones
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ReportHeader describes where a text report's groups came from
+type ReportHeader struct {
+	Version   string    // fclones version
+	Timestamp time.Time // When the groups were found
+	Command   string    // fclones group command line that found them
+	BaseDir   string    // Directory relative paths in the command are resolved against
+}
+
+// WriteTextReport writes groups in the default text report format of
+// fclones group, which fclones link, dedupe and remove also accept as input.
+// fclones needs every line of the header to read the report.
+func WriteTextReport(w io.Writer, header ReportHeader, groups []Group) error {
+	var totalFiles, totalSize, redundantFiles, redundantSize int64
+	for _, g := range groups {
+		totalFiles += int64(len(g.Files))
+		totalSize += g.FileLen * int64(len(g.Files))
+		if len(g.Files) > 1 {
+			redundantFiles += int64(len(g.Files) - 1)
+			redundantSize += g.FileLen * int64(len(g.Files)-1)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Report by fclones %s\n", header.Version)
+	fmt.Fprintf(bw, "# Timestamp: %s\n", header.Timestamp.Format("2006-01-02 15:04:05.000 -0700"))
+	fmt.Fprintf(bw, "# Command: %s\n", header.Command)
+	fmt.Fprintf(bw, "# Base dir: %s\n", header.BaseDir)
+	fmt.Fprintf(bw, "# Total: %d B (%s) in %d files in %d groups\n", totalSize, HumanSize(totalSize), totalFiles, len(groups))
+	fmt.Fprintf(bw, "# Redundant: %d B (%s) in %d files\n", redundantSize, HumanSize(redundantSize), redundantFiles)
+	fmt.Fprintf(bw, "# Missing: 0 B (0 B) in 0 files\n")
+	for _, g := range groups {
+		fmt.Fprintf(bw, "%s, %d B (%s) * %d:\n", g.FileHash, g.FileLen, HumanSize(g.FileLen), len(g.Files))
+		for _, f := range g.Files {
+			fmt.Fprintf(bw, "    %s\n", f)
+		}
+	}
+	return bw.Flush()
+}
+
+// QuoteCommand joins a command line, quoting arguments the way a shell
+// would need them
+func QuoteCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;#~!") {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// HumanSize formats bytes with decimal units the way fclones reports do
+func HumanSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
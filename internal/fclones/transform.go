@@ -0,0 +1,50 @@
+package fclones
+
+// TransformPreset is a ready-made content transform for a common media type.
+// fclones replaces $IN with the path of each file and hashes the command's
+// standard output instead of the file itself.
+type TransformPreset struct {
+	Name    string // Stable identifier used in forms
+	Label   string // Human-readable description
+	Command string // Command passed to --transform
+}
+
+// TransformPresets are the built-in content transforms, in display order
+var TransformPresets = []TransformPreset{
+	{
+		Name:    "images",
+		Label:   "Images: ignore metadata (exiftool)",
+		Command: "exiftool -q -all= -o - $IN",
+	},
+	{
+		Name:    "audio",
+		Label:   "Audio: ignore tags (ffmpeg)",
+		Command: "ffmpeg -v error -i $IN -map 0:a -c copy -map_metadata -1 -fflags +bitexact -f matroska -",
+	},
+	{
+		Name:    "video",
+		Label:   "Video: ignore metadata (ffmpeg)",
+		Command: "ffmpeg -v error -i $IN -map 0:v -map 0:a? -c copy -map_metadata -1 -fflags +bitexact -f matroska -",
+	},
+}
+
+// TransformPresetCommand returns the command for the named preset
+func TransformPresetCommand(name string) (string, bool) {
+	for _, p := range TransformPresets {
+		if p.Name == name {
+			return p.Command, true
+		}
+	}
+	return "", false
+}
+
+// TransformPresetName returns the name of the preset with the given command,
+// or "" if the command isn't a preset
+func TransformPresetName(command string) string {
+	for _, p := range TransformPresets {
+		if p.Command == command {
+			return p.Name
+		}
+	}
+	return ""
+}
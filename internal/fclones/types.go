@@ -1,6 +1,9 @@
 package fclones
 
-// GroupOutput represents the JSON output from fclones group command
+import "os"
+
+// GroupOutput represents the JSON output from fclones group command. Groups
+// is left empty when they're streamed to ScanOptions.OnGroup.
 type GroupOutput struct {
 	Header Header  `json:"header"`
 	Groups []Group `json:"groups"`
@@ -80,8 +83,32 @@ type ScanOptions struct {
 	IgnoreCase    bool // Case-insensitive pattern matching (--ignore-case)
 	MaxDepth      *int // Recursion depth limit (nil = unlimited)
 
+	// Matching modes
+	NamePatterns []string // Glob patterns file names must match (--name)
+	MatchName    bool     // Only group files that also share a file name (--match-name)
+	Isolate      bool     // Only count duplicates found under different paths (--isolate)
+	MatchLinks   bool     // Treat hard links to the same file as duplicates (--match-links)
+	RFOver       int      // Report files with more than this many copies (--rf-over, 0 = fclones default of 1)
+	RFUnder      int      // Report files with fewer than this many copies (--rf-under, 0 = off)
+	Transform    string   // Command that transforms file contents before hashing (--transform, "" = none)
+
 	// Caching (fclones stores cache in $HOME/.cache/fclones on Linux)
 	UseCache bool // Enable hash caching (--cache)
+
+	// Resource limits
+	Threads int    // Thread count (--threads, 0 = fclones default)
+	Nice    int    // CPU niceness the process runs at (0 = unchanged)
+	IOClass string // I/O scheduling class: "best-effort" or "idle" ("" = unchanged)
+
+	// OnStart is called with the fclones process once it has started, so the
+	// caller can suspend and resume it
+	OnStart func(p *os.Process)
+
+	// OnHeader and OnGroup receive the report as it's decoded. OnHeader is
+	// called once before any group. When OnGroup is set, groups are passed to
+	// it instead of being collected; an error from either stops the scan.
+	OnHeader func(h *Header) error
+	OnGroup  func(g Group) error
 }
 
 // LinkOptions configures a link operation
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"sort"
 	"strconv"
@@ -80,6 +81,18 @@ func (h *Handler) ActionDetail(w http.ResponseWriter, r *http.Request) {
 		groups = allGroups[start:end]
 	}
 
+	// Files the action changed or failed to change
+	var fileResults []*db.ActionFile
+	files, err := h.db.ListActionFiles(id)
+	if err != nil {
+		log.Printf("handlers: failed to list files of action %d: %v", id, err)
+	}
+	for _, f := range files {
+		if f.Status != db.FileActionNone {
+			fileResults = append(fileResults, f)
+		}
+	}
+
 	data := ActionDetailData{
 		Title:     "Action Details",
 		ActiveNav: "history",
@@ -96,11 +109,23 @@ func (h *Handler) ActionDetail(w http.ResponseWriter, r *http.Request) {
 			SortOrder:   sortOrder,
 			BaseURL:     fmt.Sprintf("/actions/%d", id),
 		},
+		FileResults: fileResults,
+	}
+	if action.FreeSpaceChange != nil {
+		data.FreeSpaceChange = formatBytesChange(*action.FreeSpaceChange)
 	}
 
 	h.render(w, "action_detail.html", data)
 }
 
+// formatBytesChange formats a change in bytes with its sign, e.g. "+2 KB"
+func formatBytesChange(n int64) string {
+	if n < 0 {
+		return "-" + formatBytes(-n)
+	}
+	return "+" + formatBytes(n)
+}
+
 // sortGroups sorts groups in place by the specified column and order
 func sortGroups(groups []*db.DuplicateGroup, sortBy, sortOrder string) {
 	sort.Slice(groups, func(i, j int) bool {
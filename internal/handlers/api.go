@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lyallcooper/kuron/internal/api"
+	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/scheduler"
+	"github.com/lyallcooper/kuron/internal/services"
+)
+
+// Bounds on the page sizes the API returns
+const (
+	apiDefaultLimit = 50
+	apiMaxLimit     = 1000
+)
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	data, _ := json.Marshal(v)
+	w.Write(data)
+}
+
+// writeAPIError writes an error as a JSON response
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, api.Error{Error: msg})
+}
+
+// requireAPIMutation checks that a request changing state uses the right
+// method and came from an API client. Browsers can't send a cross-site JSON
+// request without a CORS preflight, which the server never allows, so
+// requiring the JSON content type protects the API the way CSRF tokens
+// protect forms.
+func requireAPIMutation(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "requests must be application/json")
+		return false
+	}
+	return true
+}
+
+// decodeAPIRequest decodes a JSON request body into v
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// apiPage parses the limit and offset query parameters
+func apiPage(query url.Values) (limit, offset int) {
+	limit = apiDefaultLimit
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		limit = min(n, apiMaxLimit)
+	}
+	if n, err := strconv.Atoi(query.Get("offset")); err == nil && n > 0 {
+		offset = n
+	}
+	return limit, offset
+}
+
+// APIScans handles POST /api/scans
+// Starts a scan and returns its run.
+func (h *Handler) APIScans(w http.ResponseWriter, r *http.Request) {
+	if !requireAPIMutation(w, r, http.MethodPost) {
+		return
+	}
+
+	var req api.ScanRequest
+	if !decodeAPIRequest(w, r, &req) {
+		return
+	}
+	if len(req.Paths) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "at least one path is required")
+		return
+	}
+	for _, p := range req.Paths {
+		if !h.cfg.IsPathAllowed(p) {
+			writeAPIError(w, http.StatusForbidden, fmt.Sprintf("path not allowed: %s", p))
+			return
+		}
+	}
+
+	minSize, err := parseSizeWithError(req.MinSize)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid min size: %s", req.MinSize))
+		return
+	}
+	var maxSize *int64
+	if req.MaxSize != "" {
+		size, err := parseSizeWithError(req.MaxSize)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid max size: %s", req.MaxSize))
+			return
+		}
+		maxSize = &size
+	}
+
+	run, err := h.scanner.StartScan(r.Context(), &services.ScanConfig{
+		Paths:           req.Paths,
+		MinSize:         minSize,
+		MaxSize:         maxSize,
+		IncludePatterns: req.IncludePatterns,
+		ExcludePatterns: req.ExcludePatterns,
+		IncludeHidden:   req.IncludeHidden,
+		FollowLinks:     req.FollowLinks,
+		OneFileSystem:   req.OneFileSystem,
+		NoIgnore:        req.NoIgnore,
+		IgnoreCase:      req.IgnoreCase,
+		MaxDepth:        req.MaxDepth,
+		NamePatterns:    req.NamePatterns,
+		MatchName:       req.MatchName,
+		Isolate:         req.Isolate,
+		MatchLinks:      req.MatchLinks,
+		RFOver:          req.RFOver,
+		RFUnder:         req.RFUnder,
+	}, nil)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, api.NewRun(run))
+}
+
+// APIRuns handles the /api/runs routes:
+//
+//	GET  /api/runs                 recent scan runs
+//	GET  /api/runs/{id}            a scan run
+//	POST /api/runs/{id}/cancel     cancel a running scan
+//	POST /api/runs/{id}/pin        keep a scan run from retention cleanup
+//	POST /api/runs/{id}/unpin      let retention cleanup remove a scan run
+//	GET  /api/runs/{id}/groups     groups matching a filter
+//	GET  /api/runs/{id}/export     download groups, as on the results page
+//	POST /api/runs/{id}/actions    run or preview an action
+func (h *Handler) APIRuns(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/runs"), "/"), "/")
+	if parts[0] == "" {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		limit, offset := apiPage(r.URL.Query())
+		runs, err := h.db.ListScanRuns(limit, offset)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		out := make([]api.Run, 0, len(runs))
+		for _, run := range runs {
+			out = append(out, api.NewRun(run))
+		}
+		writeJSON(w, http.StatusOK, out)
+		return
+	}
+
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	run, err := h.db.GetScanRun(id)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "scan run not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, api.NewRun(run))
+	case len(parts) == 2 && parts[1] == "cancel":
+		if requireAPIMutation(w, r, http.MethodPost) {
+			h.scanner.CancelScan(id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case len(parts) == 2 && (parts[1] == "pin" || parts[1] == "unpin"):
+		if requireAPIMutation(w, r, http.MethodPost) {
+			if err := h.db.SetScanRunPinned(id, parts[1] == "pin"); err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case len(parts) == 2 && parts[1] == "groups" && r.Method == http.MethodGet:
+		h.apiGroups(w, r, id)
+	case len(parts) == 2 && parts[1] == "export" && r.Method == http.MethodGet:
+		h.ExportScan(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "actions":
+		if requireAPIMutation(w, r, http.MethodPost) {
+			h.apiAction(w, r, run)
+		}
+	default:
+		writeAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// apiGroups writes a page of the run's groups matching the filter in the query
+func (h *Handler) apiGroups(w http.ResponseWriter, r *http.Request, runID int64) {
+	query := r.URL.Query()
+	limit, offset := apiPage(query)
+	filter := parseGroupFilterForm(query).filter()
+
+	total, err := h.db.CountDuplicateGroups(runID, filter)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	groups, err := h.db.ListDuplicateGroupsPaginated(db.DuplicateGroupQuery{
+		ScanRunID:            runID,
+		DuplicateGroupFilter: filter,
+		Limit:                limit,
+		Offset:               offset,
+		SortBy:               query.Get("sort"),
+		SortOrder:            query.Get("order"),
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := api.GroupPage{Total: total, Groups: make([]api.Group, 0, len(groups))}
+	for _, g := range groups {
+		page.Groups = append(page.Groups, api.NewGroup(g))
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// apiAction runs or previews an action on the run's groups
+func (h *Handler) apiAction(w http.ResponseWriter, r *http.Request, run *db.ScanRun) {
+	var req api.ActionRequest
+	if !decodeAPIRequest(w, r, &req) {
+		return
+	}
+
+	var actionType db.ActionType
+	switch req.Action {
+	case "hardlink":
+		actionType = db.ActionTypeHardlink
+	case "reflink":
+		actionType = db.ActionTypeReflink
+	case "remove":
+		actionType = db.ActionTypeRemove
+	default:
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("unknown action %q", req.Action))
+		return
+	}
+
+	groupIDs := req.GroupIDs
+	if req.All {
+		filterValues, err := url.ParseQuery(req.Filter)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid filter: "+err.Error())
+			return
+		}
+		groupIDs, err = h.db.GetDuplicateGroupIDs(run.ID, parseGroupFilterForm(filterValues).filter())
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if len(groupIDs) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no groups selected")
+		return
+	}
+
+	// Groups matched on transformed content may differ byte-for-byte
+	if req.Apply && run.IsTransformed() && !req.ConfirmTransform {
+		writeAPIError(w, http.StatusConflict, "groups were matched on transformed content; confirm_transform is required to apply an action")
+		return
+	}
+
+	result, err := h.scanner.ExecuteAction(r.Context(), run.ID, groupIDs, actionType, !req.Apply, req.Priority)
+	out := api.ActionResult{DryRun: !req.Apply}
+	if result != nil {
+		out.Output = result.Output
+		if result.Action != nil {
+			// Reload the action for the outcome recorded when it completed
+			recorded := result.Action
+			if a, err := h.db.GetAction(recorded.ID); err == nil {
+				recorded = a
+			}
+			action := api.NewAction(recorded)
+			out.Action = &action
+		}
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrAuditScan) {
+			status = http.StatusBadRequest
+		}
+		out.Error = err.Error()
+		writeJSON(w, status, out)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// APIJobs handles the /api/jobs routes:
+//
+//	GET    /api/jobs                 scheduled jobs
+//	POST   /api/jobs/{id}/run        start a run; with ?wait=1, return once it has finished
+//	POST   /api/jobs/{id}/enable     enable the job's schedule
+//	POST   /api/jobs/{id}/disable    disable the job's schedule
+//	DELETE /api/jobs/{id}            delete the job
+func (h *Handler) APIJobs(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs"), "/"), "/")
+	if parts[0] == "" {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		jobs, err := h.db.ListScheduledJobs()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		out := make([]api.Job, 0, len(jobs))
+		for _, job := range jobs {
+			out = append(out, api.NewJob(job))
+		}
+		writeJSON(w, http.StatusOK, out)
+		return
+	}
+
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	job, err := h.db.GetScheduledJob(id)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	// Managed jobs can be run, but only changed through the jobs file
+	if job.Managed && (r.Method == http.MethodDelete || len(parts) == 2 && parts[1] != "run") {
+		writeAPIError(w, http.StatusConflict, "job is managed by the server's jobs file")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, api.NewJob(job))
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if requireAPIMutation(w, r, http.MethodDelete) {
+			if err := h.db.DeleteScheduledJob(id); err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case len(parts) == 2 && (parts[1] == "enable" || parts[1] == "disable"):
+		if requireAPIMutation(w, r, http.MethodPost) {
+			job.Enabled = parts[1] == "enable"
+			if err := h.db.SetJobEnabled(id, job.Enabled); err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, api.NewJob(job))
+		}
+	case len(parts) == 2 && parts[1] == "run":
+		if requireAPIMutation(w, r, http.MethodPost) {
+			h.apiRunJob(w, r, job)
+		}
+	default:
+		writeAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// apiRunJob starts a run of the job's pipeline, or with ?wait=1 runs it to completion
+func (h *Handler) apiRunJob(w http.ResponseWriter, r *http.Request, job *db.ScheduledJob) {
+	if len(job.Paths) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no paths configured for this job")
+		return
+	}
+	if h.scheduler == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "scheduler is not available")
+		return
+	}
+
+	out := api.JobRun{JobID: job.ID}
+	wait, _ := strconv.ParseBool(r.URL.Query().Get("wait"))
+	var err error
+	if wait {
+		err = h.scheduler.RunJobAndWait(r.Context(), job)
+	} else {
+		err = h.scheduler.RunNow(job)
+	}
+	switch {
+	case errors.Is(err, scheduler.ErrJobActive):
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case !wait:
+		writeJSON(w, http.StatusAccepted, out)
+		return
+	}
+
+	out.Done = true
+	if run, err := h.db.GetLastRunForJob(job.ID); err == nil {
+		out.RunID = run.ID
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/backup"
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+// maxBackupUploadMemory is how much of an uploaded backup is held in memory;
+// the rest is buffered to a temporary file
+const maxBackupUploadMemory = 32 << 20
+
+// Backup handles GET/POST /settings/backup
+// GET downloads a fresh backup of the database; POST saves one to the backup directory.
+func (h *Handler) Backup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.downloadBackup(w)
+	case http.MethodPost:
+		if !h.requireCSRF(w, r) {
+			return
+		}
+		f, err := backup.Create(h.db, h.cfg.BackupDir, h.cfg.BackupKeep)
+		if err != nil {
+			h.redirect(w, r, "/settings?error="+url.QueryEscape("Backup failed: "+err.Error()))
+			return
+		}
+		h.redirect(w, r, "/settings?success="+url.QueryEscape("Saved backup "+f.Name))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// downloadBackup writes a backup of the database to a temporary file and sends it
+func (h *Handler) downloadBackup(w http.ResponseWriter) {
+	dir, err := os.MkdirTemp("", "kuron-backup-")
+	if err != nil {
+		http.Error(w, "Failed to create backup", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := backup.FileName(time.Now())
+	path := filepath.Join(dir, name)
+	if err := h.db.Backup(path); err != nil {
+		log.Printf("handlers: backup failed: %v", err)
+		http.Error(w, "Failed to create backup", http.StatusInternalServerError)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Failed to create backup", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	setDownloadHeaders(w, "application/vnd.sqlite3", name)
+	if info, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	io.Copy(w, f)
+}
+
+// RestoreBackup handles POST /settings/restore
+// Replaces the database's contents with an uploaded backup or one from the
+// backup directory, after saving the current contents as a backup.
+func (h *Handler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxBackupUploadMemory); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	if !h.requireCSRF(w, r) {
+		return
+	}
+
+	fail := func(msg string) {
+		h.redirect(w, r, "/settings?error="+url.QueryEscape(msg))
+	}
+
+	// Running scans, actions and jobs would write results for runs and
+	// groups the restore removes
+	if h.scanner.HasActiveScans() || h.scanner.HasActiveActions() {
+		fail("Wait for running scans and actions to finish before restoring a backup")
+		return
+	}
+	if h.scheduler != nil && h.scheduler.HasActiveJobs() {
+		fail("Wait for running jobs to finish before restoring a backup")
+		return
+	}
+
+	var path string
+	if file, _, err := r.FormFile("backup"); err == nil {
+		defer file.Close()
+		tmp, err := os.CreateTemp("", "kuron-upload-*.db")
+		if err != nil {
+			fail("Failed to save upload")
+			return
+		}
+		defer os.Remove(tmp.Name())
+		_, err = io.Copy(tmp, file)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fail("Failed to save upload")
+			return
+		}
+		path = tmp.Name()
+	} else if name := r.FormValue("name"); name != "" {
+		f, err := backup.Find(h.cfg.BackupDir, name)
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		path = f.Path
+	} else {
+		fail("Choose a backup file to restore")
+		return
+	}
+
+	if _, err := db.CheckBackup(path); err != nil {
+		fail("Invalid backup: " + err.Error())
+		return
+	}
+
+	// Keep the current contents so the restore can be undone. Nothing is
+	// rotated out here, since that could remove the backup being restored.
+	saved, err := backup.Create(h.db, h.cfg.BackupDir, 0)
+	if err != nil {
+		fail("Failed to back up the current database: " + err.Error())
+		return
+	}
+
+	if err := h.db.Restore(r.Context(), path); err != nil {
+		log.Printf("handlers: restore failed: %v", err)
+		fail("Restore failed: " + err.Error())
+		return
+	}
+
+	// Settings now come from the restored database
+	if !h.cfg.RetentionDaysFromEnv {
+		if val, err := h.db.GetSetting("retention_days"); err == nil {
+			if days, err := strconv.Atoi(val); err == nil && days >= 1 && days <= 9999 {
+				h.cfg.RetentionDays = days
+			}
+		}
+	}
+
+	h.redirect(w, r, "/settings?success="+url.QueryEscape("Backup restored. The previous database was saved as "+saved.Name+"."))
+}
@@ -2,6 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
 )
 
 // Dashboard handles GET /
@@ -34,6 +38,18 @@ func (h *Handler) Dashboard(w http.ResponseWriter, r *http.Request) {
 		RecentScans:   recentScans,
 	}
 
+	data.Stats.AtRiskFiles, data.Stats.AtRiskBytes, data.Stats.AuditScans, err = h.db.GetAtRiskStats()
+	if err != nil {
+		renderError("Failed to load statistics")
+		return
+	}
+
+	data.Trends, err = h.loadTrends(r.URL.Query().Get("range"), r.URL.Query().Get("job"), time.Now())
+	if err != nil {
+		renderError("Failed to load trends")
+		return
+	}
+
 	// Get recent scan runs
 	runs, err := h.db.GetRecentScanRuns(5)
 	if err != nil {
@@ -65,3 +81,143 @@ func (h *Handler) Dashboard(w http.ResponseWriter, r *http.Request) {
 
 	h.render(w, "dashboard.html", data)
 }
+
+// Periods covered by each trend bar
+const (
+	bucketDay   = "day"
+	bucketWeek  = "week"
+	bucketMonth = "month"
+)
+
+// loadTrends builds the dashboard's charts for a range (30d, 90d, 1y or all)
+// and job filter, from the daily stats so they cover more than the retention
+// period
+func (h *Handler) loadTrends(rangeName, job string, now time.Time) (TrendsView, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var from time.Time
+	var bucket string
+	switch rangeName {
+	case "90d":
+		from, bucket = today.AddDate(0, 0, -89), bucketWeek
+	case "1y":
+		from, bucket = today.AddDate(0, -11, 0), bucketMonth
+	case "all":
+		first, err := h.db.FirstDailyStatsDate()
+		if err != nil {
+			return TrendsView{}, err
+		}
+		from, bucket = today, bucketMonth
+		if !first.IsZero() && first.Before(today) {
+			from = first
+		}
+	default:
+		rangeName = "30d"
+		from, bucket = today.AddDate(0, 0, -29), bucketDay
+	}
+	from = trendBucketStart(from, bucket)
+
+	var jobID *int64
+	if id, err := strconv.ParseInt(job, 10, 64); err == nil && id >= 0 {
+		jobID = &id
+	} else {
+		job = ""
+	}
+
+	stats, err := h.db.ListDailyStats(from, today, jobID)
+	if err != nil {
+		return TrendsView{}, err
+	}
+	return buildTrends(rangeName, job, stats, from, today, bucket), nil
+}
+
+// buildTrends totals daily stats into bars of the given size from from to to
+func buildTrends(rangeName, job string, stats []*db.DailyStats, from, to time.Time, bucket string) TrendsView {
+	var starts []time.Time
+	index := make(map[string]int)
+	for t := from; !t.After(to); t = trendBucketNext(t, bucket) {
+		index[t.Format("2006-01-02")] = len(starts)
+		starts = append(starts, t)
+	}
+
+	scans := make([]int64, len(starts))
+	wasted := make([]int64, len(starts))
+	saved := make([]int64, len(starts))
+	empty := true
+	for _, s := range stats {
+		i, ok := index[trendBucketStart(s.Date, bucket).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		scans[i] += int64(s.ScansRun)
+		wasted[i] += s.BytesWasted
+		saved[i] += s.BytesSaved
+		if s.ScansRun > 0 || s.BytesWasted > 0 || s.BytesSaved > 0 {
+			empty = false
+		}
+	}
+
+	labels := make([]string, len(starts))
+	for i, t := range starts {
+		if bucket == bucketMonth {
+			labels[i] = t.Format("Jan 2006")
+		} else {
+			labels[i] = t.Format("Jan 2")
+		}
+	}
+
+	return TrendsView{
+		Range: rangeName,
+		Job:   job,
+		From:  labels[0],
+		To:    labels[len(labels)-1],
+		Empty: empty,
+		Charts: []TrendChart{
+			trendChart("Scans Run", labels, scans, formatInt),
+			trendChart("Redundant Found", labels, wasted, formatBytes),
+			trendChart("Space Saved", labels, saved, formatBytes),
+		},
+	}
+}
+
+// trendChart builds a bar chart, scaling the bars to the largest value
+func trendChart(title string, labels []string, values []int64, format func(int64) string) TrendChart {
+	var total, peak int64
+	for _, v := range values {
+		total += v
+		peak = max(peak, v)
+	}
+
+	chart := TrendChart{Title: title, Total: format(total), Bars: make([]TrendBar, len(values))}
+	for i, v := range values {
+		chart.Bars[i] = TrendBar{Label: labels[i], Value: format(v)}
+		if peak > 0 {
+			chart.Bars[i].Height = int(v * 100 / peak)
+		}
+	}
+	return chart
+}
+
+// trendBucketStart returns the start of the day, week (from Monday) or month containing t
+func trendBucketStart(t time.Time, bucket string) time.Time {
+	y, m, d := t.Date()
+	switch bucket {
+	case bucketWeek:
+		day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case bucketMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// trendBucketNext returns the start of the bucket after the one starting at t
+func trendBucketNext(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case bucketWeek:
+		return t.AddDate(0, 0, 7)
+	case bucketMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
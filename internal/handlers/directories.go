@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lyallcooper/kuron/internal/services"
+)
+
+// directoryPairsLimit is how many directory pairs the analysis shows
+const directoryPairsLimit = 100
+
+// ScanDirectories handles GET /scans/runs/{id}/directories
+func (h *Handler) ScanDirectories(w http.ResponseWriter, r *http.Request, runIDStr string) {
+	id, err := strconv.ParseInt(runIDStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	run, err := h.db.GetScanRun(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if run.IsAudit() {
+		http.Error(w, services.ErrAuditScan.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pairs, err := h.db.ListDirectoryPairs(id, directoryPairsLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, "directories.html", DirectoriesData{
+		Title:     "Duplicate Directories",
+		ActiveNav: "history",
+		CSRFToken: h.getOrCreateCSRFToken(w, r),
+		Run:       run,
+		Pairs:     pairs,
+		Limit:     directoryPairsLimit,
+	})
+}
+
+// HandleDirectoryRemove handles POST /scans/runs/{id}/directories/remove,
+// previewing the deletion of the files under one directory of a pair that
+// have copies under the other
+func (h *Handler) HandleDirectoryRemove(w http.ResponseWriter, r *http.Request, runIDStr string) {
+	if !h.requireCSRF(w, r) {
+		return
+	}
+
+	runID, err := strconv.ParseInt(runIDStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	run, err := h.db.GetScanRun(runID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if run.IsAudit() {
+		http.Error(w, services.ErrAuditScan.Error(), http.StatusBadRequest)
+		return
+	}
+
+	removeDir := strings.TrimSpace(r.FormValue("remove_dir"))
+	keepDir := strings.TrimSpace(r.FormValue("keep_dir"))
+	if removeDir == "" || keepDir == "" || dirsOverlap(removeDir, keepDir) {
+		http.Error(w, "Choose a directory to remove and one to keep", http.StatusBadRequest)
+		return
+	}
+
+	paths, groupIDs, err := h.db.ListDirectoryPairFiles(runID, removeDir, keepDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(paths) == 0 {
+		h.redirect(w, r, "/scans/runs/"+runIDStr+"/directories")
+		return
+	}
+
+	// Always preview; confirming deletes the listed files through delete-files
+	h.deleteFiles(w, r, run, paths, groupIDs, true)
+}
+
+// dirsOverlap reports whether two directories are the same or one contains the other
+func dirsOverlap(a, b string) bool {
+	a, b = strings.TrimSuffix(a, "/")+"/", strings.TrimSuffix(b, "/")+"/"
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/api"
+	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/fclones"
+)
+
+// exportBatchSize is how many groups or actions an export reads at a time
+const exportBatchSize = 1000
+
+// ExportScan handles GET /scans/runs/{id}/export?format=...
+// Downloads the scan's groups matching the filter in the query, in the
+// results page's sort order.
+func (h *Handler) ExportScan(w http.ResponseWriter, r *http.Request, runIDStr string) {
+	id, err := strconv.ParseInt(runIDStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	run, err := h.db.GetScanRun(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	q := db.DuplicateGroupQuery{
+		ScanRunID:            id,
+		DuplicateGroupFilter: parseGroupFilterForm(query).filter(),
+		SortBy:               query.Get("sort"),
+		SortOrder:            query.Get("order"),
+	}
+	name := fmt.Sprintf("kuron-scan-%d", id)
+
+	switch format := query.Get("format"); format {
+	case "csv":
+		setDownloadHeaders(w, "text/csv; charset=utf-8", name+".csv")
+		err = h.exportGroupsCSV(w, q)
+	case "json":
+		setDownloadHeaders(w, "application/json", name+".json")
+		err = h.exportGroupsJSON(w, q)
+	case "fclones-json", "fclones-text":
+		// fclones reports hold every group at once
+		var groups []fclones.Group
+		err = h.eachExportGroup(q, func(g *db.DuplicateGroup) error {
+			groups = append(groups, fclones.Group{FileLen: g.FileSize, FileHash: g.FileHash, Files: g.Files})
+			return nil
+		})
+		if err != nil {
+			break
+		}
+		if format == "fclones-json" {
+			setDownloadHeaders(w, "application/json", name+"-fclones.json")
+			_, err = io.WriteString(w, h.executor.GroupToInput(groups))
+		} else {
+			// The report names the fclones version kuron runs, which reads it
+			version, verr := h.executor.Version(r.Context())
+			if verr != nil {
+				http.Error(w, "fclones is needed to write its report format: "+verr.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			setDownloadHeaders(w, "text/plain; charset=utf-8", name+"-fclones.txt")
+			err = fclones.WriteTextReport(w, fclonesReportHeader(run, version), groups)
+		}
+	default:
+		http.Error(w, "Unknown export format", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Printf("handlers: failed to export scan %d: %v", id, err)
+	}
+}
+
+// fclonesReportHeader describes a scan run in an fclones report: the command
+// its report was imported with, or the one kuron ran
+func fclonesReportHeader(run *db.ScanRun, version string) fclones.ReportHeader {
+	header := fclones.ReportHeader{Version: version, Timestamp: run.StartedAt, BaseDir: "/"}
+	if run.ImportedCommand != nil {
+		header.Command = *run.ImportedCommand
+		return header
+	}
+	header.Command = fclones.QuoteCommand(fclones.GroupCommand(fclones.ScanOptions{
+		Paths:           run.Paths,
+		MinSize:         run.MinSize,
+		MaxSize:         run.MaxSize,
+		IncludePatterns: run.IncludePatterns,
+		ExcludePatterns: run.ExcludePatterns,
+		IncludeHidden:   run.IncludeHidden,
+		FollowLinks:     run.FollowLinks,
+		OneFileSystem:   run.OneFileSystem,
+		NoIgnore:        run.NoIgnore,
+		IgnoreCase:      run.IgnoreCase,
+		MaxDepth:        run.MaxDepth,
+		NamePatterns:    run.NamePatterns,
+		MatchName:       run.MatchName,
+		Isolate:         run.Isolate,
+		MatchLinks:      run.MatchLinks,
+		RFOver:          run.RFOver,
+		RFUnder:         run.RFUnder,
+		Transform:       run.Transform,
+	}))
+	return header
+}
+
+// ExportActions handles GET /actions/export?format=csv|json
+// Downloads the log of all actions taken.
+func (h *Handler) ExportActions(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		setDownloadHeaders(w, "text/csv; charset=utf-8", "kuron-actions.csv")
+		err = h.exportActionsCSV(w)
+	case "json":
+		setDownloadHeaders(w, "application/json", "kuron-actions.json")
+		err = h.exportActionsJSON(w)
+	default:
+		http.Error(w, "Unknown export format", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Printf("handlers: failed to export actions: %v", err)
+	}
+}
+
+// setDownloadHeaders marks the response as a file download
+func setDownloadHeaders(w http.ResponseWriter, contentType, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+// eachExportGroup calls fn with each group matching the query, reading them in batches
+func (h *Handler) eachExportGroup(q db.DuplicateGroupQuery, fn func(*db.DuplicateGroup) error) error {
+	q.Limit = exportBatchSize
+	for q.Offset = 0; ; q.Offset += exportBatchSize {
+		groups, err := h.db.ListDuplicateGroupsPaginated(q)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			if err := fn(g); err != nil {
+				return err
+			}
+		}
+		if len(groups) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// exportGroupsCSV writes one row per file of each group
+func (h *Handler) exportGroupsCSV(w io.Writer, q db.DuplicateGroupQuery) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"group_id", "file_hash", "file_size", "file_count", "wasted_bytes", "status", "path"})
+	err := h.eachExportGroup(q, func(g *db.DuplicateGroup) error {
+		for _, path := range g.Files {
+			if err := cw.Write([]string{
+				strconv.FormatInt(g.ID, 10),
+				g.FileHash,
+				strconv.FormatInt(g.FileSize, 10),
+				strconv.Itoa(g.FileCount),
+				strconv.FormatInt(g.WastedBytes, 10),
+				string(g.Status),
+				path,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// exportGroupsJSON writes the groups as a JSON document, one group at a time
+func (h *Handler) exportGroupsJSON(w io.Writer, q db.DuplicateGroupQuery) error {
+	header, _ := json.Marshal(q.ScanRunID)
+	exportedAt, _ := json.Marshal(time.Now())
+	if _, err := fmt.Fprintf(w, `{"scan_run_id":%s,"exported_at":%s,"groups":[`, header, exportedAt); err != nil {
+		return err
+	}
+
+	first := true
+	err := h.eachExportGroup(q, func(g *db.DuplicateGroup) error {
+		data, err := json.Marshal(api.NewGroup(g))
+		if err != nil {
+			return err
+		}
+		if !first {
+			data = append([]byte{','}, data...)
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// eachExportAction calls fn with each action, newest first, reading them in batches
+func (h *Handler) eachExportAction(fn func(*db.Action) error) error {
+	for offset := 0; ; offset += exportBatchSize {
+		actions, err := h.db.ListActions(exportBatchSize, offset)
+		if err != nil {
+			return err
+		}
+		for _, a := range actions {
+			if err := fn(a); err != nil {
+				return err
+			}
+		}
+		if len(actions) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// optionalInt64 formats a value for CSV, leaving it empty when unset
+func optionalInt64(n *int64) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.FormatInt(*n, 10)
+}
+
+// exportActionsCSV writes one row per action
+func (h *Handler) exportActionsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "scan_run_id", "action_type", "status", "started_at", "completed_at",
+		"groups_processed", "files_processed", "bytes_saved", "bytes_measured", "free_space_change",
+		"command", "error_message"})
+	err := h.eachExportAction(func(a *db.Action) error {
+		view := api.NewAction(a)
+		var completedAt string
+		if a.CompletedAt != nil {
+			completedAt = a.CompletedAt.Format(time.RFC3339)
+		}
+		return cw.Write([]string{
+			strconv.FormatInt(a.ID, 10),
+			strconv.FormatInt(a.ScanRunID, 10),
+			string(a.ActionType),
+			string(a.Status),
+			a.StartedAt.Format(time.RFC3339),
+			completedAt,
+			strconv.Itoa(a.GroupsProcessed),
+			strconv.Itoa(a.FilesProcessed),
+			strconv.FormatInt(a.BytesSaved, 10),
+			optionalInt64(a.BytesMeasured),
+			optionalInt64(a.FreeSpaceChange),
+			view.Command,
+			view.ErrorMessage,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// exportActionsJSON writes the actions, with the files each processed, as a JSON array
+func (h *Handler) exportActionsJSON(w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	first := true
+	err := h.eachExportAction(func(a *db.Action) error {
+		data, err := json.Marshal(api.NewAction(a))
+		if err != nil {
+			return err
+		}
+		if !first {
+			data = append([]byte{','}, data...)
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
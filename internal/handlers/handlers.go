@@ -13,6 +13,7 @@ import (
 	"github.com/lyallcooper/kuron/internal/config"
 	"github.com/lyallcooper/kuron/internal/db"
 	"github.com/lyallcooper/kuron/internal/fclones"
+	"github.com/lyallcooper/kuron/internal/scheduler"
 	"github.com/lyallcooper/kuron/internal/services"
 )
 
@@ -22,6 +23,7 @@ type Handler struct {
 	cfg         *config.Config
 	executor    fclones.ExecutorInterface
 	scanner     *services.Scanner
+	scheduler   *scheduler.Scheduler
 	webFS       embed.FS
 	funcMap     template.FuncMap
 	templates   map[string]*template.Template // Pre-compiled page templates
@@ -31,7 +33,7 @@ type Handler struct {
 }
 
 // New creates a new Handler
-func New(database *db.DB, cfg *config.Config, executor fclones.ExecutorInterface, scanner *services.Scanner, webFS embed.FS, version string, disableCSRF bool) (*Handler, error) {
+func New(database *db.DB, cfg *config.Config, executor fclones.ExecutorInterface, scanner *services.Scanner, sched *scheduler.Scheduler, webFS embed.FS, version string, disableCSRF bool) (*Handler, error) {
 	// Template functions
 	funcMap := template.FuncMap{
 		"formatBytes":     formatBytes,
@@ -45,6 +47,14 @@ func New(database *db.DB, cfg *config.Config, executor fclones.ExecutorInterface
 		"add":             func(a, b int) int { return a + b },
 		"subtract":        func(a, b int) int { return a - b },
 		"formatSizeInput": formatSizeInput,
+		"jobEventLabel":   jobEventLabel,
+		"jobEventBadge":   jobEventBadge,
+		"jobStepLabel":    jobStepLabel,
+		"stepRunBadge":    stepRunBadge,
+		"transformPreset": transformPreset,
+		"transformPresets": func() []fclones.TransformPreset {
+			return fclones.TransformPresets
+		},
 		"plural": func(n int, singular, plural string) string {
 			if n == 1 {
 				return singular
@@ -67,11 +77,13 @@ func New(database *db.DB, cfg *config.Config, executor fclones.ExecutorInterface
 		"dashboard.html",
 		"jobs.html",
 		"job_form.html",
+		"jobs_import.html",
 		"history.html",
 		"quick_scan.html",
 		"scan_results.html",
 		"settings.html",
 		"action_detail.html",
+		"directories.html",
 	}
 
 	templates := make(map[string]*template.Template, len(pages))
@@ -93,6 +105,7 @@ func New(database *db.DB, cfg *config.Config, executor fclones.ExecutorInterface
 		cfg:         cfg,
 		executor:    executor,
 		scanner:     scanner,
+		scheduler:   sched,
 		webFS:       webFS,
 		funcMap:     funcMap,
 		templates:   templates,
@@ -138,24 +151,36 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 
 	// Quick scan and scan results
 	mux.HandleFunc("/scans/quick", h.QuickScan)
+	mux.HandleFunc("/scans/import", h.ImportReport)
 	mux.HandleFunc("/scans/runs/", h.ScanResults)
 
 	// Jobs
 	mux.HandleFunc("/jobs", h.Jobs)
 	mux.HandleFunc("/jobs/new", h.JobForm)
+	mux.HandleFunc("/jobs/export", h.ExportJobs)
+	mux.HandleFunc("/jobs/import", h.ImportJobs)
 	mux.HandleFunc("/jobs/", h.JobRoutes)
 
 	// History
 	mux.HandleFunc("/history", h.History)
 
 	// Action details
+	mux.HandleFunc("/actions/export", h.ExportActions)
 	mux.HandleFunc("/actions/", h.ActionDetail)
 
 	// Settings
 	mux.HandleFunc("/settings", h.Settings)
+	mux.HandleFunc("/settings/backup", h.Backup)
+	mux.HandleFunc("/settings/restore", h.RestoreBackup)
 
 	// API
 	mux.HandleFunc("/api/paths/suggest", h.SuggestPaths)
+	mux.HandleFunc("/api/scans", h.APIScans)
+	mux.HandleFunc("/api/runs", h.APIRuns)
+	mux.HandleFunc("/api/runs/", h.APIRuns)
+	mux.HandleFunc("/api/jobs", h.APIJobs)
+	mux.HandleFunc("/api/jobs/", h.APIJobs)
+	mux.HandleFunc("/api/jobs/schedule-preview", h.SchedulePreview)
 
 	// SSE
 	mux.HandleFunc("/sse/scan/", h.ScanProgressSSE)
@@ -367,6 +392,76 @@ func joinLines(items []string) string {
 	return strings.Join(items, "\n")
 }
 
+// jobEventLabel returns a short display label for a job scheduling event
+func jobEventLabel(e db.JobEventType) string {
+	switch e {
+	case db.JobEventStarted:
+		return "Started"
+	case db.JobEventCaughtUp:
+		return "Caught up"
+	case db.JobEventSkippedMissed:
+		return "Skipped (missed)"
+	case db.JobEventSkippedOverlap:
+		return "Skipped (overlap)"
+	case db.JobEventQueued:
+		return "Queued"
+	case db.JobEventManual:
+		return "Manual"
+	case db.JobEventDeferred:
+		return "Deferred"
+	default:
+		return string(e)
+	}
+}
+
+// jobStepLabel returns a short display label for a pipeline step type
+func jobStepLabel(t db.JobStepType) string {
+	switch t {
+	case db.JobStepScan:
+		return "Scan"
+	case db.JobStepAction:
+		return "Action"
+	case db.JobStepNotify:
+		return "Notify"
+	case db.JobStepWaitForJob:
+		return "Wait for job"
+	default:
+		return string(t)
+	}
+}
+
+// transformPreset returns the name of the preset a transform command came
+// from, "custom" for other commands, or "" when there's no transform
+func transformPreset(command string) string {
+	if command == "" {
+		return ""
+	}
+	if name := fclones.TransformPresetName(command); name != "" {
+		return name
+	}
+	return "custom"
+}
+
+// stepRunBadge returns the badge class suffix for a pipeline step outcome
+func stepRunBadge(s db.JobStepRunStatus) string {
+	if s == db.JobStepRunSkipped {
+		return "cancelled"
+	}
+	return string(s)
+}
+
+// jobEventBadge returns the badge class suffix for a job scheduling event
+func jobEventBadge(e db.JobEventType) string {
+	switch e {
+	case db.JobEventStarted, db.JobEventCaughtUp, db.JobEventManual:
+		return "completed"
+	case db.JobEventQueued, db.JobEventDeferred:
+		return "pending"
+	default:
+		return "cancelled"
+	}
+}
+
 func derefInt64(p *int64) int64 {
 	if p == nil {
 		return 0
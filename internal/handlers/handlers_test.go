@@ -1,13 +1,22 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/lyallcooper/kuron/internal/backup"
 	"github.com/lyallcooper/kuron/internal/config"
+	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/fclones"
+	"github.com/lyallcooper/kuron/internal/jobconfig"
 	"github.com/lyallcooper/kuron/internal/webfs"
 )
 
@@ -16,13 +25,29 @@ import (
 func testHandler(t *testing.T) *Handler {
 	t.Helper()
 	cfg := &config.Config{}
-	h, err := New(nil, cfg, nil, nil, webfs.FS, "test", true)
+	h, err := New(nil, cfg, nil, nil, nil, webfs.FS, "test", true)
 	if err != nil {
 		t.Fatalf("failed to create test handler: %v", err)
 	}
 	return h
 }
 
+// testHandlerWithDB creates a Handler for testing backed by a fresh database
+func testHandlerWithDB(t *testing.T) (*Handler, *db.DB) {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "kuron.db"))
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	h, err := New(database, &config.Config{}, nil, nil, nil, webfs.FS, "test", true)
+	if err != nil {
+		t.Fatalf("failed to create test handler: %v", err)
+	}
+	return h, database
+}
+
 func TestRender_CachedTemplate(t *testing.T) {
 	h := testHandler(t)
 
@@ -78,7 +103,7 @@ func TestRender_UnknownTemplate(t *testing.T) {
 
 func TestNew_TemplatesPrecompiled(t *testing.T) {
 	cfg := &config.Config{}
-	h, err := New(nil, cfg, nil, nil, webfs.FS, "test", true)
+	h, err := New(nil, cfg, nil, nil, nil, webfs.FS, "test", true)
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -88,11 +113,13 @@ func TestNew_TemplatesPrecompiled(t *testing.T) {
 		"dashboard.html",
 		"jobs.html",
 		"job_form.html",
+		"jobs_import.html",
 		"history.html",
 		"quick_scan.html",
 		"scan_results.html",
 		"settings.html",
 		"action_detail.html",
+		"directories.html",
 	}
 
 	for _, name := range expectedTemplates {
@@ -129,7 +156,7 @@ func TestRequireCSRF_Valid_DisabledMode(t *testing.T) {
 func TestRequireCSRF_Invalid_EnabledMode(t *testing.T) {
 	// When CSRF is enabled, missing token should fail
 	cfg := &config.Config{}
-	h, err := New(nil, cfg, nil, nil, webfs.FS, "test", false) // disableCSRF = false
+	h, err := New(nil, cfg, nil, nil, nil, webfs.FS, "test", false) // disableCSRF = false
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -157,7 +184,7 @@ func TestRequireCSRF_Invalid_EnabledMode(t *testing.T) {
 func TestRequireCSRF_GetRequest_Passes(t *testing.T) {
 	// GET requests should always pass CSRF validation
 	cfg := &config.Config{}
-	h, err := New(nil, cfg, nil, nil, webfs.FS, "test", false) // disableCSRF = false
+	h, err := New(nil, cfg, nil, nil, nil, webfs.FS, "test", false) // disableCSRF = false
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
 	}
@@ -222,6 +249,74 @@ func TestDashboardTemplate_NoError(t *testing.T) {
 	}
 }
 
+func TestBuildTrends(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.Local) }
+	stats := []*db.DailyStats{
+		{Date: day(2), ScansRun: 1, BytesWasted: 100},
+		{Date: day(4), ScansRun: 2, BytesWasted: 300, BytesSaved: 2000},
+		{Date: day(9), ScansRun: 1},
+	}
+
+	// 2026-03-02 is a Monday, so the first two days share a week
+	trends := buildTrends("90d", "", stats, day(2), day(15), bucketWeek)
+	if trends.Empty {
+		t.Error("Empty = true, want false")
+	}
+	if trends.From != "Mar 2" || trends.To != "Mar 9" {
+		t.Errorf("axis = %s to %s, want Mar 2 to Mar 9", trends.From, trends.To)
+	}
+
+	scans := trends.Charts[0]
+	if scans.Total != "4" || len(scans.Bars) != 2 {
+		t.Fatalf("scans chart = %+v", scans)
+	}
+	if scans.Bars[0].Value != "3" || scans.Bars[0].Height != 100 || scans.Bars[1].Height != 33 {
+		t.Errorf("scan bars = %+v", scans.Bars)
+	}
+	if saved := trends.Charts[2]; saved.Total != "2 KB" || saved.Bars[1].Height != 0 {
+		t.Errorf("saved chart = %+v", saved)
+	}
+
+	if empty := buildTrends("30d", "", nil, day(1), day(30), bucketDay); !empty.Empty || len(empty.Charts[0].Bars) != 30 {
+		t.Errorf("empty trends = %+v", empty)
+	}
+}
+
+func TestDashboardTemplate_Trends(t *testing.T) {
+	h := testHandler(t)
+
+	data := DashboardData{
+		ActiveNav: "dashboard",
+		Jobs:      []*JobView{{ID: 7, Name: "Nightly"}},
+		Trends: TrendsView{
+			Range: "1y",
+			Job:   "7",
+			From:  "Apr 2026",
+			To:    "Mar 2027",
+			Charts: []TrendChart{{
+				Title: "Space Saved",
+				Total: "1 GB",
+				Bars:  []TrendBar{{Label: "Apr 2026", Value: "1 GB", Height: 100}},
+			}},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	h.render(w, "dashboard.html", data)
+	body := w.Body.String()
+
+	for _, want := range []string{
+		`<option value="7" selected>Nightly</option>`,
+		`<option value="1y" selected>`,
+		`title="Apr 2026: 1 GB"`,
+		`style="height: 100%"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response missing %s", want)
+		}
+	}
+}
+
 func TestFormatBytes(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -551,3 +646,906 @@ func TestFormatSizeInputParseSizeRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestSchedulePreview(t *testing.T) {
+	h := testHandler(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantRuns  int
+		wantError bool
+	}{
+		{"valid", "cron_expression=" + url.QueryEscape("30 2 * * *"), 5, false},
+		{"descriptor with timezone", "cron_expression=%40daily&timezone=Europe%2FBerlin", 5, false},
+		{"invalid expression", "cron_expression=nope", 0, true},
+		{"invalid timezone", "cron_expression=%40daily&timezone=Nowhere", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/jobs/schedule-preview?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.SchedulePreview(w, req)
+
+			var preview SchedulePreviewView
+			if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if (preview.Error != "") != tt.wantError {
+				t.Errorf("Error = %q, wantError %v", preview.Error, tt.wantError)
+			}
+			if len(preview.NextRuns) != tt.wantRuns {
+				t.Errorf("got %d runs, want %d", len(preview.NextRuns), tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestFormatRunTimes(t *testing.T) {
+	onMinute := []time.Time{time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)}
+	if got := formatRunTimes(onMinute); got[0] != "Fri, Jan 2 2026 03:04 UTC" {
+		t.Errorf("formatRunTimes() = %q", got[0])
+	}
+
+	withSeconds := []time.Time{onMinute[0], onMinute[0].Add(30 * time.Second)}
+	if got := formatRunTimes(withSeconds); got[0] != "Fri, Jan 2 2026 03:04:00 UTC" {
+		t.Errorf("formatRunTimes() with seconds = %q", got[0])
+	}
+}
+
+func TestJobFormTemplate_ScheduleError(t *testing.T) {
+	h := testHandler(t)
+
+	w := httptest.NewRecorder()
+	h.render(w, "job_form.html", JobFormData{
+		Title:         "New Job",
+		ActiveNav:     "jobs",
+		ScheduleError: "Invalid schedule: unknown timezone",
+	})
+
+	body := w.Body.String()
+	if !strings.Contains(body, `class="cron-description cron-invalid" id="cron-description">Invalid schedule: unknown timezone`) {
+		t.Error("schedule error should be rendered next to the schedule field")
+	}
+}
+
+func TestParseJobSteps(t *testing.T) {
+	tests := []struct {
+		name      string
+		form      url.Values
+		wantTypes []db.JobStepType
+		wantErr   bool
+	}{
+		{"no steps", url.Values{}, nil, false},
+		{
+			"scan then action",
+			url.Values{
+				"step_type":    {"scan", "action"},
+				"step_paths":   {"/a\n/b\n", ""},
+				"step_action":  {"hardlink", "reflink"},
+				"step_webhook": {"", ""},
+				"step_job":     {"", ""},
+			},
+			[]db.JobStepType{db.JobStepScan, db.JobStepAction},
+			false,
+		},
+		{
+			"action without scan",
+			url.Values{"step_type": {"action"}, "step_action": {"hardlink"}},
+			nil,
+			true,
+		},
+		{
+			"invalid webhook",
+			url.Values{"step_type": {"notify"}, "step_webhook": {"ftp://example.com"}},
+			nil,
+			true,
+		},
+		{
+			"wait without job",
+			url.Values{"step_type": {"wait_for_job"}, "step_job": {""}},
+			nil,
+			true,
+		},
+		{
+			"unknown type",
+			url.Values{"step_type": {"reboot"}},
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := parseJobSteps(tt.form)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJobSteps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(steps) != len(tt.wantTypes) {
+				t.Fatalf("got %d steps, want %d", len(steps), len(tt.wantTypes))
+			}
+			for i, step := range steps {
+				if step.Type != tt.wantTypes[i] {
+					t.Errorf("step %d type = %s, want %s", i, step.Type, tt.wantTypes[i])
+				}
+			}
+		})
+	}
+
+	// Field values line up with their row
+	steps, _ := parseJobSteps(url.Values{
+		"step_type":    {"scan", "action", "notify", "wait_for_job"},
+		"step_paths":   {"/a\n/b", "", "", ""},
+		"step_action":  {"hardlink", "reflink", "hardlink", "hardlink"},
+		"step_webhook": {"", "", "https://example.com/hook", ""},
+		"step_job":     {"", "", "", "7"},
+	})
+	if len(steps[0].Paths) != 2 || steps[1].ActionType != db.ActionTypeReflink ||
+		steps[2].WebhookURL != "https://example.com/hook" || steps[3].JobID != 7 {
+		t.Errorf("unexpected steps: %+v", steps)
+	}
+}
+
+func TestValidateJobSteps_WaitCycle(t *testing.T) {
+	h, database := testHandlerWithDB(t)
+	newJob := func(name string, steps []db.JobStep) *db.ScheduledJob {
+		job, err := database.CreateScheduledJob(&db.ScheduledJob{
+			Name: name, Paths: []string{"/data"}, CronExpression: "0 3 * * *", Action: "scan", Steps: steps,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	waitFor := func(id int64) []db.JobStep {
+		return []db.JobStep{{Type: db.JobStepWaitForJob, JobID: id}, {Type: db.JobStepScan}}
+	}
+	a := newJob("A", nil)
+	b := newJob("B", waitFor(a.ID))
+	c := newJob("C", waitFor(b.ID))
+
+	// A waiting for C, which waits for A through B
+	a.Steps = waitFor(c.ID)
+	if err := h.validateJobSteps(a); err == nil || !strings.Contains(err.Error(), "C waits for this job") {
+		t.Errorf("validateJobSteps = %v, want a wait cycle error", err)
+	}
+
+	// Waiting the other way round is fine
+	c.Steps = waitFor(a.ID)
+	if err := h.validateJobSteps(c); err != nil {
+		t.Errorf("validateJobSteps without a cycle = %v", err)
+	}
+}
+
+func TestJobFormTemplate_Pipeline(t *testing.T) {
+	h := testHandler(t)
+
+	scanRunID := int64(12)
+	w := httptest.NewRecorder()
+	h.render(w, "job_form.html", JobFormData{
+		Title:     "Edit Job",
+		ActiveNav: "jobs",
+		Job: &db.ScheduledJob{
+			ID:   1,
+			Name: "Pipeline",
+			Steps: []db.JobStep{
+				{Type: db.JobStepScan, Paths: []string{"/a"}},
+				{Type: db.JobStepWaitForJob, JobID: 2},
+			},
+		},
+		OtherJobs: []*db.ScheduledJob{{ID: 2, Name: "Upstream"}},
+		Events:    []*db.JobEvent{{ID: 5, JobID: 1, Event: db.JobEventManual, ScanRunID: &scanRunID}},
+		StepRuns: map[int64][]*db.JobStepRun{
+			5: {
+				{JobEventID: 5, StepType: db.JobStepScan, Status: db.JobStepRunCompleted, ScanRunID: &scanRunID, Message: "Found 3 duplicate groups"},
+				{JobEventID: 5, StepIndex: 1, StepType: db.JobStepWaitForJob, Status: db.JobStepRunSkipped},
+			},
+		},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("render() status = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`<option value="2" selected>Upstream</option>`,
+		`<a href="/scans/runs/12">Found 3 duplicate groups</a>`,
+		`badge-cancelled">Wait for job</span>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response missing %q", want)
+		}
+	}
+}
+
+func TestJobTemplates_Managed(t *testing.T) {
+	h := testHandler(t)
+
+	w := httptest.NewRecorder()
+	h.render(w, "job_form.html", JobFormData{
+		Title:     "Edit Job",
+		ActiveNav: "jobs",
+		Job:       &db.ScheduledJob{ID: 3, Name: "Provisioned", Managed: true},
+	})
+	body := w.Body.String()
+	for _, want := range []string{"managed by the server's jobs file", "<fieldset disabled", `formaction="/jobs/3/run"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("managed job form missing %q", want)
+		}
+	}
+	if strings.Contains(body, `id="btn-save"`) || strings.Contains(body, "confirmDelete('/jobs/3'") {
+		t.Error("managed job form should not offer to save or delete")
+	}
+
+	w = httptest.NewRecorder()
+	h.render(w, "jobs.html", JobsData{
+		Title: "Jobs",
+		Jobs:  []*JobView{{ID: 3, Name: "Provisioned", Managed: true}},
+	})
+	body = w.Body.String()
+	if !strings.Contains(body, ">Managed</span>") || strings.Contains(body, "/jobs/3/toggle") {
+		t.Error("managed jobs should be badged and not toggleable in the job list")
+	}
+}
+
+func TestParseMatchOptions(t *testing.T) {
+	parse := func(form url.Values) (matchOptions, error) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.ParseForm()
+		return parseMatchOptions(r)
+	}
+
+	m, err := parse(url.Values{
+		"name_patterns": {"*.jpg", " ", "IMG_*"},
+		"isolate":       {"1"},
+		"match_links":   {"1"},
+		"rf_under":      {"2"},
+	})
+	if err != nil {
+		t.Fatalf("parseMatchOptions failed: %v", err)
+	}
+	if strings.Join(m.NamePatterns, ",") != "*.jpg,IMG_*" || !m.Isolate || !m.MatchLinks || m.MatchName || m.RFUnder != 2 || m.RFOver != 0 {
+		t.Errorf("got %+v", m)
+	}
+
+	if _, err := parse(url.Values{"rf_over": {"2"}, "rf_under": {"2"}}); err == nil {
+		t.Error("setting both copy limits should fail")
+	}
+	if _, err := parse(url.Values{"rf_over": {"0"}}); err == nil {
+		t.Error("a copy count below 1 should fail")
+	}
+}
+
+func TestScanResultsTemplate_Audit(t *testing.T) {
+	h := testHandler(t)
+
+	completed := time.Now()
+	w := httptest.NewRecorder()
+	h.render(w, "scan_results.html", ScanResultsData{
+		Title:     "Scan Results",
+		ActiveNav: "history",
+		Run: &db.ScanRun{
+			ID:             3,
+			Status:         db.ScanRunStatusCompleted,
+			CompletedAt:    &completed,
+			DuplicateFiles: 1,
+			RFUnder:        2,
+		},
+		GroupsTable: GroupsTableData{
+			Groups: []*db.DuplicateGroup{{ID: 1, FileHash: "abc", FileSize: 1024, FileCount: 1, Files: []string{"/a/only"}}},
+			Audit:  true,
+		},
+		AtRiskBytes: 1024,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("render() status = %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "<h1>At-Risk Files</h1>") {
+		t.Error("response missing at-risk title")
+	}
+	for _, unwanted := range []string{`id="btn-hardlink"`, `id="select-page"`, "Redundant"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("response should not contain %q", unwanted)
+		}
+	}
+}
+
+func TestAuditScan_RejectsFileRemoval(t *testing.T) {
+	h, database := testHandlerWithDB(t)
+
+	path := filepath.Join(t.TempDir(), "only")
+	os.WriteFile(path, []byte("data"), 0644)
+
+	run, err := database.CreateScanRun(nil, nil, []string{filepath.Dir(path)}, &db.ScanRunOptions{RFUnder: 3})
+	if err != nil {
+		t.Fatalf("CreateScanRun() error = %v", err)
+	}
+
+	form := url.Values{"file_paths": {path}, "confirm": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.HandleDeleteFiles(w, req, strconv.FormatInt(run.ID, 10))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error("at-risk file should not be deleted")
+	}
+
+	// Nor can an audit's groups be treated as duplicate directories
+	w = httptest.NewRecorder()
+	h.ScanDirectories(w, httptest.NewRequest(http.MethodGet, "/", nil), strconv.FormatInt(run.ID, 10))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("directories status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	form = url.Values{"remove_dir": {filepath.Dir(path)}, "keep_dir": {"/elsewhere"}}
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	h.HandleDirectoryRemove(w, req, strconv.FormatInt(run.ID, 10))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("directory remove status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleDeleteFiles_TransformedNeedsConfirmation(t *testing.T) {
+	h, database := testHandlerWithDB(t)
+
+	path := filepath.Join(t.TempDir(), "copy")
+	os.WriteFile(path, []byte("data"), 0644)
+
+	run, err := database.CreateScanRun(nil, nil, []string{filepath.Dir(path)}, &db.ScanRunOptions{Transform: "exiftool -q -all= -o - $IN"})
+	if err != nil {
+		t.Fatalf("CreateScanRun() error = %v", err)
+	}
+
+	post := func(form url.Values) string {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.HandleDeleteFiles(w, req, strconv.FormatInt(run.ID, 10))
+		return w.Body.String()
+	}
+
+	body := post(url.Values{"file_paths": {path}, "confirm": {"1"}})
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("file should not be deleted without confirming the transform")
+	}
+	if !strings.Contains(body, `name="confirm_transform" value="1" required`) {
+		t.Error("preview of transformed groups should require confirmation")
+	}
+
+	post(url.Values{"file_paths": {path}, "confirm": {"1"}, "confirm_transform": {"1"}})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("file should be deleted once the transform is confirmed")
+	}
+}
+
+func TestFclonesReportHeader(t *testing.T) {
+	started := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	run := &db.ScanRun{Paths: []string{"/data/photos"}, StartedAt: started, MinSize: 1024, MatchLinks: true}
+
+	header := fclonesReportHeader(run, "0.35.0")
+	if header.Command != "fclones group -s 1024 --match-links /data/photos" {
+		t.Errorf("command = %q, want the scan's own command", header.Command)
+	}
+	if header.Version != "0.35.0" || !header.Timestamp.Equal(started) {
+		t.Errorf("header = %+v", header)
+	}
+
+	imported := "fclones group --rf-over 3 /backup"
+	run.ImportedCommand = &imported
+	if header := fclonesReportHeader(run, "0.35.0"); header.Command != imported {
+		t.Errorf("command = %q, want the imported report's command", header.Command)
+	}
+}
+
+func TestParseTransform(t *testing.T) {
+	parse := func(form url.Values, allowCustom bool) (string, error) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.ParseForm()
+		return parseTransform(r, allowCustom)
+	}
+
+	if got, err := parse(url.Values{}, false); err != nil || got != "" {
+		t.Errorf("no transform = %q, %v", got, err)
+	}
+
+	want, _ := fclones.TransformPresetCommand("images")
+	if got, err := parse(url.Values{"transform_preset": {"images"}}, false); err != nil || got != want {
+		t.Errorf("images preset = %q, %v; want %q", got, err, want)
+	}
+	if got := transformPreset(want); got != "images" {
+		t.Errorf("transformPreset(%q) = %q, want images", want, got)
+	}
+
+	custom := url.Values{"transform_preset": {"custom"}, "transform": {" cat $IN "}}
+	if got, err := parse(custom, true); err != nil || got != "cat $IN" {
+		t.Errorf("custom transform = %q, %v", got, err)
+	}
+	if _, err := parse(custom, false); err == nil {
+		t.Error("custom transform should be rejected when hooks are disabled")
+	}
+	if got := transformPreset("cat $IN"); got != "custom" {
+		t.Errorf("transformPreset(custom) = %q, want custom", got)
+	}
+
+	if _, err := parse(url.Values{"transform_preset": {"bogus"}}, true); err == nil {
+		t.Error("unknown preset should be rejected")
+	}
+}
+
+func TestActionModal_TransformedNeedsConfirmation(t *testing.T) {
+	h := testHandler(t)
+
+	w := httptest.NewRecorder()
+	h.renderActionResultModal(w, renderActionModalParams{
+		Action:      "hardlink",
+		Output:      "preview",
+		DryRun:      true,
+		RunID:       "1",
+		GroupIDs:    "1,2",
+		Transformed: true,
+	})
+	body := w.Body.String()
+	if !strings.Contains(body, `name="confirm_transform" value="1" required`) {
+		t.Error("preview of transformed groups should require confirmation")
+	}
+
+	w = httptest.NewRecorder()
+	h.renderActionResultModal(w, renderActionModalParams{Action: "hardlink", Output: "preview", DryRun: true, RunID: "1"})
+	if strings.Contains(w.Body.String(), "confirm_transform") {
+		t.Error("preview of byte-identical groups should not need extra confirmation")
+	}
+}
+
+func TestGroupFilterForm(t *testing.T) {
+	form := parseGroupFilterForm(url.Values{
+		"path":      {" *.jpg "},
+		"ext":       {"jpg"},
+		"min_size":  {"1 MB"},
+		"max_size":  {"bogus"},
+		"min_files": {"3"},
+		"page":      {"2"},
+	})
+	if !form.Active() {
+		t.Error("form should be active")
+	}
+	want := db.DuplicateGroupFilter{Path: "*.jpg", Ext: "jpg", MinSize: 1_000_000, MinFiles: 3}
+	if got := form.filter(); got != want {
+		t.Errorf("filter() = %+v, want %+v", got, want)
+	}
+
+	// The filter round-trips through the action form's encoded query
+	values, _ := url.ParseQuery(form.Query())
+	if got := parseGroupFilterForm(values); got != form {
+		t.Errorf("round trip = %+v, want %+v", got, form)
+	}
+
+	table := GroupsTableData{BaseURL: "/scans/runs/1", SortBy: "size", SortOrder: "asc", Filter: form}
+	link, _ := url.Parse(table.PageURL(3))
+	q := link.Query()
+	if link.Path != "/scans/runs/1" || q.Get("page") != "3" || q.Get("sort") != "size" || q.Get("path") != "*.jpg" || q.Has("status") {
+		t.Errorf("PageURL(3) = %s", table.PageURL(3))
+	}
+
+	if (GroupFilterForm{}).Active() {
+		t.Error("empty form should not be active")
+	}
+
+	link, _ = url.Parse(table.ExportURL("csv"))
+	q = link.Query()
+	if link.Path != "/scans/runs/1/export" || q.Get("format") != "csv" || q.Get("order") != "asc" || q.Get("ext") != "jpg" || q.Has("page") {
+		t.Errorf("ExportURL(csv) = %s", table.ExportURL("csv"))
+	}
+}
+
+func TestScanResultsTemplate_FilterWithNoMatches(t *testing.T) {
+	h := testHandler(t)
+
+	completed := time.Now()
+	w := httptest.NewRecorder()
+	h.render(w, "scan_results.html", ScanResultsData{
+		Title:     "Scan Results",
+		ActiveNav: "history",
+		Run:       &db.ScanRun{ID: 4, Status: db.ScanRunStatusCompleted, CompletedAt: &completed, DuplicateGroups: 2},
+		GroupsTable: GroupsTableData{
+			Interactive: true,
+			BaseURL:     "/scans/runs/4",
+			Filter:      GroupFilterForm{Path: "missing", Ext: "jpg"},
+		},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("render() status = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{`name="path" class="form-input" value="missing"`, `name="filter" id="group-filter" value="ext=jpg&amp;path=missing"`, "No groups to display."} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response missing %q", want)
+		}
+	}
+	if strings.Contains(body, "No duplicates found") {
+		t.Error("filtered results should not report that the scan found nothing")
+	}
+}
+
+func TestScanResultsTemplate_Imported(t *testing.T) {
+	h := testHandler(t)
+
+	completed := time.Now()
+	command := "fclones group --format json /mnt/a"
+	w := httptest.NewRecorder()
+	h.render(w, "scan_results.html", ScanResultsData{
+		Title:     "Scan Results",
+		ActiveNav: "history",
+		Run: &db.ScanRun{ID: 5, Status: db.ScanRunStatusCompleted, CompletedAt: &completed,
+			Paths: []string{"/mnt/a"}, ImportedCommand: &command},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("render() status = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"Imported from fclones report", "<code>" + command + "</code>", `<div class="stat-value">Imported</div>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response missing %q", want)
+		}
+	}
+	if strings.Contains(body, "Files Scanned") {
+		t.Error("imported runs don't know how many files were scanned")
+	}
+}
+
+func TestGroupsTable_CollapsesLinkedFiles(t *testing.T) {
+	h := testHandler(t)
+
+	w := httptest.NewRecorder()
+	h.render(w, "action_detail.html", ActionDetailData{
+		Title:  "Action Details",
+		Action: &db.Action{ID: 1, ActionType: db.ActionTypeHardlink, Status: db.ActionStatusCompleted},
+		GroupsTable: GroupsTableData{
+			Groups: []*db.DuplicateGroup{{ID: 1, FileHash: "h", FileSize: 10, FileCount: 3, WastedBytes: 10,
+				Status: db.DuplicateGroupStatusPending, Files: []string{"/a", "/b", "/c"}, Links: []string{"1:5", "1:6", "1:5"}}},
+			Page: 1, TotalPages: 1, TotalCount: 1,
+		},
+	})
+	body := w.Body.String()
+
+	if !strings.Contains(body, "(1 linked)") {
+		t.Error("file count should note the linked path")
+	}
+	if !strings.Contains(body, `<div class="file-link" title="Hardlinked to the path above">/c</div>`) {
+		t.Error("linked path should be shown under the file it's linked to")
+	}
+}
+
+func TestDirsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"/data/copy", "/data/photos", false},
+		{"/data/copy", "/data/copy/", true},
+		{"/data", "/data/photos", true},
+		{"/data/photos", "/data", true},
+		{"/data/photo", "/data/photos", false},
+		{"/", "/data", true},
+	}
+	for _, tt := range tests {
+		if got := dirsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("dirsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDirectoriesTemplate(t *testing.T) {
+	h := testHandler(t)
+
+	w := httptest.NewRecorder()
+	h.render(w, "directories.html", DirectoriesData{
+		Title:     "Duplicate Directories",
+		ActiveNav: "history",
+		Run:       &db.ScanRun{ID: 5, Status: db.ScanRunStatusCompleted},
+		Pairs: []*db.DirectoryPair{
+			{DirA: "/data/copy", DirB: "/data/photos", Groups: 2, FilesA: 2, FilesB: 2, TotalA: 2, TotalB: 8, SharedBytes: 2048},
+		},
+		Limit: directoryPairsLimit,
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("render() status = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`hx-post="/scans/runs/5/directories/remove"`,
+		`name="remove_dir" value="/data/copy"`,
+		`name="remove_dir" value="/data/photos"`,
+		"2 files (100%)",
+		"2 files (25%)",
+		"full copy",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response missing %q", want)
+		}
+	}
+	if strings.Count(body, "full copy") != 1 {
+		t.Error("only the fully duplicated side should be marked as a full copy")
+	}
+}
+
+func TestBuildWasteTree(t *testing.T) {
+	tree := buildWasteTree([]*db.DirectoryWaste{
+		{Dir: "/data/copy", Files: 3, WastedBytes: 90},
+		{Dir: "/data/photos/2024", Files: 1, WastedBytes: 50},
+		{Dir: "/data/photos", Files: 2, WastedBytes: 10},
+	})
+
+	// The root skips down to the deepest common directory
+	if tree.Path != "/data" || tree.WastedBytes != 150 || tree.Files != 6 || tree.Here != nil {
+		t.Fatalf("root = %+v", tree)
+	}
+	if len(tree.Children) != 2 || tree.Children[0].Name != "copy" || tree.Children[1].Name != "photos" {
+		t.Fatalf("children should be sorted by wasted bytes: %+v", tree.Children)
+	}
+	photos := tree.Children[1]
+	if photos.Path != "/data/photos" || photos.WastedBytes != 60 || photos.Files != 3 || photos.WastedSize != formatBytes(60) {
+		t.Errorf("photos = %+v", photos)
+	}
+	if photos.Here == nil || photos.Here.Files != 2 || photos.Here.WastedBytes != 10 {
+		t.Errorf("photos.Here = %+v, want the files directly in it", photos.Here)
+	}
+	if len(photos.Children) != 1 || photos.Children[0].Path != "/data/photos/2024" {
+		t.Errorf("photos.Children = %+v", photos.Children)
+	}
+
+	// Waste in the root directory keeps the tree rooted there
+	tree = buildWasteTree([]*db.DirectoryWaste{{Dir: "/", Files: 1, WastedBytes: 5}, {Dir: "/data", Files: 1, WastedBytes: 5}})
+	if tree.Path != "/" || tree.Here == nil || len(tree.Children) != 1 {
+		t.Errorf("root with files = %+v", tree)
+	}
+
+	if tree := buildWasteTree(nil); tree.Path != "/" || tree.Files != 0 {
+		t.Errorf("empty tree = %+v", tree)
+	}
+}
+
+func TestRequireAPIMutation(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		want        int
+	}{
+		{"json", http.MethodPost, "application/json", http.StatusOK},
+		{"json with charset", http.MethodPost, "application/json; charset=utf-8", http.StatusOK},
+		{"form post", http.MethodPost, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"no content type", http.MethodPost, "", http.StatusUnsupportedMediaType},
+		{"wrong method", http.MethodGet, "application/json", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/scans", strings.NewReader("{}"))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			ok := requireAPIMutation(w, req, http.MethodPost)
+			if ok != (tt.want == http.StatusOK) || w.Code != tt.want {
+				t.Errorf("requireAPIMutation() = %v with status %d, want status %d", ok, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettingsTemplate_Backups(t *testing.T) {
+	h := testHandler(t)
+
+	w := httptest.NewRecorder()
+	h.render(w, "settings.html", SettingsData{
+		Title:          "Settings",
+		ActiveNav:      "settings",
+		BackupDir:      "/data/backups",
+		BackupInterval: "24h",
+		BackupKeep:     7,
+		Backups: []backup.File{
+			{Name: "kuron-20260102-030405.db", Size: 2048000, CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+	})
+	body := w.Body.String()
+
+	for _, want := range []string{
+		"every <strong>24h</strong>",
+		"/data/backups",
+		`action="/settings/restore"`,
+		`name="name" value="kuron-20260102-030405.db"`,
+		"2.05 MB",
+		`href="/settings/backup"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("settings page missing %q", want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.render(w, "settings.html", SettingsData{Title: "Settings", BackupDir: "/data/backups"})
+	if body := w.Body.String(); !strings.Contains(body, "Scheduled backups are disabled") {
+		t.Error("settings page should say scheduled backups are disabled")
+	}
+}
+
+func TestSettingsTemplate_Retention(t *testing.T) {
+	h := testHandler(t)
+
+	data := SettingsData{
+		Title:             "Settings",
+		RetentionDays:     30,
+		RetentionEditable: true,
+		Retention:         db.RetentionPolicy{GroupDays: 7, ActionDays: 365, KeepRuns: 2},
+	}
+	w := httptest.NewRecorder()
+	h.render(w, "settings.html", data)
+	body := w.Body.String()
+
+	for _, want := range []string{
+		`name="retention_days" value="30"`,
+		`name="keep_runs_per_job" value="2"`,
+		`name="group_retention_days" value="7"`,
+		`name="action_retention_days" value="365"`,
+		`name="stats_retention_days" value="0"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("settings page missing %q", want)
+		}
+	}
+
+	// Scan history retention set via env var can't be edited, but the rest can
+	data.RetentionEditable = false
+	w = httptest.NewRecorder()
+	h.render(w, "settings.html", data)
+	body = w.Body.String()
+	if strings.Contains(body, `name="retention_days"`) || !strings.Contains(body, "KURON_RETENTION_DAYS") {
+		t.Error("locked scan history retention should be shown read-only")
+	}
+	if !strings.Contains(body, `name="group_retention_days"`) {
+		t.Error("other retention settings should stay editable")
+	}
+}
+
+func TestActionDetailTemplate_FileResults(t *testing.T) {
+	h := testHandler(t)
+
+	data := ActionDetailData{
+		Title:  "Action Details",
+		Action: &db.Action{ID: 1, ActionType: db.ActionTypeHardlink, Status: db.ActionStatusCompleted, Files: []string{"/a", "/b", "/c"}},
+		FileResults: []*db.ActionFile{
+			{Path: "/b", Status: db.FileActionDone},
+			{Path: "/c", Status: db.FileActionFailed, Error: "not linked to /a"},
+		},
+	}
+	w := httptest.NewRecorder()
+	h.render(w, "action_detail.html", data)
+	body := w.Body.String()
+
+	for _, want := range []string{
+		"File Results (2)",
+		`<span class="badge badge-done">done</span>`,
+		`<span class="badge badge-failed">failed</span>`,
+		"not linked to /a",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("action page missing %q", want)
+		}
+	}
+	if strings.Contains(body, "Files (3)") {
+		t.Error("plain file list should give way to the file results")
+	}
+}
+
+func TestActionDetailTemplate_Savings(t *testing.T) {
+	h := testHandler(t)
+
+	measured := int64(4000)
+	data := ActionDetailData{
+		Title:           "Action Details",
+		Action:          &db.Action{ID: 1, ActionType: db.ActionTypeHardlink, Status: db.ActionStatusCompleted, BytesSaved: 6000, BytesMeasured: &measured},
+		FreeSpaceChange: formatBytesChange(-2000),
+	}
+	w := httptest.NewRecorder()
+	h.render(w, "action_detail.html", data)
+	body := w.Body.String()
+
+	for _, want := range []string{"Space Saved (Estimated)", "6 KB", "Space Saved (Measured)", "4 KB", "Free Space Change", "-2 KB"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("action page missing %q", want)
+		}
+	}
+
+	// Actions from before measuring show only the estimate
+	data.Action.BytesMeasured = nil
+	data.FreeSpaceChange = ""
+	w = httptest.NewRecorder()
+	h.render(w, "action_detail.html", data)
+	if body := w.Body.String(); strings.Contains(body, "Measured") || strings.Contains(body, "Free Space Change") {
+		t.Error("unmeasured action should show only the estimate")
+	}
+}
+
+func TestJobsImportTemplate_Preview(t *testing.T) {
+	h := testHandler(t)
+
+	w := httptest.NewRecorder()
+	h.render(w, "jobs_import.html", JobsImportData{
+		Title:  "Import Jobs",
+		Config: `{"version": 1, "jobs": []}`,
+		Plan: &jobconfig.Plan{
+			Jobs: []jobconfig.JobChange{
+				{Name: "Photos", Change: jobconfig.ChangeCreate},
+				{Name: "Media", Change: jobconfig.ChangeUpdate, Fields: []string{"cron_expression"}},
+			},
+			Settings: []jobconfig.SettingChange{
+				{Key: "retention_days", Value: "90", Current: "30", Change: jobconfig.ChangeUpdate},
+			},
+		},
+		Created: 1,
+		Updated: 1,
+	})
+	body := w.Body.String()
+
+	for _, want := range []string{
+		"creates <strong>1</strong> job and updates <strong>1</strong>",
+		"<code>cron_expression</code>",
+		"30 &rarr; 90",
+		`name="config_json" value="{&#34;version&#34;: 1, &#34;jobs&#34;: []}"`,
+		`name="confirm" value="1"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("import preview missing %q", want)
+		}
+	}
+
+	// Invalid imports can't be confirmed
+	w = httptest.NewRecorder()
+	h.render(w, "jobs_import.html", JobsImportData{
+		Title: "Import Jobs",
+		Plan: &jobconfig.Plan{Jobs: []jobconfig.JobChange{
+			{Name: "Photos", Change: jobconfig.ChangeCreate, Error: "path not allowed: /etc"},
+		}},
+	})
+	body = w.Body.String()
+	if !strings.Contains(body, "path not allowed: /etc") {
+		t.Error("import preview should show job errors")
+	}
+	if strings.Contains(body, `name="confirm"`) {
+		t.Error("an invalid import should not offer to confirm")
+	}
+}
+
+func TestFormatInterval(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                          "",
+		-time.Hour:                 "",
+		24 * time.Hour:             "24h",
+		90 * time.Minute:           "1h30m",
+		30 * time.Minute:           "30m",
+		45 * time.Second:           "45s",
+		time.Hour + 30*time.Second: "1h0m30s",
+	}
+	for in, want := range tests {
+		if got := formatInterval(in); got != want {
+			t.Errorf("formatInterval(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lyallcooper/kuron/internal/config"
+)
+
+// maxReportUploadMemory is how much of an uploaded report is held in memory;
+// the rest is buffered to a temporary file
+const maxReportUploadMemory = 32 << 20
+
+// ImportReport handles POST /scans/import
+// Creates a scan run from an uploaded fclones report or one at a path on the server.
+func (h *Handler) ImportReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxReportUploadMemory); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	if !h.requireCSRF(w, r) {
+		return
+	}
+
+	reportPath := strings.TrimSpace(r.FormValue("report_path"))
+	renderError := func(errMsg string) {
+		h.render(w, "quick_scan.html", QuickScanData{
+			Title:        "Quick Scan",
+			ActiveNav:    "jobs",
+			CSRFToken:    h.getOrCreateCSRFToken(w, r),
+			AllowedPaths: h.cfg.AllowedPaths,
+			HooksEnabled: h.cfg.HooksEnabled,
+			ReportPath:   reportPath,
+			Error:        errMsg,
+		})
+	}
+
+	var report io.Reader
+	if file, _, err := r.FormFile("report"); err == nil {
+		defer file.Close()
+		report = file
+	} else if reportPath != "" {
+		reportPath = config.ExpandPath(reportPath)
+		if !h.cfg.IsPathAllowed(reportPath) {
+			renderError(fmt.Sprintf("Path not allowed: %s", reportPath))
+			return
+		}
+		f, err := os.Open(reportPath)
+		if err != nil {
+			renderError(fmt.Sprintf("Failed to open report: %v", err))
+			return
+		}
+		defer f.Close()
+		report = f
+	} else {
+		renderError("Choose a report file or enter its path")
+		return
+	}
+
+	run, err := h.scanner.ImportReport(report, h.cfg.IsPathAllowed)
+	if err != nil {
+		renderError(err.Error())
+		return
+	}
+
+	h.redirect(w, r, "/scans/runs/"+strconv.FormatInt(run.ID, 10))
+}
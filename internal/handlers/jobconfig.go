@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/jobconfig"
+)
+
+// maxJobConfigSize is the largest job configuration file accepted for import
+const maxJobConfigSize = 4 << 20
+
+// ExportJobs handles GET /jobs/export
+// Downloads the definitions of all jobs and the settings as a JSON file.
+func (h *Handler) ExportJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	f, err := jobconfig.Export(h.db, now)
+	if err != nil {
+		log.Printf("handlers: job export failed: %v", err)
+		http.Error(w, "Failed to export jobs", http.StatusInternalServerError)
+		return
+	}
+
+	setDownloadHeaders(w, "application/json", "kuron-jobs-"+now.Format("20060102")+".json")
+	if err := jobconfig.Write(w, f); err != nil {
+		log.Printf("handlers: job export failed: %v", err)
+	}
+}
+
+// ImportJobs handles GET/POST /jobs/import
+// An uploaded file is previewed first; resubmitting it with confirm=1
+// creates and updates the jobs and settings in it.
+func (h *Handler) ImportJobs(w http.ResponseWriter, r *http.Request) {
+	data := JobsImportData{
+		Title:     "Import Jobs",
+		ActiveNav: "jobs",
+		CSRFToken: h.getOrCreateCSRFToken(w, r),
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.render(w, "jobs_import.html", data)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxJobConfigSize); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	if !h.requireCSRF(w, r) {
+		return
+	}
+
+	renderError := func(errMsg string) {
+		data.Error = errMsg
+		h.render(w, "jobs_import.html", data)
+	}
+
+	if file, _, err := r.FormFile("config"); err == nil {
+		defer file.Close()
+		content, err := io.ReadAll(io.LimitReader(file, maxJobConfigSize+1))
+		if err != nil {
+			renderError("Failed to read upload")
+			return
+		}
+		if len(content) > maxJobConfigSize {
+			renderError("The file is too large")
+			return
+		}
+		data.Config = string(content)
+	} else {
+		data.Config = r.FormValue("config_json")
+	}
+	if strings.TrimSpace(data.Config) == "" {
+		renderError("Choose a job configuration file to import")
+		return
+	}
+
+	f, err := jobconfig.Read(strings.NewReader(data.Config))
+	if err != nil {
+		data.Config = ""
+		renderError(err.Error())
+		return
+	}
+
+	opts := jobconfig.Options{
+		IsPathAllowed: h.cfg.IsPathAllowed,
+		HooksEnabled:  h.cfg.HooksEnabled,
+	}
+	if h.cfg.RetentionDaysFromEnv {
+		opts.LockedSettings = []string{"retention_days"}
+	}
+
+	// Plan again when confirming, since jobs may have changed since the preview
+	plan, err := jobconfig.NewPlan(h.db, f, opts)
+	if err != nil {
+		renderError("Failed to compare jobs: " + err.Error())
+		return
+	}
+	data.Plan = plan
+	data.Created, data.Updated = plan.Counts()
+
+	if r.FormValue("confirm") != "1" || !plan.Valid() {
+		h.render(w, "jobs_import.html", data)
+		return
+	}
+
+	if err := jobconfig.Apply(h.db, plan, time.Now()); err != nil {
+		log.Printf("handlers: job import failed: %v", err)
+		renderError("Import failed: " + err.Error())
+		return
+	}
+
+	// Apply imported settings to the running server
+	for _, c := range plan.Settings {
+		if c.Key == "retention_days" && c.Change == jobconfig.ChangeUpdate {
+			if days, err := strconv.Atoi(c.Value); err == nil {
+				h.cfg.RetentionDays = days
+			}
+		}
+	}
+
+	msg := fmt.Sprintf("Imported jobs: %d created, %d updated", data.Created, data.Updated)
+	h.redirect(w, r, "/jobs?success="+url.QueryEscape(msg))
+}
@@ -1,18 +1,32 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/lyallcooper/kuron/internal/config"
 	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/scheduler"
 	"github.com/lyallcooper/kuron/internal/services"
-	"github.com/robfig/cron/v3"
 )
 
+// jobEventsLimit is the number of scheduling events shown on the job page
+const jobEventsLimit = 20
+
+// schedulePreviewRuns is the number of upcoming run times shown in the job form
+const schedulePreviewRuns = 5
+
+// managedJobError is shown for attempts to change a job provisioned from the jobs file
+const managedJobError = "This job is managed by the server's jobs file; change it there and restart kuron"
+
 // Jobs handles GET /jobs
 func (h *Handler) Jobs(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
@@ -50,6 +64,7 @@ func (h *Handler) Jobs(w http.ResponseWriter, r *http.Request) {
 		ActiveNav: "jobs",
 		CSRFToken: h.getOrCreateCSRFToken(w, r),
 		Jobs:      views,
+		Success:   r.URL.Query().Get("success"),
 	}
 
 	h.render(w, "jobs.html", data)
@@ -62,6 +77,9 @@ func (h *Handler) JobForm(w http.ResponseWriter, r *http.Request) {
 		ActiveNav:    "jobs",
 		CSRFToken:    h.getOrCreateCSRFToken(w, r),
 		AllowedPaths: h.cfg.AllowedPaths,
+		HooksEnabled: h.cfg.HooksEnabled,
+		GlobalWindow: h.cfg.MaintenanceWindow,
+		OtherJobs:    h.listOtherJobs(0),
 	}
 
 	h.render(w, "job_form.html", data)
@@ -139,6 +157,7 @@ func (h *Handler) parseJobForm(r *http.Request) (*db.ScheduledJob, error) {
 	minSizeStr := r.FormValue("min_size")
 	maxSizeStr := r.FormValue("max_size")
 	cronExpr := strings.TrimSpace(r.FormValue("cron_expression"))
+	timezone := strings.TrimSpace(r.FormValue("timezone"))
 	action := r.FormValue("action")
 	enabled := r.FormValue("enabled") == "1"
 
@@ -205,25 +224,261 @@ func (h *Handler) parseJobForm(r *http.Request) (*db.ScheduledJob, error) {
 		}
 	}
 
+	match, err := parseMatchOptions(r)
+	if err != nil && validationErr == nil {
+		validationErr = err
+	}
+
+	// Parse scheduling policies
+	missedRunPolicy := db.MissedRunPolicy(r.FormValue("missed_run_policy"))
+	switch missedRunPolicy {
+	case db.MissedRunPolicySkip, db.MissedRunPolicyRunOnce:
+	default:
+		missedRunPolicy = db.MissedRunPolicyRunOnce
+	}
+	overlapPolicy := db.OverlapPolicy(r.FormValue("overlap_policy"))
+	switch overlapPolicy {
+	case db.OverlapPolicyForbid, db.OverlapPolicyQueue, db.OverlapPolicyAllow:
+	default:
+		overlapPolicy = db.OverlapPolicyForbid
+	}
+	maintenanceWindow := strings.TrimSpace(r.FormValue("maintenance_window"))
+	if _, err := scheduler.ParseMaintenanceWindow(maintenanceWindow); err != nil && validationErr == nil {
+		validationErr = fmt.Errorf("Invalid maintenance window: %v", err)
+	}
+
+	// Parse resource limits
+	var threads, nice int
+	if t, err := strconv.Atoi(r.FormValue("threads")); err == nil && t > 0 {
+		threads = t
+	}
+	if n, err := strconv.Atoi(r.FormValue("nice")); err == nil && n > 0 {
+		nice = min(n, 19)
+	}
+	ioClass := db.IOClass(r.FormValue("io_class"))
+	switch ioClass {
+	case db.IOClassBestEffort, db.IOClassIdle:
+	default:
+		ioClass = db.IOClassDefault
+	}
+
+	// Parse pipeline steps
+	steps, err := parseJobSteps(r.Form)
+	if err != nil && validationErr == nil {
+		validationErr = err
+	}
+
+	// Audit jobs report files with too few copies (default: no copy at all),
+	// which can't be hardlinked or reflinked
+	if action == "audit" && match.RFUnder == 0 {
+		match.RFUnder = 2
+		if match.RFOver > 0 && validationErr == nil {
+			validationErr = fmt.Errorf("Audit jobs report files with fewer copies; clear \"More copies than\"")
+		}
+	}
+	if match.RFUnder > 0 && validationErr == nil {
+		if action == "scan_hardlink" || action == "scan_reflink" {
+			validationErr = fmt.Errorf("At-risk file scans can only be reported; choose Report Only as the action")
+		}
+		for _, step := range steps {
+			if step.Type == db.JobStepAction {
+				validationErr = fmt.Errorf("At-risk file scans can't be followed by action steps")
+				break
+			}
+		}
+	}
+
+	// Groups matched on transformed content may differ byte-for-byte, so
+	// actions on them must be confirmed from the results page
+	transform, err := parseTransform(r, h.cfg.HooksEnabled)
+	if err != nil && validationErr == nil {
+		validationErr = err
+	}
+	if transform != "" && validationErr == nil {
+		if action == "scan_hardlink" || action == "scan_reflink" {
+			validationErr = fmt.Errorf("Scans with a content transform can't apply actions automatically; choose Scan Only")
+		}
+		for _, step := range steps {
+			if step.Type == db.JobStepAction {
+				validationErr = fmt.Errorf("Scans with a content transform can't be followed by action steps")
+				break
+			}
+		}
+	}
+
+	// Parse hooks (only allowed when enabled by the server)
+	preScanHook := strings.TrimSpace(r.FormValue("pre_scan_hook"))
+	preActionHook := strings.TrimSpace(r.FormValue("pre_action_hook"))
+	postActionHook := strings.TrimSpace(r.FormValue("post_action_hook"))
+	if !h.cfg.HooksEnabled && (preScanHook != "" || preActionHook != "" || postActionHook != "") && validationErr == nil {
+		validationErr = fmt.Errorf("Hook commands are disabled; set KURON_HOOKS_ENABLED=true to use them")
+	}
+
 	return &db.ScheduledJob{
-		Name:            name,
-		Paths:           paths,
-		MinSize:         minSize,
-		MaxSize:         maxSize,
-		IncludePatterns: includePatterns,
-		ExcludePatterns: excludePatterns,
-		CronExpression:  cronExpr,
-		Action:          action,
-		Enabled:         enabled,
-		IncludeHidden:   includeHidden,
-		FollowLinks:     followLinks,
-		OneFileSystem:   oneFileSystem,
-		NoIgnore:        noIgnore,
-		IgnoreCase:      ignoreCase,
-		MaxDepth:        maxDepth,
+		Name:              name,
+		Paths:             paths,
+		MinSize:           minSize,
+		MaxSize:           maxSize,
+		IncludePatterns:   includePatterns,
+		ExcludePatterns:   excludePatterns,
+		CronExpression:    cronExpr,
+		Timezone:          timezone,
+		Action:            action,
+		Enabled:           enabled,
+		IncludeHidden:     includeHidden,
+		FollowLinks:       followLinks,
+		OneFileSystem:     oneFileSystem,
+		NoIgnore:          noIgnore,
+		IgnoreCase:        ignoreCase,
+		MaxDepth:          maxDepth,
+		NamePatterns:      match.NamePatterns,
+		MatchName:         match.MatchName,
+		Isolate:           match.Isolate,
+		MatchLinks:        match.MatchLinks,
+		RFOver:            match.RFOver,
+		RFUnder:           match.RFUnder,
+		Transform:         transform,
+		MissedRunPolicy:   missedRunPolicy,
+		OverlapPolicy:     overlapPolicy,
+		Steps:             steps,
+		MaintenanceWindow: maintenanceWindow,
+		Threads:           threads,
+		Nice:              nice,
+		IOClass:           ioClass,
+		PreScanHook:       preScanHook,
+		PreActionHook:     preActionHook,
+		PostActionHook:    postActionHook,
 	}, validationErr
 }
 
+// parseJobSteps parses the pipeline step rows of the job form. Each row
+// submits every step field, so the field arrays line up by index.
+func parseJobSteps(form url.Values) ([]db.JobStep, error) {
+	field := func(name string, i int) string {
+		if values := form[name]; i < len(values) {
+			return strings.TrimSpace(values[i])
+		}
+		return ""
+	}
+
+	var steps []db.JobStep
+	hasScan := false
+	for i, stepType := range form["step_type"] {
+		step := db.JobStep{Type: db.JobStepType(stepType)}
+		n := len(steps) + 1
+
+		switch step.Type {
+		case db.JobStepScan:
+			for _, p := range strings.Split(field("step_paths", i), "\n") {
+				if p = strings.TrimSpace(p); p != "" {
+					step.Paths = append(step.Paths, config.ExpandPath(p))
+				}
+			}
+			hasScan = true
+		case db.JobStepAction:
+			step.ActionType = db.ActionType(field("step_action", i))
+			if step.ActionType != db.ActionTypeHardlink && step.ActionType != db.ActionTypeReflink {
+				return steps, fmt.Errorf("Step %d: invalid action", n)
+			}
+			if !hasScan {
+				return steps, fmt.Errorf("Step %d: an action step needs a scan step before it", n)
+			}
+		case db.JobStepNotify:
+			step.WebhookURL = field("step_webhook", i)
+			if step.WebhookURL != "" {
+				u, err := url.Parse(step.WebhookURL)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return steps, fmt.Errorf("Step %d: invalid webhook URL: %s", n, step.WebhookURL)
+				}
+			}
+		case db.JobStepWaitForJob:
+			id, err := strconv.ParseInt(field("step_job", i), 10, 64)
+			if err != nil || id <= 0 {
+				return steps, fmt.Errorf("Step %d: choose a job to wait for", n)
+			}
+			step.JobID = id
+		default:
+			return steps, fmt.Errorf("Step %d: unknown step type %q", n, stepType)
+		}
+
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// validateJobSteps checks step paths against the allowlist and that
+// wait-for-job steps reference another existing job
+func (h *Handler) validateJobSteps(job *db.ScheduledJob) error {
+	// The jobs each job waits for, with this job's steps as submitted
+	var waits map[int64][]int64
+	for i, step := range job.Steps {
+		switch step.Type {
+		case db.JobStepScan:
+			if len(h.cfg.AllowedPaths) == 0 {
+				continue
+			}
+			for _, p := range step.Paths {
+				if !h.cfg.IsPathAllowed(p) {
+					return fmt.Errorf("Step %d: path not allowed: %s", i+1, p)
+				}
+			}
+		case db.JobStepWaitForJob:
+			if step.JobID == job.ID {
+				return fmt.Errorf("Step %d: a job can't wait for itself", i+1)
+			}
+			other, err := h.db.GetScheduledJob(step.JobID)
+			if err != nil {
+				return fmt.Errorf("Step %d: job %d not found", i+1, step.JobID)
+			}
+			if waits == nil {
+				if waits, err = h.jobWaits(job); err != nil {
+					return err
+				}
+			}
+			if scheduler.WaitsFor(other.ID, job.ID, func(id int64) []int64 { return waits[id] }) {
+				return fmt.Errorf("Step %d: %s waits for this job, so neither could finish", i+1, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// jobWaits returns the jobs each job waits for, using job's own steps in
+// place of any saved ones
+func (h *Handler) jobWaits(job *db.ScheduledJob) (map[int64][]int64, error) {
+	jobs, err := h.db.ListScheduledJobs()
+	if err != nil {
+		return nil, err
+	}
+	waits := make(map[int64][]int64, len(jobs)+1)
+	for _, j := range append(jobs, job) {
+		waits[j.ID] = nil
+		for _, step := range j.Steps {
+			if step.Type == db.JobStepWaitForJob {
+				waits[j.ID] = append(waits[j.ID], step.JobID)
+			}
+		}
+	}
+	return waits, nil
+}
+
+// listOtherJobs returns all jobs except the given one, for wait-for-job steps
+func (h *Handler) listOtherJobs(excludeID int64) []*db.ScheduledJob {
+	jobs, err := h.db.ListScheduledJobs()
+	if err != nil {
+		log.Printf("handlers: failed to list jobs: %v", err)
+		return nil
+	}
+
+	var others []*db.ScheduledJob
+	for _, j := range jobs {
+		if j.ID != excludeID {
+			others = append(others, j)
+		}
+	}
+	return others
+}
+
 // CreateJob handles POST /jobs
 func (h *Handler) CreateJob(w http.ResponseWriter, r *http.Request) {
 	if !h.requireCSRF(w, r) {
@@ -232,18 +487,23 @@ func (h *Handler) CreateJob(w http.ResponseWriter, r *http.Request) {
 
 	job, err := h.parseJobForm(r)
 
-	// Helper to render form with error
-	renderError := func(errMsg string) {
+	// Helpers to render form with error
+	renderForm := func(errMsg, scheduleErr string) {
 		data := JobFormData{
-			Title:        "New Job",
-			ActiveNav:    "jobs",
-			CSRFToken:    h.getOrCreateCSRFToken(w, r),
-			Job:          job,
-			Error:        errMsg,
-			AllowedPaths: h.cfg.AllowedPaths,
+			Title:         "New Job",
+			ActiveNav:     "jobs",
+			CSRFToken:     h.getOrCreateCSRFToken(w, r),
+			Job:           job,
+			Error:         errMsg,
+			ScheduleError: scheduleErr,
+			AllowedPaths:  h.cfg.AllowedPaths,
+			HooksEnabled:  h.cfg.HooksEnabled,
+			GlobalWindow:  h.cfg.MaintenanceWindow,
+			OtherJobs:     h.listOtherJobs(0),
 		}
 		h.render(w, "job_form.html", data)
 	}
+	renderError := func(errMsg string) { renderForm(errMsg, "") }
 
 	if err != nil {
 		renderError(err.Error())
@@ -272,11 +532,16 @@ func (h *Handler) CreateJob(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Validate cron expression
-	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser.Parse(job.CronExpression)
+	// Validate pipeline steps
+	if err := h.validateJobSteps(job); err != nil {
+		renderError(err.Error())
+		return
+	}
+
+	// Validate schedule (shown next to the field) and calculate next run
+	schedule, err := scheduler.ParseSchedule(job.CronExpression, job.Timezone)
 	if err != nil {
-		renderError("Invalid cron expression: " + err.Error())
+		renderForm("", "Invalid schedule: "+err.Error())
 		return
 	}
 
@@ -306,12 +571,31 @@ func (h *Handler) EditJobForm(w http.ResponseWriter, r *http.Request, id int64)
 		return
 	}
 
+	events, err := h.db.ListJobEvents(id, jobEventsLimit)
+	if err != nil {
+		log.Printf("handlers: failed to load events for job %d: %v", id, err)
+	}
+
+	eventIDs := make([]int64, len(events))
+	for i, e := range events {
+		eventIDs[i] = e.ID
+	}
+	stepRuns, err := h.db.ListJobStepRuns(eventIDs)
+	if err != nil {
+		log.Printf("handlers: failed to load step runs for job %d: %v", id, err)
+	}
+
 	data := JobFormData{
 		Title:        "Edit Job",
 		ActiveNav:    "jobs",
 		CSRFToken:    h.getOrCreateCSRFToken(w, r),
 		Job:          job,
 		AllowedPaths: h.cfg.AllowedPaths,
+		HooksEnabled: h.cfg.HooksEnabled,
+		GlobalWindow: h.cfg.MaintenanceWindow,
+		OtherJobs:    h.listOtherJobs(id),
+		Events:       events,
+		StepRuns:     stepRuns,
 	}
 
 	h.render(w, "job_form.html", data)
@@ -323,21 +607,34 @@ func (h *Handler) UpdateJob(w http.ResponseWriter, r *http.Request, id int64) {
 		return
 	}
 
+	if existing, err := h.db.GetScheduledJob(id); err != nil {
+		http.NotFound(w, r)
+		return
+	} else if existing.Managed {
+		http.Error(w, managedJobError, http.StatusConflict)
+		return
+	}
+
 	job, err := h.parseJobForm(r)
 	job.ID = id
 
-	// Helper to render form with error
-	renderError := func(errMsg string) {
+	// Helpers to render form with error
+	renderForm := func(errMsg, scheduleErr string) {
 		data := JobFormData{
-			Title:        "Edit Job",
-			ActiveNav:    "jobs",
-			CSRFToken:    h.getOrCreateCSRFToken(w, r),
-			Job:          job,
-			Error:        errMsg,
-			AllowedPaths: h.cfg.AllowedPaths,
+			Title:         "Edit Job",
+			ActiveNav:     "jobs",
+			CSRFToken:     h.getOrCreateCSRFToken(w, r),
+			Job:           job,
+			Error:         errMsg,
+			ScheduleError: scheduleErr,
+			AllowedPaths:  h.cfg.AllowedPaths,
+			HooksEnabled:  h.cfg.HooksEnabled,
+			GlobalWindow:  h.cfg.MaintenanceWindow,
+			OtherJobs:     h.listOtherJobs(id),
 		}
 		h.render(w, "job_form.html", data)
 	}
+	renderError := func(errMsg string) { renderForm(errMsg, "") }
 
 	if err != nil {
 		renderError(err.Error())
@@ -366,11 +663,16 @@ func (h *Handler) UpdateJob(w http.ResponseWriter, r *http.Request, id int64) {
 		}
 	}
 
-	// Validate and calculate next run
-	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser.Parse(job.CronExpression)
+	// Validate pipeline steps
+	if err := h.validateJobSteps(job); err != nil {
+		renderError(err.Error())
+		return
+	}
+
+	// Validate schedule (shown next to the field) and calculate next run
+	schedule, err := scheduler.ParseSchedule(job.CronExpression, job.Timezone)
 	if err != nil {
-		renderError("Invalid cron expression: " + err.Error())
+		renderForm("", "Invalid schedule: "+err.Error())
 		return
 	}
 
@@ -402,6 +704,10 @@ func (h *Handler) ToggleJob(w http.ResponseWriter, r *http.Request, id int64) {
 		http.NotFound(w, r)
 		return
 	}
+	if job.Managed {
+		http.Error(w, managedJobError, http.StatusConflict)
+		return
+	}
 
 	if err := h.db.SetJobEnabled(id, !job.Enabled); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -432,36 +738,65 @@ func (h *Handler) runJobByID(w http.ResponseWriter, r *http.Request, id int64) {
 		return
 	}
 
-	// Build scan config from job
-	cfg := &services.ScanConfig{
-		Paths:           job.Paths,
-		MinSize:         job.MinSize,
-		MaxSize:         job.MaxSize,
-		IncludePatterns: job.IncludePatterns,
-		ExcludePatterns: job.ExcludePatterns,
-		IncludeHidden:   job.IncludeHidden,
-		FollowLinks:     job.FollowLinks,
-		OneFileSystem:   job.OneFileSystem,
-		NoIgnore:        job.NoIgnore,
-		IgnoreCase:      job.IgnoreCase,
-		MaxDepth:        job.MaxDepth,
+	run, err := h.startJobRun(r.Context(), job)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, scheduler.ErrJobActive) {
+			status = http.StatusConflict
+		} else if len(job.Steps) > 0 {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
 	}
 
+	// Pipelines show their progress in the job's run history
+	if run == nil {
+		h.redirect(w, r, "/jobs/"+strconv.FormatInt(id, 10)+"/edit")
+		return
+	}
+	h.redirect(w, r, "/scans/runs/"+strconv.FormatInt(run.ID, 10))
+}
+
+// startJobRun starts a run of the job outside its schedule. Pipelines run
+// through the scheduler, so only jobs that just scan return their scan run.
+func (h *Handler) startJobRun(ctx context.Context, job *db.ScheduledJob) (*db.ScanRun, error) {
+	if len(job.Steps) > 0 {
+		if h.scheduler == nil {
+			return nil, errors.New("scheduler is not available")
+		}
+		return nil, h.scheduler.RunNow(job)
+	}
+
+	// Build scan config from job
+	cfg := services.JobScanConfig(job)
+
 	// Start scan
-	run, err := h.scanner.StartScan(r.Context(), cfg, &job.ID)
+	run, err := h.scanner.StartScan(ctx, cfg, &job.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	// Update last run time
+	// Update last run time (a job with an invalid schedule can still be run manually)
 	now := time.Now()
-	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, _ := parser.Parse(job.CronExpression)
-	nextRun := schedule.Next(now)
-	h.db.UpdateJobLastRun(id, now, nextRun)
+	var nextRun time.Time
+	if schedule, err := scheduler.ParseSchedule(job.CronExpression, job.Timezone); err == nil {
+		nextRun = schedule.Next(now)
+	} else if job.NextRunAt != nil {
+		nextRun = *job.NextRunAt
+	}
+	h.db.UpdateJobLastRun(job.ID, now, nextRun)
 
-	h.redirect(w, r, "/scans/runs/"+strconv.FormatInt(run.ID, 10))
+	if err := h.db.CreateJobEvent(&db.JobEvent{
+		JobID:     job.ID,
+		Event:     db.JobEventManual,
+		ScanRunID: &run.ID,
+		Message:   "Started manually",
+	}); err != nil {
+		log.Printf("handlers: failed to record event for job %d: %v", job.ID, err)
+	}
+
+	return run, nil
 }
 
 // DeleteJob handles DELETE /jobs/{id}
@@ -470,6 +805,16 @@ func (h *Handler) DeleteJob(w http.ResponseWriter, r *http.Request, id int64) {
 		return
 	}
 
+	job, err := h.db.GetScheduledJob(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if job.Managed {
+		http.Error(w, managedJobError, http.StatusConflict)
+		return
+	}
+
 	if err := h.db.DeleteScheduledJob(id); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -477,3 +822,41 @@ func (h *Handler) DeleteJob(w http.ResponseWriter, r *http.Request, id int64) {
 
 	h.redirect(w, r, "/jobs")
 }
+
+// SchedulePreview handles GET /api/jobs/schedule-preview
+// Returns the next run times for a cron expression so the job form can
+// show them (and any validation error) while the user types.
+func (h *Handler) SchedulePreview(w http.ResponseWriter, r *http.Request) {
+	expr := r.URL.Query().Get("cron_expression")
+	timezone := r.URL.Query().Get("timezone")
+
+	var preview SchedulePreviewView
+	schedule, err := scheduler.ParseSchedule(expr, timezone)
+	if err != nil {
+		preview.Error = err.Error()
+	} else {
+		preview.NextRuns = formatRunTimes(scheduler.NextRuns(schedule, time.Now(), schedulePreviewRuns))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	data, _ := json.Marshal(preview)
+	w.Write(data)
+}
+
+// formatRunTimes formats upcoming run times for display, including seconds
+// only when the schedule actually uses them
+func formatRunTimes(runs []time.Time) []string {
+	layout := "Mon, Jan 2 2006 15:04 MST"
+	for _, t := range runs {
+		if t.Second() != 0 {
+			layout = "Mon, Jan 2 2006 15:04:05 MST"
+			break
+		}
+	}
+
+	formatted := make([]string, len(runs))
+	for i, t := range runs {
+		formatted[i] = t.Format(layout)
+	}
+	return formatted
+}
@@ -5,12 +5,14 @@ import (
 	"html"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/lyallcooper/kuron/internal/config"
 	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/fclones"
 	"github.com/lyallcooper/kuron/internal/services"
 )
 
@@ -23,6 +25,7 @@ func (h *Handler) QuickScan(w http.ResponseWriter, r *http.Request) {
 			ActiveNav:    "jobs",
 			CSRFToken:    h.getOrCreateCSRFToken(w, r),
 			AllowedPaths: h.cfg.AllowedPaths,
+			HooksEnabled: h.cfg.HooksEnabled,
 		}
 
 		h.render(w, "quick_scan.html", data)
@@ -75,6 +78,8 @@ func (h *Handler) QuickScan(w http.ResponseWriter, r *http.Request) {
 	noIgnore := r.FormValue("no_ignore") == "1"
 	ignoreCase := r.FormValue("ignore_case") == "1"
 	maxDepthStr := r.FormValue("max_depth")
+	match, matchErr := parseMatchOptions(r)
+	transform, transformErr := parseTransform(r, h.cfg.HooksEnabled)
 
 	// Helper to render form with error
 	renderError := func(errMsg string) {
@@ -93,6 +98,14 @@ func (h *Handler) QuickScan(w http.ResponseWriter, r *http.Request) {
 			NoIgnore:        noIgnore,
 			IgnoreCase:      ignoreCase,
 			MaxDepth:        maxDepthStr,
+			NamePatterns:    match.NamePatterns,
+			MatchName:       match.MatchName,
+			Isolate:         match.Isolate,
+			MatchLinks:      match.MatchLinks,
+			RFOver:          r.FormValue("rf_over"),
+			RFUnder:         r.FormValue("rf_under"),
+			Transform:       transform,
+			HooksEnabled:    h.cfg.HooksEnabled,
 			Error:           errMsg,
 		}
 		h.render(w, "quick_scan.html", data)
@@ -138,6 +151,15 @@ func (h *Handler) QuickScan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if matchErr != nil {
+		renderError(matchErr.Error())
+		return
+	}
+	if transformErr != nil {
+		renderError(transformErr.Error())
+		return
+	}
+
 	// Parse max depth
 	var maxDepth *int
 	if maxDepthStr != "" {
@@ -159,6 +181,13 @@ func (h *Handler) QuickScan(w http.ResponseWriter, r *http.Request) {
 		NoIgnore:        noIgnore,
 		IgnoreCase:      ignoreCase,
 		MaxDepth:        maxDepth,
+		NamePatterns:    match.NamePatterns,
+		MatchName:       match.MatchName,
+		Isolate:         match.Isolate,
+		MatchLinks:      match.MatchLinks,
+		RFOver:          match.RFOver,
+		RFUnder:         match.RFUnder,
+		Transform:       transform,
 	}
 
 	// Start scan
@@ -194,6 +223,40 @@ func (h *Handler) ScanResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Handle pause/resume POST
+	if len(parts) >= 5 && (parts[4] == "pause" || parts[4] == "resume") && r.Method == http.MethodPost {
+		h.PauseScan(w, r, parts[3], parts[4] == "pause")
+		return
+	}
+
+	// Handle pin/unpin POST
+	if len(parts) >= 5 && (parts[4] == "pin" || parts[4] == "unpin") && r.Method == http.MethodPost {
+		h.PinScan(w, r, parts[3], parts[4] == "pin")
+		return
+	}
+
+	// Handle wasted space breakdown
+	if len(parts) >= 5 && parts[4] == "waste" {
+		h.ScanWaste(w, r, parts[3])
+		return
+	}
+
+	// Handle exports
+	if len(parts) >= 5 && parts[4] == "export" {
+		h.ExportScan(w, r, parts[3])
+		return
+	}
+
+	// Handle directory analysis
+	if len(parts) >= 5 && parts[4] == "directories" {
+		if len(parts) >= 6 && parts[5] == "remove" && r.Method == http.MethodPost {
+			h.HandleDirectoryRemove(w, r, parts[3])
+		} else {
+			h.ScanDirectories(w, r, parts[3])
+		}
+		return
+	}
+
 	// Handle delete-files POST
 	if len(parts) >= 5 && parts[4] == "delete-files" && r.Method == http.MethodPost {
 		h.HandleDeleteFiles(w, r, parts[3])
@@ -236,10 +299,11 @@ func (h *Handler) ScanResults(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Filter
-	status := query.Get("status")
+	filterForm := parseGroupFilterForm(query)
+	filter := filterForm.filter()
 
 	// Get total count
-	totalCount, err := h.db.CountDuplicateGroups(id, status)
+	totalCount, err := h.db.CountDuplicateGroups(id, filter)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -256,12 +320,12 @@ func (h *Handler) ScanResults(w http.ResponseWriter, r *http.Request) {
 
 	// Get groups with pagination
 	groups, err := h.db.ListDuplicateGroupsPaginated(db.DuplicateGroupQuery{
-		ScanRunID: id,
-		Status:    status,
-		SortBy:    sortBy,
-		SortOrder: sortOrder,
-		Limit:     pageSize,
-		Offset:    (page - 1) * pageSize,
+		ScanRunID:            id,
+		DuplicateGroupFilter: filter,
+		SortBy:               sortBy,
+		SortOrder:            sortOrder,
+		Limit:                pageSize,
+		Offset:               (page - 1) * pageSize,
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -277,25 +341,33 @@ func (h *Handler) ScanResults(w http.ResponseWriter, r *http.Request) {
 	// Fetch actions taken from this scan
 	actions, _ := h.db.ListActionsByScanRun(id)
 
+	var atRiskBytes int64
+	if run.IsAudit() {
+		atRiskBytes, _ = h.db.GetAtRiskBytes(id)
+	}
+
 	data := ScanResultsData{
 		Title:     "Scan Results",
 		ActiveNav: "history",
 		CSRFToken: h.getOrCreateCSRFToken(w, r),
 		Run:       run,
+		Paused:    h.scanner.IsPaused(id),
 		Job:       job,
 		GroupsTable: GroupsTableData{
-			Groups:       groups,
-			Interactive:  true,
-			Page:         page,
-			PageSize:     pageSize,
-			TotalCount:   totalCount,
-			TotalPages:   totalPages,
-			SortBy:       sortBy,
-			SortOrder:    sortOrder,
-			BaseURL:      fmt.Sprintf("/scans/runs/%d", id),
-			StatusFilter: status,
+			Groups:      groups,
+			Interactive: !run.IsAudit(),
+			Audit:       run.IsAudit(),
+			Page:        page,
+			PageSize:    pageSize,
+			TotalCount:  totalCount,
+			TotalPages:  totalPages,
+			SortBy:      sortBy,
+			SortOrder:   sortOrder,
+			BaseURL:     fmt.Sprintf("/scans/runs/%d", id),
+			Filter:      filterForm,
 		},
-		Actions: actions,
+		Actions:     actions,
+		AtRiskBytes: atRiskBytes,
 	}
 
 	h.render(w, "scan_results.html", data)
@@ -324,7 +396,7 @@ func (h *Handler) HandleAction(w http.ResponseWriter, r *http.Request, runIDStr
 	dryRun := !confirm
 
 	selectAll := r.FormValue("select_all") == "1"
-	statusFilter := r.FormValue("status_filter")
+	filterQuery := r.FormValue("filter")
 	groupIDsStr := r.FormValue("group_ids")
 	priority := r.FormValue("remove-priority") // For remove action
 
@@ -332,7 +404,8 @@ func (h *Handler) HandleAction(w http.ResponseWriter, r *http.Request, runIDStr
 
 	if selectAll {
 		// Fetch all group IDs matching the current filter
-		groupIDs, err = h.db.GetDuplicateGroupIDs(runID, statusFilter)
+		filterValues, _ := url.ParseQuery(filterQuery)
+		groupIDs, err = h.db.GetDuplicateGroupIDs(runID, parseGroupFilterForm(filterValues).filter())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -372,6 +445,16 @@ func (h *Handler) HandleAction(w http.ResponseWriter, r *http.Request, runIDStr
 		return
 	}
 
+	// Groups matched on transformed content may differ byte-for-byte, so
+	// applying an action needs an extra confirmation; without it, preview again
+	var transformed bool
+	if run, err := h.db.GetScanRun(runID); err == nil {
+		transformed = run.IsTransformed()
+	}
+	if transformed && r.FormValue("confirm_transform") != "1" {
+		dryRun = true
+	}
+
 	result, err := h.scanner.ExecuteAction(r.Context(), runID, groupIDs, actionType, dryRun, priority)
 
 	// For HTMX requests, show modal with results (or error)
@@ -393,18 +476,25 @@ func (h *Handler) HandleAction(w http.ResponseWriter, r *http.Request, runIDStr
 			output = result.Output
 		}
 
+		var failed int
+		if result != nil {
+			failed = result.Failed
+		}
+
 		h.renderActionResultModal(w, renderActionModalParams{
-			Action:       action,
-			Output:       output,
-			DryRun:       dryRun,
-			RedirectURL:  "/scans/runs/" + runIDStr,
-			RunID:        runIDStr,
-			GroupIDs:     groupIDsStr,
-			SelectAll:    selectAll,
-			StatusFilter: statusFilter,
-			CSRFToken:    csrfToken,
-			Priority:     priority,
-			Error:        errorMsg,
+			Action:      action,
+			Output:      output,
+			Failed:      failed,
+			DryRun:      dryRun,
+			RedirectURL: "/scans/runs/" + runIDStr,
+			RunID:       runIDStr,
+			GroupIDs:    groupIDsStr,
+			SelectAll:   selectAll,
+			Filter:      filterQuery,
+			CSRFToken:   csrfToken,
+			Priority:    priority,
+			Transformed: transformed,
+			Error:       errorMsg,
 		})
 		return
 	}
@@ -419,17 +509,19 @@ func (h *Handler) HandleAction(w http.ResponseWriter, r *http.Request, runIDStr
 
 // renderActionModalParams holds parameters for rendering the action result modal
 type renderActionModalParams struct {
-	Action       string
-	Output       string
-	DryRun       bool
-	RedirectURL  string
-	RunID        string
-	GroupIDs     string
-	SelectAll    bool
-	StatusFilter string
-	CSRFToken    string
-	Priority     string // For remove action
-	Error        string // Error message if action failed
+	Action      string
+	Output      string
+	DryRun      bool
+	RedirectURL string
+	RunID       string
+	GroupIDs    string
+	SelectAll   bool
+	Filter      string // Encoded group filter, for select all
+	CSRFToken   string
+	Priority    string // For remove action
+	Transformed bool   // Groups were matched on transformed content
+	Error       string // Error message if action failed
+	Failed      int    // Files the action failed to change, though it changed others
 }
 
 // renderActionResultModal renders the action results modal
@@ -458,6 +550,9 @@ func (h *Handler) renderActionResultModal(w http.ResponseWriter, p renderActionM
 	if p.Error != "" {
 		title = actionName + " Failed"
 		description = "The operation failed:"
+	} else if p.Failed > 0 {
+		title = actionName + " Partially Complete"
+		description = fmt.Sprintf("%d files couldn't be changed. The following operations were performed:", p.Failed)
 	} else if p.DryRun {
 		title = actionName + " Preview"
 		description = "The following operations would be performed:"
@@ -476,6 +571,13 @@ func (h *Handler) renderActionResultModal(w http.ResponseWriter, p renderActionM
 		if p.SelectAll {
 			selectAllValue = "1"
 		}
+		var transformConfirm string
+		if p.Transformed {
+			transformConfirm = `<label class="form-checkbox">
+				<input type="checkbox" name="confirm_transform" value="1" required>
+				<span>I've checked these files are the same</span>
+			</label>`
+		}
 		confirmForm = `<form method="POST" action="/scans/runs/` + p.RunID + `/action" style="display:inline;"
 			hx-post="/scans/runs/` + p.RunID + `/action"
 			hx-target="#modal-backdrop"
@@ -484,9 +586,9 @@ func (h *Handler) renderActionResultModal(w http.ResponseWriter, p renderActionM
 			<input type="hidden" name="action" value="` + p.Action + `">
 			<input type="hidden" name="group_ids" value="` + html.EscapeString(p.GroupIDs) + `">
 			<input type="hidden" name="select_all" value="` + selectAllValue + `">
-			<input type="hidden" name="status_filter" value="` + html.EscapeString(p.StatusFilter) + `">
+			<input type="hidden" name="filter" value="` + html.EscapeString(p.Filter) + `">
 			<input type="hidden" name="remove-priority" value="` + html.EscapeString(p.Priority) + `">
-			<input type="hidden" name="confirm" value="1">
+			<input type="hidden" name="confirm" value="1">` + transformConfirm + `
 			<button type="submit" class="` + confirmBtnClass + `">
 				<span class="btn-text">` + confirmBtnText + `</span>
 				<span class="btn-spinner"><span class="spinner"></span></span>
@@ -503,6 +605,9 @@ func (h *Handler) renderActionResultModal(w http.ResponseWriter, p renderActionM
 		if p.Action == "remove" {
 			warningHTML = `<p class="muted" style="margin:0.75rem 0 0;">Warning: this cannot be undone</p>`
 		}
+		if p.Transformed {
+			warningHTML += `<p class="muted" style="margin:0.75rem 0 0;">These files were matched on transformed content and may not be identical. Data that differs, such as metadata, will be lost.</p>`
+		}
 	} else {
 		footerButtons = `<button class="btn" onclick="window.location.href='` + p.RedirectURL + `'">Done</button>`
 	}
@@ -561,41 +666,115 @@ func (h *Handler) CancelScan(w http.ResponseWriter, r *http.Request, runIDStr st
 	h.redirect(w, r, "/scans/runs/"+runIDStr)
 }
 
+// PauseScan handles POST /scans/runs/{id}/pause and /scans/runs/{id}/resume
+func (h *Handler) PauseScan(w http.ResponseWriter, r *http.Request, runIDStr string, pause bool) {
+	if !h.requireCSRF(w, r) {
+		return
+	}
+
+	runID, err := strconv.ParseInt(runIDStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if pause {
+		err = h.scanner.PauseScan(runID)
+	} else {
+		err = h.scanner.ResumeScan(runID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	h.redirect(w, r, "/scans/runs/"+runIDStr)
+}
+
+// PinScan handles POST /scans/runs/{id}/pin and /unpin
+func (h *Handler) PinScan(w http.ResponseWriter, r *http.Request, runIDStr string, pin bool) {
+	if !h.requireCSRF(w, r) {
+		return
+	}
+
+	runID, err := strconv.ParseInt(runIDStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if _, err := h.db.GetScanRun(runID); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := h.db.SetScanRunPinned(runID, pin); err != nil {
+		http.Error(w, "Failed to update scan run", http.StatusInternalServerError)
+		return
+	}
+	h.redirect(w, r, "/scans/runs/"+runIDStr)
+}
+
 // HandleDeleteFiles handles POST /scans/runs/{id}/delete-files for manual file deletion
 func (h *Handler) HandleDeleteFiles(w http.ResponseWriter, r *http.Request, runIDStr string) {
 	if !h.requireCSRF(w, r) {
 		return
 	}
 
+	runID, err := strconv.ParseInt(runIDStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	run, err := h.db.GetScanRun(runID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Files of an audit are at risk, not duplicates
+	if run.IsAudit() {
+		http.Error(w, services.ErrAuditScan.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Always preview first unless explicitly confirming
 	confirm := r.FormValue("confirm") == "1"
-	dryRun := !confirm
 
-	filePathsStr := r.FormValue("file_paths")
-	filePaths := strings.Split(filePathsStr, "\n")
+	var paths []string
+	for _, path := range strings.Split(r.FormValue("file_paths"), "\n") {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
 
 	// Parse group IDs for marking as processed
-	groupIDsStr := r.FormValue("group_ids")
 	var groupIDs []int64
-	for _, idStr := range strings.Split(groupIDsStr, ",") {
+	for _, idStr := range strings.Split(r.FormValue("group_ids"), ",") {
 		if id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64); err == nil {
 			groupIDs = append(groupIDs, id)
 		}
 	}
 
-	var results []string
-	var processedFiles []string
-	var deletedCount, errorCount int
+	h.deleteFiles(w, r, run, paths, groupIDs, !confirm)
+}
 
-	// Count valid files first for summary
-	var validPaths []string
-	for _, path := range filePaths {
-		path = strings.TrimSpace(path)
-		if path != "" {
-			validPaths = append(validPaths, path)
-		}
+// deleteFiles deletes files of a scan run's groups, or previews the deletion,
+// and renders the result modal
+func (h *Handler) deleteFiles(w http.ResponseWriter, r *http.Request, run *db.ScanRun, validPaths []string, groupIDs []int64, dryRun bool) {
+	runIDStr := strconv.FormatInt(run.ID, 10)
+
+	// As with actions, files matched on transformed content need an extra
+	// confirmation before deleting; without it, preview again
+	if run.IsTransformed() && r.FormValue("confirm_transform") != "1" {
+		dryRun = true
 	}
 
+	var results []string
+	var processedFiles, deletedFiles, failedFiles []string
+	var fileResults []db.ActionFile
+	var deletedCount, errorCount int
+
 	// Add input summary (consistent with fclones actions)
 	results = append(results, fmt.Sprintf("# Input: %d files from %d groups", len(validPaths), len(groupIDs)))
 
@@ -618,9 +797,13 @@ func (h *Handler) HandleDeleteFiles(w http.ResponseWriter, r *http.Request, runI
 			if err := os.Remove(path); err != nil {
 				results = append(results, rmCmd)
 				results = append(results, fmt.Sprintf("error: %v", err))
+				failedFiles = append(failedFiles, path)
+				fileResults = append(fileResults, db.ActionFile{Path: path, Status: db.FileActionFailed, Error: err.Error()})
 				errorCount++
 			} else {
 				results = append(results, rmCmd)
+				deletedFiles = append(deletedFiles, path)
+				fileResults = append(fileResults, db.ActionFile{Path: path, Status: db.FileActionDeleted})
 				deletedCount++
 			}
 		}
@@ -630,42 +813,46 @@ func (h *Handler) HandleDeleteFiles(w http.ResponseWriter, r *http.Request, runI
 
 	// Record action when files are actually deleted (not dry-run)
 	if !dryRun && (deletedCount > 0 || errorCount > 0) {
-		runID, err := strconv.ParseInt(runIDStr, 10, 64)
+		action, err := h.db.CreateAction(&db.Action{
+			ScanRunID:  run.ID,
+			ActionType: db.ActionTypeDelete,
+		})
 		if err != nil {
-			log.Printf("handlers: failed to parse run ID %q for action recording: %v", runIDStr, err)
+			log.Printf("handlers: failed to create delete action: %v", err)
 		} else {
-			action, err := h.db.CreateAction(&db.Action{
-				ScanRunID:  runID,
-				ActionType: db.ActionTypeDelete,
-			})
-			if err != nil {
-				log.Printf("handlers: failed to create delete action: %v", err)
-			} else {
-				status := db.ActionStatusCompleted
-				var errMsg *string
-				if errorCount > 0 && deletedCount == 0 {
-					status = db.ActionStatusFailed
-					msg := fmt.Sprintf("%d errors", errorCount)
-					errMsg = &msg
-				}
-				if err := h.db.CompleteAction(action.ID, &db.ActionCompletion{
-					GroupsProcessed: len(groupIDs),
-					FilesProcessed:  deletedCount,
-					Status:          status,
-					ErrorMessage:    errMsg,
-					Output:          &output,
-					Files:           processedFiles,
-					GroupIDs:        groupIDs,
-				}); err != nil {
-					log.Printf("handlers: failed to complete delete action: %v", err)
-				}
+			status := db.ActionStatusCompleted
+			var errMsg *string
+			if errorCount > 0 && deletedCount == 0 {
+				status = db.ActionStatusFailed
+				msg := fmt.Sprintf("%d errors", errorCount)
+				errMsg = &msg
+			}
+			if err := h.db.CompleteAction(action.ID, &db.ActionCompletion{
+				GroupsProcessed: len(groupIDs),
+				FilesProcessed:  deletedCount,
+				Status:          status,
+				ErrorMessage:    errMsg,
+				Output:          &output,
+				Files:           processedFiles,
+				GroupIDs:        groupIDs,
+				Results:         fileResults,
+			}); err != nil {
+				log.Printf("handlers: failed to complete delete action: %v", err)
 			}
 
-			// Mark affected groups as processed (if any files were deleted)
-			if deletedCount > 0 && len(groupIDs) > 0 {
-				if err := h.db.UpdateDuplicateGroupStatus(groupIDs, db.DuplicateGroupStatusProcessed); err != nil {
-					log.Printf("handlers: failed to update group status: %v", err)
-				}
+			// Record the outcome for each file
+			if err := h.db.SetGroupFilesActionStatus(groupIDs, deletedFiles, action.ID, db.FileActionDeleted); err != nil {
+				log.Printf("handlers: failed to record deleted files: %v", err)
+			}
+			if err := h.db.SetGroupFilesActionStatus(groupIDs, failedFiles, action.ID, db.FileActionFailed); err != nil {
+				log.Printf("handlers: failed to record failed files: %v", err)
+			}
+		}
+
+		// Mark affected groups as processed (if any files were deleted)
+		if deletedCount > 0 && len(groupIDs) > 0 {
+			if err := h.db.UpdateDuplicateGroupStatus(groupIDs, db.DuplicateGroupStatusProcessed); err != nil {
+				log.Printf("handlers: failed to update group status: %v", err)
 			}
 		}
 	}
@@ -676,13 +863,19 @@ func (h *Handler) HandleDeleteFiles(w http.ResponseWriter, r *http.Request, runI
 		csrfToken = cookie.Value
 	}
 
+	groupIDStrs := make([]string, len(groupIDs))
+	for i, id := range groupIDs {
+		groupIDStrs[i] = strconv.FormatInt(id, 10)
+	}
+
 	h.renderDeleteFilesModal(w, deleteFilesModalParams{
 		Output:      output,
 		DryRun:      dryRun,
-		FilePaths:   filePathsStr,
-		GroupIDs:    groupIDsStr,
+		FilePaths:   strings.Join(validPaths, "\n"),
+		GroupIDs:    strings.Join(groupIDStrs, ","),
 		RunID:       runIDStr,
 		CSRFToken:   csrfToken,
+		Transformed: run.IsTransformed(),
 		DeleteCount: deletedCount,
 		ErrorCount:  errorCount,
 	})
@@ -696,6 +889,7 @@ type deleteFilesModalParams struct {
 	GroupIDs    string
 	RunID       string
 	CSRFToken   string
+	Transformed bool // Groups were matched on transformed content
 	DeleteCount int
 	ErrorCount  int
 }
@@ -719,6 +913,13 @@ func (h *Handler) renderDeleteFilesModal(w http.ResponseWriter, p deleteFilesMod
 
 	var confirmForm string
 	if p.DryRun {
+		var transformConfirm string
+		if p.Transformed {
+			transformConfirm = `<label class="form-checkbox">
+				<input type="checkbox" name="confirm_transform" value="1" required>
+				<span>I've checked these files are the same</span>
+			</label>`
+		}
 		confirmForm = `<form method="POST" action="/scans/runs/` + p.RunID + `/delete-files" style="display:inline;"
 			hx-post="/scans/runs/` + p.RunID + `/delete-files"
 			hx-target="#modal-backdrop"
@@ -726,7 +927,7 @@ func (h *Handler) renderDeleteFilesModal(w http.ResponseWriter, p deleteFilesMod
 			<input type="hidden" name="` + csrfFormField + `" value="` + p.CSRFToken + `">
 			<input type="hidden" name="file_paths" value="` + html.EscapeString(p.FilePaths) + `">
 			<input type="hidden" name="group_ids" value="` + html.EscapeString(p.GroupIDs) + `">
-			<input type="hidden" name="confirm" value="1">
+			<input type="hidden" name="confirm" value="1">` + transformConfirm + `
 			<button type="submit" class="btn btn-danger">
 				<span class="btn-text">Delete Files</span>
 				<span class="btn-spinner"><span class="spinner"></span></span>
@@ -738,6 +939,9 @@ func (h *Handler) renderDeleteFilesModal(w http.ResponseWriter, p deleteFilesMod
 	if p.DryRun {
 		footerButtons = `<button class="btn" onclick="closeModal()">Cancel</button>` + confirmForm
 		warningHTML = `<p class="muted" style="margin:0.75rem 0 0;">Warning: this cannot be undone</p>`
+		if p.Transformed {
+			warningHTML += `<p class="muted" style="margin:0.75rem 0 0;">These files were matched on transformed content and may not be identical to the copies kept.</p>`
+		}
 	} else {
 		footerButtons = `<button class="btn" onclick="window.location.reload()">Done</button>`
 	}
@@ -771,6 +975,106 @@ document.addEventListener('keydown', function(e) {
 	w.Write([]byte(modalHTML))
 }
 
+// matchOptions holds the fclones matching modes from a scan or job form
+type matchOptions struct {
+	NamePatterns []string
+	MatchName    bool
+	Isolate      bool
+	MatchLinks   bool
+	RFOver       int
+	RFUnder      int
+}
+
+// parseMatchOptions parses the matching mode fields shared by the quick scan
+// and job forms. Only one of the replication factor limits may be set.
+func parseMatchOptions(r *http.Request) (matchOptions, error) {
+	m := matchOptions{
+		MatchName:  r.FormValue("match_name") == "1",
+		Isolate:    r.FormValue("isolate") == "1",
+		MatchLinks: r.FormValue("match_links") == "1",
+	}
+	for _, p := range r.Form["name_patterns"] {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			m.NamePatterns = append(m.NamePatterns, p)
+		}
+	}
+
+	parseCopies := func(field string) (int, error) {
+		s := strings.TrimSpace(r.FormValue(field))
+		if s == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("Invalid copy count: %s", s)
+		}
+		return n, nil
+	}
+	var err error
+	if m.RFOver, err = parseCopies("rf_over"); err != nil {
+		return m, err
+	}
+	if m.RFUnder, err = parseCopies("rf_under"); err != nil {
+		return m, err
+	}
+	if m.RFOver > 0 && m.RFUnder > 0 {
+		return m, fmt.Errorf("Set either more than or fewer than copies, not both")
+	}
+	return m, nil
+}
+
+// parseTransform returns the content transform command selected on a scan or
+// job form: a preset's command, or a custom command if allowCustom is set.
+func parseTransform(r *http.Request, allowCustom bool) (string, error) {
+	preset := r.FormValue("transform_preset")
+	switch preset {
+	case "":
+		return "", nil
+	case "custom":
+		command := strings.TrimSpace(r.FormValue("transform"))
+		if command != "" && !allowCustom {
+			return command, fmt.Errorf("Custom transform commands are disabled (set KURON_HOOKS_ENABLED=true)")
+		}
+		return command, nil
+	}
+	command, ok := fclones.TransformPresetCommand(preset)
+	if !ok {
+		return "", fmt.Errorf("Unknown content transform: %s", preset)
+	}
+	return command, nil
+}
+
+// parseGroupFilterForm reads the scan results filter from query parameters
+func parseGroupFilterForm(v url.Values) GroupFilterForm {
+	return GroupFilterForm{
+		Status:   v.Get("status"),
+		Path:     strings.TrimSpace(v.Get("path")),
+		Dir:      strings.TrimSpace(v.Get("dir")),
+		Ext:      strings.TrimSpace(v.Get("ext")),
+		MinSize:  strings.TrimSpace(v.Get("min_size")),
+		MaxSize:  strings.TrimSpace(v.Get("max_size")),
+		MinFiles: strings.TrimSpace(v.Get("min_files")),
+		MaxFiles: strings.TrimSpace(v.Get("max_files")),
+	}
+}
+
+// filter converts the form to a database filter. Invalid sizes and counts are
+// ignored, like other malformed query parameters.
+func (f GroupFilterForm) filter() db.DuplicateGroupFilter {
+	filter := db.DuplicateGroupFilter{
+		Status: f.Status,
+		Path:   f.Path,
+		Dir:    f.Dir,
+		Ext:    f.Ext,
+	}
+	filter.MinSize, _ = parseSizeWithError(f.MinSize)
+	filter.MaxSize, _ = parseSizeWithError(f.MaxSize)
+	filter.MinFiles, _ = strconv.Atoi(f.MinFiles)
+	filter.MaxFiles, _ = strconv.Atoi(f.MaxFiles)
+	return filter
+}
+
 // parseSizeWithError parses a human-readable size string to bytes, returning an error if invalid
 // Supports both decimal (MB, GB) and binary (MiB, GiB) units
 func parseSizeWithError(s string) (int64, error) {
@@ -3,12 +3,16 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/lyallcooper/kuron/internal/backup"
 )
 
 // Settings handles GET/POST /settings
@@ -26,17 +30,32 @@ func (h *Handler) Settings(w http.ResponseWriter, r *http.Request) {
 		fclonesVersion = version
 	}
 
+	backups, err := backup.List(h.cfg.BackupDir)
+	if err != nil {
+		log.Printf("handlers: failed to list backups: %v", err)
+	}
+
+	retention, err := h.db.GetRetentionPolicy()
+	if err != nil {
+		log.Printf("handlers: failed to load retention policy: %v", err)
+	}
+
 	data := SettingsData{
 		Title:             "Settings",
 		ActiveNav:         "settings",
 		CSRFToken:         h.getOrCreateCSRFToken(w, r),
 		RetentionDays:     h.cfg.RetentionDays,
 		RetentionEditable: !h.cfg.RetentionDaysFromEnv,
+		Retention:         retention,
 		Version:           h.version,
 		FclonesVersion:    fclonesVersion,
 		DBPath:            h.cfg.DBPath,
 		Port:              h.cfg.Port,
 		AllowedPaths:      h.cfg.AllowedPaths,
+		BackupDir:         h.cfg.BackupDir,
+		BackupInterval:    formatInterval(h.cfg.BackupInterval),
+		BackupKeep:        h.cfg.BackupKeep,
+		Backups:           backups,
 		Error:             r.URL.Query().Get("error"),
 		Success:           r.URL.Query().Get("success"),
 	}
@@ -44,33 +63,68 @@ func (h *Handler) Settings(w http.ResponseWriter, r *http.Request) {
 	h.render(w, "settings.html", data)
 }
 
+// formatInterval formats a configured interval without zero trailing units,
+// e.g. "24h" or "1h30m", or returns "" if it's not positive
+func formatInterval(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// retentionFields are the retention settings on the settings form, with
+// their allowed ranges and the error shown for values outside them
+var retentionFields = []struct {
+	key      string
+	min, max int
+	message  string
+}{
+	{"retention_days", 1, 9999, "Scan history retention must be between 1 and 9999 days"},
+	{"keep_runs_per_job", 0, 1000, "Runs kept per job must be between 0 and 1000"},
+	{"group_retention_days", 0, 9999, "Group retention must be between 0 and 9999 days"},
+	{"action_retention_days", 0, 9999, "Action retention must be between 0 and 9999 days"},
+	{"stats_retention_days", 0, 9999, "Stats retention must be between 0 and 9999 days"},
+}
+
 // UpdateSettings handles POST /settings
 func (h *Handler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	if !h.requireCSRF(w, r) {
 		return
 	}
 
-	// Only allow updating if not set via env var
-	if h.cfg.RetentionDaysFromEnv {
-		h.redirect(w, r, "/settings?error=Retention+is+set+via+environment+variable")
-		return
-	}
-
-	retentionStr := r.FormValue("retention_days")
-	retention, err := strconv.Atoi(retentionStr)
-	if err != nil || retention < 1 || retention > 9999 {
-		h.redirect(w, r, "/settings?error=Retention+must+be+between+1+and+9999+days")
-		return
+	values := make(map[string]int)
+	for _, f := range retentionFields {
+		// Scan history retention can't be changed if set via env var
+		if f.key == "retention_days" && h.cfg.RetentionDaysFromEnv {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(r.FormValue(f.key)))
+		if err != nil || n < f.min || n > f.max {
+			h.redirect(w, r, "/settings?error="+url.QueryEscape(f.message))
+			return
+		}
+		values[f.key] = n
 	}
 
 	// Save to database
-	if err := h.db.SetSetting("retention_days", retentionStr); err != nil {
-		h.redirect(w, r, "/settings?error=Failed+to+save+setting")
-		return
+	for key, n := range values {
+		if err := h.db.SetSetting(key, strconv.Itoa(n)); err != nil {
+			h.redirect(w, r, "/settings?error=Failed+to+save+setting")
+			return
+		}
 	}
 
 	// Update in-memory config
-	h.cfg.RetentionDays = retention
+	if days, ok := values["retention_days"]; ok {
+		h.cfg.RetentionDays = days
+	}
 
 	h.redirect(w, r, "/settings?success=Settings+saved")
 }
@@ -45,12 +45,16 @@ func (h *Handler) ScanProgressSSE(w http.ResponseWriter, r *http.Request) {
 	// Send initial state and check if already complete
 	run, err := h.db.GetScanRun(runID)
 	if err == nil {
+		status := string(run.Status)
+		if h.scanner.IsPaused(runID) {
+			status = "paused"
+		}
 		h.sendScanProgress(w, flusher, &types.ScanProgress{
 			FilesScanned: run.FilesScanned,
 			BytesScanned: run.BytesScanned,
 			GroupsFound:  run.DuplicateGroups,
 			WastedBytes:  run.WastedBytes,
-			Status:       string(run.Status),
+			Status:       status,
 		})
 
 		// If scan already completed, send complete event and wait briefly for client
@@ -74,7 +78,7 @@ func (h *Handler) ScanProgressSSE(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			h.sendScanProgress(w, flusher, update)
-			if update.Status != "running" {
+			if !scanInProgress(update.Status) {
 				h.sendEvent(w, flusher, "complete", fmt.Sprintf(`{"status":"%s"}`, update.Status))
 				h.waitForClientOrTimeout(r, 2*time.Second)
 				return
@@ -83,6 +87,11 @@ func (h *Handler) ScanProgressSSE(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// scanInProgress reports whether a progress status means the scan hasn't finished
+func scanInProgress(status string) bool {
+	return status == "running" || status == "paused"
+}
+
 // waitForClientOrTimeout waits for the client to disconnect or times out
 func (h *Handler) waitForClientOrTimeout(r *http.Request, timeout time.Duration) {
 	select {
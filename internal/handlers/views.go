@@ -1,6 +1,13 @@
 package handlers
 
-import "github.com/lyallcooper/kuron/internal/db"
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/lyallcooper/kuron/internal/backup"
+	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/jobconfig"
+)
 
 // View model structs for templates.
 // These are separate from db models to allow formatting and presentation logic.
@@ -10,16 +17,44 @@ type DashboardData struct {
 	Title       string
 	ActiveNav   string
 	Stats       DashboardStats
+	Trends      TrendsView
 	RecentScans []*ScanRunView
 	Jobs        []*JobView
 	Error       string
 }
 
+// TrendsView holds the dashboard's charts of activity over time
+type TrendsView struct {
+	Range  string // 30d, 90d, 1y or all
+	Job    string // Job ID, "0" for quick scans and imports, or empty for all
+	From   string // Label of the first bar
+	To     string // Label of the last bar
+	Charts []TrendChart
+	Empty  bool // No activity in the range
+}
+
+// TrendChart is a bar chart of one statistic
+type TrendChart struct {
+	Title string
+	Total string
+	Bars  []TrendBar
+}
+
+// TrendBar is one day, week or month of a trend chart
+type TrendBar struct {
+	Label  string
+	Value  string
+	Height int // Percentage of the chart's tallest bar
+}
+
 // DashboardStats holds dashboard statistics
 type DashboardStats struct {
 	TotalSaved    int64
 	PendingGroups int
 	RecentScans   int
+	AtRiskFiles   int64 // From the latest audit scan of each job
+	AtRiskBytes   int64
+	AuditScans    int
 }
 
 // ScanRunView is a view model for scan runs on the dashboard
@@ -37,11 +72,14 @@ type JobView struct {
 	Name           string
 	PathCount      int
 	CronExpression string
+	Timezone       string
 	Action         string
+	StepCount      int // Number of pipeline steps (0 = plain scan/action job)
 	NextRunAt      string
 	LastRunAt      string
 	LastRunID      int64
 	Enabled        bool
+	Managed        bool // Provisioned from the server's jobs file
 }
 
 // toJobView converts a ScheduledJob to a JobView
@@ -51,11 +89,15 @@ func toJobView(job *db.ScheduledJob) *JobView {
 		Name:           job.Name,
 		PathCount:      len(job.Paths),
 		CronExpression: job.CronExpression,
+		Timezone:       job.Timezone,
 		Action:         job.Action,
+		StepCount:      len(job.Steps),
 		Enabled:        job.Enabled,
+		Managed:        job.Managed,
 	}
+	// Run times are shown in server local time, whatever the job's timezone
 	if job.NextRunAt != nil {
-		view.NextRunAt = job.NextRunAt.Format("2006-01-02 15:04")
+		view.NextRunAt = job.NextRunAt.Local().Format("2006-01-02 15:04")
 	}
 	if job.LastRunAt != nil {
 		view.LastRunAt = job.LastRunAt.Format("2006-01-02 15:04")
@@ -69,16 +111,53 @@ type JobsData struct {
 	ActiveNav string
 	CSRFToken string
 	Jobs      []*JobView
+	Success   string
+}
+
+// JobsImportData holds data for the job import template
+type JobsImportData struct {
+	Title     string
+	ActiveNav string
+	CSRFToken string
+	Config    string          // The uploaded file, resubmitted to apply the import
+	Plan      *jobconfig.Plan // Preview of the changes (nil until a file is uploaded)
+	Created   int
+	Updated   int
+	Error     string
 }
 
 // JobFormData holds data for the job form template
 type JobFormData struct {
-	Title        string
-	ActiveNav    string
-	CSRFToken    string
-	Job          *db.ScheduledJob
-	Error        string
-	AllowedPaths []string
+	Title         string
+	ActiveNav     string
+	CSRFToken     string
+	Job           *db.ScheduledJob
+	Error         string
+	ScheduleError string // Schedule validation error, shown next to the field
+	AllowedPaths  []string
+	HooksEnabled  bool                       // Whether hook commands may be set
+	GlobalWindow  string                     // Maintenance window used by jobs without their own
+	OtherJobs     []*db.ScheduledJob         // Jobs a wait-for-job step can reference
+	Events        []*db.JobEvent             // Recent scheduling decisions (edit only)
+	StepRuns      map[int64][]*db.JobStepRun // Pipeline step outcomes by event ID (edit only)
+}
+
+// SchedulePreviewView is the JSON response for a job schedule preview
+type SchedulePreviewView struct {
+	NextRuns []string `json:"next_runs"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// WasteNode is a directory in the JSON breakdown of a scan's redundant bytes,
+// with the totals of everything under it
+type WasteNode struct {
+	Name        string       `json:"name"`
+	Path        string       `json:"path"`
+	WastedBytes int64        `json:"wasted_bytes"`
+	WastedSize  string       `json:"wasted_size"` // WastedBytes formatted for display
+	Files       int          `json:"files"`
+	Children    []*WasteNode `json:"children,omitempty"`
+	Here        *WasteNode   `json:"here,omitempty"` // Files directly in the directory
 }
 
 // QuickScanData holds data for the quick scan template
@@ -93,6 +172,8 @@ type QuickScanData struct {
 	ExcludePatterns []string
 	Error           string
 	AllowedPaths    []string
+	HooksEnabled    bool   // Whether custom transform commands may be set
+	ReportPath      string // Server path of an fclones report to import
 
 	// Advanced options
 	IncludeHidden bool
@@ -101,6 +182,15 @@ type QuickScanData struct {
 	NoIgnore      bool
 	IgnoreCase    bool
 	MaxDepth      string
+
+	// Matching modes
+	NamePatterns []string
+	MatchName    bool
+	Isolate      bool
+	MatchLinks   bool
+	RFOver       string
+	RFUnder      string
+	Transform    string
 }
 
 // ScanResultsData holds data for the scan results template
@@ -109,9 +199,21 @@ type ScanResultsData struct {
 	ActiveNav   string
 	CSRFToken   string
 	Run         *db.ScanRun
+	Paused      bool             // Whether the running scan is paused
 	Job         *db.ScheduledJob // The job this scan was from, if any
 	GroupsTable GroupsTableData
 	Actions     []*db.Action // Actions taken from this scan
+	AtRiskBytes int64        // Total size of at-risk files (audit scans only)
+}
+
+// DirectoriesData holds data for the duplicate directories template
+type DirectoriesData struct {
+	Title     string
+	ActiveNav string
+	CSRFToken string
+	Run       *db.ScanRun
+	Pairs     []*db.DirectoryPair
+	Limit     int // Most pairs shown
 }
 
 // HistoryData holds data for the history template
@@ -139,36 +241,105 @@ type SettingsData struct {
 	CSRFToken         string
 	RetentionDays     int
 	RetentionEditable bool
+	Retention         db.RetentionPolicy // Stored policy; RetentionDays overrides its RunDays
 	Version           string
 	FclonesVersion    string
 	DBPath            string
 	Port              int
 	AllowedPaths      []string
+	BackupDir         string
+	BackupInterval    string // Empty when scheduled backups are disabled
+	BackupKeep        int
+	Backups           []backup.File // Newest first
 	Error             string
 	Success           string
 }
 
 // ActionDetailData holds data for the action detail template
 type ActionDetailData struct {
-	Title       string
-	ActiveNav   string
-	Action      *db.Action
-	Run         *db.ScanRun // The scan run this action was from
-	GroupsTable GroupsTableData
+	Title           string
+	ActiveNav       string
+	Action          *db.Action
+	Run             *db.ScanRun // The scan run this action was from
+	GroupsTable     GroupsTableData
+	FileResults     []*db.ActionFile // Files with a recorded outcome
+	FreeSpaceChange string           // Signed change in free space, if measured
 }
 
 // GroupsTableData holds data for the shared groups table partial
 type GroupsTableData struct {
-	Groups       []*db.DuplicateGroup
-	Interactive  bool // Show checkboxes, status column, file selection
-	Page         int
-	PageSize     int
-	TotalCount   int
-	TotalPages   int
-	SortBy       string
-	SortOrder    string
-	BaseURL      string // Base URL for pagination/sorting links
-	StatusFilter string // Optional status filter (only for interactive mode)
+	Groups      []*db.DuplicateGroup
+	Interactive bool // Show checkboxes, status column, file selection
+	Audit       bool // Groups are at-risk files rather than duplicates
+	Page        int
+	PageSize    int
+	TotalCount  int
+	TotalPages  int
+	SortBy      string
+	SortOrder   string
+	BaseURL     string          // Base URL for pagination/sorting links
+	Filter      GroupFilterForm // Optional filter (only for scan results)
+}
+
+// PageURL returns the link to a page of the table, keeping the sort and filter
+func (d GroupsTableData) PageURL(page int) string {
+	v := d.Filter.Values()
+	v.Set("page", strconv.Itoa(page))
+	v.Set("sort", d.SortBy)
+	v.Set("order", d.SortOrder)
+	return d.BaseURL + "?" + v.Encode()
+}
+
+// ExportURL returns the link to download the table's groups in a format,
+// keeping the sort and filter
+func (d GroupsTableData) ExportURL(format string) string {
+	v := d.Filter.Values()
+	v.Set("sort", d.SortBy)
+	v.Set("order", d.SortOrder)
+	v.Set("format", format)
+	return d.BaseURL + "/export?" + v.Encode()
+}
+
+// GroupFilterForm holds the filter fields of the scan results page as entered
+type GroupFilterForm struct {
+	Status   string
+	Path     string
+	Dir      string
+	Ext      string
+	MinSize  string
+	MaxSize  string
+	MinFiles string
+	MaxFiles string
+}
+
+// Values returns the filter's non-empty fields as query parameters
+func (f GroupFilterForm) Values() url.Values {
+	v := url.Values{}
+	for _, p := range []struct{ key, value string }{
+		{"status", f.Status},
+		{"path", f.Path},
+		{"dir", f.Dir},
+		{"ext", f.Ext},
+		{"min_size", f.MinSize},
+		{"max_size", f.MaxSize},
+		{"min_files", f.MinFiles},
+		{"max_files", f.MaxFiles},
+	} {
+		if p.value != "" {
+			v.Set(p.key, p.value)
+		}
+	}
+	return v
+}
+
+// Query returns the filter encoded as a query string
+func (f GroupFilterForm) Query() string {
+	return f.Values().Encode()
+}
+
+// Active reports whether any filter field is set
+func (f GroupFilterForm) Active() bool {
+	return f != GroupFilterForm{}
 }
 
 // ScanProgressData is sent via SSE during scans
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+// ScanWaste handles GET /scans/runs/{id}/waste
+// Returns the scan's redundant bytes rolled up the directory tree as JSON.
+func (h *Handler) ScanWaste(w http.ResponseWriter, r *http.Request, runIDStr string) {
+	id, err := strconv.ParseInt(runIDStr, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	dirs, err := h.db.ListWasteByDirectory(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	data, _ := json.Marshal(buildWasteTree(dirs))
+	w.Write(data)
+}
+
+// buildWasteTree rolls per-directory waste up to every ancestor. The returned
+// root is the deepest directory all the waste is under, and children are
+// sorted by redundant bytes, largest first.
+func buildWasteTree(dirs []*db.DirectoryWaste) *WasteNode {
+	root := &WasteNode{Name: "/", Path: "/"}
+	nodes := map[string]*WasteNode{"/": root}
+	for _, d := range dirs {
+		node := root
+		node.WastedBytes += d.WastedBytes
+		node.Files += d.Files
+		path := ""
+		for _, name := range strings.Split(strings.Trim(d.Dir, "/"), "/") {
+			if name == "" {
+				continue
+			}
+			path += "/" + name
+			child, ok := nodes[path]
+			if !ok {
+				child = &WasteNode{Name: name, Path: path}
+				nodes[path] = child
+				node.Children = append(node.Children, child)
+			}
+			node = child
+			node.WastedBytes += d.WastedBytes
+			node.Files += d.Files
+		}
+		node.Here = &WasteNode{Name: node.Name, Path: node.Path, WastedBytes: d.WastedBytes, Files: d.Files}
+	}
+
+	// Skip down through directories that only lead to one other
+	for len(root.Children) == 1 && root.Here == nil {
+		root = root.Children[0]
+	}
+
+	finishWasteTree(root)
+	return root
+}
+
+// finishWasteTree formats every node's size and sorts its children by
+// redundant bytes, largest first
+func finishWasteTree(node *WasteNode) {
+	node.WastedSize = formatBytes(node.WastedBytes)
+	if node.Here != nil {
+		node.Here.WastedSize = formatBytes(node.Here.WastedBytes)
+	}
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.WastedBytes != b.WastedBytes {
+			return a.WastedBytes > b.WastedBytes
+		}
+		return a.Name < b.Name
+	})
+	for _, c := range node.Children {
+		finishWasteTree(c)
+	}
+}
@@ -0,0 +1,302 @@
+// Package jobconfig reads and writes portable job configuration files, used
+// to copy scheduled jobs and settings between kuron instances.
+package jobconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+// FormatVersion is the version of the file format written by Export
+const FormatVersion = 1
+
+// File is a job configuration file
+type File struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at,omitzero"`
+	Settings   map[string]string `json:"settings,omitempty"`
+	Jobs       []Job             `json:"jobs"`
+}
+
+// Job is a scheduled job's definition, without its ID or run history.
+// Sizes are in bytes.
+type Job struct {
+	Name            string   `json:"name"`
+	Paths           []string `json:"paths"`
+	MinSize         int64    `json:"min_size,omitempty"`
+	MaxSize         *int64   `json:"max_size,omitempty"`
+	IncludePatterns []string `json:"include_patterns,omitempty"`
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	CronExpression  string   `json:"cron_expression"`
+	Timezone        string   `json:"timezone,omitempty"`
+	Action          string   `json:"action"`
+	Enabled         bool     `json:"enabled"`
+
+	IncludeHidden bool `json:"include_hidden,omitempty"`
+	FollowLinks   bool `json:"follow_links,omitempty"`
+	OneFileSystem bool `json:"one_file_system,omitempty"`
+	NoIgnore      bool `json:"no_ignore,omitempty"`
+	IgnoreCase    bool `json:"ignore_case,omitempty"`
+	MaxDepth      *int `json:"max_depth,omitempty"`
+
+	NamePatterns []string `json:"name_patterns,omitempty"`
+	MatchName    bool     `json:"match_name,omitempty"`
+	Isolate      bool     `json:"isolate,omitempty"`
+	MatchLinks   bool     `json:"match_links,omitempty"`
+	RFOver       int      `json:"rf_over,omitempty"`
+	RFUnder      int      `json:"rf_under,omitempty"`
+	Transform    string   `json:"transform,omitempty"`
+
+	MissedRunPolicy   db.MissedRunPolicy `json:"missed_run_policy,omitempty"`
+	OverlapPolicy     db.OverlapPolicy   `json:"overlap_policy,omitempty"`
+	MaintenanceWindow string             `json:"maintenance_window,omitempty"`
+
+	Threads int        `json:"threads,omitempty"`
+	Nice    int        `json:"nice,omitempty"`
+	IOClass db.IOClass `json:"io_class,omitempty"`
+
+	Steps []Step `json:"steps,omitempty"`
+
+	PreScanHook    string `json:"pre_scan_hook,omitempty"`
+	PreActionHook  string `json:"pre_action_hook,omitempty"`
+	PostActionHook string `json:"post_action_hook,omitempty"`
+}
+
+// Step is a pipeline step. Wait-for-job steps name the job they wait for,
+// since job IDs differ between instances.
+type Step struct {
+	Type       db.JobStepType `json:"type"`
+	Paths      []string       `json:"paths,omitempty"`
+	ActionType db.ActionType  `json:"action_type,omitempty"`
+	WebhookURL string         `json:"webhook_url,omitempty"`
+	Job        string         `json:"job,omitempty"`
+}
+
+// exportedSettings are the settings that are copied between instances
+var exportedSettings = []string{
+	"retention_days", "keep_runs_per_job", "group_retention_days", "action_retention_days", "stats_retention_days",
+}
+
+// Export returns the configuration of all jobs and settings in the database
+func Export(database *db.DB, now time.Time) (*File, error) {
+	jobs, err := database.ListScheduledJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int64]string, len(jobs))
+	for _, j := range jobs {
+		names[j.ID] = j.Name
+	}
+
+	f := &File{
+		Version:    FormatVersion,
+		ExportedAt: now.UTC().Truncate(time.Second),
+		Settings:   make(map[string]string),
+		Jobs:       make([]Job, 0, len(jobs)),
+	}
+	for _, j := range jobs {
+		f.Jobs = append(f.Jobs, fromScheduledJob(j, names))
+	}
+	for _, key := range exportedSettings {
+		val, err := database.GetSetting(key)
+		if err != nil {
+			return nil, err
+		}
+		if val != "" {
+			f.Settings[key] = val
+		}
+	}
+	return f, nil
+}
+
+// Write writes the file as indented JSON
+func Write(w io.Writer, f *File) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+// Read parses a JSON or YAML configuration file. Unknown fields are rejected
+// so that misspelled options aren't silently ignored.
+func Read(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("the file is empty")
+	}
+
+	// JSON is YAML too, but is decoded directly for its clearer errors
+	if trimmed[0] != '{' {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("invalid job configuration: %w", err)
+		}
+		if data, err = stringSettings(data); err != nil {
+			return nil, fmt.Errorf("invalid job configuration: %w", err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid job configuration: %w", err)
+	}
+	switch {
+	case f.Version == 0:
+		return nil, fmt.Errorf("invalid job configuration: missing version")
+	case f.Version > FormatVersion:
+		return nil, fmt.Errorf("the file is from a newer version of kuron (format version %d)", f.Version)
+	}
+	return &f, nil
+}
+
+// stringSettings quotes the settings of a file converted from YAML, where
+// values like 30 are written unquoted but settings are stored as strings
+func stringSettings(data []byte) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil || raw["settings"] == nil {
+		return data, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw["settings"]))
+	dec.UseNumber()
+	var settings map[string]any
+	if err := dec.Decode(&settings); err != nil {
+		return nil, fmt.Errorf("settings must be a mapping")
+	}
+	for key, val := range settings {
+		switch val.(type) {
+		case string:
+		case json.Number, bool:
+			settings[key] = fmt.Sprint(val)
+		default:
+			return nil, fmt.Errorf("setting %q must be a single value", key)
+		}
+	}
+	var err error
+	if raw["settings"], err = json.Marshal(settings); err != nil {
+		return nil, err
+	}
+	return json.Marshal(raw)
+}
+
+// fromScheduledJob converts a job for export, naming the jobs its
+// wait-for-job steps reference
+func fromScheduledJob(j *db.ScheduledJob, names map[int64]string) Job {
+	job := Job{
+		Name:              j.Name,
+		Paths:             j.Paths,
+		MinSize:           j.MinSize,
+		MaxSize:           j.MaxSize,
+		IncludePatterns:   nonEmpty(j.IncludePatterns),
+		ExcludePatterns:   nonEmpty(j.ExcludePatterns),
+		CronExpression:    j.CronExpression,
+		Timezone:          j.Timezone,
+		Action:            j.Action,
+		Enabled:           j.Enabled,
+		IncludeHidden:     j.IncludeHidden,
+		FollowLinks:       j.FollowLinks,
+		OneFileSystem:     j.OneFileSystem,
+		NoIgnore:          j.NoIgnore,
+		IgnoreCase:        j.IgnoreCase,
+		MaxDepth:          j.MaxDepth,
+		NamePatterns:      nonEmpty(j.NamePatterns),
+		MatchName:         j.MatchName,
+		Isolate:           j.Isolate,
+		MatchLinks:        j.MatchLinks,
+		RFOver:            j.RFOver,
+		RFUnder:           j.RFUnder,
+		Transform:         j.Transform,
+		MissedRunPolicy:   j.MissedRunPolicy,
+		OverlapPolicy:     j.OverlapPolicy,
+		MaintenanceWindow: j.MaintenanceWindow,
+		Threads:           j.Threads,
+		Nice:              j.Nice,
+		IOClass:           j.IOClass,
+		PreScanHook:       j.PreScanHook,
+		PreActionHook:     j.PreActionHook,
+		PostActionHook:    j.PostActionHook,
+	}
+	for _, s := range j.Steps {
+		step := Step{
+			Type:       s.Type,
+			Paths:      nonEmpty(s.Paths),
+			ActionType: s.ActionType,
+			WebhookURL: s.WebhookURL,
+		}
+		if s.Type == db.JobStepWaitForJob {
+			step.Job = names[s.JobID]
+		}
+		job.Steps = append(job.Steps, step)
+	}
+	return job
+}
+
+// toScheduledJob applies the definition to a job, resolving wait-for-job
+// steps to job IDs. The job's ID and run history are left as they are.
+func (j Job) toScheduledJob(job *db.ScheduledJob, ids map[string]int64) {
+	job.Name = j.Name
+	job.Paths = j.Paths
+	job.MinSize = j.MinSize
+	job.MaxSize = j.MaxSize
+	job.IncludePatterns = j.IncludePatterns
+	job.ExcludePatterns = j.ExcludePatterns
+	job.CronExpression = j.CronExpression
+	job.Timezone = j.Timezone
+	job.Action = j.Action
+	job.Enabled = j.Enabled
+	job.IncludeHidden = j.IncludeHidden
+	job.FollowLinks = j.FollowLinks
+	job.OneFileSystem = j.OneFileSystem
+	job.NoIgnore = j.NoIgnore
+	job.IgnoreCase = j.IgnoreCase
+	job.MaxDepth = j.MaxDepth
+	job.NamePatterns = j.NamePatterns
+	job.MatchName = j.MatchName
+	job.Isolate = j.Isolate
+	job.MatchLinks = j.MatchLinks
+	job.RFOver = j.RFOver
+	job.RFUnder = j.RFUnder
+	job.Transform = j.Transform
+	job.MissedRunPolicy = j.MissedRunPolicy
+	job.OverlapPolicy = j.OverlapPolicy
+	job.MaintenanceWindow = j.MaintenanceWindow
+	job.Threads = j.Threads
+	job.Nice = j.Nice
+	job.IOClass = j.IOClass
+	job.PreScanHook = j.PreScanHook
+	job.PreActionHook = j.PreActionHook
+	job.PostActionHook = j.PostActionHook
+
+	job.Steps = nil
+	for _, s := range j.Steps {
+		step := db.JobStep{
+			Type:       s.Type,
+			Paths:      s.Paths,
+			ActionType: s.ActionType,
+			WebhookURL: s.WebhookURL,
+		}
+		if s.Type == db.JobStepWaitForJob {
+			step.JobID = ids[s.Job]
+		}
+		job.Steps = append(job.Steps, step)
+	}
+}
+
+// nonEmpty returns nil for empty slices, so that jobs read back from the
+// database compare equal to their definitions
+func nonEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
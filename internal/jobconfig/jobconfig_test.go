@@ -0,0 +1,546 @@
+package jobconfig
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+func testDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "kuron.db"))
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func allowAll(string) bool { return true }
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	src := testDB(t)
+	maxSize := int64(1 << 30)
+	depth := 3
+	photos, err := src.CreateScheduledJob(&db.ScheduledJob{
+		Name:            "Photos",
+		Paths:           []string{"/data/photos"},
+		MinSize:         1024,
+		MaxSize:         &maxSize,
+		ExcludePatterns: []string{"*.tmp"},
+		CronExpression:  "0 3 * * *",
+		Timezone:        "Europe/Berlin",
+		Action:          "scan_hardlink",
+		Enabled:         true,
+		IncludeHidden:   true,
+		MaxDepth:        &depth,
+		Threads:         2,
+		Nice:            10,
+		IOClass:         db.IOClassIdle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "After Photos",
+		Paths:          []string{"/data"},
+		CronExpression: "0 4 * * *",
+		Action:         "scan",
+		Steps: []db.JobStep{
+			{Type: db.JobStepWaitForJob, JobID: photos.ID},
+			{Type: db.JobStepScan},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetSetting("retention_days", "90"); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := Export(src, time.Now())
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, exported); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"job": "Photos"`) {
+		t.Errorf("wait-for-job step should reference the job by name:\n%s", buf.String())
+	}
+
+	f, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	dst := testDB(t)
+	plan, err := NewPlan(dst, f, Options{IsPathAllowed: allowAll})
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+	if !plan.Valid() {
+		t.Fatalf("plan should be valid: %+v", plan)
+	}
+	if created, updated := plan.Counts(); created != 2 || updated != 0 {
+		t.Errorf("Counts = %d created, %d updated; want 2, 0", created, updated)
+	}
+	if err := Apply(dst, plan, time.Now()); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	jobs, err := dst.ListScheduledJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("got %d jobs, want 2", len(jobs))
+	}
+	after, imported := jobs[0], jobs[1]
+	if imported.Name != "Photos" || !imported.Enabled || imported.Timezone != "Europe/Berlin" ||
+		imported.MaxSize == nil || *imported.MaxSize != maxSize || imported.IOClass != db.IOClassIdle ||
+		imported.NextRunAt == nil {
+		t.Errorf("imported job = %+v", imported)
+	}
+	if len(after.Steps) != 2 || after.Steps[0].JobID != imported.ID {
+		t.Errorf("wait-for-job step = %+v, want job %d", after.Steps, imported.ID)
+	}
+	if val, _ := dst.GetSetting("retention_days"); val != "90" {
+		t.Errorf("retention_days = %q, want 90", val)
+	}
+
+	// Importing the same file again changes nothing
+	plan, err = NewPlan(dst, f, Options{IsPathAllowed: allowAll})
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+	for _, c := range plan.Jobs {
+		if c.Change != ChangeUnchanged {
+			t.Errorf("job %q: change = %s (fields %v), want unchanged", c.Name, c.Change, c.Fields)
+		}
+	}
+	for _, c := range plan.Settings {
+		if c.Change != ChangeUnchanged {
+			t.Errorf("setting %s: change = %s, want unchanged", c.Key, c.Change)
+		}
+	}
+}
+
+func TestNewPlan_UpdatesByName(t *testing.T) {
+	database := testDB(t)
+	existing, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Media",
+		Paths:          []string{"/data/media"},
+		CronExpression: "0 3 * * *",
+		Action:         "scan",
+		Enabled:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &File{Version: FormatVersion, Jobs: []Job{{
+		Name:           "Media",
+		Paths:          []string{"/data/media"},
+		CronExpression: "0 5 * * *",
+		Action:         "scan_reflink",
+		Enabled:        true,
+	}}}
+	plan, err := NewPlan(database, f, Options{IsPathAllowed: allowAll, LockedSettings: []string{"retention_days"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := plan.Jobs[0]
+	if c.Change != ChangeUpdate || !slices.Equal(c.Fields, []string{"cron_expression", "action"}) {
+		t.Errorf("change = %s %v, want update of cron_expression and action", c.Change, c.Fields)
+	}
+
+	if err := Apply(database, plan, time.Now()); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	job, err := database.GetScheduledJob(existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.CronExpression != "0 5 * * *" || job.Action != "scan_reflink" {
+		t.Errorf("job not updated: %+v", job)
+	}
+	if jobs, _ := database.ListScheduledJobs(); len(jobs) != 1 {
+		t.Errorf("got %d jobs, want the existing one updated", len(jobs))
+	}
+}
+
+func TestApply_AllOrNothing(t *testing.T) {
+	database := testDB(t)
+	existing, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Media",
+		Paths:          []string{"/data/media"},
+		CronExpression: "0 3 * * *",
+		Action:         "scan",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keeps Media's ID from being reused for the created job
+	if _, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Other",
+		Paths:          []string{"/data/other"},
+		CronExpression: "0 3 * * *",
+		Action:         "scan",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &File{Version: FormatVersion, Jobs: []Job{
+		{Name: "Media", Paths: []string{"/data/media"}, CronExpression: "0 5 * * *", Action: "scan"},
+		{Name: "Photos", Paths: []string{"/data/photos"}, CronExpression: "0 4 * * *", Action: "scan"},
+	}, Settings: map[string]string{"retention_days": "7"}}
+	plan, err := NewPlan(database, f, Options{IsPathAllowed: allowAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting the job to update makes Apply fail after creating Photos
+	if err := database.DeleteScheduledJob(existing.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(database, plan, time.Now()); err == nil {
+		t.Fatal("Apply of a stale plan succeeded")
+	}
+	if jobs, _ := database.ListScheduledJobs(); len(jobs) != 1 {
+		t.Errorf("got %d jobs after a failed Apply, want only Other", len(jobs))
+	}
+	if v, _ := database.GetSetting("retention_days"); v == "7" {
+		t.Error("setting saved by a failed Apply")
+	}
+}
+
+func TestNewPlan_Validation(t *testing.T) {
+	database := testDB(t)
+	allowed := func(p string) bool { return strings.HasPrefix(p, "/data/") }
+
+	job := func(modify func(j *Job)) Job {
+		j := Job{Name: "Job", Paths: []string{"/data/a"}, CronExpression: "0 3 * * *", Action: "scan"}
+		modify(&j)
+		return j
+	}
+	tests := []struct {
+		name string
+		job  Job
+		want string
+	}{
+		{"valid", job(func(j *Job) {}), ""},
+		{"path not allowed", job(func(j *Job) { j.Paths = []string{"/etc"} }), "path not allowed: /etc"},
+		{"no paths", job(func(j *Job) { j.Paths = nil }), "at least one path"},
+		{"bad cron", job(func(j *Job) { j.CronExpression = "nope" }), "invalid schedule"},
+		{"bad action", job(func(j *Job) { j.Action = "delete" }), "unknown action"},
+		{"hooks disabled", job(func(j *Job) { j.PreScanHook = "true" }), "hook commands are disabled"},
+		{"custom transform", job(func(j *Job) { j.Transform = "cat $IN" }), "custom transform"},
+		{"step path", job(func(j *Job) { j.Steps = []Step{{Type: db.JobStepScan, Paths: []string{"/root"}}} }), "step 1: path not allowed"},
+		{"unknown wait job", job(func(j *Job) { j.Steps = []Step{{Type: db.JobStepWaitForJob, Job: "Missing"}} }), `job "Missing" not found`},
+		{"audit with action", job(func(j *Job) {
+			j.Action = "audit"
+			j.Steps = []Step{{Type: db.JobStepScan}, {Type: db.JobStepAction, ActionType: db.ActionTypeHardlink}}
+		}), "at-risk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := NewPlan(database, &File{Version: FormatVersion, Jobs: []Job{tt.job}}, Options{IsPathAllowed: allowed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := plan.Jobs[0].Error
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("error = %q, want %q", got, tt.want)
+			}
+			if plan.Valid() != (tt.want == "") {
+				t.Errorf("Valid = %v", plan.Valid())
+			}
+		})
+	}
+
+	f := &File{
+		Version:  FormatVersion,
+		Settings: map[string]string{"retention_days": "0", "theme": "dark"},
+		Jobs:     []Job{job(func(j *Job) {}), job(func(j *Job) {})},
+	}
+	plan, err := NewPlan(database, f, Options{IsPathAllowed: allowed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plan.Jobs[1].Error, "more than one job") {
+		t.Errorf("duplicate name error = %q", plan.Jobs[1].Error)
+	}
+	if plan.Settings[0].Error == "" || plan.Settings[1].Error != "unknown setting" {
+		t.Errorf("setting errors = %+v", plan.Settings)
+	}
+	if err := Apply(database, plan, time.Now()); err == nil {
+		t.Error("Apply should refuse an invalid plan")
+	}
+}
+
+func TestNewPlan_WaitCycles(t *testing.T) {
+	database := testDB(t)
+	job := func(name, waitFor string) Job {
+		return Job{Name: name, Paths: []string{"/data"}, CronExpression: "0 3 * * *", Action: "scan",
+			Steps: []Step{{Type: db.JobStepWaitForJob, Job: waitFor}, {Type: db.JobStepScan}}}
+	}
+	opts := Options{IsPathAllowed: allowAll}
+
+	// Jobs in the file waiting for each other
+	f := &File{Version: FormatVersion, Jobs: []Job{job("A", "B"), job("B", "C"), job("C", "A")}}
+	plan, err := NewPlan(database, f, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range plan.Jobs {
+		if !strings.Contains(c.Error, "neither could finish") {
+			t.Errorf("job %s error = %q, want a wait cycle", c.Name, c.Error)
+		}
+	}
+
+	// A job waiting for a job on the server that waits for it
+	a, err := database.CreateScheduledJob(&db.ScheduledJob{Name: "A", Paths: []string{"/data"}, CronExpression: "0 3 * * *", Action: "scan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name: "B", Paths: []string{"/data"}, CronExpression: "0 3 * * *", Action: "scan",
+		Steps: []db.JobStep{{Type: db.JobStepWaitForJob, JobID: a.ID}, {Type: db.JobStepScan}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = NewPlan(database, &File{Version: FormatVersion, Jobs: []Job{job("A", "B")}}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plan.Jobs[0].Error; !strings.Contains(got, `"B" waits for this job`) {
+		t.Errorf("error = %q, want B waiting for A", got)
+	}
+
+	// Importing B too, no longer waiting for A, breaks the cycle
+	b := job("B", "")
+	b.Steps = []Step{{Type: db.JobStepScan}}
+	plan, err = NewPlan(database, &File{Version: FormatVersion, Jobs: []Job{job("A", "B"), b}}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Valid() {
+		t.Errorf("plan invalid: %q, %q", plan.Jobs[0].Error, plan.Jobs[1].Error)
+	}
+}
+
+func TestRead(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"version": 1, "jobs": [{"name": "a", "pahts": []}]}`)); err == nil ||
+		!strings.Contains(err.Error(), "pahts") {
+		t.Errorf("unknown field error = %v", err)
+	}
+	if _, err := Read(strings.NewReader(`{"jobs": []}`)); err == nil {
+		t.Error("a file without a version should be rejected")
+	}
+	if _, err := Read(strings.NewReader(`{"version": 99, "jobs": []}`)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("newer version error = %v", err)
+	}
+	if _, err := Read(strings.NewReader("")); err == nil {
+		t.Error("an empty file should be rejected")
+	}
+}
+
+func TestRead_YAML(t *testing.T) {
+	yaml := `# Jobs for the media server
+---
+version: 1
+settings:
+  retention_days: 30
+  keep_runs_per_job: "5"
+jobs:
+  - name: Photos
+    paths:
+      - /data/photos   # originals
+      - "/data/photo backups"
+    min_size: 1048576
+    max_depth: 3
+    include_patterns: ['*.jpg', '*.png']
+    cron_expression: "0 3 * * *"
+    action: hardlink
+    enabled: true
+    pre_scan_hook: |
+      mount /data/photos
+      test -d /data/photos/.ready
+    steps:
+    - type: scan
+    - {type: wait_for_job, job: Music}
+  - name: Music
+    paths: [/data/music]
+    cron_expression: 0 4 * * 0
+    action: scan
+    enabled: false
+    post_action_hook: >-
+      curl -fsS
+      https://example.com/done
+`
+	f, err := Read(strings.NewReader(yaml))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	maxDepth := 3
+	want := &File{
+		Version:  1,
+		Settings: map[string]string{"retention_days": "30", "keep_runs_per_job": "5"},
+		Jobs: []Job{
+			{
+				Name:            "Photos",
+				Paths:           []string{"/data/photos", "/data/photo backups"},
+				MinSize:         1048576,
+				MaxDepth:        &maxDepth,
+				IncludePatterns: []string{"*.jpg", "*.png"},
+				CronExpression:  "0 3 * * *",
+				Action:          "hardlink",
+				Enabled:         true,
+				PreScanHook:     "mount /data/photos\ntest -d /data/photos/.ready\n",
+				Steps: []Step{
+					{Type: db.JobStepScan},
+					{Type: db.JobStepWaitForJob, Job: "Music"},
+				},
+			},
+			{
+				Name:           "Music",
+				Paths:          []string{"/data/music"},
+				CronExpression: "0 4 * * 0",
+				Action:         "scan",
+				PostActionHook: "curl -fsS https://example.com/done",
+			},
+		},
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("Read() =\n%+v\nwant\n%+v", f, want)
+	}
+
+	// An exported file reads back the same as YAML, since JSON is YAML
+	var buf bytes.Buffer
+	if err := Write(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := yamlToJSON(buf.Bytes()); err != nil {
+		t.Errorf("exported file isn't valid YAML: %v", err)
+	} else if got, err := Read(bytes.NewReader(data)); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("exported file read as YAML = %+v (err %v), want %+v", got, err, want)
+	}
+
+	for _, tt := range []struct {
+		yaml, err string
+	}{
+		{"version: 1\njobs:\n  - name: a\n    pahts: []\n", "pahts"},
+		{"version: 1\nversion: 2\n", "line 2: duplicate key"},
+		{"version: 1\njobs:\n  - name: a\n     paths: []\n", "line 4: unexpected indentation"},
+		{"version: 1\njobs:\n\t- name: a\n", "line 3: tabs"},
+		{"version: 1\njobs: [a, b\n", "line 2: unterminated"},
+		{"version: 1\njobs: *all\n", "aliases"},
+		{"# nothing here\n", "empty"},
+	} {
+		if _, err := Read(strings.NewReader(tt.yaml)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Read(%q) error = %v, want %q", tt.yaml, err, tt.err)
+		}
+	}
+}
+
+func TestProvision(t *testing.T) {
+	database := testDB(t)
+	adopted, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name: "Media", Paths: []string{"/data/media"}, CronExpression: "0 3 * * *", Action: "scan", Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name: "Old", Paths: []string{"/data/old"}, CronExpression: "0 3 * * *", Action: "scan", Enabled: true, Managed: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manual, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name: "Manual", Paths: []string{"/data/manual"}, CronExpression: "0 3 * * *", Action: "scan", Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &File{Version: FormatVersion, Jobs: []Job{
+		{Name: "Media", Paths: []string{"/data/media"}, CronExpression: "0 3 * * *", Action: "scan", Enabled: true},
+		{Name: "Photos", Paths: []string{"/data/photos"}, CronExpression: "0 4 * * *", Action: "scan_hardlink", Enabled: true},
+	}}
+	result, err := Provision(database, f, Options{IsPathAllowed: allowAll}, time.Now())
+	if err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	if *result != (ProvisionResult{Created: 1, Updated: 1, Disabled: 1}) {
+		t.Errorf("result = %+v, want 1 created, 1 updated, 1 disabled", *result)
+	}
+
+	jobs, err := database.ListScheduledJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*db.ScheduledJob)
+	for _, j := range jobs {
+		byName[j.Name] = j
+	}
+	if j := byName["Media"]; j.ID != adopted.ID || !j.Managed || !j.Enabled {
+		t.Errorf("Media = %+v, want the existing job managed", j)
+	}
+	if j := byName["Photos"]; !j.Managed || !j.Enabled || j.Action != "scan_hardlink" {
+		t.Errorf("Photos = %+v, want a new managed job", j)
+	}
+	if j := byName["Old"]; j.ID != removed.ID || j.Managed || j.Enabled {
+		t.Errorf("Old = %+v, want disabled and no longer managed", j)
+	}
+	if j := byName["Manual"]; j.ID != manual.ID || j.Managed || !j.Enabled {
+		t.Errorf("Manual = %+v, want unchanged", j)
+	}
+
+	// Provisioning again changes nothing
+	result, err = Provision(database, f, Options{IsPathAllowed: allowAll}, time.Now())
+	if err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	if *result != (ProvisionResult{}) {
+		t.Errorf("second result = %+v, want no changes", *result)
+	}
+
+	// Imports can't change managed jobs
+	plan, err := NewPlan(database, f, Options{IsPathAllowed: allowAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Valid() || !strings.Contains(plan.Jobs[0].Error, "managed") {
+		t.Errorf("import of managed jobs = %+v, want an error", plan.Jobs)
+	}
+
+	// Invalid files change nothing
+	bad := &File{Version: FormatVersion, Jobs: []Job{
+		{Name: "Photos", Paths: []string{"/data/photos"}, CronExpression: "never", Action: "scan"},
+	}}
+	if _, err := Provision(database, bad, Options{IsPathAllowed: allowAll}, time.Now()); err == nil ||
+		!strings.Contains(err.Error(), `job "Photos": invalid schedule`) {
+		t.Errorf("Provision(invalid) error = %v", err)
+	}
+	if j, _ := database.GetScheduledJob(byName["Photos"].ID); j.CronExpression != "0 4 * * *" {
+		t.Errorf("invalid file changed job: %+v", j)
+	}
+
+	// Without a jobs file, managed jobs are handed back as they are
+	released, err := Release(database)
+	if err != nil || released != 2 {
+		t.Errorf("Release = %d, %v; want 2", released, err)
+	}
+	if j, _ := database.GetScheduledJob(adopted.ID); j.Managed || !j.Enabled {
+		t.Errorf("released job = %+v, want enabled and not managed", j)
+	}
+}
@@ -0,0 +1,498 @@
+package jobconfig
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/config"
+	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/fclones"
+	"github.com/lyallcooper/kuron/internal/scheduler"
+)
+
+// Change is what an import does to a job or setting
+type Change string
+
+const (
+	ChangeCreate    Change = "create"
+	ChangeUpdate    Change = "update"
+	ChangeUnchanged Change = "unchanged"
+	ChangeSkip      Change = "skip" // Settings set by the environment are left alone
+)
+
+// Options are the server's limits that imported jobs are validated against
+type Options struct {
+	IsPathAllowed  func(path string) bool
+	HooksEnabled   bool     // Allow hook commands and custom transforms
+	LockedSettings []string // Settings set by the environment
+}
+
+// JobChange is the planned change to one job
+type JobChange struct {
+	Name   string
+	Change Change
+	Fields []string // Fields that change, for updates
+	Error  string   // Why the job can't be imported
+
+	job Job
+	id  int64 // The existing job, for updates
+}
+
+// SettingChange is the planned change to one setting
+type SettingChange struct {
+	Key     string
+	Value   string
+	Current string
+	Change  Change
+	Error   string
+}
+
+// Plan is a preview of an import: jobs are matched to existing jobs by name
+// and created or updated to match the file. Jobs not in the file are kept.
+type Plan struct {
+	Jobs     []JobChange
+	Settings []SettingChange
+
+	managed bool // Whether the jobs are provisioned from a jobs file
+}
+
+// Valid reports whether every job and setting in the file can be imported
+func (p *Plan) Valid() bool {
+	for _, c := range p.Jobs {
+		if c.Error != "" {
+			return false
+		}
+	}
+	for _, c := range p.Settings {
+		if c.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Counts returns the number of jobs that would be created and updated
+func (p *Plan) Counts() (created, updated int) {
+	for _, c := range p.Jobs {
+		switch c.Change {
+		case ChangeCreate:
+			created++
+		case ChangeUpdate:
+			updated++
+		}
+	}
+	return created, updated
+}
+
+// NewPlan compares the file to the database and validates its jobs and
+// settings. Managed jobs can't be changed by an import.
+func NewPlan(database *db.DB, f *File, opts Options) (*Plan, error) {
+	return newPlan(database, f, opts, false)
+}
+
+// newPlan plans an import, or the provisioning of managed jobs, which
+// takes over jobs of the same name
+func newPlan(database *db.DB, f *File, opts Options, managed bool) (*Plan, error) {
+	existing, err := database.ListScheduledJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int64]string, len(existing))
+	byName := make(map[string][]*db.ScheduledJob)
+	for _, j := range existing {
+		names[j.ID] = j.Name
+		byName[j.Name] = append(byName[j.Name], j)
+	}
+
+	// Wait-for-job steps may reference jobs in the file or already on the
+	// server. Jobs in the file replace the server's jobs of the same name.
+	waits := make(map[string][]string, len(byName)+len(f.Jobs))
+	for _, j := range existing {
+		waited := waits[j.Name]
+		for _, step := range j.Steps {
+			if step.Type == db.JobStepWaitForJob {
+				waited = append(waited, names[step.JobID])
+			}
+		}
+		waits[j.Name] = waited
+	}
+	for _, j := range f.Jobs {
+		waits[strings.TrimSpace(j.Name)] = waitedFor(j)
+	}
+
+	plan := &Plan{managed: managed}
+	seen := make(map[string]bool, len(f.Jobs))
+	for _, j := range f.Jobs {
+		j.Name = strings.TrimSpace(j.Name)
+		c := JobChange{Name: j.Name, job: j}
+
+		err := validate(&c.job, opts, waits)
+		if err == nil && seen[j.Name] {
+			err = fmt.Errorf("the file has more than one job named %q", j.Name)
+		}
+		seen[j.Name] = true
+
+		switch matches := byName[j.Name]; {
+		case len(matches) == 0:
+			c.Change = ChangeCreate
+		case len(matches) > 1:
+			c.Change = ChangeUpdate
+			if err == nil {
+				err = fmt.Errorf("%d jobs on this server are named %q; rename them first", len(matches), j.Name)
+			}
+		default:
+			c.id = matches[0].ID
+			c.Fields = changedFields(fromScheduledJob(matches[0], names), c.job)
+			if matches[0].Managed != managed {
+				c.Fields = append(c.Fields, "managed")
+			}
+			c.Change = ChangeUpdate
+			if len(c.Fields) == 0 {
+				c.Change = ChangeUnchanged
+			}
+			if matches[0].Managed && !managed && err == nil {
+				err = fmt.Errorf("the job is managed by the server's jobs file")
+			}
+		}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		plan.Jobs = append(plan.Jobs, c)
+	}
+
+	keys := make([]string, 0, len(f.Settings))
+	for key := range f.Settings {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		c := SettingChange{Key: key, Value: strings.TrimSpace(f.Settings[key])}
+		if c.Current, err = database.GetSetting(key); err != nil {
+			return nil, err
+		}
+		switch {
+		case !slices.Contains(exportedSettings, key):
+			c.Error = "unknown setting"
+		case slices.Contains(opts.LockedSettings, key):
+			c.Change = ChangeSkip
+		case c.Value == c.Current:
+			c.Change = ChangeUnchanged
+		default:
+			c.Change = ChangeUpdate
+		}
+		if c.Error == "" {
+			if err := validateSetting(key, c.Value); err != nil {
+				c.Error = err.Error()
+			}
+		}
+		plan.Settings = append(plan.Settings, c)
+	}
+
+	return plan, nil
+}
+
+// Apply creates and updates the planned jobs and settings in one transaction,
+// so either all of the plan is applied or none of it. The plan must be valid
+// and fresh, since jobs are matched by the IDs found when planning.
+func Apply(database *db.DB, plan *Plan, now time.Time) error {
+	return database.Transaction(func(tx *db.DB) error {
+		return apply(tx, plan, now)
+	})
+}
+
+// apply writes the plan with database, which callers run in a transaction
+func apply(database *db.DB, plan *Plan, now time.Time) error {
+	if !plan.Valid() {
+		return fmt.Errorf("the import has errors")
+	}
+
+	existing, err := database.ListScheduledJobs()
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]int64, len(existing))
+	for _, j := range existing {
+		if _, ok := ids[j.Name]; !ok {
+			ids[j.Name] = j.ID
+		}
+	}
+
+	// Create new jobs disabled first, so that every job's wait-for-job steps
+	// can be resolved when it's filled in below
+	for i := range plan.Jobs {
+		c := &plan.Jobs[i]
+		if c.Change != ChangeCreate {
+			continue
+		}
+		created, err := database.CreateScheduledJob(&db.ScheduledJob{
+			Name:           c.job.Name,
+			Paths:          c.job.Paths,
+			CronExpression: c.job.CronExpression,
+			Action:         c.job.Action,
+			Managed:        plan.managed,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create job %q: %w", c.Name, err)
+		}
+		c.id = created.ID
+		ids[c.Name] = created.ID
+	}
+
+	for _, c := range plan.Jobs {
+		if c.Change != ChangeCreate && c.Change != ChangeUpdate {
+			continue
+		}
+		job, err := database.GetScheduledJob(c.id)
+		if err != nil {
+			return fmt.Errorf("failed to load job %q: %w", c.Name, err)
+		}
+		c.job.toScheduledJob(job, ids)
+		job.Managed = plan.managed
+
+		schedule, err := scheduler.ParseSchedule(job.CronExpression, job.Timezone)
+		if err != nil {
+			return fmt.Errorf("job %q: invalid schedule: %w", c.Name, err)
+		}
+		nextRun := schedule.Next(now)
+		job.NextRunAt = &nextRun
+
+		if err := database.UpdateScheduledJob(job); err != nil {
+			return fmt.Errorf("failed to update job %q: %w", c.Name, err)
+		}
+	}
+
+	for _, c := range plan.Settings {
+		if c.Change != ChangeUpdate {
+			continue
+		}
+		if err := database.SetSetting(c.Key, c.Value); err != nil {
+			return fmt.Errorf("failed to save setting %s: %w", c.Key, err)
+		}
+	}
+	return nil
+}
+
+// changedFields returns the names of the fields that differ between two jobs
+func changedFields(a, b Job) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+
+	var fields []string
+	for i := range t.NumField() {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// validateSetting checks a setting's value, with the same limits as the settings page
+func validateSetting(key, value string) error {
+	switch key {
+	case "retention_days":
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 || days > 9999 {
+			return fmt.Errorf("retention must be between 1 and 9999 days")
+		}
+	case "group_retention_days", "action_retention_days", "stats_retention_days":
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 || days > 9999 {
+			return fmt.Errorf("retention must be between 0 and 9999 days")
+		}
+	case "keep_runs_per_job":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 1000 {
+			return fmt.Errorf("runs kept per job must be between 0 and 1000")
+		}
+	}
+	return nil
+}
+
+// validate checks a job against the same rules as the job form and fills in
+// the defaults the form would. waits holds the jobs that wait-for-job steps
+// may reference, and the jobs each of them waits for.
+func validate(j *Job, opts Options, waits map[string][]string) error {
+	if j.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	j.Paths = expandPaths(j.Paths)
+	if len(j.Paths) == 0 {
+		return fmt.Errorf("at least one path is required")
+	}
+	for _, p := range j.Paths {
+		if !opts.IsPathAllowed(p) {
+			return fmt.Errorf("path not allowed: %s", p)
+		}
+	}
+
+	if j.MinSize < 0 {
+		return fmt.Errorf("invalid min size: %d", j.MinSize)
+	}
+	if j.MaxSize != nil && *j.MaxSize <= 0 {
+		j.MaxSize = nil
+	}
+	if j.MaxDepth != nil && *j.MaxDepth < 0 {
+		return fmt.Errorf("invalid max depth: %d", *j.MaxDepth)
+	}
+	j.IncludePatterns = nonEmpty(j.IncludePatterns)
+	j.ExcludePatterns = nonEmpty(j.ExcludePatterns)
+	j.NamePatterns = nonEmpty(j.NamePatterns)
+
+	if _, err := scheduler.ParseSchedule(j.CronExpression, j.Timezone); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	if _, err := scheduler.ParseMaintenanceWindow(j.MaintenanceWindow); err != nil {
+		return fmt.Errorf("invalid maintenance window: %w", err)
+	}
+
+	switch j.Action {
+	case "scan", "scan_hardlink", "scan_reflink", "audit":
+	default:
+		return fmt.Errorf("unknown action %q", j.Action)
+	}
+
+	switch j.MissedRunPolicy {
+	case db.MissedRunPolicySkip, db.MissedRunPolicyRunOnce:
+	case "":
+		j.MissedRunPolicy = db.MissedRunPolicyRunOnce
+	default:
+		return fmt.Errorf("unknown missed run policy %q", j.MissedRunPolicy)
+	}
+	switch j.OverlapPolicy {
+	case db.OverlapPolicyForbid, db.OverlapPolicyQueue, db.OverlapPolicyAllow:
+	case "":
+		j.OverlapPolicy = db.OverlapPolicyForbid
+	default:
+		return fmt.Errorf("unknown overlap policy %q", j.OverlapPolicy)
+	}
+
+	if j.Threads < 0 {
+		return fmt.Errorf("invalid thread count: %d", j.Threads)
+	}
+	if j.Nice < 0 || j.Nice > 19 {
+		return fmt.Errorf("nice must be between 0 and 19")
+	}
+	switch j.IOClass {
+	case db.IOClassDefault, db.IOClassBestEffort, db.IOClassIdle:
+	default:
+		return fmt.Errorf("unknown I/O class %q", j.IOClass)
+	}
+
+	if err := validateSteps(j, opts, waits); err != nil {
+		return err
+	}
+	hasActionStep := slices.ContainsFunc(j.Steps, func(s Step) bool { return s.Type == db.JobStepAction })
+	autoAction := j.Action == "scan_hardlink" || j.Action == "scan_reflink"
+
+	if j.RFOver < 0 || j.RFUnder < 0 {
+		return fmt.Errorf("invalid copy count")
+	}
+	if j.RFOver > 0 && j.RFUnder > 0 {
+		return fmt.Errorf("set either rf_over or rf_under, not both")
+	}
+	// Audit jobs report files with too few copies (default: no copy at all)
+	if j.Action == "audit" {
+		if j.RFOver > 0 {
+			return fmt.Errorf("audit jobs report files with fewer copies; remove rf_over")
+		}
+		if j.RFUnder == 0 {
+			j.RFUnder = 2
+		}
+	}
+	if j.RFUnder > 0 && (autoAction || hasActionStep) {
+		return fmt.Errorf("at-risk file scans can only be reported, not acted on")
+	}
+
+	if j.Transform != "" {
+		if !opts.HooksEnabled && fclones.TransformPresetName(j.Transform) == "" {
+			return fmt.Errorf("custom transform commands are disabled (set KURON_HOOKS_ENABLED=true)")
+		}
+		if autoAction || hasActionStep {
+			return fmt.Errorf("scans with a content transform can't apply actions automatically")
+		}
+	}
+
+	if !opts.HooksEnabled && (j.PreScanHook != "" || j.PreActionHook != "" || j.PostActionHook != "") {
+		return fmt.Errorf("hook commands are disabled; set KURON_HOOKS_ENABLED=true to use them")
+	}
+	return nil
+}
+
+// validateSteps checks a job's pipeline steps like the job form does
+func validateSteps(j *Job, opts Options, waits map[string][]string) error {
+	hasScan := false
+	for i := range j.Steps {
+		step := &j.Steps[i]
+		n := i + 1
+		switch step.Type {
+		case db.JobStepScan:
+			step.Paths = expandPaths(step.Paths)
+			for _, p := range step.Paths {
+				if !opts.IsPathAllowed(p) {
+					return fmt.Errorf("step %d: path not allowed: %s", n, p)
+				}
+			}
+			hasScan = true
+		case db.JobStepAction:
+			if step.ActionType != db.ActionTypeHardlink && step.ActionType != db.ActionTypeReflink {
+				return fmt.Errorf("step %d: invalid action %q", n, step.ActionType)
+			}
+			if !hasScan {
+				return fmt.Errorf("step %d: an action step needs a scan step before it", n)
+			}
+		case db.JobStepNotify:
+			if step.WebhookURL != "" {
+				u, err := url.Parse(step.WebhookURL)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("step %d: invalid webhook URL: %s", n, step.WebhookURL)
+				}
+			}
+		case db.JobStepWaitForJob:
+			switch {
+			case step.Job == "":
+				return fmt.Errorf("step %d: name the job to wait for", n)
+			case step.Job == j.Name:
+				return fmt.Errorf("step %d: a job can't wait for itself", n)
+			}
+			if _, ok := waits[step.Job]; !ok {
+				return fmt.Errorf("step %d: job %q not found", n, step.Job)
+			}
+			if scheduler.WaitsFor(step.Job, j.Name, func(name string) []string { return waits[name] }) {
+				return fmt.Errorf("step %d: %q waits for this job, so neither could finish", n, step.Job)
+			}
+		default:
+			return fmt.Errorf("step %d: unknown step type %q", n, step.Type)
+		}
+	}
+	return nil
+}
+
+// waitedFor returns the names of the jobs a job's wait-for-job steps wait for
+func waitedFor(j Job) []string {
+	var names []string
+	for _, step := range j.Steps {
+		if step.Type == db.JobStepWaitForJob {
+			names = append(names, step.Job)
+		}
+	}
+	return names
+}
+
+// expandPaths expands and trims paths, dropping empty ones
+func expandPaths(paths []string) []string {
+	var expanded []string
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			expanded = append(expanded, config.ExpandPath(p))
+		}
+	}
+	return expanded
+}
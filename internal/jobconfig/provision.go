@@ -0,0 +1,99 @@
+package jobconfig
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+// ProvisionResult counts the jobs changed by Provision
+type ProvisionResult struct {
+	Created  int
+	Updated  int
+	Disabled int // Managed jobs removed from the file
+}
+
+// Provision reconciles the jobs in a jobs file into the database. Jobs in the
+// file are created, or updated to match if a job of the same name exists, and
+// marked managed. Managed jobs no longer in the file are disabled and handed
+// back to the UI. Nothing changes unless every job in the file is valid, and
+// the changes are made in one transaction.
+func Provision(database *db.DB, f *File, opts Options, now time.Time) (*ProvisionResult, error) {
+	plan, err := newPlan(database, f, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.Valid() {
+		var errs []error
+		for _, c := range plan.Jobs {
+			if c.Error != "" {
+				errs = append(errs, fmt.Errorf("job %q: %s", c.Name, c.Error))
+			}
+		}
+		for _, c := range plan.Settings {
+			if c.Error != "" {
+				errs = append(errs, fmt.Errorf("setting %s: %s", c.Key, c.Error))
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	result := &ProvisionResult{}
+	result.Created, result.Updated = plan.Counts()
+
+	inFile := make(map[string]bool, len(plan.Jobs))
+	for _, c := range plan.Jobs {
+		inFile[c.Name] = true
+	}
+
+	err = database.Transaction(func(tx *db.DB) error {
+		if err := apply(tx, plan, now); err != nil {
+			return err
+		}
+
+		jobs, err := tx.ListScheduledJobs()
+		if err != nil {
+			return err
+		}
+		for _, j := range jobs {
+			if !j.Managed || inFile[j.Name] {
+				continue
+			}
+			j.Managed = false
+			j.Enabled = false
+			if err := tx.UpdateScheduledJob(j); err != nil {
+				return fmt.Errorf("failed to disable job %q: %w", j.Name, err)
+			}
+			result.Disabled++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Release hands all managed jobs back to the UI, unchanged, for when the
+// server no longer provisions jobs. It returns the number of jobs released.
+func Release(database *db.DB) (int, error) {
+	jobs, err := database.ListScheduledJobs()
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, j := range jobs {
+		if !j.Managed {
+			continue
+		}
+		j.Managed = false
+		if err := database.UpdateScheduledJob(j); err != nil {
+			return released, fmt.Errorf("failed to release job %q: %w", j.Name, err)
+		}
+		released++
+	}
+	return released, nil
+}
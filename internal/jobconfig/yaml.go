@@ -0,0 +1,482 @@
+package jobconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlToJSON converts a YAML document to JSON, so a YAML configuration file
+// can be decoded with the same struct tags as a JSON one. It supports the
+// parts of YAML a configuration file needs: block mappings and sequences,
+// single-line flow sequences and mappings, plain and quoted scalars, literal
+// (|) and folded (>) block scalars, and comments. Anchors, aliases, tags and
+// multiple documents aren't supported.
+func yamlToJSON(data []byte) ([]byte, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	for i, line := range p.lines {
+		if strings.TrimRight(line, " \t") == "..." {
+			p.lines = p.lines[:i]
+			break
+		}
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) && strings.TrimRight(p.lines[p.pos], " \t") == "---" {
+		p.pos++
+	}
+
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil, fmt.Errorf("the file is empty")
+	}
+	v, err := p.parseNode(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank(); p.pos < len(p.lines) {
+		if strings.TrimSpace(p.lines[p.pos]) == "---" {
+			return nil, fmt.Errorf("line %d: only one document is supported", p.pos+1)
+		}
+		return nil, fmt.Errorf("line %d: unexpected content", p.pos+1)
+	}
+	return json.Marshal(v)
+}
+
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+// skipBlank moves past blank and comment-only lines
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) {
+		t := strings.TrimSpace(p.lines[p.pos])
+		if t != "" && !strings.HasPrefix(t, "#") {
+			return
+		}
+		p.pos++
+	}
+}
+
+// indent returns the indentation and content of the current line
+func (p *yamlParser) indent() (int, string, error) {
+	line := p.lines[p.pos]
+	n := len(line) - len(strings.TrimLeft(line, " "))
+	if n < len(line) && line[n] == '\t' {
+		return 0, "", fmt.Errorf("line %d: tabs can't be used for indentation", p.pos+1)
+	}
+	return n, strings.TrimRight(line[n:], " \t"), nil
+}
+
+// parseNode parses the node starting on the next line, which must be
+// indented by at least min
+func (p *yamlParser) parseNode(min int) (any, error) {
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	n, text, err := p.indent()
+	if err != nil || n < min {
+		return nil, err
+	}
+	switch {
+	case isSeqItem(text):
+		return p.parseSeq(n)
+	case mappingKeyEnd(text) >= 0:
+		return p.parseMap(n)
+	}
+	line := p.pos + 1
+	p.pos++
+	return parseScalar(p.joinFlow(text), line)
+}
+
+// isSeqItem reports whether a line's content is a block sequence item
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseSeq parses a block sequence whose items are indented by n
+func (p *yamlParser) parseSeq(n int) ([]any, error) {
+	items := []any{}
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		in, text, err := p.indent()
+		if err != nil {
+			return nil, err
+		}
+		if in < n || !isSeqItem(text) {
+			break
+		}
+		if in > n {
+			return nil, fmt.Errorf("line %d: unexpected indentation", p.pos+1)
+		}
+
+		rest := strings.TrimLeft(strings.TrimPrefix(text, "-"), " ")
+		var item any
+		if rest == "" || strings.HasPrefix(rest, "#") {
+			p.pos++
+			item, err = p.parseNode(n + 1)
+		} else {
+			// The item's content starts a node at its own column, so
+			// "- name: a" continues with keys lined up under "name"
+			col := n + len(text) - len(rest)
+			p.lines[p.pos] = strings.Repeat(" ", col) + rest
+			item, err = p.parseNode(col)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseMap parses a block mapping whose keys are indented by n
+func (p *yamlParser) parseMap(n int) (map[string]any, error) {
+	m := make(map[string]any)
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		in, text, err := p.indent()
+		if err != nil {
+			return nil, err
+		}
+		if in < n || isSeqItem(text) && in == n {
+			break
+		}
+		if in > n {
+			return nil, fmt.Errorf("line %d: unexpected indentation", p.pos+1)
+		}
+
+		end := mappingKeyEnd(text)
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: expected a key followed by a colon", p.pos+1)
+		}
+		k, err := parseScalar(text[:end], p.pos+1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", p.pos+1, key)
+		}
+
+		rest := strings.TrimLeft(text[end+1:], " \t")
+		switch {
+		case rest == "" || strings.HasPrefix(rest, "#"):
+			p.pos++
+			p.skipBlank()
+			if p.pos < len(p.lines) {
+				// A sequence may be indented as much as its key
+				if in, text, _ := p.indent(); in == n && isSeqItem(text) {
+					m[key], err = p.parseSeq(n)
+					break
+				}
+			}
+			m[key], err = p.parseNode(n + 1)
+		case rest[0] == '|' || rest[0] == '>':
+			m[key], err = p.parseBlockScalar(n, rest)
+		default:
+			line := p.pos + 1
+			p.pos++
+			m[key], err = parseScalar(p.joinFlow(rest), line)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// parseBlockScalar parses a literal or folded block scalar for a key
+// indented by n, with header being the indicator after the key
+func (p *yamlParser) parseBlockScalar(n int, header string) (string, error) {
+	line := p.pos + 1
+	if i := strings.Index(header, " #"); i >= 0 {
+		header = strings.TrimSpace(header[:i])
+	}
+	folded := header[0] == '>'
+	chomp := header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return "", fmt.Errorf("line %d: unsupported block scalar header %q", line, header)
+	}
+	p.pos++
+
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := strings.TrimRight(p.lines[p.pos], " \t")
+		if raw == "" {
+			lines = append(lines, "")
+			continue
+		}
+		in := len(raw) - len(strings.TrimLeft(raw, " "))
+		if blockIndent < 0 {
+			if in <= n {
+				break
+			}
+			blockIndent = in
+		}
+		if in < blockIndent {
+			break
+		}
+		lines = append(lines, raw[blockIndent:])
+	}
+
+	// Trailing blank lines belong to what follows unless they're kept
+	content := len(lines)
+	for content > 0 && lines[content-1] == "" {
+		content--
+	}
+	p.pos -= len(lines) - content
+	trailing := lines[content:]
+	lines = lines[:content]
+
+	var b strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			// Folding joins adjacent lines with a space and turns each
+			// blank line into a line break
+			if folded && l != "" && lines[i-1] != "" && !strings.HasPrefix(l, " ") {
+				b.WriteByte(' ')
+			} else if !folded || lines[i-1] != "" || l == "" {
+				b.WriteByte('\n')
+			}
+		}
+		b.WriteString(l)
+	}
+	s := b.String()
+	switch {
+	case len(lines) == 0:
+	case chomp == "":
+		s += "\n"
+	case chomp == "+":
+		s += "\n" + strings.Repeat("\n", len(trailing))
+	}
+	return s, nil
+}
+
+// joinFlow appends the lines following a flow collection that continues
+// past the end of its first line, text
+func (p *yamlParser) joinFlow(text string) string {
+	if text == "" || text[0] != '[' && text[0] != '{' {
+		return text
+	}
+	text = stripComment(text)
+	for flowDepth(text) > 0 && p.pos < len(p.lines) {
+		text += " " + strings.TrimSpace(stripComment(p.lines[p.pos]))
+		p.pos++
+	}
+	return text
+}
+
+// flowDepth returns how many flow collections are left open in text
+func flowDepth(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			if i > 0 && !strings.ContainsRune(" \t[{,:", rune(text[i-1])) {
+				continue
+			}
+			end := quoteEnd(text[i:])
+			if end < 0 {
+				return depth
+			}
+			i += end
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// stripComment removes a comment from the end of a line
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" \t[{,:", rune(line[i-1]))):
+			if end := quoteEnd(line[i:]); end >= 0 {
+				i += end
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return line
+}
+
+// mappingKeyEnd returns the index of the colon ending a mapping key at the
+// start of text, or -1 if text isn't a key and value
+func mappingKeyEnd(text string) int {
+	start := 0
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end := quoteEnd(text)
+		if end < 0 {
+			return -1
+		}
+		start = end + 1
+	} else if text != "" && strings.ContainsRune("[{#", rune(text[0])) {
+		return -1
+	}
+	for i := start; i < len(text); i++ {
+		switch {
+		case text[i] == '#' && i > 0 && (text[i-1] == ' ' || text[i-1] == '\t'):
+			return -1
+		case text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t'):
+			return i
+		}
+	}
+	return -1
+}
+
+// quoteEnd returns the index of the quote closing the quoted scalar text
+// starts with, or -1 if it isn't closed
+func quoteEnd(text string) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case q == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// parseScalar parses a value written on a single line
+func parseScalar(text string, line int) (any, error) {
+	v, rest, err := parseFlow(strings.TrimSpace(text), false, line)
+	if err != nil {
+		return nil, err
+	}
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return nil, fmt.Errorf("line %d: unexpected %q after value", line, rest)
+	}
+	return v, nil
+}
+
+// parseFlow parses a value at the start of text, returning what follows it.
+// Inside flow collections, commas and closing brackets end plain scalars.
+func parseFlow(text string, inFlow bool, line int) (any, string, error) {
+	if text == "" {
+		return nil, "", nil
+	}
+	switch text[0] {
+	case '"', '\'':
+		end := quoteEnd(text)
+		if end < 0 {
+			return nil, "", fmt.Errorf("line %d: unterminated quoted string", line)
+		}
+		if text[0] == '\'' {
+			return strings.ReplaceAll(text[1:end], "''", "'"), text[end+1:], nil
+		}
+		s, err := strconv.Unquote(strings.ReplaceAll(text[:end+1], `\/`, "/"))
+		if err != nil {
+			return nil, "", fmt.Errorf("line %d: invalid quoted string %s", line, text[:end+1])
+		}
+		return s, text[end+1:], nil
+
+	case '[', '{':
+		closing := byte(']')
+		if text[0] == '{' {
+			closing = '}'
+		}
+		seq := []any{}
+		m := make(map[string]any)
+		rest := strings.TrimLeft(text[1:], " ")
+		for {
+			if rest == "" {
+				return nil, "", fmt.Errorf("line %d: unterminated flow collection", line)
+			}
+			if rest[0] == closing {
+				rest = rest[1:]
+				break
+			}
+			v, r, err := parseFlow(rest, true, line)
+			if err != nil {
+				return nil, "", err
+			}
+			r = strings.TrimLeft(r, " ")
+			if closing == '}' {
+				if r == "" || r[0] != ':' {
+					return nil, "", fmt.Errorf("line %d: expected a colon after a key", line)
+				}
+				key, ok := v.(string)
+				if !ok {
+					key = fmt.Sprint(v)
+				}
+				v, r, err = parseFlow(strings.TrimLeft(r[1:], " "), true, line)
+				if err != nil {
+					return nil, "", err
+				}
+				m[key] = v
+				r = strings.TrimLeft(r, " ")
+			} else {
+				seq = append(seq, v)
+			}
+			if r != "" && r[0] == ',' {
+				r = strings.TrimLeft(r[1:], " ")
+			} else if r != "" && r[0] != closing {
+				return nil, "", fmt.Errorf("line %d: expected a comma or %q in flow collection", line, closing)
+			}
+			rest = r
+		}
+		if closing == '}' {
+			return m, rest, nil
+		}
+		return seq, rest, nil
+
+	case '&', '*', '!':
+		return nil, "", fmt.Errorf("line %d: anchors, aliases and tags aren't supported", line)
+	}
+
+	// A plain scalar runs to a comment, or in a flow collection to the
+	// next separator
+	end := len(text)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == '#' && i > 0 && (text[i-1] == ' ' || text[i-1] == '\t') ||
+			inFlow && (c == ',' || c == ']' || c == '}' || c == ':' && (i+1 == len(text) || text[i+1] == ' ')) {
+			end = i
+			break
+		}
+	}
+	s := strings.TrimSpace(text[:end])
+	return plainValue(s), text[end:], nil
+}
+
+// plainValue resolves an unquoted scalar to a null, boolean, number or string
+func plainValue(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if yamlInt.MatchString(s) {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	}
+	if yamlFloat.MatchString(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
@@ -0,0 +1,358 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/fclones"
+	"github.com/lyallcooper/kuron/internal/services"
+)
+
+// pollInterval is how often running scans and jobs are checked for completion
+var pollInterval = 5 * time.Second
+
+// waitForJobTimeout bounds how long a wait_for_job step waits for the other job to finish
+const waitForJobTimeout = 12 * time.Hour
+
+// notifyTimeout bounds a notify step's webhook request
+const notifyTimeout = 30 * time.Second
+
+// jobEventsScanLimit is how many recent events are searched for a job's latest run
+const jobEventsScanLimit = 20
+
+// pipelineRun holds the state shared between the steps of one job run
+type pipelineRun struct {
+	job       *db.ScheduledJob
+	eventID   int64
+	scanRunID int64            // Most recent scan run started by a scan step (0 = none yet)
+	steps     []*db.JobStepRun // Steps run so far, for notify summaries
+}
+
+// runPipeline executes the job's steps in order, recording each step's outcome
+// against the run's event. A failed step stops the pipeline and the remaining
+// steps are recorded as skipped.
+func (s *Scheduler) runPipeline(ctx context.Context, job *db.ScheduledJob, eventID int64) {
+	p := &pipelineRun{job: job, eventID: eventID}
+	steps := job.PipelineSteps()
+
+	for i, step := range steps {
+		sr := &db.JobStepRun{
+			JobEventID: eventID,
+			JobID:      job.ID,
+			StepIndex:  i,
+			StepType:   step.Type,
+		}
+		if err := s.db.CreateJobStepRun(sr); err != nil {
+			log.Printf("scheduler: failed to record step %d of job %d: %v", i, job.ID, err)
+		}
+
+		message, err := s.runStep(ctx, p, step, sr)
+
+		completedAt := time.Now()
+		sr.CompletedAt = &completedAt
+		sr.Status = db.JobStepRunCompleted
+		sr.Message = message
+		if err != nil {
+			sr.Status = db.JobStepRunFailed
+			sr.Message = err.Error()
+		}
+		if err := s.db.UpdateJobStepRun(sr); err != nil {
+			log.Printf("scheduler: failed to update step %d of job %d: %v", i, job.ID, err)
+		}
+		p.steps = append(p.steps, sr)
+
+		if err != nil {
+			log.Printf("scheduler: step %d (%s) of job %d failed: %v", i+1, step.Type, job.ID, err)
+			s.skipSteps(job.ID, eventID, steps, i+1)
+			return
+		}
+	}
+}
+
+// skipSteps records the steps from index onwards as skipped
+func (s *Scheduler) skipSteps(jobID, eventID int64, steps []db.JobStep, from int) {
+	for i := from; i < len(steps); i++ {
+		if err := s.db.CreateJobStepRun(&db.JobStepRun{
+			JobEventID: eventID,
+			JobID:      jobID,
+			StepIndex:  i,
+			StepType:   steps[i].Type,
+			Status:     db.JobStepRunSkipped,
+			Message:    "Skipped because an earlier step failed",
+		}); err != nil {
+			log.Printf("scheduler: failed to record skipped step %d of job %d: %v", i, jobID, err)
+		}
+	}
+}
+
+// runStep executes a single step and returns a summary of its outcome
+func (s *Scheduler) runStep(ctx context.Context, p *pipelineRun, step db.JobStep, sr *db.JobStepRun) (string, error) {
+	switch step.Type {
+	case db.JobStepScan:
+		return s.runScanStep(ctx, p, step, sr)
+	case db.JobStepAction:
+		return s.runActionStep(ctx, p, step, sr)
+	case db.JobStepNotify:
+		return s.runNotifyStep(ctx, p, step)
+	case db.JobStepWaitForJob:
+		return s.runWaitForJobStep(ctx, p, step)
+	default:
+		return "", fmt.Errorf("unknown step type %q", step.Type)
+	}
+}
+
+// runScanStep scans the step's paths (or the job's) and waits for the scan to finish
+func (s *Scheduler) runScanStep(ctx context.Context, p *pipelineRun, step db.JobStep, sr *db.JobStepRun) (string, error) {
+	job := p.job
+	paths := step.Paths
+	if len(paths) == 0 {
+		paths = job.Paths
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no paths configured")
+	}
+
+	cfg := services.JobScanConfig(job)
+	cfg.Paths = paths
+
+	run, err := s.scanner.StartScan(ctx, cfg, &job.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to start scan: %w", err)
+	}
+	sr.ScanRunID = &run.ID
+	if err := s.db.UpdateJobStepRun(sr); err != nil {
+		log.Printf("scheduler: failed to update step %d of job %d: %v", sr.StepIndex, job.ID, err)
+	}
+
+	// The run's event links to its first scan
+	if p.scanRunID == 0 && p.eventID != 0 {
+		if err := s.db.SetJobEventScanRun(p.eventID, run.ID); err != nil {
+			log.Printf("scheduler: failed to link event %d to scan run %d: %v", p.eventID, run.ID, err)
+		}
+	}
+	p.scanRunID = run.ID
+	log.Printf("scheduler: started scan run %d for job %d", run.ID, job.ID)
+
+	run, err = s.waitForScan(ctx, run.ID)
+	if err != nil {
+		return "", err
+	}
+	if run.Status != db.ScanRunStatusCompleted {
+		return "", fmt.Errorf("scan %d finished with status %s", run.ID, run.Status)
+	}
+
+	return fmt.Sprintf("Found %d duplicate groups (%s wasted)", run.DuplicateGroups, fclones.HumanSize(run.WastedBytes)), nil
+}
+
+// runActionStep applies the step's action to the pending groups of the previous scan
+func (s *Scheduler) runActionStep(ctx context.Context, p *pipelineRun, step db.JobStep, sr *db.JobStepRun) (string, error) {
+	if p.scanRunID == 0 {
+		return "", fmt.Errorf("no scan step before this action")
+	}
+	if step.ActionType != db.ActionTypeHardlink && step.ActionType != db.ActionTypeReflink {
+		return "", fmt.Errorf("unsupported action %q", step.ActionType)
+	}
+
+	// Groups matched on transformed content need a person to confirm them
+	if run, err := s.db.GetScanRun(p.scanRunID); err == nil && run.IsTransformed() {
+		return "", fmt.Errorf("scan %d matched transformed content; review and apply actions from its results", p.scanRunID)
+	}
+
+	groupIDs, err := s.db.GetDuplicateGroupIDs(p.scanRunID, db.DuplicateGroupFilter{Status: string(db.DuplicateGroupStatusPending)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get duplicate groups: %w", err)
+	}
+	if len(groupIDs) == 0 {
+		return fmt.Sprintf("No duplicates found by scan %d", p.scanRunID), nil
+	}
+
+	// Execute action (not dry run for scheduled jobs)
+	hooks := services.ActionHooks{PreAction: p.job.PreActionHook, PostAction: p.job.PostActionHook}
+	result, err := s.scanner.ExecuteActionWithHooks(ctx, p.scanRunID, groupIDs, step.ActionType, hooks)
+	if result != nil && result.Action != nil {
+		sr.ActionID = &result.Action.ID
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w", step.ActionType, err)
+	}
+	if result.HookErr != nil {
+		return "", fmt.Errorf("applied %s to %d groups, but %w", step.ActionType, len(groupIDs), result.HookErr)
+	}
+	if result.Failed > 0 {
+		return "", fmt.Errorf("applied %s to %d groups, but %d files failed", step.ActionType, len(groupIDs), result.Failed)
+	}
+
+	log.Printf("scheduler: executed %s on %d groups for job %d", step.ActionType, len(groupIDs), p.job.ID)
+	return fmt.Sprintf("Applied %s to %d groups", step.ActionType, len(groupIDs)), nil
+}
+
+// pipelineSummary is the payload sent by notify steps
+type pipelineSummary struct {
+	JobID   int64                `json:"job_id"`
+	JobName string               `json:"job_name"`
+	Steps   []pipelineStepResult `json:"steps"`
+}
+
+type pipelineStepResult struct {
+	Type      db.JobStepType      `json:"type"`
+	Status    db.JobStepRunStatus `json:"status"`
+	Message   string              `json:"message"`
+	ScanRunID *int64              `json:"scan_run_id,omitempty"`
+	ActionID  *int64              `json:"action_id,omitempty"`
+}
+
+// runNotifyStep sends a summary of the steps run so far to the step's webhook
+func (s *Scheduler) runNotifyStep(ctx context.Context, p *pipelineRun, step db.JobStep) (string, error) {
+	summary := pipelineSummary{JobID: p.job.ID, JobName: p.job.Name}
+	for _, sr := range p.steps {
+		summary.Steps = append(summary.Steps, pipelineStepResult{
+			Type:      sr.StepType,
+			Status:    sr.Status,
+			Message:   sr.Message,
+			ScanRunID: sr.ScanRunID,
+			ActionID:  sr.ActionID,
+		})
+	}
+
+	if step.WebhookURL == "" {
+		for _, r := range summary.Steps {
+			log.Printf("scheduler: job %d (%s): %s %s: %s", p.job.ID, p.job.Name, r.Type, r.Status, r.Message)
+		}
+		return "Logged summary", nil
+	}
+
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return "", err
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, step.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("webhook request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return "Sent summary to webhook", nil
+}
+
+// WaitsFor reports whether job from waits for job to, directly or through the
+// jobs it waits for. waits returns the jobs named by a job's wait-for-job
+// steps. Jobs that wait for each other would each block until the wait times
+// out, so such steps are rejected when jobs are saved.
+func WaitsFor[K comparable](from, to K, waits func(K) []K) bool {
+	seen := make(map[K]bool)
+	pending := []K{from}
+	for len(pending) > 0 {
+		job := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if job == to {
+			return true
+		}
+		if !seen[job] {
+			seen[job] = true
+			pending = append(pending, waits(job)...)
+		}
+	}
+	return false
+}
+
+// runWaitForJobStep waits for another job to finish and fails unless its latest run succeeded
+func (s *Scheduler) runWaitForJobStep(ctx context.Context, p *pipelineRun, step db.JobStep) (string, error) {
+	other, err := s.db.GetScheduledJob(step.JobID)
+	if err != nil {
+		return "", fmt.Errorf("job %d not found", step.JobID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, waitForJobTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for s.isJobActive(other.ID) {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("gave up waiting for job %q: %w", other.Name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	if !s.jobSucceeded(other.ID) {
+		return "", fmt.Errorf("latest run of job %q did not succeed", other.Name)
+	}
+	return fmt.Sprintf("Job %q succeeded", other.Name), nil
+}
+
+// jobSucceeded reports whether the job's latest run succeeded. Runs with
+// recorded steps succeed when every step completed; otherwise the latest
+// scan run must have completed.
+func (s *Scheduler) jobSucceeded(jobID int64) bool {
+	events, err := s.db.ListJobEvents(jobID, jobEventsScanLimit)
+	if err != nil {
+		log.Printf("scheduler: failed to get events for job %d: %v", jobID, err)
+		return false
+	}
+
+	for _, e := range events {
+		if e.Event != db.JobEventStarted && e.Event != db.JobEventCaughtUp && e.Event != db.JobEventManual {
+			continue
+		}
+		stepRuns, err := s.db.ListJobStepRuns([]int64{e.ID})
+		if err != nil {
+			log.Printf("scheduler: failed to get steps for job %d: %v", jobID, err)
+			return false
+		}
+		if steps := stepRuns[e.ID]; len(steps) > 0 {
+			for _, sr := range steps {
+				if sr.Status != db.JobStepRunCompleted {
+					return false
+				}
+			}
+			return true
+		}
+		break
+	}
+
+	run, err := s.db.GetLastRunForJob(jobID)
+	if err != nil {
+		return false
+	}
+	return run.Status == db.ScanRunStatusCompleted
+}
+
+// waitForScan polls until a scan run is no longer running and returns it
+func (s *Scheduler) waitForScan(ctx context.Context, runID int64) (*db.ScanRun, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+			run, err := s.db.GetScanRun(runID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get scan run: %w", err)
+			}
+			if run.Status != db.ScanRunStatusRunning {
+				return run, nil
+			}
+		}
+	}
+}
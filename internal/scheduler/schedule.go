@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // Embedded zone database so job timezones resolve on hosts without one
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser accepts standard 5-field expressions, an optional leading
+// seconds field, and descriptors like @daily or @every 6h
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// ParseSchedule parses a job's cron expression in the given IANA timezone.
+// An empty timezone uses the server's local time. The expression may carry
+// its own CRON_TZ= prefix instead, but not both.
+func ParseSchedule(expr, timezone string) (cron.Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, fmt.Errorf("empty cron expression")
+	}
+
+	timezone = strings.TrimSpace(timezone)
+	if timezone != "" {
+		if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+			return nil, fmt.Errorf("timezone is set both in the expression and on the job")
+		}
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", timezone)
+		}
+		expr = "CRON_TZ=" + timezone + " " + expr
+	}
+
+	return cronParser.Parse(expr)
+}
+
+// NextRuns returns the next n run times of a schedule after from
+func NextRuns(schedule cron.Schedule, from time.Time, n int) []time.Time {
+	runs := make([]time.Time, 0, n)
+	t := from
+	for i := 0; i < n; i++ {
+		t = schedule.Next(t)
+		if t.IsZero() {
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs
+}
@@ -2,37 +2,69 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/lyallcooper/kuron/internal/db"
 	"github.com/lyallcooper/kuron/internal/services"
-	"github.com/robfig/cron/v3"
 )
 
+// missedRunGrace is how late a run may start before it counts as missed.
+// The scheduler checks jobs at least every minute, so anything within two checks is on time.
+const missedRunGrace = 2 * time.Minute
+
+// Bounds on the wait between job checks. The scheduler sleeps until the next
+// job is due so schedules with seconds fire on time, but still checks every
+// minute to pick up edited jobs and queued runs.
+const (
+	minCheckInterval = time.Second
+	maxCheckInterval = time.Minute
+)
+
+// ErrJobActive is returned when a manual run would overlap a run of the same
+// job and the job's overlap policy doesn't allow it
+var ErrJobActive = errors.New("a run of this job is already in progress")
+
 // Scheduler manages scheduled jobs
 type Scheduler struct {
 	db      *db.DB
 	scanner *services.Scanner
-	parser  cron.Parser
+	window  *MaintenanceWindow // Global maintenance window for jobs without their own (nil = always open)
 
 	mu       sync.RWMutex
 	running  bool
 	stopChan chan struct{}
+	ctx      context.Context    // Context for running jobs, cancelled on stop
 	cancel   context.CancelFunc // Cancel function for running jobs
 	wg       sync.WaitGroup     // Tracks spawned job goroutines
+
+	// Per-job run tracking for overlap policies
+	jobMu      sync.Mutex
+	activeJobs map[int64]int       // Job ID -> number of runs started by the scheduler still in progress
+	queuedJobs map[int64]time.Time // Job ID -> scheduled time of the run waiting for the active run to finish
 }
 
 // New creates a new scheduler
 func New(database *db.DB, scanner *services.Scanner) *Scheduler {
 	return &Scheduler{
-		db:      database,
-		scanner: scanner,
-		parser:  cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow),
+		db:         database,
+		scanner:    scanner,
+		activeJobs: make(map[int64]int),
+		queuedJobs: make(map[int64]time.Time),
 	}
 }
 
+// SetMaintenanceWindow sets the window scheduled runs may start in, for jobs
+// that don't set their own. The global window is evaluated in server local time.
+func (s *Scheduler) SetMaintenanceWindow(w *MaintenanceWindow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.window = w
+}
+
 // Start starts the scheduler
 func (s *Scheduler) Start() {
 	s.mu.Lock()
@@ -45,6 +77,7 @@ func (s *Scheduler) Start() {
 
 	// Create cancellable context for all spawned jobs
 	ctx, cancel := context.WithCancel(context.Background())
+	s.ctx = ctx
 	s.cancel = cancel
 	s.mu.Unlock()
 
@@ -73,172 +106,341 @@ func (s *Scheduler) Stop() {
 
 // run is the main scheduler loop
 func (s *Scheduler) run(ctx context.Context) {
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
-
 	// Check immediately on start
-	s.checkJobs(ctx)
+	next := s.checkJobs(ctx)
+
+	timer := time.NewTimer(checkInterval(next))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-s.stopChan:
 			return
-		case <-ticker.C:
-			s.checkJobs(ctx)
+		case <-timer.C:
+			next = s.checkJobs(ctx)
+			timer.Reset(checkInterval(next))
 		}
 	}
 }
 
-// checkJobs checks for jobs that need to run
-func (s *Scheduler) checkJobs(ctx context.Context) {
+// checkInterval returns how long to wait before checking for the run due at next
+func checkInterval(next time.Time) time.Duration {
+	if next.IsZero() {
+		return maxCheckInterval
+	}
+	wait := time.Until(next)
+	if wait < minCheckInterval {
+		return minCheckInterval
+	}
+	if wait > maxCheckInterval {
+		return maxCheckInterval
+	}
+	return wait
+}
+
+// checkJobs checks for jobs that need to run and returns the earliest
+// upcoming run time among jobs that are not yet due (zero if none)
+func (s *Scheduler) checkJobs(ctx context.Context) time.Time {
 	jobs, err := s.db.GetEnabledJobs()
 	if err != nil {
 		log.Printf("scheduler: failed to get jobs: %v", err)
-		return
+		return time.Time{}
 	}
 
 	now := time.Now()
+	var next time.Time
 
 	for _, job := range jobs {
+		// Start a queued run once the run it was waiting on has finished,
+		// holding it while the maintenance window is closed
+		if _, deferred := s.deferUntil(job, now); !deferred {
+			if scheduledFor, ok := s.takeQueuedRun(job.ID); ok {
+				s.startJob(ctx, job, db.JobEventStarted, &scheduledFor, "Started queued run")
+			}
+		}
+
 		if job.NextRunAt == nil {
 			continue
 		}
 
 		if now.After(*job.NextRunAt) || now.Equal(*job.NextRunAt) {
-			s.wg.Add(1)
-			go s.runJob(ctx, job)
+			s.handleDueJob(ctx, job, now)
+		} else if next.IsZero() || job.NextRunAt.Before(next) {
+			next = *job.NextRunAt
 		}
 	}
-}
 
-// runJob executes a scheduled job
-func (s *Scheduler) runJob(ctx context.Context, job *db.ScheduledJob) {
-	defer s.wg.Done()
+	return next
+}
 
-	log.Printf("scheduler: running job %d (%s)", job.ID, job.Name)
+// handleDueJob applies the job's missed-run and overlap policies to a due run
+// and either starts, queues or skips it. The next run time is always advanced
+// so the same occurrence is never handled twice.
+func (s *Scheduler) handleDueJob(ctx context.Context, job *db.ScheduledJob, now time.Time) {
+	scheduledFor := *job.NextRunAt
 
-	// Check if context is already cancelled
-	if ctx.Err() != nil {
-		log.Printf("scheduler: job %d cancelled before start", job.ID)
+	schedule, err := ParseSchedule(job.CronExpression, job.Timezone)
+	if err != nil {
+		log.Printf("scheduler: invalid schedule for job %d: %v", job.ID, err)
 		return
 	}
+	nextRun := schedule.Next(now)
 
-	if len(job.Paths) == 0 {
-		log.Printf("scheduler: no paths configured for job %d", job.ID)
-		return
-	}
+	event := db.JobEventStarted
+	message := "Started on schedule"
 
-	// Build scan config from job
-	cfg := &services.ScanConfig{
-		Paths:           job.Paths,
-		MinSize:         job.MinSize,
-		MaxSize:         job.MaxSize,
-		IncludePatterns: job.IncludePatterns,
-		ExcludePatterns: job.ExcludePatterns,
-		IncludeHidden:   job.IncludeHidden,
-		FollowLinks:     job.FollowLinks,
-		OneFileSystem:   job.OneFileSystem,
-		NoIgnore:        job.NoIgnore,
-		IgnoreCase:      job.IgnoreCase,
-		MaxDepth:        job.MaxDepth,
+	// Missed-run policy: a run is missed if it is well past its scheduled time
+	if now.Sub(scheduledFor) > missedRunGrace {
+		if job.MissedRunPolicy == db.MissedRunPolicySkip {
+			if err := s.db.UpdateJobNextRun(job.ID, nextRun); err != nil {
+				log.Printf("scheduler: failed to update job next run: %v", err)
+			}
+			s.recordEvent(job.ID, db.JobEventSkippedMissed, &scheduledFor,
+				fmt.Sprintf("Missed run skipped, next run at %s", nextRun.Format("2006-01-02 15:04")))
+			log.Printf("scheduler: skipped missed run of job %d scheduled for %v", job.ID, scheduledFor)
+			return
+		}
+		event = db.JobEventCaughtUp
+		message = fmt.Sprintf("Caught up missed run (%s late)", now.Sub(scheduledFor).Round(time.Minute))
 	}
 
-	// Start scan with cancellable context
-	run, err := s.scanner.StartScan(ctx, cfg, &job.ID)
-	if err != nil {
-		log.Printf("scheduler: failed to start scan for job %d: %v", job.ID, err)
+	// Maintenance window: move the run to when the window next opens
+	if openAt, deferred := s.deferUntil(job, now); deferred {
+		if err := s.db.UpdateJobNextRun(job.ID, openAt); err != nil {
+			log.Printf("scheduler: failed to update job next run: %v", err)
+		}
+		s.recordEvent(job.ID, db.JobEventDeferred, &scheduledFor,
+			fmt.Sprintf("Outside maintenance window, deferred to %s", openAt.Local().Format("2006-01-02 15:04")))
+		log.Printf("scheduler: deferred job %d until %v", job.ID, openAt)
 		return
 	}
 
-	// Update last run time
-	now := time.Now()
-	schedule, err := s.parser.Parse(job.CronExpression)
-	if err != nil {
-		log.Printf("scheduler: invalid cron expression for job %d: %v", job.ID, err)
+	// Overlap policy: check for a run of this job that is still in progress
+	if job.OverlapPolicy != db.OverlapPolicyAllow && s.isJobActive(job.ID) {
+		if err := s.db.UpdateJobNextRun(job.ID, nextRun); err != nil {
+			log.Printf("scheduler: failed to update job next run: %v", err)
+		}
+		if job.OverlapPolicy == db.OverlapPolicyQueue {
+			s.queueRun(job.ID, scheduledFor)
+			s.recordEvent(job.ID, db.JobEventQueued, &scheduledFor, "Previous run still active, queued")
+			log.Printf("scheduler: queued job %d behind its active run", job.ID)
+		} else {
+			s.recordEvent(job.ID, db.JobEventSkippedOverlap, &scheduledFor, "Previous run still active, skipped")
+			log.Printf("scheduler: skipped job %d, previous run still active", job.ID)
+		}
 		return
 	}
 
-	nextRun := schedule.Next(now)
-	if err := s.db.UpdateJobLastRun(job.ID, now, nextRun); err != nil {
-		log.Printf("scheduler: failed to update job last run: %v", err)
+	// Advance the schedule before the run starts, so the next check doesn't
+	// find the same occurrence due again
+	if err := s.db.UpdateJobNextRun(job.ID, nextRun); err != nil {
+		log.Printf("scheduler: failed to update job next run: %v", err)
+		return
 	}
+	s.startJob(ctx, job, event, &scheduledFor, message)
+}
 
-	log.Printf("scheduler: started scan run %d for job %d, next run at %v", run.ID, job.ID, nextRun)
+// deferUntil reports whether the job's maintenance window is closed at now,
+// and if so when it next opens. A job's own window is evaluated in the job's
+// timezone and replaces the global window. Invalid windows are treated as open.
+func (s *Scheduler) deferUntil(job *db.ScheduledJob, now time.Time) (time.Time, bool) {
+	s.mu.RLock()
+	window := s.window
+	s.mu.RUnlock()
+	loc := time.Local
+
+	if job.MaintenanceWindow != "" {
+		w, err := ParseMaintenanceWindow(job.MaintenanceWindow)
+		if err != nil {
+			log.Printf("scheduler: invalid maintenance window for job %d: %v", job.ID, err)
+			return time.Time{}, false
+		}
+		window = w
+		if job.Timezone != "" {
+			if l, err := time.LoadLocation(job.Timezone); err == nil {
+				loc = l
+			}
+		}
+	}
 
-	// If action is specified, wait for scan to complete and execute action
-	if job.Action != "scan" {
-		s.waitAndExecuteAction(ctx, run.ID, job)
+	if window.Contains(now.In(loc)) {
+		return time.Time{}, false
 	}
+	return window.NextOpen(now.In(loc)), true
 }
 
-// waitAndExecuteAction waits for a scan to complete and executes the configured action
-func (s *Scheduler) waitAndExecuteAction(ctx context.Context, runID int64, job *db.ScheduledJob) {
-	// Poll for completion
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// startJob runs the job in the background
+func (s *Scheduler) startJob(ctx context.Context, job *db.ScheduledJob, event db.JobEventType, scheduledFor *time.Time, message string) {
+	s.jobMu.Lock()
+	s.activeJobs[job.ID]++
+	s.jobMu.Unlock()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			run, err := s.db.GetScanRun(runID)
-			if err != nil {
-				log.Printf("scheduler: failed to get scan run: %v", err)
-				return
-			}
+	s.wg.Add(1)
+	go s.runJob(ctx, job, event, scheduledFor, message)
+}
 
-			if run.Status == db.ScanRunStatusRunning {
-				continue
-			}
+// isJobActive reports whether a run of the job is still in progress, either
+// one started by the scheduler or one started manually.
+func (s *Scheduler) isJobActive(jobID int64) bool {
+	s.jobMu.Lock()
+	active := s.activeJobs[jobID] > 0
+	s.jobMu.Unlock()
+	if active {
+		return true
+	}
 
-			if run.Status != db.ScanRunStatusCompleted {
-				log.Printf("scheduler: scan %d did not complete successfully, skipping action", runID)
-				return
-			}
+	// Runs left marked as running by a previous process aren't active, so
+	// confirm with the scanner rather than trusting the stored status
+	runIDs, err := s.db.GetRunningScanRunIDsForJob(jobID)
+	if err != nil {
+		log.Printf("scheduler: failed to check running scans for job %d: %v", jobID, err)
+		return false
+	}
+	for _, id := range runIDs {
+		if s.scanner.IsActive(id) {
+			return true
+		}
+	}
+	return false
+}
 
-			// Get all pending groups
-			groups, err := s.db.ListDuplicateGroups(runID, "pending")
-			if err != nil {
-				log.Printf("scheduler: failed to get duplicate groups: %v", err)
-				return
-			}
+// HasActiveJobs reports whether a run of any job is in progress in this
+// process, including between its pipeline's steps
+func (s *Scheduler) HasActiveJobs() bool {
+	s.jobMu.Lock()
+	defer s.jobMu.Unlock()
+	return len(s.activeJobs) > 0
+}
 
-			if len(groups) == 0 {
-				log.Printf("scheduler: no duplicate groups found for scan %d", runID)
-				return
-			}
+// queueRun records a run to start once the job's active run finishes.
+// Only one run is queued per job; later runs are coalesced into it.
+func (s *Scheduler) queueRun(jobID int64, scheduledFor time.Time) {
+	s.jobMu.Lock()
+	defer s.jobMu.Unlock()
+	if _, ok := s.queuedJobs[jobID]; !ok {
+		s.queuedJobs[jobID] = scheduledFor
+	}
+}
 
-			// Collect group IDs
-			var groupIDs []int64
-			for _, g := range groups {
-				groupIDs = append(groupIDs, g.ID)
-			}
+// takeQueuedRun removes and returns the job's queued run if the job is no longer active
+func (s *Scheduler) takeQueuedRun(jobID int64) (time.Time, bool) {
+	s.jobMu.Lock()
+	scheduledFor, ok := s.queuedJobs[jobID]
+	s.jobMu.Unlock()
+	if !ok || s.isJobActive(jobID) {
+		return time.Time{}, false
+	}
 
-			// Determine action type
-			var actionType db.ActionType
-			if job.Action == "scan_hardlink" {
-				actionType = db.ActionTypeHardlink
-			} else {
-				actionType = db.ActionTypeReflink
-			}
+	s.jobMu.Lock()
+	delete(s.queuedJobs, jobID)
+	s.jobMu.Unlock()
+	return scheduledFor, true
+}
 
-			// Execute action (not dry run for scheduled jobs)
-			_, err = s.scanner.ExecuteAction(ctx, runID, groupIDs, actionType, false, "")
-			if err != nil {
-				log.Printf("scheduler: failed to execute action: %v", err)
-			} else {
-				log.Printf("scheduler: executed %s on %d groups for job %d", actionType, len(groupIDs), job.ID)
-			}
+// recordEvent stores a scheduling decision in the job's history and returns its ID (0 if it couldn't be stored)
+func (s *Scheduler) recordEvent(jobID int64, event db.JobEventType, scheduledFor *time.Time, message string) int64 {
+	e := &db.JobEvent{
+		JobID:        jobID,
+		Event:        event,
+		ScheduledFor: scheduledFor,
+		Message:      message,
+	}
+	if err := s.db.CreateJobEvent(e); err != nil {
+		log.Printf("scheduler: failed to record event for job %d: %v", jobID, err)
+		return 0
+	}
+	return e.ID
+}
 
-			return
+// runJob executes a run of a job's pipeline
+func (s *Scheduler) runJob(ctx context.Context, job *db.ScheduledJob, event db.JobEventType, scheduledFor *time.Time, message string) {
+	defer s.wg.Done()
+	defer func() {
+		s.jobMu.Lock()
+		if s.activeJobs[job.ID]--; s.activeJobs[job.ID] <= 0 {
+			delete(s.activeJobs, job.ID)
 		}
+		s.jobMu.Unlock()
+	}()
+
+	log.Printf("scheduler: running job %d (%s)", job.ID, job.Name)
+
+	// Check if context is already cancelled
+	if ctx.Err() != nil {
+		log.Printf("scheduler: job %d cancelled before start", job.ID)
+		return
 	}
+
+	// Scheduled runs had their schedule advanced when they were found due.
+	// Manual runs restart it from now, though jobs with an invalid schedule
+	// keep their next run time.
+	now := time.Now()
+	if event == db.JobEventManual {
+		nextRun := now
+		if job.NextRunAt != nil {
+			nextRun = *job.NextRunAt
+		}
+		if schedule, err := ParseSchedule(job.CronExpression, job.Timezone); err == nil {
+			nextRun = schedule.Next(now)
+		}
+		if err := s.db.UpdateJobLastRun(job.ID, now, nextRun); err != nil {
+			log.Printf("scheduler: failed to update job last run: %v", err)
+		}
+	} else if err := s.db.UpdateJobLastRunAt(job.ID, now); err != nil {
+		log.Printf("scheduler: failed to update job last run: %v", err)
+	}
+
+	eventID := s.recordEvent(job.ID, event, scheduledFor, message)
+	s.runPipeline(ctx, job, eventID)
+	log.Printf("scheduler: finished job %d", job.ID)
+}
+
+// RunNow starts a run of the job's pipeline outside its schedule. Manual runs
+// count as active while running, and are refused with ErrJobActive while the
+// job is running unless its overlap policy allows overlapping runs.
+func (s *Scheduler) RunNow(job *db.ScheduledJob) error {
+	s.mu.RLock()
+	ctx := s.ctx
+	running := s.running
+	s.mu.RUnlock()
+	if !running {
+		return fmt.Errorf("scheduler is not running")
+	}
+	if s.overlaps(job) {
+		return ErrJobActive
+	}
+
+	s.startJob(ctx, job, db.JobEventManual, nil, "Started manually")
+	return nil
+}
+
+// RunJobAndWait runs the job's pipeline outside its schedule and returns once
+// it has finished. Unlike RunNow it doesn't need the scheduler to be started,
+// so one-off runs from the command line don't also start other due jobs.
+// Overlapping runs are refused like RunNow's.
+func (s *Scheduler) RunJobAndWait(ctx context.Context, job *db.ScheduledJob) error {
+	if s.overlaps(job) {
+		return ErrJobActive
+	}
+
+	s.jobMu.Lock()
+	s.activeJobs[job.ID]++
+	s.jobMu.Unlock()
+
+	s.wg.Add(1)
+	s.runJob(ctx, job, db.JobEventManual, nil, "Started manually")
+	return nil
+}
+
+// overlaps reports whether a manual run of the job would overlap an active
+// run its overlap policy doesn't allow
+func (s *Scheduler) overlaps(job *db.ScheduledJob) bool {
+	return job.OverlapPolicy != db.OverlapPolicyAllow && s.isJobActive(job.ID)
 }
 
 // UpdateNextRun updates the next run time for a job
 func (s *Scheduler) UpdateNextRun(job *db.ScheduledJob) error {
-	schedule, err := s.parser.Parse(job.CronExpression)
+	schedule, err := ParseSchedule(job.CronExpression, job.Timezone)
 	if err != nil {
 		return err
 	}
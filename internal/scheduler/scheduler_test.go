@@ -2,7 +2,13 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -12,6 +18,12 @@ import (
 	"github.com/lyallcooper/kuron/internal/services"
 )
 
+func TestMain(m *testing.M) {
+	// Check scans and jobs quickly so pipeline tests don't wait on the production interval
+	pollInterval = 10 * time.Millisecond
+	os.Exit(m.Run())
+}
+
 // mockExecutor implements fclones.ExecutorInterface for testing
 type mockExecutor struct {
 	mu          sync.Mutex
@@ -30,14 +42,60 @@ func (m *mockExecutor) Version(ctx context.Context) (string, error) {
 func (m *mockExecutor) Group(ctx context.Context, opts fclones.ScanOptions, progressChan chan<- fclones.Progress) (*fclones.GroupOutput, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.groupOutput, m.groupErr
+	if m.groupErr != nil {
+		return nil, m.groupErr
+	}
+	return streamGroups(m.groupOutput, opts)
+}
+
+// streamGroups passes a canned report to the scan's handlers the way the real
+// executor does, returning the output without groups when they're streamed
+func streamGroups(out *fclones.GroupOutput, opts fclones.ScanOptions) (*fclones.GroupOutput, error) {
+	if out == nil || opts.OnGroup == nil {
+		return out, nil
+	}
+	if opts.OnHeader != nil {
+		if err := opts.OnHeader(&out.Header); err != nil {
+			return nil, err
+		}
+	}
+	for _, g := range out.Groups {
+		if err := opts.OnGroup(g); err != nil {
+			return nil, err
+		}
+	}
+	return &fclones.GroupOutput{Header: out.Header}, nil
 }
 
 func (m *mockExecutor) GroupToInput(groups []fclones.Group) string {
-	return ""
+	var b strings.Builder
+	for _, g := range groups {
+		b.WriteString(g.FileHash + "\n")
+		for _, f := range g.Files {
+			b.WriteString("    " + f + "\n")
+		}
+	}
+	return b.String()
 }
 
+// Link hardlinks the files of each group in input to the group's first
 func (m *mockExecutor) Link(ctx context.Context, input string, opts fclones.LinkOptions) (string, error) {
+	if opts.DryRun {
+		return "", nil
+	}
+	var first string
+	for _, line := range strings.Split(input, "\n") {
+		path, isFile := strings.CutPrefix(line, "    ")
+		switch {
+		case !isFile:
+			first = ""
+		case first == "":
+			first = path
+		default:
+			os.Remove(path)
+			os.Link(first, path)
+		}
+	}
 	return "", nil
 }
 
@@ -64,7 +122,7 @@ func TestNew(t *testing.T) {
 	executor := &mockExecutor{
 		groupOutput: &fclones.GroupOutput{Header: fclones.Header{Stats: fclones.Stats{}}},
 	}
-	scanner := services.NewScanner(database, executor, 5*time.Minute, false, "")
+	scanner := services.NewScanner(database, executor, 5*time.Minute, false)
 
 	s := New(database, scanner)
 
@@ -87,7 +145,7 @@ func TestStartStop(t *testing.T) {
 	executor := &mockExecutor{
 		groupOutput: &fclones.GroupOutput{Header: fclones.Header{Stats: fclones.Stats{}}},
 	}
-	scanner := services.NewScanner(database, executor, 5*time.Minute, false, "")
+	scanner := services.NewScanner(database, executor, 5*time.Minute, false)
 	s := New(database, scanner)
 
 	// Start scheduler
@@ -124,7 +182,7 @@ func TestUpdateNextRun(t *testing.T) {
 	executor := &mockExecutor{
 		groupOutput: &fclones.GroupOutput{Header: fclones.Header{Stats: fclones.Stats{}}},
 	}
-	scanner := services.NewScanner(database, executor, 5*time.Minute, false, "")
+	scanner := services.NewScanner(database, executor, 5*time.Minute, false)
 	s := New(database, scanner)
 
 	// Create a job
@@ -165,7 +223,7 @@ func TestUpdateNextRunInvalidCron(t *testing.T) {
 	executor := &mockExecutor{
 		groupOutput: &fclones.GroupOutput{Header: fclones.Header{Stats: fclones.Stats{}}},
 	}
-	scanner := services.NewScanner(database, executor, 5*time.Minute, false, "")
+	scanner := services.NewScanner(database, executor, 5*time.Minute, false)
 	s := New(database, scanner)
 
 	job := &db.ScheduledJob{
@@ -188,7 +246,7 @@ func TestCronExpressionParsing(t *testing.T) {
 	executor := &mockExecutor{
 		groupOutput: &fclones.GroupOutput{Header: fclones.Header{Stats: fclones.Stats{}}},
 	}
-	scanner := services.NewScanner(database, executor, 5*time.Minute, false, "")
+	scanner := services.NewScanner(database, executor, 5*time.Minute, false)
 	s := New(database, scanner)
 
 	tests := []struct {
@@ -203,7 +261,12 @@ func TestCronExpressionParsing(t *testing.T) {
 		{"monthly first day", "0 0 1 * *", false},
 		{"invalid", "invalid", true},
 		{"too few fields", "* * *", true},
-		{"too many fields", "* * * * * *", true}, // 6 fields (with seconds) not supported by our parser
+		{"with seconds", "30 0 * * * *", false},
+		{"daily descriptor", "@daily", false},
+		{"every descriptor", "@every 6h", false},
+		{"timezone prefix", "CRON_TZ=Europe/Berlin 0 9 * * *", false},
+		{"unknown descriptor", "@fortnightly", true},
+		{"too many fields", "* * * * * * *", true},
 	}
 
 	for _, tt := range tests {
@@ -230,7 +293,7 @@ func TestCheckJobsFiltersCorrectly(t *testing.T) {
 	executor := &mockExecutor{
 		groupOutput: &fclones.GroupOutput{Header: fclones.Header{Stats: fclones.Stats{}}},
 	}
-	scanner := services.NewScanner(database, executor, 5*time.Minute, false, "")
+	scanner := services.NewScanner(database, executor, 5*time.Minute, false)
 	_ = New(database, scanner) // Scheduler not directly used, just testing DB filtering
 
 	// Create enabled job with past next run time (should trigger)
@@ -296,7 +359,7 @@ func TestGracefulShutdown(t *testing.T) {
 		done:    make(chan struct{}),
 	}
 
-	scanner := services.NewScanner(database, blockingExecutor, 5*time.Minute, false, "")
+	scanner := services.NewScanner(database, blockingExecutor, 5*time.Minute, false)
 	s := New(database, scanner)
 
 	// Create job that will trigger immediately
@@ -341,6 +404,632 @@ func TestGracefulShutdown(t *testing.T) {
 	}
 }
 
+func newTestScheduler(t *testing.T) (*Scheduler, *db.DB) {
+	t.Helper()
+	database := testDB(t)
+	executor := &mockExecutor{
+		groupOutput: &fclones.GroupOutput{Header: fclones.Header{Stats: fclones.Stats{}}},
+	}
+	scanner := services.NewScanner(database, executor, 5*time.Minute, false)
+	return New(database, scanner), database
+}
+
+// waitForJobEvent polls until the job has an event of the given type
+func waitForJobEvent(t *testing.T, database *db.DB, jobID int64, event db.JobEventType) *db.JobEvent {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		events, err := database.ListJobEvents(jobID, 10)
+		if err != nil {
+			t.Fatalf("ListJobEvents failed: %v", err)
+		}
+		for _, e := range events {
+			if e.Event == event {
+				return e
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %d: no %q event recorded", jobID, event)
+	return nil
+}
+
+func TestMissedRunSkipPolicy(t *testing.T) {
+	s, database := newTestScheduler(t)
+
+	pastTime := time.Now().Add(-3 * time.Hour)
+	job, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:            "Skip Missed",
+		Paths:           []string{"/tmp"},
+		Enabled:         true,
+		CronExpression:  "0 * * * *",
+		Action:          "scan",
+		NextRunAt:       &pastTime,
+		MissedRunPolicy: db.MissedRunPolicySkip,
+	})
+	if err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+
+	s.checkJobs(context.Background())
+	s.wg.Wait()
+
+	event := waitForJobEvent(t, database, job.ID, db.JobEventSkippedMissed)
+	if event.ScheduledFor == nil || !event.ScheduledFor.Equal(pastTime) {
+		t.Errorf("ScheduledFor = %v, want %v", event.ScheduledFor, pastTime)
+	}
+
+	if _, err := database.GetLastRunForJob(job.ID); err == nil {
+		t.Error("no scan should have been started for a skipped run")
+	}
+
+	updated, _ := database.GetScheduledJob(job.ID)
+	if updated.NextRunAt == nil || !updated.NextRunAt.After(time.Now()) {
+		t.Errorf("NextRunAt should be advanced to the future, got %v", updated.NextRunAt)
+	}
+}
+
+func TestMissedRunCatchUpPolicy(t *testing.T) {
+	s, database := newTestScheduler(t)
+
+	pastTime := time.Now().Add(-3 * time.Hour)
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:            "Catch Up",
+		Paths:           []string{"/tmp"},
+		Enabled:         true,
+		CronExpression:  "0 * * * *",
+		Action:          "scan",
+		NextRunAt:       &pastTime,
+		MissedRunPolicy: db.MissedRunPolicyRunOnce,
+	})
+
+	s.checkJobs(context.Background())
+	s.wg.Wait()
+
+	event := waitForJobEvent(t, database, job.ID, db.JobEventCaughtUp)
+	if event.ScanRunID == nil {
+		t.Fatal("caught up event should reference the scan run")
+	}
+	if _, err := database.GetScanRun(*event.ScanRunID); err != nil {
+		t.Errorf("scan run %d not found: %v", *event.ScanRunID, err)
+	}
+}
+
+func TestDueJobAdvancesScheduleBeforeStarting(t *testing.T) {
+	s, database := newTestScheduler(t)
+
+	dueTime := time.Now().Add(-30 * time.Second)
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Allow Overlap",
+		Paths:          []string{"/tmp"},
+		Enabled:        true,
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		NextRunAt:      &dueTime,
+		OverlapPolicy:  db.OverlapPolicyAllow,
+	})
+
+	// The next check must not find the same occurrence due, however soon it
+	// comes after the run starts
+	s.checkJobs(context.Background())
+	updated, _ := database.GetScheduledJob(job.ID)
+	if updated.NextRunAt == nil || !updated.NextRunAt.After(time.Now()) {
+		t.Errorf("next run = %v, want it advanced before the run starts", updated.NextRunAt)
+	}
+	s.checkJobs(context.Background())
+	s.wg.Wait()
+
+	events, _ := database.ListJobEvents(job.ID, 10)
+	var started int
+	for _, e := range events {
+		if e.Event == db.JobEventStarted {
+			started++
+		}
+	}
+	if started != 1 {
+		t.Errorf("job started %d times, want 1", started)
+	}
+	if updated, _ = database.GetScheduledJob(job.ID); updated.LastRunAt == nil {
+		t.Error("last run time should be recorded")
+	}
+}
+
+func TestOverlapForbidPolicy(t *testing.T) {
+	s, database := newTestScheduler(t)
+
+	dueTime := time.Now().Add(-30 * time.Second)
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Forbid Overlap",
+		Paths:          []string{"/tmp"},
+		Enabled:        true,
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		NextRunAt:      &dueTime,
+		OverlapPolicy:  db.OverlapPolicyForbid,
+	})
+
+	// Simulate a run of this job that is still in progress
+	if s.HasActiveJobs() {
+		t.Error("HasActiveJobs() = true before any job ran")
+	}
+	s.activeJobs[job.ID] = 1
+	if !s.HasActiveJobs() {
+		t.Error("HasActiveJobs() = false with a run in progress")
+	}
+
+	s.checkJobs(context.Background())
+
+	waitForJobEvent(t, database, job.ID, db.JobEventSkippedOverlap)
+	if _, err := database.GetLastRunForJob(job.ID); err == nil {
+		t.Error("no scan should have been started while the previous run is active")
+	}
+}
+
+func TestOverlapQueuePolicy(t *testing.T) {
+	s, database := newTestScheduler(t)
+
+	dueTime := time.Now().Add(-30 * time.Second)
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Queue Overlap",
+		Paths:          []string{"/tmp"},
+		Enabled:        true,
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		NextRunAt:      &dueTime,
+		OverlapPolicy:  db.OverlapPolicyQueue,
+	})
+
+	s.activeJobs[job.ID] = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		s.wg.Wait()
+	}()
+
+	s.checkJobs(ctx)
+	waitForJobEvent(t, database, job.ID, db.JobEventQueued)
+	if _, err := database.GetLastRunForJob(job.ID); err == nil {
+		t.Fatal("queued run should not start while the previous run is active")
+	}
+
+	// Previous run finishes; the queued run starts on the next check
+	s.jobMu.Lock()
+	delete(s.activeJobs, job.ID)
+	s.jobMu.Unlock()
+
+	s.checkJobs(ctx)
+	event := waitForJobEvent(t, database, job.ID, db.JobEventStarted)
+	if event.ScheduledFor == nil || !event.ScheduledFor.Equal(dueTime) {
+		t.Errorf("ScheduledFor = %v, want %v", event.ScheduledFor, dueTime)
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2026, 3, 28, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		expr     string
+		timezone string
+		want     time.Time
+		wantErr  bool
+	}{
+		{"local five fields", "0 9 * * *", "UTC", time.Date(2026, 3, 29, 9, 0, 0, 0, time.UTC), false},
+		{"seconds", "15 30 12 * * *", "UTC", time.Date(2026, 3, 28, 12, 30, 15, 0, time.UTC), false},
+		{"descriptor", "@daily", "UTC", time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC), false},
+		{"every", "@every 6h", "", from.Add(6 * time.Hour), false},
+		// 09:00 in Berlin is 08:00 UTC until DST starts on 2026-03-29, then 07:00 UTC
+		{"job timezone", "0 9 * * *", "Europe/Berlin", time.Date(2026, 3, 29, 7, 0, 0, 0, time.UTC), false},
+		{"expression timezone", "CRON_TZ=Asia/Tokyo 0 9 * * *", "", time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC), false},
+		{"unknown timezone", "0 9 * * *", "Mars/Olympus_Mons", time.Time{}, true},
+		{"timezone set twice", "CRON_TZ=UTC 0 9 * * *", "Europe/Berlin", time.Time{}, true},
+		{"empty", "  ", "", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expr, tt.timezone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSchedule(%q, %q) error = %v, wantErr %v", tt.expr, tt.timezone, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := schedule.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNextRuns(t *testing.T) {
+	schedule, err := ParseSchedule("0 */6 * * *", "UTC")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+
+	from := time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC)
+	runs := NextRuns(schedule, from, 5)
+	if len(runs) != 5 {
+		t.Fatalf("expected 5 runs, got %d", len(runs))
+	}
+	for i, run := range runs {
+		want := time.Date(2026, 1, 1, 6*(i+1), 0, 0, 0, time.UTC)
+		if !run.Equal(want) {
+			t.Errorf("run %d = %v, want %v", i, run, want)
+		}
+	}
+}
+
+func TestCheckInterval(t *testing.T) {
+	if got := checkInterval(time.Time{}); got != maxCheckInterval {
+		t.Errorf("no upcoming run: got %v, want %v", got, maxCheckInterval)
+	}
+	if got := checkInterval(time.Now().Add(-time.Minute)); got != minCheckInterval {
+		t.Errorf("overdue run: got %v, want %v", got, minCheckInterval)
+	}
+	if got := checkInterval(time.Now().Add(time.Hour)); got != maxCheckInterval {
+		t.Errorf("distant run: got %v, want %v", got, maxCheckInterval)
+	}
+	if got := checkInterval(time.Now().Add(10 * time.Second)); got < 9*time.Second || got > 10*time.Second {
+		t.Errorf("run in 10s: got %v", got)
+	}
+}
+
+// stepRunsForLatestEvent returns the step runs of the job's most recent event
+func stepRunsForLatestEvent(t *testing.T, database *db.DB, jobID int64) (*db.JobEvent, []*db.JobStepRun) {
+	t.Helper()
+	events, err := database.ListJobEvents(jobID, 1)
+	if err != nil || len(events) == 0 {
+		t.Fatalf("no events for job %d: %v", jobID, err)
+	}
+	stepRuns, err := database.ListJobStepRuns([]int64{events[0].ID})
+	if err != nil {
+		t.Fatalf("ListJobStepRuns failed: %v", err)
+	}
+	return events[0], stepRuns[events[0].ID]
+}
+
+func TestPipelineRunsSteps(t *testing.T) {
+	database := testDB(t)
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	for _, f := range files {
+		if err := os.WriteFile(f, []byte("duplicate"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	executor := &mockExecutor{
+		groupOutput: &fclones.GroupOutput{
+			Header: fclones.Header{Stats: fclones.Stats{}},
+			Groups: []fclones.Group{
+				{FileLen: 100, FileHash: "abc", Files: files},
+			},
+		},
+	}
+	scanner := services.NewScanner(database, executor, 5*time.Minute, false)
+	s := New(database, scanner)
+
+	var summary pipelineSummary
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&summary)
+	}))
+	defer webhook.Close()
+
+	job, err := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Pipeline",
+		Paths:          []string{"/tmp"},
+		Enabled:        true,
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		Steps: []db.JobStep{
+			{Type: db.JobStepScan},
+			{Type: db.JobStepAction, ActionType: db.ActionTypeHardlink},
+			{Type: db.JobStepNotify, WebhookURL: webhook.URL},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateScheduledJob failed: %v", err)
+	}
+
+	s.startJob(context.Background(), job, db.JobEventManual, nil, "Started manually")
+	s.wg.Wait()
+
+	event, steps := stepRunsForLatestEvent(t, database, job.ID)
+	if len(steps) != 3 {
+		t.Fatalf("expected 3 step runs, got %d", len(steps))
+	}
+	for _, sr := range steps {
+		if sr.Status != db.JobStepRunCompleted {
+			t.Errorf("step %d (%s) status = %s (%s), want completed", sr.StepIndex, sr.StepType, sr.Status, sr.Message)
+		}
+	}
+
+	if steps[0].ScanRunID == nil {
+		t.Fatal("scan step should record its scan run")
+	}
+	if event.ScanRunID == nil || *event.ScanRunID != *steps[0].ScanRunID {
+		t.Error("event should link to the pipeline's first scan run")
+	}
+	if steps[1].ActionID == nil {
+		t.Fatal("action step should record its action")
+	}
+	action, err := database.GetAction(*steps[1].ActionID)
+	if err != nil || action.ScanRunID != *steps[0].ScanRunID || action.ActionType != db.ActionTypeHardlink {
+		t.Errorf("unexpected action %+v (err %v)", action, err)
+	}
+
+	if summary.JobID != job.ID || len(summary.Steps) != 2 {
+		t.Errorf("webhook summary = %+v, want job %d with 2 steps", summary, job.ID)
+	}
+}
+
+func TestPipelineFailureSkipsRemainingSteps(t *testing.T) {
+	s, database := newTestScheduler(t)
+
+	// A job that has never run can't have succeeded
+	other, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Upstream",
+		Paths:          []string{"/tmp"},
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+	})
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Downstream",
+		Paths:          []string{"/tmp"},
+		Enabled:        true,
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		Steps: []db.JobStep{
+			{Type: db.JobStepWaitForJob, JobID: other.ID},
+			{Type: db.JobStepScan},
+		},
+	})
+
+	s.startJob(context.Background(), job, db.JobEventManual, nil, "Started manually")
+	s.wg.Wait()
+
+	_, steps := stepRunsForLatestEvent(t, database, job.ID)
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 step runs, got %d", len(steps))
+	}
+	if steps[0].Status != db.JobStepRunFailed {
+		t.Errorf("wait step status = %s, want failed", steps[0].Status)
+	}
+	if steps[1].Status != db.JobStepRunSkipped {
+		t.Errorf("scan step status = %s, want skipped", steps[1].Status)
+	}
+	if _, err := database.GetLastRunForJob(job.ID); err == nil {
+		t.Error("skipped scan step should not start a scan")
+	}
+}
+
+func TestWaitForJobStepSucceeds(t *testing.T) {
+	s, database := newTestScheduler(t)
+
+	other, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Upstream",
+		Paths:          []string{"/tmp"},
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+	})
+	run, _ := database.CreateScanRun(nil, &other.ID, other.Paths, nil)
+	database.CompleteScanRun(run.ID, db.ScanRunStatusCompleted, nil)
+
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Downstream",
+		Paths:          []string{"/tmp"},
+		Enabled:        true,
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		Steps: []db.JobStep{
+			{Type: db.JobStepWaitForJob, JobID: other.ID},
+			{Type: db.JobStepNotify},
+		},
+	})
+
+	s.startJob(context.Background(), job, db.JobEventManual, nil, "Started manually")
+	s.wg.Wait()
+
+	_, steps := stepRunsForLatestEvent(t, database, job.ID)
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 step runs, got %d", len(steps))
+	}
+	for _, sr := range steps {
+		if sr.Status != db.JobStepRunCompleted {
+			t.Errorf("step %d (%s) status = %s (%s), want completed", sr.StepIndex, sr.StepType, sr.Status, sr.Message)
+		}
+	}
+
+	// The downstream run now counts as a success for jobs waiting on it
+	if !s.jobSucceeded(job.ID) {
+		t.Error("jobSucceeded should be true when every step completed")
+	}
+}
+
+func TestRunNowRequiresRunningScheduler(t *testing.T) {
+	s, database := newTestScheduler(t)
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Manual",
+		Paths:          []string{"/tmp"},
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+	})
+
+	if err := s.RunNow(job); err == nil {
+		t.Error("RunNow should fail when the scheduler is not running")
+	}
+}
+
+func TestManualRunsHonorOverlapPolicy(t *testing.T) {
+	s, database := newTestScheduler(t)
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Manual",
+		Paths:          []string{"/tmp"},
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		OverlapPolicy:  db.OverlapPolicyForbid,
+	})
+	s.activeJobs[job.ID] = 1
+
+	if err := s.RunJobAndWait(context.Background(), job); !errors.Is(err, ErrJobActive) {
+		t.Errorf("RunJobAndWait of an active job = %v, want ErrJobActive", err)
+	}
+	s.mu.Lock()
+	s.running, s.ctx = true, context.Background()
+	s.mu.Unlock()
+	if err := s.RunNow(job); !errors.Is(err, ErrJobActive) {
+		t.Errorf("RunNow of an active job = %v, want ErrJobActive", err)
+	}
+	if events, _ := database.ListJobEvents(job.ID, 10); len(events) != 0 {
+		t.Errorf("refused runs recorded %d events, want none", len(events))
+	}
+}
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	valid := []string{"", "22:00-06:00", "Mon-Fri 22:00-06:00, Sat-Sun 00:00-24:00", "sat 01:30-04:00", "Fri-Mon 20:00-23:59"}
+	for _, spec := range valid {
+		if _, err := ParseMaintenanceWindow(spec); err != nil {
+			t.Errorf("ParseMaintenanceWindow(%q) failed: %v", spec, err)
+		}
+	}
+
+	invalid := []string{"22:00", "25:00-06:00", "22:00-06:60", "Funday 22:00-06:00", "Mon-Fri", "10:00-10:00", "24:00-06:00", "Mon Tue 22:00-06:00"}
+	for _, spec := range invalid {
+		if _, err := ParseMaintenanceWindow(spec); err == nil {
+			t.Errorf("ParseMaintenanceWindow(%q) should fail", spec)
+		}
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	w, err := ParseMaintenanceWindow("Mon-Fri 22:00-06:00, Sat-Sun 00:00-24:00")
+	if err != nil {
+		t.Fatalf("ParseMaintenanceWindow failed: %v", err)
+	}
+
+	// 2024-01-01 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{"monday afternoon", at(1, 14, 0), false},
+		{"monday evening", at(1, 22, 0), true},
+		{"tuesday early morning", at(2, 5, 59), true},
+		{"tuesday morning", at(2, 6, 0), false},
+		{"monday early morning (sunday's range ends at midnight)", at(1, 3, 0), false},
+		{"saturday noon", at(6, 12, 0), true},
+		{"friday night into saturday", at(6, 2, 0), true},
+	}
+	for _, tt := range tests {
+		if got := w.Contains(tt.t); got != tt.want {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tt.name, tt.t, got, tt.want)
+		}
+	}
+
+	var always *MaintenanceWindow
+	if !always.Contains(at(1, 14, 0)) {
+		t.Error("nil window should always be open")
+	}
+}
+
+func TestMaintenanceWindowNextOpen(t *testing.T) {
+	w, _ := ParseMaintenanceWindow("Mon-Fri 22:00-06:00")
+
+	// Monday afternoon opens Monday evening
+	from := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)
+	if got, want := w.NextOpen(from), time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("NextOpen(%v) = %v, want %v", from, got, want)
+	}
+
+	// Saturday morning (after Friday's range ends) opens Monday evening
+	from = time.Date(2024, 1, 6, 9, 0, 0, 0, time.UTC)
+	if got, want := w.NextOpen(from), time.Date(2024, 1, 8, 22, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("NextOpen(%v) = %v, want %v", from, got, want)
+	}
+
+	// Inside the window returns the time itself
+	from = time.Date(2024, 1, 2, 23, 0, 0, 0, time.UTC)
+	if got := w.NextOpen(from); !got.Equal(from) {
+		t.Errorf("NextOpen(%v) = %v, want unchanged", from, got)
+	}
+}
+
+// windowAround returns a window that opens at now+offset in loc and lasts an hour
+func windowAround(now time.Time, loc *time.Location, offset time.Duration) string {
+	start := now.In(loc).Add(offset)
+	return start.Format("15:04") + "-" + start.Add(time.Hour).Format("15:04")
+}
+
+func TestMaintenanceWindowDefersRun(t *testing.T) {
+	s, database := newTestScheduler(t)
+
+	dueTime := time.Now().Add(-time.Second)
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:              "Windowed",
+		Paths:             []string{"/tmp"},
+		Enabled:           true,
+		CronExpression:    "* * * * *",
+		Timezone:          "UTC",
+		Action:            "scan",
+		NextRunAt:         &dueTime,
+		MaintenanceWindow: windowAround(time.Now(), time.UTC, 2*time.Hour),
+	})
+
+	s.checkJobs(context.Background())
+	s.wg.Wait()
+
+	waitForJobEvent(t, database, job.ID, db.JobEventDeferred)
+	if _, err := database.GetLastRunForJob(job.ID); err == nil {
+		t.Error("no scan should start outside the maintenance window")
+	}
+
+	updated, _ := database.GetScheduledJob(job.ID)
+	want := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+	if updated.NextRunAt == nil || updated.NextRunAt.Sub(want).Abs() > time.Minute {
+		t.Errorf("NextRunAt = %v, want about %v", updated.NextRunAt, want)
+	}
+}
+
+func TestMaintenanceWindowAllowsRun(t *testing.T) {
+	s, database := newTestScheduler(t)
+
+	// The job's own open window overrides a closed global window
+	global, _ := ParseMaintenanceWindow(windowAround(time.Now(), time.Local, 2*time.Hour))
+	s.SetMaintenanceWindow(global)
+
+	dueTime := time.Now().Add(-time.Second)
+	job, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:              "Open Window",
+		Paths:             []string{"/tmp"},
+		Enabled:           true,
+		CronExpression:    "0 * * * *",
+		Timezone:          "UTC",
+		Action:            "scan",
+		NextRunAt:         &dueTime,
+		MaintenanceWindow: windowAround(time.Now(), time.UTC, -30*time.Minute),
+	})
+	other, _ := database.CreateScheduledJob(&db.ScheduledJob{
+		Name:           "Global Window",
+		Paths:          []string{"/tmp"},
+		Enabled:        true,
+		CronExpression: "0 * * * *",
+		Action:         "scan",
+		NextRunAt:      &dueTime,
+	})
+
+	s.checkJobs(context.Background())
+	s.wg.Wait()
+
+	waitForJobEvent(t, database, job.ID, db.JobEventStarted)
+	waitForJobEvent(t, database, other.ID, db.JobEventDeferred)
+}
+
 // blockingExecutor blocks until signaled
 type blockingExecutor struct {
 	started chan struct{}
@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a set of weekly time ranges during which scheduled
+// runs may start, such as "Mon-Fri 22:00-06:00, Sat-Sun 00:00-24:00".
+// Ranges that end before they start run past midnight into the next day.
+// A nil window is always open.
+type MaintenanceWindow struct {
+	spec   string
+	ranges []windowRange
+}
+
+// windowRange is one time range, active on the days it starts
+type windowRange struct {
+	days  [7]bool // Indexed by time.Weekday
+	start int     // Minutes after midnight
+	end   int     // Minutes after midnight (1440 = end of day)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseMaintenanceWindow parses a comma-separated list of ranges, each an
+// optional day or day range followed by a HH:MM-HH:MM time range. An empty
+// spec returns a nil (always open) window.
+func ParseMaintenanceWindow(spec string) (*MaintenanceWindow, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	w := &MaintenanceWindow{spec: spec}
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.Fields(part)
+		var r windowRange
+		var times string
+		switch len(fields) {
+		case 1:
+			for d := range r.days {
+				r.days[d] = true
+			}
+			times = fields[0]
+		case 2:
+			days, err := parseWindowDays(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			r.days = days
+			times = fields[1]
+		default:
+			return nil, fmt.Errorf("invalid window %q: expected [days] HH:MM-HH:MM", strings.TrimSpace(part))
+		}
+
+		from, to, ok := strings.Cut(times, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid time range %q: expected HH:MM-HH:MM", times)
+		}
+		var err error
+		if r.start, err = parseWindowTime(from); err != nil {
+			return nil, err
+		}
+		if r.end, err = parseWindowTime(to); err != nil {
+			return nil, err
+		}
+		if r.start == r.end || r.start == minutesPerDay {
+			return nil, fmt.Errorf("invalid time range %q: empty range", times)
+		}
+		w.ranges = append(w.ranges, r)
+	}
+	return w, nil
+}
+
+const minutesPerDay = 24 * 60
+
+// parseWindowDays parses a day ("Sat") or an inclusive day range ("Mon-Fri")
+func parseWindowDays(s string) ([7]bool, error) {
+	var days [7]bool
+	from, to, isRange := strings.Cut(strings.ToLower(s), "-")
+	first, ok := weekdays[from]
+	if !ok {
+		return days, fmt.Errorf("invalid day %q", s)
+	}
+	last := first
+	if isRange {
+		if last, ok = weekdays[to]; !ok {
+			return days, fmt.Errorf("invalid day range %q", s)
+		}
+	}
+	for d := first; ; d = (d + 1) % 7 {
+		days[d] = true
+		if d == last {
+			break
+		}
+	}
+	return days, nil
+}
+
+// parseWindowTime parses HH:MM into minutes after midnight; 24:00 is allowed as an end time
+func parseWindowTime(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	h, errH := strconv.Atoi(hh)
+	m, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// String returns the window as it was written
+func (w *MaintenanceWindow) String() string {
+	if w == nil {
+		return ""
+	}
+	return w.spec
+}
+
+// Contains reports whether t falls inside the window, in t's location
+func (w *MaintenanceWindow) Contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	day := t.Weekday()
+	prev := (day + 6) % 7
+	minute := t.Hour()*60 + t.Minute()
+	for _, r := range w.ranges {
+		if r.start < r.end {
+			if r.days[day] && minute >= r.start && minute < r.end {
+				return true
+			}
+			continue
+		}
+		// Overnight range: the evening part today or the morning part of yesterday's range
+		if (r.days[day] && minute >= r.start) || (r.days[prev] && minute < r.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen returns t if the window is open at t, otherwise the next time it opens
+func (w *MaintenanceWindow) NextOpen(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	var next time.Time
+	for offset := 0; offset <= 7; offset++ {
+		date := t.AddDate(0, 0, offset)
+		for _, r := range w.ranges {
+			if !r.days[date.Weekday()] {
+				continue
+			}
+			open := time.Date(date.Year(), date.Month(), date.Day(), r.start/60, r.start%60, 0, 0, t.Location())
+			if open.After(t) && (next.IsZero() || open.Before(next)) {
+				next = open
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return next
+}
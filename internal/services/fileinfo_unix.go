@@ -0,0 +1,28 @@
+//go:build !windows
+
+package services
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the inode and device number of a stat result
+func fileIdentity(fi os.FileInfo) (inode, device *int64) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, nil
+	}
+	ino, dev := int64(st.Ino), int64(st.Dev)
+	return &ino, &dev
+}
+
+// fileUsage returns the link count and allocated size of a stat result
+func fileUsage(fi os.FileInfo) (links, allocated int64, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	// Blocks are always counted in 512-byte units, whatever the filesystem's block size
+	return int64(st.Nlink), int64(st.Blocks) * 512, true
+}
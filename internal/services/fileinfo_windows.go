@@ -0,0 +1,15 @@
+//go:build windows
+
+package services
+
+import "os"
+
+// fileIdentity is not supported on Windows
+func fileIdentity(fi os.FileInfo) (inode, device *int64) {
+	return nil, nil
+}
+
+// fileUsage is not supported on Windows
+func fileUsage(fi os.FileInfo) (links, allocated int64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+// maxHookOutput caps how much of a hook's combined output is stored
+const maxHookOutput = 64 * 1024
+
+// hookWaitDelay is how long a killed hook's output pipes are waited on
+// before giving up, so a hook that leaves background processes running
+// can't hang the scan
+const hookWaitDelay = 5 * time.Second
+
+// Hook names passed to hook commands as KURON_HOOK
+const (
+	HookPreScan    = "pre_scan"
+	HookPreAction  = "pre_action"
+	HookPostAction = "post_action"
+)
+
+// ActionHooks are the commands run around an action
+type ActionHooks struct {
+	PreAction  string
+	PostAction string
+}
+
+// errHooksDisabled is returned when a hook is configured but hooks are not enabled
+var errHooksDisabled = errors.New("hook commands are disabled (set KURON_HOOKS_ENABLED=true)")
+
+// EnableHooks allows jobs to run hook commands, each limited to timeout
+func (s *Scanner) EnableHooks(timeout time.Duration) {
+	s.hooksEnabled = true
+	s.hookTimeout = timeout
+}
+
+// HooksEnabled reports whether hook commands may run
+func (s *Scanner) HooksEnabled() bool {
+	return s.hooksEnabled
+}
+
+// runHook runs a hook command through the shell with the given extra
+// environment. It returns the command line and its combined output, and an
+// error if the command could not run, exited non-zero or timed out.
+func (s *Scanner) runHook(ctx context.Context, name, command string, env []string) (string, error) {
+	if !s.hooksEnabled {
+		return "", errHooksDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.hookTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), "KURON_HOOK="+name)
+	cmd.Env = append(cmd.Env, env...)
+	cmd.WaitDelay = hookWaitDelay
+	configureHookProcess(cmd)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+
+	output := out.String()
+	if len(output) > maxHookOutput {
+		output = output[:maxHookOutput] + "\n# Output truncated\n"
+	}
+	output = "$ " + command + "\n" + output
+
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return output, fmt.Errorf("%s hook timed out after %s", name, s.hookTimeout)
+		}
+		return output, fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	return output, nil
+}
+
+// scanHookEnv describes a scan run to hook commands
+func scanHookEnv(runID int64, jobID *int64, paths []string) []string {
+	env := []string{
+		"KURON_SCAN_RUN_ID=" + strconv.FormatInt(runID, 10),
+		"KURON_PATHS=" + strings.Join(paths, "\n"),
+	}
+	if jobID != nil {
+		env = append(env, "KURON_JOB_ID="+strconv.FormatInt(*jobID, 10))
+	}
+	return env
+}
+
+// actionHookEnv describes an action and the groups it applies to to hook commands
+func actionHookEnv(run *db.ScanRun, action *db.Action, groupCount, fileCount int, wastedBytes int64) []string {
+	env := scanHookEnv(run.ID, run.ScheduledJobID, run.Paths)
+	return append(env,
+		"KURON_ACTION_ID="+strconv.FormatInt(action.ID, 10),
+		"KURON_ACTION_TYPE="+string(action.ActionType),
+		"KURON_GROUP_COUNT="+strconv.Itoa(groupCount),
+		"KURON_FILE_COUNT="+strconv.Itoa(fileCount),
+		"KURON_WASTED_BYTES="+strconv.FormatInt(wastedBytes, 10),
+	)
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/fclones"
+)
+
+func skipWithoutShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use sh")
+	}
+}
+
+// waitForScanRun polls until a scan run is no longer running
+func waitForScanRun(t *testing.T, database *db.DB, runID int64) *db.ScanRun {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		run, err := database.GetScanRun(runID)
+		if err != nil {
+			t.Fatalf("GetScanRun failed: %v", err)
+		}
+		if run.Status != db.ScanRunStatusRunning {
+			return run
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("scan run %d did not finish", runID)
+	return nil
+}
+
+func duplicateOutput(t *testing.T) *fclones.GroupOutput {
+	return &fclones.GroupOutput{
+		Header: fclones.Header{Stats: fclones.Stats{GroupCount: 1}},
+		Groups: []fclones.Group{
+			{FileLen: 1000, FileHash: "hash1", Files: duplicateFiles(t, "a", "b")},
+		},
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	skipWithoutShell(t)
+	scanner := NewScanner(testDB(t), &mockExecutor{}, time.Minute, false)
+
+	t.Run("disabled", func(t *testing.T) {
+		if _, err := scanner.runHook(context.Background(), HookPreScan, "true", nil); err == nil {
+			t.Error("expected error when hooks are disabled")
+		}
+	})
+
+	scanner.EnableHooks(500 * time.Millisecond)
+
+	t.Run("environment and output", func(t *testing.T) {
+		output, err := scanner.runHook(context.Background(), HookPreScan, `echo "$KURON_HOOK $KURON_SCAN_RUN_ID"`, []string{"KURON_SCAN_RUN_ID=7"})
+		if err != nil {
+			t.Fatalf("runHook failed: %v", err)
+		}
+		want := "$ echo \"$KURON_HOOK $KURON_SCAN_RUN_ID\"\npre_scan 7\n"
+		if output != want {
+			t.Errorf("output = %q, want %q", output, want)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		output, err := scanner.runHook(context.Background(), HookPreScan, "echo oops >&2; exit 3", nil)
+		if err == nil {
+			t.Fatal("expected error for non-zero exit")
+		}
+		if !strings.Contains(output, "oops") {
+			t.Errorf("output should include stderr, got %q", output)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		_, err := scanner.runHook(context.Background(), HookPreScan, "sleep 5", nil)
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	})
+}
+
+func TestPreScanHook(t *testing.T) {
+	skipWithoutShell(t)
+
+	t.Run("success", func(t *testing.T) {
+		database := testDB(t)
+		executor := &mockExecutor{groupOutput: duplicateOutput(t)}
+		scanner := NewScanner(database, executor, time.Minute, false)
+		scanner.EnableHooks(time.Minute)
+
+		jobID := int64(42)
+		cfg := &ScanConfig{Paths: []string{"/data"}, PreScanHook: `echo "job $KURON_JOB_ID paths $KURON_PATHS"`}
+		run, err := scanner.StartScan(context.Background(), cfg, &jobID)
+		if err != nil {
+			t.Fatalf("StartScan failed: %v", err)
+		}
+
+		run = waitForScanRun(t, database, run.ID)
+		if run.Status != db.ScanRunStatusCompleted {
+			t.Errorf("status = %s, want completed", run.Status)
+		}
+		if run.HookOutput == nil || !strings.Contains(*run.HookOutput, "job 42 paths /data") {
+			t.Errorf("HookOutput = %v, want hook output", run.HookOutput)
+		}
+	})
+
+	t.Run("failure aborts scan", func(t *testing.T) {
+		database := testDB(t)
+		executor := &mockExecutor{groupOutput: duplicateOutput(t)}
+		scanner := NewScanner(database, executor, time.Minute, false)
+		scanner.EnableHooks(time.Minute)
+
+		cfg := &ScanConfig{Paths: []string{"/data"}, PreScanHook: "echo no snapshot; exit 1"}
+		run, err := scanner.StartScan(context.Background(), cfg, nil)
+		if err != nil {
+			t.Fatalf("StartScan failed: %v", err)
+		}
+
+		run = waitForScanRun(t, database, run.ID)
+		if run.Status != db.ScanRunStatusFailed {
+			t.Errorf("status = %s, want failed", run.Status)
+		}
+		if run.HookOutput == nil || !strings.Contains(*run.HookOutput, "no snapshot") {
+			t.Errorf("HookOutput = %v, want hook output", run.HookOutput)
+		}
+		executor.mu.Lock()
+		defer executor.mu.Unlock()
+		if executor.groupCalls != 0 {
+			t.Errorf("fclones ran %d times after a failed pre-scan hook", executor.groupCalls)
+		}
+	})
+
+	t.Run("disabled fails scan", func(t *testing.T) {
+		database := testDB(t)
+		scanner := NewScanner(database, &mockExecutor{groupOutput: duplicateOutput(t)}, time.Minute, false)
+
+		run, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{"/data"}, PreScanHook: "true"}, nil)
+		if err != nil {
+			t.Fatalf("StartScan failed: %v", err)
+		}
+
+		run = waitForScanRun(t, database, run.ID)
+		if run.Status != db.ScanRunStatusFailed {
+			t.Errorf("status = %s, want failed", run.Status)
+		}
+	})
+}
+
+func TestExecuteActionWithHooks(t *testing.T) {
+	skipWithoutShell(t)
+
+	setup := func(t *testing.T) (*db.DB, *mockExecutor, *Scanner, int64, []int64) {
+		database := testDB(t)
+		executor := &mockExecutor{groupOutput: duplicateOutput(t), linkOutput: "Linked 1 file"}
+		scanner := NewScanner(database, executor, time.Minute, false)
+		scanner.EnableHooks(time.Minute)
+
+		run, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{"/data"}}, nil)
+		if err != nil {
+			t.Fatalf("StartScan failed: %v", err)
+		}
+		waitForScanRun(t, database, run.ID)
+
+		groupIDs, err := database.GetDuplicateGroupIDs(run.ID, db.DuplicateGroupFilter{Status: string(db.DuplicateGroupStatusPending)})
+		if err != nil || len(groupIDs) == 0 {
+			t.Fatalf("no groups found: %v", err)
+		}
+		return database, executor, scanner, run.ID, groupIDs
+	}
+
+	t.Run("hooks run around action", func(t *testing.T) {
+		database, executor, scanner, runID, groupIDs := setup(t)
+
+		hooks := ActionHooks{
+			PreAction:  `echo "pre $KURON_ACTION_TYPE $KURON_GROUP_COUNT $KURON_WASTED_BYTES"`,
+			PostAction: `echo "post $KURON_ACTION_STATUS $KURON_BYTES_SAVED"`,
+		}
+		result, err := scanner.ExecuteActionWithHooks(context.Background(), runID, groupIDs, db.ActionTypeHardlink, hooks)
+		if err != nil {
+			t.Fatalf("ExecuteActionWithHooks failed: %v", err)
+		}
+		if result.HookErr != nil {
+			t.Errorf("HookErr = %v", result.HookErr)
+		}
+		if executor.linkCalls != 1 {
+			t.Errorf("executor.Link called %d times, want 1", executor.linkCalls)
+		}
+
+		action, err := database.GetAction(result.Action.ID)
+		if err != nil {
+			t.Fatalf("GetAction failed: %v", err)
+		}
+		if action.Output == nil {
+			t.Fatal("action output not stored")
+		}
+		output := *action.Output
+		pre := strings.Index(output, "pre hardlink 1 1000")
+		link := strings.Index(output, "Linked 1 file")
+		post := strings.Index(output, "post completed 1000")
+		if pre < 0 || link < 0 || post < 0 || !(pre < link && link < post) {
+			t.Errorf("output should contain pre hook, fclones and post hook output in order, got %q", output)
+		}
+	})
+
+	t.Run("failing pre-action hook aborts action", func(t *testing.T) {
+		database, executor, scanner, runID, groupIDs := setup(t)
+
+		result, err := scanner.ExecuteActionWithHooks(context.Background(), runID, groupIDs, db.ActionTypeHardlink, ActionHooks{PreAction: "exit 1"})
+		if err == nil {
+			t.Fatal("expected error from failing pre-action hook")
+		}
+		if executor.linkCalls != 0 {
+			t.Errorf("executor.Link called %d times after failed pre-action hook", executor.linkCalls)
+		}
+
+		action, err := database.GetAction(result.Action.ID)
+		if err != nil {
+			t.Fatalf("GetAction failed: %v", err)
+		}
+		if action.Status != db.ActionStatusFailed {
+			t.Errorf("status = %s, want failed", action.Status)
+		}
+		if action.Output == nil || !strings.Contains(*action.Output, "$ exit 1") {
+			t.Errorf("action output should contain the hook command, got %v", action.Output)
+		}
+	})
+
+	t.Run("failing post-action hook is reported", func(t *testing.T) {
+		database, _, scanner, runID, groupIDs := setup(t)
+
+		result, err := scanner.ExecuteActionWithHooks(context.Background(), runID, groupIDs, db.ActionTypeHardlink, ActionHooks{PostAction: "exit 2"})
+		if err != nil {
+			t.Fatalf("ExecuteActionWithHooks failed: %v", err)
+		}
+		if result.HookErr == nil {
+			t.Error("expected HookErr from failing post-action hook")
+		}
+
+		action, err := database.GetAction(result.Action.ID)
+		if err != nil {
+			t.Fatalf("GetAction failed: %v", err)
+		}
+		if action.Status != db.ActionStatusCompleted {
+			t.Errorf("status = %s, want completed", action.Status)
+		}
+	})
+}
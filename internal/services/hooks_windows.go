@@ -0,0 +1,9 @@
+//go:build windows
+
+package services
+
+import "os/exec"
+
+// configureHookProcess is a no-op on Windows; only the shell itself is
+// killed on timeout
+func configureHookProcess(cmd *exec.Cmd) {}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/fclones"
+)
+
+// errReportMissingHeader is returned when a report's groups come before its
+// header, or it has no header at all
+var errReportMissingHeader = errors.New("report has no header before its groups; it must be fclones group --format json output")
+
+// reportTimestampLayouts are the formats fclones has written report timestamps in
+var reportTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -07:00",
+	"2006-01-02 15:04:05.999999999 -0700",
+}
+
+// ImportReport creates a completed scan run from the JSON report of an
+// fclones group run elsewhere, so it can be browsed and acted on like a
+// native scan. isAllowed is checked against the scanned paths and every
+// file in the report; a report touching any other path is rejected.
+func (s *Scanner) ImportReport(r io.Reader, isAllowed func(path string) bool) (*db.ScanRun, error) {
+	var run *db.ScanRun
+	var header *fclones.Header
+	var audit bool
+	var groupCount, fileCount, wasted int64
+	batch := make([]*db.DuplicateGroup, 0, groupBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.db.CreateDuplicateGroups(batch); err != nil {
+			return fmt.Errorf("failed to store duplicate groups: %w", err)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	onHeader := func(h *fclones.Header) error {
+		header = h
+		opts := fclones.ParseGroupCommand(h.Command, h.BaseDir)
+		if len(opts.Paths) == 0 {
+			return errors.New("report's command has no scanned paths")
+		}
+		for _, p := range opts.Paths {
+			if !isAllowed(p) {
+				return fmt.Errorf("path not allowed: %s", p)
+			}
+		}
+
+		var err error
+		run, err = s.db.CreateScanRun(nil, nil, opts.Paths, &db.ScanRunOptions{
+			MinSize:         opts.MinSize,
+			MaxSize:         opts.MaxSize,
+			IncludePatterns: opts.IncludePatterns,
+			ExcludePatterns: opts.ExcludePatterns,
+			IncludeHidden:   opts.IncludeHidden,
+			FollowLinks:     opts.FollowLinks,
+			OneFileSystem:   opts.OneFileSystem,
+			NoIgnore:        opts.NoIgnore,
+			IgnoreCase:      opts.IgnoreCase,
+			MaxDepth:        opts.MaxDepth,
+			NamePatterns:    opts.NamePatterns,
+			MatchName:       opts.MatchName,
+			Isolate:         opts.Isolate,
+			MatchLinks:      opts.MatchLinks,
+			RFOver:          opts.RFOver,
+			RFUnder:         opts.RFUnder,
+			Transform:       opts.Transform,
+		})
+		audit = opts.RFUnder > 0
+		return err
+	}
+
+	onGroup := func(group fclones.Group) error {
+		if run == nil {
+			return errReportMissingHeader
+		}
+		for i, path := range group.Files {
+			path = header.ResolvePath(path)
+			if !isAllowed(path) {
+				return fmt.Errorf("path not allowed: %s", path)
+			}
+			group.Files[i] = path
+		}
+
+		g := newDuplicateGroup(run.ID, group, audit)
+		if g == nil {
+			return nil
+		}
+		groupCount++
+		if audit {
+			fileCount += int64(g.FileCount)
+		} else {
+			fileCount += int64(len(g.Copies()) - 1)
+			wasted += g.WastedBytes
+		}
+
+		batch = append(batch, g)
+		if len(batch) >= groupBatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	_, err := fclones.DecodeGroups(r, onHeader, onGroup)
+	if err == nil {
+		err = flush()
+	}
+	if err == nil && run == nil {
+		err = errReportMissingHeader
+	}
+	if err != nil {
+		if run == nil {
+			return nil, fmt.Errorf("failed to import report: %w", err)
+		}
+
+		// Don't leave partial results behind
+		if dbErr := s.db.DeleteDuplicateGroups(run.ID); dbErr != nil {
+			log.Printf("import %d: failed to remove partial results: %v", run.ID, dbErr)
+		}
+		errMsg := fmt.Sprintf("failed to import report: %v", err)
+		s.db.CompleteScanRun(run.ID, db.ScanRunStatusFailed, &errMsg)
+		return nil, errors.New(errMsg)
+	}
+
+	// The report only lists files in groups, so the number scanned is unknown
+	if err := s.db.UpdateScanRunProgress(run.ID, 0, 0, groupCount, fileCount, wasted); err != nil {
+		log.Printf("import %d: failed to update stats: %v", run.ID, err)
+	}
+	if err := s.db.CompleteScanRun(run.ID, db.ScanRunStatusCompleted, nil); err != nil {
+		return nil, err
+	}
+	if err := s.db.SetScanRunImported(run.ID, strings.Join(header.Command, " "), reportTime(header.Timestamp)); err != nil {
+		return nil, err
+	}
+
+	log.Printf("import %d: imported %d groups from fclones report of %s", run.ID, groupCount, strings.Join(run.Paths, ", "))
+	return s.db.GetScanRun(run.ID)
+}
+
+// reportTime parses a report's timestamp, falling back to now if it can't be
+func reportTime(timestamp string) time.Time {
+	for _, layout := range reportTimestampLayouts {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
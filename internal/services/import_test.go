@@ -0,0 +1,96 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+const testReport = `{
+	"header": {
+		"version": "0.35.0",
+		"timestamp": "2024-05-01T12:30:00.123456+02:00",
+		"command": ["fclones", "group", "--format", "json", "--min", "1K", "media", "/mnt/backup"],
+		"base_dir": "/home/me",
+		"stats": {"group_count": 2}
+	},
+	"groups": [
+		{"file_len": 2000, "file_hash": "a", "files": ["media/x.jpg", "/mnt/backup/x.jpg"]},
+		{"file_len": 1000, "file_hash": "b", "files": ["media/y.jpg", "media/z.jpg", "/mnt/backup/y.jpg"]}
+	]
+}`
+
+func TestImportReport(t *testing.T) {
+	database := testDB(t)
+	scanner := NewScanner(database, &mockExecutor{}, 5*time.Minute, false)
+
+	run, err := scanner.ImportReport(strings.NewReader(testReport), func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("ImportReport failed: %v", err)
+	}
+
+	if run.Status != db.ScanRunStatusCompleted || !run.IsImported() {
+		t.Errorf("run = %s, imported %v; want completed import", run.Status, run.IsImported())
+	}
+	if got, want := *run.ImportedCommand, "fclones group --format json --min 1K media /mnt/backup"; got != want {
+		t.Errorf("ImportedCommand = %q, want %q", got, want)
+	}
+	if want := time.Date(2024, 5, 1, 10, 30, 0, 123456000, time.UTC); !run.StartedAt.Equal(want) {
+		t.Errorf("StartedAt = %v, want %v", run.StartedAt, want)
+	}
+	if len(run.Paths) != 2 || run.Paths[0] != "/home/me/media" || run.MinSize != 1000 {
+		t.Errorf("Paths = %q, MinSize = %d", run.Paths, run.MinSize)
+	}
+	if run.DuplicateGroups != 2 || run.DuplicateFiles != 3 || run.WastedBytes != 4000 {
+		t.Errorf("stats = %d groups, %d files, %d wasted; want 2, 3, 4000",
+			run.DuplicateGroups, run.DuplicateFiles, run.WastedBytes)
+	}
+
+	groups, err := database.ListDuplicateGroups(run.ID, "")
+	if err != nil || len(groups) != 2 {
+		t.Fatalf("ListDuplicateGroups = %d groups, %v; want 2", len(groups), err)
+	}
+	for _, g := range groups {
+		for _, f := range g.Files {
+			if !strings.HasPrefix(f, "/") {
+				t.Errorf("file %q should be resolved against the base dir", f)
+			}
+		}
+	}
+}
+
+func TestImportReportRejected(t *testing.T) {
+	database := testDB(t)
+	scanner := NewScanner(database, &mockExecutor{}, 5*time.Minute, false)
+
+	// A scanned path outside the allowlist is rejected before a run is created
+	_, err := scanner.ImportReport(strings.NewReader(testReport), func(p string) bool { return p != "/mnt/backup" })
+	if err == nil || !strings.Contains(err.Error(), "/mnt/backup") {
+		t.Errorf("ImportReport error = %v, want path not allowed", err)
+	}
+	if runs, _ := database.ListScanRuns(10, 0); len(runs) != 0 {
+		t.Errorf("expected no scan runs, got %d", len(runs))
+	}
+
+	// A file outside the allowlist fails the run without leaving groups behind
+	_, err = scanner.ImportReport(strings.NewReader(testReport), func(p string) bool { return p != "/home/me/media/z.jpg" })
+	if err == nil {
+		t.Fatal("ImportReport should fail for a file outside the allowlist")
+	}
+	runs, _ := database.ListScanRuns(10, 0)
+	if len(runs) != 1 || runs[0].Status != db.ScanRunStatusFailed {
+		t.Fatalf("expected 1 failed run, got %d", len(runs))
+	}
+	if n, _ := database.CountDuplicateGroups(runs[0].ID, db.DuplicateGroupFilter{}); n != 0 {
+		t.Errorf("expected partial groups to be removed, got %d", n)
+	}
+
+	// Anything other than an fclones JSON report is rejected
+	for _, input := range []string{"not json", `{"groups": [{"file_len": 1, "file_hash": "a", "files": ["/a", "/b"]}]}`} {
+		if _, err := scanner.ImportReport(strings.NewReader(input), func(string) bool { return true }); err == nil {
+			t.Errorf("ImportReport(%q) should fail", input)
+		}
+	}
+}
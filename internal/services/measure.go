@@ -0,0 +1,104 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+// inodeKey identifies a file's data on disk
+type inodeKey struct {
+	device, inode int64
+}
+
+// fileBefore is a file an action was to change, as it was beforehand
+type fileBefore struct {
+	key       inodeKey
+	links     int64
+	allocated int64
+}
+
+// spaceMeter measures the disk space an action reclaims, from snapshots of
+// the files it changes and of their filesystems' free space
+type spaceMeter struct {
+	files map[string]fileBefore
+	free  map[int64]int64  // Available bytes by device, before the action
+	dirs  map[int64]string // A directory on each device, to check its free space again
+}
+
+// newSpaceMeter snapshots the files an action may change and the free
+// space of their filesystems
+func newSpaceMeter(paths []string) *spaceMeter {
+	m := &spaceMeter{
+		files: make(map[string]fileBefore),
+		free:  make(map[int64]int64),
+		dirs:  make(map[int64]string),
+	}
+	for _, path := range paths {
+		fi, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		inode, device := fileIdentity(fi)
+		links, allocated, ok := fileUsage(fi)
+		if inode == nil || !ok {
+			continue
+		}
+		m.files[path] = fileBefore{key: inodeKey{*device, *inode}, links: links, allocated: allocated}
+
+		if _, seen := m.dirs[*device]; !seen {
+			dir := filepath.Dir(path)
+			if free, ok := freeSpace(dir); ok {
+				m.dirs[*device] = dir
+				m.free[*device] = free
+			}
+		}
+	}
+	return m
+}
+
+// measure returns the space freed by the files an action changed, and the
+// change in free space of their filesystems, which also takes in anything
+// else writing to them meanwhile. An inode's space only counts as freed once
+// all its links are gone, and a reflinked copy's only where its data is
+// shared, as far as the filesystem reports. Either is nil if it couldn't be
+// measured.
+func (m *spaceMeter) measure(results []db.ActionFile, reflink bool) (reclaimed, freeChange *int64) {
+	if len(m.files) > 0 {
+		unlinked := make(map[inodeKey]int64)
+		before := make(map[inodeKey]fileBefore)
+		for _, r := range results {
+			f, ok := m.files[r.Path]
+			if !ok || r.Status != db.FileActionDone {
+				continue
+			}
+			if reflink {
+				if shared, known := sharesExtents(r.Path); known && !shared {
+					continue
+				}
+			}
+			unlinked[f.key]++
+			before[f.key] = f
+		}
+
+		var total int64
+		for key, n := range unlinked {
+			if f := before[key]; n >= f.links {
+				total += f.allocated
+			}
+		}
+		reclaimed = &total
+	}
+
+	if len(m.dirs) > 0 {
+		var total int64
+		for device, dir := range m.dirs {
+			if free, ok := freeSpace(dir); ok {
+				total += free - m.free[device]
+			}
+		}
+		freeChange = &total
+	}
+	return reclaimed, freeChange
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+func TestSpaceMeter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes aren't reported on Windows")
+	}
+
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	data := bytes.Repeat([]byte("kuron"), 20000)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := os.WriteFile(path(name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// d has another link outside the action, so its data stays on disk
+	if err := os.Link(path("d"), path("d2")); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Lstat(path("b"))
+	_, allocated, ok := fileUsage(fi)
+	if !ok {
+		t.Fatal("fileUsage failed")
+	}
+
+	meter := newSpaceMeter([]string{path("a"), path("b"), path("c"), path("d")})
+
+	// b and d get linked, c doesn't
+	for _, name := range []string{"b", "d"} {
+		os.Remove(path(name))
+		if err := os.Link(path("a"), path(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results := []db.ActionFile{
+		{Path: path("b"), Status: db.FileActionDone},
+		{Path: path("c"), Status: db.FileActionFailed},
+		{Path: path("d"), Status: db.FileActionDone},
+	}
+
+	reclaimed, freeChange := meter.measure(results, false)
+	if reclaimed == nil || *reclaimed != allocated {
+		t.Errorf("reclaimed = %v, want %d (only b's data is gone)", reclaimed, allocated)
+	}
+	if (runtime.GOOS == "linux" || runtime.GOOS == "darwin") && freeChange == nil {
+		t.Error("free space change should be measured")
+	}
+}
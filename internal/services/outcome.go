@@ -0,0 +1,235 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/lyallcooper/kuron/internal/db"
+	"github.com/lyallcooper/kuron/internal/fclones"
+)
+
+// actionOutcome is what an fclones action actually changed
+type actionOutcome struct {
+	Results        []db.ActionFile                     // Outcome of each file fclones was to change
+	Groups         map[db.DuplicateGroupStatus][]int64 // Group IDs by their new status
+	FilesProcessed int
+	FilesFailed    int
+	FilesUnknown   int // Files whose outcome couldn't be confirmed
+	BytesSaved     int64
+}
+
+// GroupsProcessed returns the number of groups the action changed any files of
+func (o *actionOutcome) GroupsProcessed() int {
+	return len(o.Groups[db.DuplicateGroupStatusProcessed]) + len(o.Groups[db.DuplicateGroupStatusPartial])
+}
+
+// verifyAction checks what an action changed in each group, using the files
+// on disk and the errors fclones logged. An action is to change every path of
+// a group but the copy it keeps. Each group with changes to check is
+// processed if all of them were made, partial if some were or couldn't be
+// confirmed, and failed if none were; groups without any keep their status.
+func verifyAction(groups []*db.DuplicateGroup, actionType db.ActionType, output string) *actionOutcome {
+	errorLines := fclones.ErrorLines(output)
+
+	// Errors that name none of the files could be about any of them
+	unattributed := false
+	for _, line := range errorLines {
+		if !slices.ContainsFunc(groups, func(g *db.DuplicateGroup) bool {
+			return slices.ContainsFunc(g.Files, func(path string) bool { return mentionsPath(line, path) })
+		}) {
+			unattributed = true
+			break
+		}
+	}
+
+	o := &actionOutcome{Groups: make(map[db.DuplicateGroupStatus][]int64)}
+	for _, g := range groups {
+		var done, failed, unknown int
+		for _, result := range verifyGroup(g, actionType, errorLines, unattributed) {
+			o.Results = append(o.Results, result)
+			switch result.Status {
+			case db.FileActionDone:
+				done++
+				o.BytesSaved += g.FileSize
+			case db.FileActionFailed:
+				failed++
+			default:
+				unknown++
+			}
+		}
+		o.FilesProcessed += done
+		o.FilesFailed += failed
+		o.FilesUnknown += unknown
+
+		switch {
+		case done > 0 && failed == 0 && unknown == 0:
+			o.Groups[db.DuplicateGroupStatusProcessed] = append(o.Groups[db.DuplicateGroupStatusProcessed], g.ID)
+		case done > 0 || unknown > 0:
+			o.Groups[db.DuplicateGroupStatusPartial] = append(o.Groups[db.DuplicateGroupStatusPartial], g.ID)
+		case failed > 0:
+			o.Groups[db.DuplicateGroupStatusFailed] = append(o.Groups[db.DuplicateGroupStatusFailed], g.ID)
+		}
+	}
+	return o
+}
+
+// verifyGroup checks the outcome for each file of a group the action was to
+// change. Files fclones logged an error for failed. Otherwise links are
+// confirmed by the paths sharing the kept copy's inode and removals by the
+// paths being gone, with the copy kept found from what's left. Reflinks
+// can't be told apart from copies, so they're taken as made unless fclones
+// logged errors that don't name their files.
+func verifyGroup(g *db.DuplicateGroup, actionType db.ActionType, errorLines []string, unattributed bool) []db.ActionFile {
+	results := make(map[string]*db.ActionFile, len(g.Files))
+	for _, path := range g.Files {
+		for _, line := range errorLines {
+			if mentionsPath(line, path) {
+				results[path] = &db.ActionFile{Path: path, Status: db.FileActionFailed, Error: line}
+				break
+			}
+		}
+	}
+	set := func(path string, status db.FileActionStatus, msg string) {
+		if results[path] == nil {
+			results[path] = &db.ActionFile{Path: path, Status: status, Error: msg}
+		}
+	}
+
+	switch actionType {
+	case db.ActionTypeRemove:
+		var left []string
+		for _, path := range g.Files {
+			if _, err := os.Lstat(path); os.IsNotExist(err) {
+				set(path, db.FileActionDone, "")
+			} else if err != nil {
+				set(path, db.FileActionFailed, err.Error())
+			} else if results[path] == nil {
+				left = append(left, path)
+			}
+		}
+		// One copy is kept, but when more are left there's no telling which
+		if len(left) > 1 {
+			for _, path := range left {
+				set(path, db.FileActionUnknown, "still exists, and may be the copy kept")
+			}
+		}
+
+	case db.ActionTypeHardlink:
+		// The copy kept is the one most paths now share, preferring the keeper
+		infos := make(map[string]os.FileInfo, len(g.Files))
+		for _, path := range g.Files {
+			// Stat follows symbolic links, so this holds for both kinds of link
+			if fi, err := os.Stat(path); err != nil {
+				set(path, db.FileActionFailed, err.Error())
+			} else {
+				infos[path] = fi
+			}
+		}
+		kept, keptLinks := "", 0
+		for _, path := range g.Files {
+			if infos[path] == nil {
+				continue
+			}
+			n := 0
+			for _, other := range g.Files {
+				if infos[other] != nil && os.SameFile(infos[path], infos[other]) {
+					n++
+				}
+			}
+			if n > keptLinks {
+				kept, keptLinks = path, n
+			}
+		}
+		keptLink := scannedLink(g, kept)
+		for _, path := range g.Files {
+			switch {
+			case path == kept || infos[path] == nil:
+			case !os.SameFile(infos[path], infos[kept]):
+				set(path, db.FileActionFailed, fmt.Sprintf("not linked to %s", kept))
+			case keptLink != "" && scannedLink(g, path) == keptLink:
+				// Already linked when scanned, so there was nothing to change
+			default:
+				set(path, db.FileActionDone, "")
+			}
+		}
+
+	default:
+		// Reflinks keep the group's keeper, its first file
+		for i, path := range g.Files {
+			if i == 0 {
+				continue
+			}
+			if _, err := os.Lstat(path); err != nil {
+				set(path, db.FileActionFailed, err.Error())
+			} else if unattributed {
+				set(path, db.FileActionUnknown, "fclones logged errors that don't name a file")
+			} else {
+				set(path, db.FileActionDone, "")
+			}
+		}
+	}
+
+	var ordered []db.ActionFile
+	for _, path := range g.Files {
+		if r := results[path]; r != nil {
+			ordered = append(ordered, *r)
+		}
+	}
+	return ordered
+}
+
+// scannedLink returns the identity of the data path was linked to when the
+// group was scanned ("" if unknown)
+func scannedLink(g *db.DuplicateGroup, path string) string {
+	if i := slices.Index(g.Files, path); i >= 0 && i < len(g.Links) {
+		return g.Links[i]
+	}
+	return ""
+}
+
+// mentionsPath reports whether a log line mentions path as a whole, rather
+// than as part of a longer path. Paths are bounded by whitespace, quotes, the
+// ends of the line, or a colon and whitespace after them.
+func mentionsPath(line, path string) bool {
+	for i := 0; i < len(line); {
+		j := strings.Index(line[i:], path)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(path)
+		before := start == 0 || isPathBound(line[start-1])
+		after := end == len(line) || isPathBound(line[end]) ||
+			line[end] == ':' && (end+1 == len(line) || isPathBound(line[end+1]))
+		if before && after {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
+// isPathBound reports whether c can delimit a path in a log line
+func isPathBound(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\'' || c == '"' || c == '`'
+}
+
+// fullyLinked reports whether all of a group's paths are now links to the
+// same data, leaving an action nothing to do
+func fullyLinked(paths []string) bool {
+	if len(paths) < 2 {
+		return false
+	}
+	first, err := os.Stat(paths[0])
+	if err != nil {
+		return false
+	}
+	for _, path := range paths[1:] {
+		fi, err := os.Stat(path)
+		if err != nil || !os.SameFile(first, fi) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lyallcooper/kuron/internal/db"
+)
+
+func TestMentionsPath(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"fclones: error: Failed to link /x/a -> /x/c: Permission denied", true},
+		{"fclones: error: Failed to remove /x/a: Permission denied", true},
+		{`fclones:  warn: Skipping "/x/a": file was modified`, true},
+		{"fclones: error: Failed to remove /x/a", true},
+		{"fclones: error: Failed to remove /x/ab: Permission denied", false},
+		{"fclones: error: Failed to remove /x/a:b: Permission denied", false},
+		{"fclones: error: Failed to remove /y/x/a: Permission denied", false},
+		{"fclones: error: Failed to remove /x/ab and /x/a", true},
+	}
+	for _, tt := range tests {
+		if got := mentionsPath(tt.line, "/x/a"); got != tt.want {
+			t.Errorf("mentionsPath(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyAction(t *testing.T) {
+	files := func(t *testing.T, names ...string) []string {
+		dir := t.TempDir()
+		var paths []string
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte("12345"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, path)
+		}
+		return paths
+	}
+	statuses := func(o *actionOutcome) map[string]db.FileActionStatus {
+		got := make(map[string]db.FileActionStatus)
+		for _, r := range o.Results {
+			got[filepath.Base(r.Path)] = r.Status
+		}
+		return got
+	}
+
+	t.Run("remove with several copies left", func(t *testing.T) {
+		paths := files(t, "a", "b", "c")
+		os.Remove(paths[2])
+		g := &db.DuplicateGroup{ID: 1, FileSize: 5, Files: paths}
+
+		o := verifyAction([]*db.DuplicateGroup{g}, db.ActionTypeRemove, "")
+		want := map[string]db.FileActionStatus{"a": db.FileActionUnknown, "b": db.FileActionUnknown, "c": db.FileActionDone}
+		if got := statuses(o); !reflect.DeepEqual(got, want) {
+			t.Errorf("statuses = %v, want %v", got, want)
+		}
+		if o.FilesProcessed != 1 || o.FilesUnknown != 2 || len(o.Groups[db.DuplicateGroupStatusPartial]) != 1 {
+			t.Errorf("outcome = %+v, want 1 processed, 2 unknown and a partial group", o)
+		}
+	})
+
+	t.Run("remove keeping one copy", func(t *testing.T) {
+		paths := files(t, "a", "b")
+		os.Remove(paths[0])
+		g := &db.DuplicateGroup{ID: 1, FileSize: 5, Files: paths}
+
+		o := verifyAction([]*db.DuplicateGroup{g}, db.ActionTypeRemove, "")
+		want := map[string]db.FileActionStatus{"a": db.FileActionDone}
+		if got := statuses(o); !reflect.DeepEqual(got, want) {
+			t.Errorf("statuses = %v, want %v", got, want)
+		}
+		if len(o.Groups[db.DuplicateGroupStatusProcessed]) != 1 || o.BytesSaved != 5 {
+			t.Errorf("outcome = %+v, want a processed group and 5 bytes saved", o)
+		}
+	})
+
+	t.Run("hardlink already linked when scanned", func(t *testing.T) {
+		paths := files(t, "a", "b", "c")
+		os.Remove(paths[1])
+		os.Link(paths[0], paths[1])
+		os.Remove(paths[2])
+		os.Link(paths[0], paths[2])
+		g := &db.DuplicateGroup{ID: 1, FileSize: 5, Files: paths, Links: []string{"1:1", "1:1", "1:2"}}
+
+		o := verifyAction([]*db.DuplicateGroup{g}, db.ActionTypeHardlink, "")
+		want := map[string]db.FileActionStatus{"c": db.FileActionDone}
+		if got := statuses(o); !reflect.DeepEqual(got, want) {
+			t.Errorf("statuses = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("reflink with unattributed errors", func(t *testing.T) {
+		paths := files(t, "a", "b")
+		g := &db.DuplicateGroup{ID: 1, FileSize: 5, Files: paths}
+
+		o := verifyAction([]*db.DuplicateGroup{g}, db.ActionTypeReflink, "fclones: error: something went wrong\n")
+		want := map[string]db.FileActionStatus{"b": db.FileActionUnknown}
+		if got := statuses(o); !reflect.DeepEqual(got, want) {
+			t.Errorf("statuses = %v, want %v", got, want)
+		}
+
+		o = verifyAction([]*db.DuplicateGroup{g}, db.ActionTypeReflink, "fclones: error: Failed to dedupe "+paths[1]+": Not supported\n")
+		if r := o.Results; len(r) != 1 || r[0].Status != db.FileActionFailed {
+			t.Errorf("results = %+v, want b failed", r)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package services
+
+import (
+	"os"
+	"syscall"
+)
+
+// suspendProcess stops the process until resumeProcess is called
+func suspendProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGSTOP)
+}
+
+// resumeProcess continues a process stopped by suspendProcess
+func resumeProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGCONT)
+}
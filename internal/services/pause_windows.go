@@ -0,0 +1,15 @@
+//go:build windows
+
+package services
+
+import "os"
+
+// suspendProcess is not supported on Windows
+func suspendProcess(p *os.Process) error {
+	return errPauseUnsupported
+}
+
+// resumeProcess is not supported on Windows
+func resumeProcess(p *os.Process) error {
+	return errPauseUnsupported
+}
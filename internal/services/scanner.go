@@ -3,8 +3,11 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -49,15 +52,90 @@ type Scanner struct {
 	// Caching config (fclones stores cache in $HOME/.cache/fclones)
 	cacheEnabled bool
 
-	// Active scans and their cancellation functions
-	mu          sync.RWMutex
-	activeScans map[int64]context.CancelFunc
+	// Hook commands (disabled unless EnableHooks is called)
+	hooksEnabled bool
+	hookTimeout  time.Duration
+
+	// Active scans and their cancellation and pause state, and how many
+	// actions are changing files
+	mu            sync.RWMutex
+	activeScans   map[int64]*activeScan
+	activeActions int
 
 	// SSE subscribers
 	subMu       sync.RWMutex
 	subscribers map[int64][]*subscriber
 }
 
+// groupBatchSize is how many duplicate groups are stored per transaction
+const groupBatchSize = 1000
+
+// ErrScanNotActive is returned when pausing or resuming a scan that isn't running
+var ErrScanNotActive = errors.New("scan is not running")
+
+// ErrAuditScan is returned when applying an action to an audit scan, whose
+// groups are files with too few copies rather than duplicates
+var ErrAuditScan = errors.New("actions can't be applied to an at-risk file scan")
+
+// errCustomTransformDisabled is returned when starting a scan with a custom
+// transform command while hook commands are disabled
+var errCustomTransformDisabled = errors.New("custom transform commands are disabled (set KURON_HOOKS_ENABLED=true)")
+
+// errScanTimeout is the cancellation cause of a scan that ran out of time
+var errScanTimeout = errors.New("scan timed out")
+
+// errPauseUnsupported is returned when pausing scans on platforms without process suspension
+var errPauseUnsupported = errors.New("pausing scans is not supported on Windows")
+
+// activeScan tracks a scan running in this process. The scan timeout is
+// enforced with a timer that is stopped while the scan is paused, so paused
+// time doesn't count towards it.
+type activeScan struct {
+	cancel context.CancelCauseFunc
+
+	mu        sync.Mutex
+	process   *os.Process   // fclones process, once started
+	paused    bool          // Whether the scan is paused
+	timer     *time.Timer   // Cancels the scan when its remaining time runs out
+	remaining time.Duration // Run time left when the timer was last started
+	resumedAt time.Time     // When the timer was last started
+}
+
+func newActiveScan(cancel context.CancelCauseFunc, timeout time.Duration) *activeScan {
+	a := &activeScan{cancel: cancel, remaining: timeout, resumedAt: time.Now()}
+	a.timer = time.AfterFunc(timeout, func() { cancel(errScanTimeout) })
+	return a
+}
+
+// setProcess records the fclones process, suspending it straight away if
+// the scan was paused before it started
+func (a *activeScan) setProcess(p *os.Process) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.process = p
+	if a.paused {
+		if err := suspendProcess(p); err != nil {
+			log.Printf("scanner: failed to suspend fclones: %v", err)
+		}
+	}
+}
+
+// status returns the progress status reported for the scan
+func (a *activeScan) status() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.paused {
+		return "paused"
+	}
+	return string(db.ScanRunStatusRunning)
+}
+
+// stop releases the scan's timer and context once it has finished
+func (a *activeScan) stop() {
+	a.timer.Stop()
+	a.cancel(nil)
+}
+
 // NewScanner creates a new scanner service
 func NewScanner(database *db.DB, executor fclones.ExecutorInterface, scanTimeout time.Duration, cacheEnabled bool) *Scanner {
 	return &Scanner{
@@ -65,7 +143,7 @@ func NewScanner(database *db.DB, executor fclones.ExecutorInterface, scanTimeout
 		executor:     executor,
 		scanTimeout:  scanTimeout,
 		cacheEnabled: cacheEnabled,
-		activeScans:  make(map[int64]context.CancelFunc),
+		activeScans:  make(map[int64]*activeScan),
 		subscribers:  make(map[int64][]*subscriber),
 	}
 }
@@ -133,6 +211,11 @@ func (s *Scanner) closeSubscribers(runID int64) {
 
 // StartScan starts a new scan with full configuration
 func (s *Scanner) StartScan(ctx context.Context, cfg *ScanConfig, jobID *int64) (*db.ScanRun, error) {
+	// Custom transforms run arbitrary commands, so they're gated like hooks
+	if cfg.Transform != "" && fclones.TransformPresetName(cfg.Transform) == "" && !s.hooksEnabled {
+		return nil, errCustomTransformDisabled
+	}
+
 	// Create scan run record with paths and options
 	opts := &db.ScanRunOptions{
 		MinSize:         cfg.MinSize,
@@ -145,27 +228,84 @@ func (s *Scanner) StartScan(ctx context.Context, cfg *ScanConfig, jobID *int64)
 		NoIgnore:        cfg.NoIgnore,
 		IgnoreCase:      cfg.IgnoreCase,
 		MaxDepth:        cfg.MaxDepth,
+		NamePatterns:    cfg.NamePatterns,
+		MatchName:       cfg.MatchName,
+		Isolate:         cfg.Isolate,
+		MatchLinks:      cfg.MatchLinks,
+		RFOver:          cfg.RFOver,
+		RFUnder:         cfg.RFUnder,
+		Transform:       cfg.Transform,
 	}
 	run, err := s.db.CreateScanRun(nil, jobID, cfg.Paths, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create context with timeout (can also be cancelled manually)
-	scanCtx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	// Create context that is cancelled manually or when the scan times out
+	scanCtx, cancel := context.WithCancelCause(context.Background())
+	scan := newActiveScan(cancel, s.scanTimeout)
 
 	s.mu.Lock()
-	s.activeScans[run.ID] = cancel
+	s.activeScans[run.ID] = scan
 	s.mu.Unlock()
 
 	// Run scan in background
-	go s.runScan(scanCtx, run.ID, cfg)
+	go s.runScan(scanCtx, scan, run.ID, jobID, cfg)
 
 	return run, nil
 }
 
+// groupFileDetails stats each file in a group for its metadata. The first
+// file is the keeper; files that can't be stat'ed keep the group's size.
+func groupFileDetails(group fclones.Group) []*db.GroupFile {
+	details := make([]*db.GroupFile, len(group.Files))
+	for i, path := range group.Files {
+		f := &db.GroupFile{Path: path, Size: group.FileLen, Role: db.FileRoleRedundant}
+		if i == 0 {
+			f.Role = db.FileRoleKeeper
+		}
+		if fi, err := os.Stat(path); err == nil {
+			mtime := fi.ModTime()
+			f.ModTime = &mtime
+			f.Inode, f.Device = fileIdentity(fi)
+		}
+		details[i] = f
+	}
+	return details
+}
+
+// newDuplicateGroup converts a group reported by fclones for storing, or
+// returns nil if it should be skipped. Audit groups are files with too few
+// copies, so they may hold a single file and have no redundant data.
+func newDuplicateGroup(runID int64, group fclones.Group, audit bool) *db.DuplicateGroup {
+	if len(group.Files) < 2 && !(audit && len(group.Files) == 1) {
+		return nil
+	}
+
+	details := groupFileDetails(group)
+	g := &db.DuplicateGroup{
+		ScanRunID:   runID,
+		FileHash:    group.FileHash,
+		FileSize:    group.FileLen,
+		FileCount:   len(group.Files),
+		Status:      db.DuplicateGroupStatusPending,
+		Files:       group.Files,
+		Links:       make([]string, len(details)),
+		FileDetails: details,
+	}
+	for i, f := range details {
+		g.Links[i] = db.FileLink(f.Inode, f.Device)
+	}
+
+	// Paths hardlinked to the same data don't waste any space
+	if !audit {
+		g.WastedBytes = group.FileLen * int64(len(g.Copies())-1)
+	}
+	return g
+}
+
 // runScan executes the actual scan
-func (s *Scanner) runScan(ctx context.Context, runID int64, cfg *ScanConfig) {
+func (s *Scanner) runScan(ctx context.Context, scan *activeScan, runID int64, jobID *int64, cfg *ScanConfig) {
 	startTime := time.Now()
 	log.Printf("scan %d: starting scan of %s", runID, strings.Join(cfg.Paths, ", "))
 
@@ -173,9 +313,33 @@ func (s *Scanner) runScan(ctx context.Context, runID int64, cfg *ScanConfig) {
 		s.mu.Lock()
 		delete(s.activeScans, runID)
 		s.mu.Unlock()
+		scan.stop()
 		s.closeSubscribers(runID)
 	}()
 
+	// Run the pre-scan hook; a failing hook aborts the scan
+	if cfg.PreScanHook != "" {
+		output, err := s.runHook(ctx, HookPreScan, cfg.PreScanHook, scanHookEnv(runID, jobID, cfg.Paths))
+		if output != "" {
+			if dbErr := s.db.SetScanRunHookOutput(runID, output); dbErr != nil {
+				log.Printf("scan %d: failed to store hook output: %v", runID, dbErr)
+			}
+		}
+		if err != nil {
+			if context.Cause(ctx) == context.Canceled {
+				s.db.CompleteScanRun(runID, db.ScanRunStatusCancelled, nil)
+				s.broadcast(runID, &types.ScanProgress{Status: "cancelled"})
+				log.Printf("scan %d: cancelled during pre-scan hook", runID)
+				return
+			}
+			errMsg := err.Error()
+			s.db.CompleteScanRun(runID, db.ScanRunStatusFailed, &errMsg)
+			s.broadcast(runID, &types.ScanProgress{Status: "failed"})
+			log.Printf("scan %d: %s", runID, errMsg)
+			return
+		}
+	}
+
 	// Progress channel
 	progressChan := make(chan fclones.Progress, 100)
 
@@ -205,7 +369,7 @@ func (s *Scanner) runScan(ctx context.Context, runID int64, cfg *ScanConfig) {
 				BytesScanned: progress.BytesScanned,
 				GroupsFound:  progress.GroupsFound,
 				WastedBytes:  progress.WastedBytes,
-				Status:       "running",
+				Status:       scan.status(),
 				PhaseNum:     progress.PhaseNum,
 				PhaseTotal:   progress.PhaseTotal,
 				PhaseName:    progress.PhaseName,
@@ -227,10 +391,87 @@ func (s *Scanner) runScan(ctx context.Context, runID int64, cfg *ScanConfig) {
 		NoIgnore:        cfg.NoIgnore,
 		IgnoreCase:      cfg.IgnoreCase,
 		MaxDepth:        cfg.MaxDepth,
+		NamePatterns:    cfg.NamePatterns,
+		MatchName:       cfg.MatchName,
+		Isolate:         cfg.Isolate,
+		MatchLinks:      cfg.MatchLinks,
+		RFOver:          cfg.RFOver,
+		RFUnder:         cfg.RFUnder,
+		Transform:       cfg.Transform,
 		UseCache:        s.cacheEnabled,
+		Threads:         cfg.Threads,
+		Nice:            cfg.Nice,
+		IOClass:         cfg.IOClass,
+		OnStart:         scan.setProcess,
+	}
+
+	// Store groups in batches as fclones reports them. Audit scans report
+	// files with too few copies, so they keep single-file groups and have no
+	// redundant data.
+	audit := cfg.RFUnder > 0
+	var totalGroups, storedGroups, atRiskGroups, atRiskFiles int64
+	var linkedFiles, linkedBytes int64 // Counted as redundant by fclones, though hardlinked
+	batch := make([]*db.DuplicateGroup, 0, groupBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.db.CreateDuplicateGroups(batch); err != nil {
+			return fmt.Errorf("failed to store duplicate groups: %w", err)
+		}
+		storedGroups += int64(len(batch))
+		batch = batch[:0]
+
+		// Report storing as a final phase after fclones' own
+		progressMu.Lock()
+		last := lastProgress
+		progressMu.Unlock()
+		phase := last.PhaseTotal + 1
+		percent := -1.0
+		if totalGroups > 0 {
+			percent = min(100, float64(storedGroups)*100/float64(totalGroups))
+		}
+		s.broadcast(runID, &types.ScanProgress{
+			FilesScanned: last.FilesScanned,
+			BytesScanned: last.BytesScanned,
+			GroupsFound:  storedGroups,
+			WastedBytes:  last.WastedBytes,
+			Status:       scan.status(),
+			PhaseNum:     phase,
+			PhaseTotal:   phase,
+			PhaseName:    "Storing results",
+			PhasePercent: percent,
+		})
+		return nil
+	}
+	opts.OnHeader = func(h *fclones.Header) error {
+		totalGroups = h.Stats.GroupCount
+		return nil
+	}
+	opts.OnGroup = func(group fclones.Group) error {
+		g := newDuplicateGroup(runID, group, audit)
+		if g == nil {
+			return nil
+		}
+		if audit {
+			atRiskGroups++
+			atRiskFiles += int64(g.FileCount)
+		} else if linked := int64(g.LinkedFiles()); linked > 0 {
+			linkedFiles += linked
+			linkedBytes += linked * g.FileSize
+		}
+
+		batch = append(batch, g)
+		if len(batch) >= groupBatchSize {
+			return flush()
+		}
+		return nil
 	}
 
 	result, err := s.executor.Group(ctx, opts, progressChan)
+	if err == nil {
+		err = flush()
+	}
 
 	// Close progress channel and wait for goroutine to finish processing
 	close(progressChan)
@@ -243,11 +484,22 @@ func (s *Scanner) runScan(ctx context.Context, runID int64, cfg *ScanConfig) {
 	progressMu.Unlock()
 
 	if err != nil {
+		// Don't leave partial results behind
+		if storedGroups > 0 {
+			if dbErr := s.db.DeleteDuplicateGroups(runID); dbErr != nil {
+				log.Printf("scan %d: failed to remove partial results: %v", runID, dbErr)
+			}
+		}
+
 		// Check if cancelled (not an error, just user-initiated stop)
 		if ctx.Err() != nil {
 			s.db.CompleteScanRun(runID, db.ScanRunStatusCancelled, nil)
 			s.broadcast(runID, &types.ScanProgress{Status: "cancelled"})
-			log.Printf("scan %d: cancelled after %s", runID, time.Since(startTime).Round(time.Second))
+			if context.Cause(ctx) == errScanTimeout {
+				log.Printf("scan %d: timed out after %s", runID, time.Since(startTime).Round(time.Second))
+			} else {
+				log.Printf("scan %d: cancelled after %s", runID, time.Since(startTime).Round(time.Second))
+			}
 			return
 		}
 
@@ -258,36 +510,21 @@ func (s *Scanner) runScan(ctx context.Context, runID int64, cfg *ScanConfig) {
 		return
 	}
 
-	// Store duplicate groups
-	for _, group := range result.Groups {
-		if len(group.Files) < 2 {
-			continue
-		}
-
-		wastedBytes := group.FileLen * int64(len(group.Files)-1)
-
-		dg := &db.DuplicateGroup{
-			ScanRunID:   runID,
-			FileHash:    group.FileHash,
-			FileSize:    group.FileLen,
-			FileCount:   len(group.Files),
-			WastedBytes: wastedBytes,
-			Status:      db.DuplicateGroupStatusPending,
-			Files:       group.Files,
-		}
-		s.db.CreateDuplicateGroup(dg)
-	}
-
 	// Update final stats
 	// Note: stats.TotalFileCount/TotalFileSize are files IN duplicate groups, not total scanned
 	// We use filesScanned and bytesScanned from progress parsing for the actual values
 	stats := result.Header.Stats
+	groupCount, fileCount, wasted := stats.GroupCount, stats.RedundantFileCount, stats.RedundantFileSize
+	fileCount, wasted = max(0, fileCount-linkedFiles), max(0, wasted-linkedBytes)
+	if audit {
+		groupCount, fileCount, wasted = atRiskGroups, atRiskFiles, 0
+	}
 	if err := s.db.UpdateScanRunProgress(runID,
 		filesScanned,
 		bytesScanned,
-		stats.GroupCount,
-		stats.RedundantFileCount,
-		stats.RedundantFileSize,
+		groupCount,
+		fileCount,
+		wasted,
 	); err != nil {
 		log.Printf("scan %d: failed to update final progress: %v", runID, err)
 	}
@@ -297,37 +534,177 @@ func (s *Scanner) runScan(ctx context.Context, runID int64, cfg *ScanConfig) {
 	s.broadcast(runID, &types.ScanProgress{
 		FilesScanned: filesScanned,
 		BytesScanned: bytesScanned,
-		GroupsFound:  stats.GroupCount,
-		WastedBytes:  stats.RedundantFileSize,
+		GroupsFound:  groupCount,
+		WastedBytes:  wasted,
 		Status:       "completed",
 	})
 
-	log.Printf("scan %d: completed in %s, found %d duplicate groups", runID, time.Since(startTime).Round(time.Second), stats.GroupCount)
+	if audit {
+		log.Printf("scan %d: completed in %s, found %d at-risk files", runID, time.Since(startTime).Round(time.Second), atRiskFiles)
+	} else {
+		log.Printf("scan %d: completed in %s, found %d duplicate groups", runID, time.Since(startTime).Round(time.Second), groupCount)
+	}
 }
 
 // CancelScan cancels an active scan
 func (s *Scanner) CancelScan(runID int64) {
 	s.mu.RLock()
-	cancel, ok := s.activeScans[runID]
+	scan, ok := s.activeScans[runID]
 	s.mu.RUnlock()
 
 	if ok {
-		cancel()
+		scan.cancel(context.Canceled)
+	}
+}
+
+// PauseScan suspends an active scan's fclones process. A scan paused before
+// fclones starts (e.g. during its pre-scan hook) is suspended as soon as it
+// starts. Time spent paused doesn't count towards the scan timeout.
+func (s *Scanner) PauseScan(runID int64) error {
+	if runtime.GOOS == "windows" {
+		return errPauseUnsupported
+	}
+
+	s.mu.RLock()
+	scan, ok := s.activeScans[runID]
+	s.mu.RUnlock()
+	if !ok {
+		return ErrScanNotActive
+	}
+
+	scan.mu.Lock()
+	if scan.paused {
+		scan.mu.Unlock()
+		return nil
+	}
+	if scan.process != nil {
+		if err := suspendProcess(scan.process); err != nil {
+			scan.mu.Unlock()
+			return fmt.Errorf("failed to pause scan: %w", err)
+		}
+	}
+	scan.paused = true
+	if scan.timer.Stop() {
+		scan.remaining -= time.Since(scan.resumedAt)
+	}
+	scan.mu.Unlock()
+
+	log.Printf("scan %d: paused", runID)
+	s.broadcastStatus(runID, "paused")
+	return nil
+}
+
+// ResumeScan continues a paused scan
+func (s *Scanner) ResumeScan(runID int64) error {
+	s.mu.RLock()
+	scan, ok := s.activeScans[runID]
+	s.mu.RUnlock()
+	if !ok {
+		return ErrScanNotActive
 	}
+
+	scan.mu.Lock()
+	if !scan.paused {
+		scan.mu.Unlock()
+		return nil
+	}
+	if scan.process != nil {
+		if err := resumeProcess(scan.process); err != nil {
+			scan.mu.Unlock()
+			return fmt.Errorf("failed to resume scan: %w", err)
+		}
+	}
+	scan.paused = false
+	scan.resumedAt = time.Now()
+	scan.timer.Reset(scan.remaining)
+	scan.mu.Unlock()
+
+	log.Printf("scan %d: resumed", runID)
+	s.broadcastStatus(runID, string(db.ScanRunStatusRunning))
+	return nil
+}
+
+// IsPaused reports whether a scan running in this process is paused
+func (s *Scanner) IsPaused(runID int64) bool {
+	s.mu.RLock()
+	scan, ok := s.activeScans[runID]
+	s.mu.RUnlock()
+	return ok && scan.status() == "paused"
+}
+
+// broadcastStatus sends a status change to subscribers with the scan's latest stored progress
+func (s *Scanner) broadcastStatus(runID int64, status string) {
+	progress := &types.ScanProgress{Status: status}
+	if run, err := s.db.GetScanRun(runID); err == nil {
+		progress.FilesScanned = run.FilesScanned
+		progress.BytesScanned = run.BytesScanned
+		progress.GroupsFound = run.DuplicateGroups
+		progress.WastedBytes = run.WastedBytes
+	}
+	s.broadcast(runID, progress)
+}
+
+// IsActive reports whether a scan is currently running in this process
+func (s *Scanner) IsActive(runID int64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.activeScans[runID]
+	return ok
+}
+
+// HasActiveScans reports whether any scan is currently running in this process
+func (s *Scanner) HasActiveScans() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.activeScans) > 0
+}
+
+// HasActiveActions reports whether any action is currently changing files in this process
+func (s *Scanner) HasActiveActions() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.activeActions > 0
 }
 
 // ActionResult contains the result of an action execution
 type ActionResult struct {
-	Action *db.Action
-	Output string // fclones command output
+	Action  *db.Action
+	Output  string // fclones command output
+	HookErr error  // Set when the post-action hook failed after the action ran
+	Failed  int    // Files the action failed to change
 }
 
 // ExecuteAction executes a dedupe action on selected groups
 func (s *Scanner) ExecuteAction(ctx context.Context, runID int64, groupIDs []int64, actionType db.ActionType, dryRun bool, priority string) (*ActionResult, error) {
+	return s.executeAction(ctx, runID, groupIDs, actionType, dryRun, priority, ActionHooks{})
+}
+
+// ExecuteActionWithHooks executes an action like ExecuteAction, running the
+// pre-action hook before fclones and the post-action hook after it. A failing
+// pre-action hook fails the action without touching any files. Hook output
+// is appended to the action's output.
+func (s *Scanner) ExecuteActionWithHooks(ctx context.Context, runID int64, groupIDs []int64, actionType db.ActionType, hooks ActionHooks) (*ActionResult, error) {
+	return s.executeAction(ctx, runID, groupIDs, actionType, false, "", hooks)
+}
+
+func (s *Scanner) executeAction(ctx context.Context, runID int64, groupIDs []int64, actionType db.ActionType, dryRun bool, priority string, hooks ActionHooks) (*ActionResult, error) {
+	if run, err := s.db.GetScanRun(runID); err == nil && run.IsAudit() {
+		return nil, ErrAuditScan
+	}
+
 	// Only create action record for real executions (not previews)
 	var action *db.Action
 	var err error
 	if !dryRun {
+		s.mu.Lock()
+		s.activeActions++
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			s.activeActions--
+			s.mu.Unlock()
+		}()
+
 		action = &db.Action{
 			ScanRunID:  runID,
 			ActionType: actionType,
@@ -340,12 +717,22 @@ func (s *Scanner) ExecuteAction(ctx context.Context, runID int64, groupIDs []int
 
 	// Get groups and collect all file paths
 	var groups []fclones.Group
+	var dbGroups []*db.DuplicateGroup
 	var allFiles []string
+	var wastedBytes int64
+	var linked []int64 // Groups already hardlinked throughout, with nothing left to link
 	for _, gid := range groupIDs {
 		g, err := s.db.GetDuplicateGroup(gid)
 		if err != nil {
 			continue
 		}
+		// Removing still has paths to remove, even where they're links
+		if actionType != db.ActionTypeRemove && fullyLinked(g.Files) {
+			linked = append(linked, g.ID)
+			continue
+		}
+		dbGroups = append(dbGroups, g)
+		wastedBytes += g.WastedBytes
 
 		groups = append(groups, fclones.Group{
 			FileLen:  g.FileSize,
@@ -355,6 +742,32 @@ func (s *Scanner) ExecuteAction(ctx context.Context, runID int64, groupIDs []int
 		allFiles = append(allFiles, g.Files...)
 	}
 
+	// Hooks don't run for previews
+	var hookEnv []string
+	if action != nil && (hooks.PreAction != "" || hooks.PostAction != "") {
+		run, err := s.db.GetScanRun(runID)
+		if err != nil {
+			run = &db.ScanRun{ID: runID}
+		}
+		hookEnv = actionHookEnv(run, action, len(groups), len(allFiles), wastedBytes)
+	}
+
+	// Run the pre-action hook; a failing hook aborts the action before any files change
+	var preHookOutput string
+	if action != nil && hooks.PreAction != "" {
+		preHookOutput, err = s.runHook(ctx, HookPreAction, hooks.PreAction, hookEnv)
+		if err != nil {
+			errMsg := err.Error()
+			s.db.CompleteAction(action.ID, &db.ActionCompletion{
+				Status:       db.ActionStatusFailed,
+				ErrorMessage: &errMsg,
+				Output:       &preHookOutput,
+				GroupIDs:     groupIDs,
+			})
+			return &ActionResult{Action: action, Output: preHookOutput}, err
+		}
+	}
+
 	// Convert to fclones input format
 	input := s.executor.GroupToInput(groups)
 
@@ -378,14 +791,16 @@ func (s *Scanner) ExecuteAction(ctx context.Context, runID int64, groupIDs []int
 		displayCommand += " --dry-run"
 	}
 
+	// For real executions, snapshot the files so the space reclaimed can be
+	// measured
+	var meter *spaceMeter
+	if action != nil && len(groups) > 0 {
+		meter = newSpaceMeter(allFiles)
+	}
+
 	var output string
-	switch actionType {
-	case db.ActionTypeHardlink:
-		output, err = s.executor.Link(ctx, input, fclones.LinkOptions{DryRun: dryRun})
-	case db.ActionTypeReflink:
-		output, err = s.executor.Dedupe(ctx, input, fclones.DedupeOptions{DryRun: dryRun})
-	case db.ActionTypeRemove:
-		output, err = s.executor.Remove(ctx, input, fclones.RemoveOptions{DryRun: dryRun, Priority: priority})
+	if len(groups) > 0 {
+		output, err = s.runFclonesAction(ctx, actionType, input, dryRun, priority)
 	}
 
 	// Prepend command and input summary to output for display
@@ -395,52 +810,126 @@ func (s *Scanner) ExecuteAction(ctx context.Context, runID int64, groupIDs []int
 		totalInputBytes += g.FileLen * int64(len(g.Files))
 	}
 	inputSummary := fmt.Sprintf("# Input: %d groups, %d files (%s)\n", len(groups), len(allFiles), formatBytes(totalInputBytes))
+	if len(linked) > 0 {
+		inputSummary += fmt.Sprintf("# Skipped %d groups already hardlinked throughout\n", len(linked))
+	}
 	output = "$ " + displayCommand + "\n" + inputSummary + output
+	if preHookOutput != "" {
+		output = preHookOutput + "\n" + output
+	}
 
-	if err != nil {
-		if action != nil {
-			errMsg := err.Error() + "\n" + output
-			s.db.CompleteAction(action.ID, &db.ActionCompletion{
-				GroupsProcessed: len(groupIDs),
-				Status:          db.ActionStatusFailed,
-				ErrorMessage:    &errMsg,
-				Output:          &output,
-				Files:           allFiles,
-				Command:         &command,
-				GroupIDs:        groupIDs,
-			})
+	// Previews don't change anything to record
+	if action == nil {
+		return &ActionResult{Output: output}, err
+	}
+
+	// Work out what changed from the files on disk
+	outcome := verifyAction(dbGroups, actionType, output)
+	summary := fmt.Sprintf("\n# Result: %d files changed, %d failed", outcome.FilesProcessed, outcome.FilesFailed)
+	if outcome.FilesUnknown > 0 {
+		summary += fmt.Sprintf(", %d unconfirmed", outcome.FilesUnknown)
+	}
+	output += summary + "\n"
+
+	// Measure what was reclaimed before a hook can touch the files
+	var measured, freeChange *int64
+	if meter != nil {
+		measured, freeChange = meter.measure(outcome.Results, actionType == db.ActionTypeReflink)
+	}
+
+	status := db.ActionStatusCompleted
+	if outcome.FilesProcessed == 0 && outcome.FilesUnknown == 0 && (err != nil || outcome.FilesFailed > 0) {
+		status = db.ActionStatusFailed
+		if err == nil {
+			err = fmt.Errorf("%s failed for all %d files", command, outcome.FilesFailed)
 		}
-		return &ActionResult{Action: action, Output: output}, err
 	}
 
-	// Calculate bytes saved
-	var bytesSaved int64
-	var filesProcessed int
-	for _, gid := range groupIDs {
-		g, err := s.db.GetDuplicateGroup(gid)
-		if err != nil {
-			continue
+	// Run the post-action hook; its failure is reported but the action stands
+	var hookErr error
+	if hooks.PostAction != "" {
+		var hookOutput string
+		hookEnv = append(hookEnv,
+			"KURON_ACTION_STATUS="+string(status),
+			fmt.Sprintf("KURON_BYTES_SAVED=%d", outcome.BytesSaved),
+			fmt.Sprintf("KURON_FILES_PROCESSED=%d", outcome.FilesProcessed),
+			fmt.Sprintf("KURON_FILES_FAILED=%d", outcome.FilesFailed),
+		)
+		hookOutput, hookErr = s.runHook(ctx, HookPostAction, hooks.PostAction, hookEnv)
+		output += "\n" + hookOutput
+	}
+
+	// Record the outcome for each group and file. Groups that were already
+	// linked need nothing more.
+	if err := s.db.UpdateDuplicateGroupStatus(linked, db.DuplicateGroupStatusProcessed); err != nil {
+		log.Printf("scanner: failed to update status of linked groups for action %d: %v", action.ID, err)
+	}
+	for groupStatus, ids := range outcome.Groups {
+		if err := s.db.UpdateDuplicateGroupStatus(ids, groupStatus); err != nil {
+			log.Printf("scanner: failed to update status of groups for action %d: %v", action.ID, err)
 		}
-		bytesSaved += g.WastedBytes
-		filesProcessed += g.FileCount - 1
-	}
-
-	// Mark groups as processed and record completion (only for real executions)
-	if action != nil {
-		s.db.UpdateDuplicateGroupStatus(groupIDs, db.DuplicateGroupStatusProcessed)
-		s.db.CompleteAction(action.ID, &db.ActionCompletion{
-			GroupsProcessed: len(groupIDs),
-			FilesProcessed:  filesProcessed,
-			BytesSaved:      bytesSaved,
-			Status:          db.ActionStatusCompleted,
-			Output:          &output,
-			Files:           allFiles,
-			Command:         &command,
-			GroupIDs:        groupIDs,
-		})
 	}
+	pathsByStatus := make(map[db.FileActionStatus][]string)
+	for _, r := range outcome.Results {
+		pathsByStatus[r.Status] = append(pathsByStatus[r.Status], r.Path)
+	}
+	for fileStatus, paths := range pathsByStatus {
+		if err := s.db.SetGroupFilesActionStatus(groupIDs, paths, action.ID, fileStatus); err != nil {
+			log.Printf("scanner: failed to record %s files for action %d: %v", fileStatus, action.ID, err)
+		}
+	}
+
+	var problems []string
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	total := outcome.FilesProcessed + outcome.FilesFailed + outcome.FilesUnknown
+	if outcome.FilesFailed > 0 && status != db.ActionStatusFailed {
+		problems = append(problems, fmt.Sprintf("%d of %d files failed", outcome.FilesFailed, total))
+	}
+	if outcome.FilesUnknown > 0 {
+		problems = append(problems, fmt.Sprintf("%d of %d files couldn't be confirmed", outcome.FilesUnknown, total))
+	}
+	if hookErr != nil {
+		problems = append(problems, hookErr.Error())
+	}
+	completion := &db.ActionCompletion{
+		GroupsProcessed: outcome.GroupsProcessed(),
+		FilesProcessed:  outcome.FilesProcessed,
+		BytesSaved:      outcome.BytesSaved,
+		BytesMeasured:   measured,
+		FreeSpaceChange: freeChange,
+		Status:          status,
+		Output:          &output,
+		Files:           allFiles,
+		Command:         &command,
+		GroupIDs:        groupIDs,
+		Results:         outcome.Results,
+	}
+	if len(problems) > 0 {
+		errMsg := strings.Join(problems, "; ")
+		completion.ErrorMessage = &errMsg
+	}
+	s.db.CompleteAction(action.ID, completion)
+
+	result := &ActionResult{Action: action, Output: output, HookErr: hookErr, Failed: outcome.FilesFailed}
+	if status == db.ActionStatusFailed {
+		return result, err
+	}
+	return result, nil
+}
 
-	return &ActionResult{Action: action, Output: output}, nil
+// runFclonesAction runs the fclones command for an action type on the groups in input
+func (s *Scanner) runFclonesAction(ctx context.Context, actionType db.ActionType, input string, dryRun bool, priority string) (string, error) {
+	switch actionType {
+	case db.ActionTypeHardlink:
+		return s.executor.Link(ctx, input, fclones.LinkOptions{DryRun: dryRun})
+	case db.ActionTypeReflink:
+		return s.executor.Dedupe(ctx, input, fclones.DedupeOptions{DryRun: dryRun})
+	case db.ActionTypeRemove:
+		return s.executor.Remove(ctx, input, fclones.RemoveOptions{DryRun: dryRun, Priority: priority})
+	}
+	return "", fmt.Errorf("unsupported action %q", actionType)
 }
 
 // ScanConfig holds configuration for a scan
@@ -458,6 +947,51 @@ type ScanConfig struct {
 	NoIgnore      bool
 	IgnoreCase    bool
 	MaxDepth      *int
+
+	// Matching modes
+	NamePatterns []string // Glob patterns file names must match
+	MatchName    bool     // Only group files that also share a file name
+	Isolate      bool     // Only count duplicates found under different paths
+	MatchLinks   bool     // Treat hard links to the same file as duplicates
+	RFOver       int      // Report files with more than this many copies (0 = default)
+	RFUnder      int      // Report files with fewer than this many copies (0 = off)
+	Transform    string   // Command that transforms file contents before matching ("" = none)
+
+	// Resource limits
+	Threads int    // fclones thread count (0 = default)
+	Nice    int    // CPU niceness (0 = unchanged)
+	IOClass string // I/O scheduling class ("" = unchanged)
+
+	// PreScanHook runs before fclones; a failing hook fails the scan
+	PreScanHook string
+}
+
+// JobScanConfig returns the scan configuration for a scheduled job's options
+func JobScanConfig(job *db.ScheduledJob) *ScanConfig {
+	return &ScanConfig{
+		Paths:           job.Paths,
+		MinSize:         job.MinSize,
+		MaxSize:         job.MaxSize,
+		IncludePatterns: job.IncludePatterns,
+		ExcludePatterns: job.ExcludePatterns,
+		IncludeHidden:   job.IncludeHidden,
+		FollowLinks:     job.FollowLinks,
+		OneFileSystem:   job.OneFileSystem,
+		NoIgnore:        job.NoIgnore,
+		IgnoreCase:      job.IgnoreCase,
+		MaxDepth:        job.MaxDepth,
+		NamePatterns:    job.NamePatterns,
+		MatchName:       job.MatchName,
+		Isolate:         job.Isolate,
+		MatchLinks:      job.MatchLinks,
+		RFOver:          job.RFOver,
+		RFUnder:         job.RFUnder,
+		Transform:       job.Transform,
+		Threads:         job.Threads,
+		Nice:            job.Nice,
+		IOClass:         string(job.IOClass),
+		PreScanHook:     job.PreScanHook,
+	}
 }
 
 // GroupOutputToJSON converts group output to JSON for debugging
@@ -2,7 +2,13 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
@@ -22,16 +28,18 @@ type mockExecutor struct {
 	groupErr    error
 	linkOutput  string
 	linkErr     error
+	onLink      func(input string) // Replaces the linking done by each link that isn't a dry run
 	dedupeOut   string
 	dedupeErr   error
 	versionOut  string
 	versionErr  error
 	checkErr    error
 
-	// Track calls
+	// Track calls (dry runs of actions aren't counted)
 	groupCalls  int
 	linkCalls   int
 	dedupeCalls int
+	removeCalls int
 }
 
 func (m *mockExecutor) CheckInstalled(ctx context.Context) error {
@@ -59,7 +67,29 @@ func (m *mockExecutor) Group(ctx context.Context, opts fclones.ScanOptions, prog
 		}
 	}
 
-	return m.groupOutput, m.groupErr
+	if m.groupErr != nil {
+		return nil, m.groupErr
+	}
+	return streamGroups(m.groupOutput, opts)
+}
+
+// streamGroups passes a canned report to the scan's handlers the way the real
+// executor does, returning the output without groups when they're streamed
+func streamGroups(out *fclones.GroupOutput, opts fclones.ScanOptions) (*fclones.GroupOutput, error) {
+	if out == nil || opts.OnGroup == nil {
+		return out, nil
+	}
+	if opts.OnHeader != nil {
+		if err := opts.OnHeader(&out.Header); err != nil {
+			return nil, err
+		}
+	}
+	for _, g := range out.Groups {
+		if err := opts.OnGroup(g); err != nil {
+			return nil, err
+		}
+	}
+	return &fclones.GroupOutput{Header: out.Header}, nil
 }
 
 func (m *mockExecutor) GroupToInput(groups []fclones.Group) string {
@@ -75,13 +105,42 @@ func (m *mockExecutor) GroupToInput(groups []fclones.Group) string {
 }
 
 func (m *mockExecutor) Link(ctx context.Context, input string, opts fclones.LinkOptions) (string, error) {
+	if opts.DryRun {
+		return m.linkOutput, m.linkErr
+	}
 	m.mu.Lock()
 	m.linkCalls++
 	m.mu.Unlock()
+	if m.onLink != nil {
+		m.onLink(input)
+	} else if m.linkErr == nil {
+		linkInput(input)
+	}
 	return m.linkOutput, m.linkErr
 }
 
+// linkInput hardlinks the files of each group in input to the group's first,
+// like fclones link does
+func linkInput(input string) {
+	var first string
+	for _, line := range strings.Split(input, "\n") {
+		path, isFile := strings.CutPrefix(line, "    ")
+		switch {
+		case !isFile:
+			first = ""
+		case first == "":
+			first = path
+		default:
+			os.Remove(path)
+			os.Link(first, path)
+		}
+	}
+}
+
 func (m *mockExecutor) Dedupe(ctx context.Context, input string, opts fclones.DedupeOptions) (string, error) {
+	if opts.DryRun {
+		return m.dedupeOut, m.dedupeErr
+	}
 	m.mu.Lock()
 	m.dedupeCalls++
 	m.mu.Unlock()
@@ -89,6 +148,11 @@ func (m *mockExecutor) Dedupe(ctx context.Context, input string, opts fclones.De
 }
 
 func (m *mockExecutor) Remove(ctx context.Context, input string, opts fclones.RemoveOptions) (string, error) {
+	if !opts.DryRun {
+		m.mu.Lock()
+		m.removeCalls++
+		m.mu.Unlock()
+	}
 	return "", nil
 }
 
@@ -103,6 +167,21 @@ func testDB(t *testing.T) *db.DB {
 	return database
 }
 
+// duplicateFiles creates files with the same content in a temp directory
+func duplicateFiles(t *testing.T, names ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("duplicate"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
 func TestNewScanner(t *testing.T) {
 	database := testDB(t)
 	executor := &mockExecutor{}
@@ -376,6 +455,161 @@ func TestCancelScan(t *testing.T) {
 	}
 }
 
+func TestPauseResumeScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("pausing scans is not supported on Windows")
+	}
+	database := testDB(t)
+	executor := &blockingMockExecutor{
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	scanner := NewScanner(database, executor, 5*time.Minute, false)
+
+	if err := scanner.PauseScan(999); err != ErrScanNotActive {
+		t.Errorf("PauseScan on unknown run = %v, want ErrScanNotActive", err)
+	}
+
+	run, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{"/tmp"}}, nil)
+	if err != nil {
+		t.Fatalf("StartScan failed: %v", err)
+	}
+	<-executor.started
+	updates := scanner.Subscribe(run.ID)
+
+	if err := scanner.PauseScan(run.ID); err != nil {
+		t.Fatalf("PauseScan failed: %v", err)
+	}
+	if !scanner.IsPaused(run.ID) {
+		t.Error("IsPaused should be true after PauseScan")
+	}
+	if update := <-updates; update.Status != "paused" {
+		t.Errorf("broadcast status = %q, want paused", update.Status)
+	}
+
+	if err := scanner.ResumeScan(run.ID); err != nil {
+		t.Fatalf("ResumeScan failed: %v", err)
+	}
+	if scanner.IsPaused(run.ID) {
+		t.Error("IsPaused should be false after ResumeScan")
+	}
+	if update := <-updates; update.Status != "running" {
+		t.Errorf("broadcast status = %q, want running", update.Status)
+	}
+
+	close(executor.done)
+	if run = waitForScanRun(t, database, run.ID); run.Status != db.ScanRunStatusCompleted {
+		t.Errorf("status = %s, want completed", run.Status)
+	}
+}
+
+func TestPausedTimeExcludedFromTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("pausing scans is not supported on Windows")
+	}
+	database := testDB(t)
+	executor := &blockingMockExecutor{
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	scanner := NewScanner(database, executor, 300*time.Millisecond, false)
+
+	run, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{"/tmp"}}, nil)
+	if err != nil {
+		t.Fatalf("StartScan failed: %v", err)
+	}
+	<-executor.started
+
+	// Stay paused for longer than the timeout
+	if err := scanner.PauseScan(run.ID); err != nil {
+		t.Fatalf("PauseScan failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if err := scanner.ResumeScan(run.ID); err != nil {
+		t.Fatalf("ResumeScan failed: %v", err)
+	}
+
+	close(executor.done)
+	if run = waitForScanRun(t, database, run.ID); run.Status != db.ScanRunStatusCompleted {
+		t.Errorf("status = %s, want completed (paused time should not count towards the timeout)", run.Status)
+	}
+}
+
+// processMockExecutor runs a real process in place of fclones
+type processMockExecutor struct {
+	blockingMockExecutor
+}
+
+func (m *processMockExecutor) Group(ctx context.Context, opts fclones.ScanOptions, progressChan chan<- fclones.Progress) (*fclones.GroupOutput, error) {
+	cmd := exec.CommandContext(ctx, "sleep", "10")
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	opts.OnStart(cmd.Process)
+	close(m.started)
+	err := cmd.Wait()
+	return nil, err
+}
+
+// waitForProcessStopped polls /proc/<pid>/stat until the process is (or is
+// no longer) stopped, since signals are delivered asynchronously
+func waitForProcessStopped(t *testing.T, pid int, stopped bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			t.Fatalf("failed to read process state: %v", err)
+		}
+		// Format: pid (comm) state ...
+		fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+		if (fields[0] == "T") == stopped {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("process %d stopped = %v, want %v", pid, !stopped, stopped)
+}
+
+func TestPauseSuspendsProcess(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process state is read from /proc")
+	}
+	database := testDB(t)
+	executor := &processMockExecutor{blockingMockExecutor{started: make(chan struct{})}}
+	scanner := NewScanner(database, executor, time.Minute, false)
+
+	run, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{"/tmp"}}, nil)
+	if err != nil {
+		t.Fatalf("StartScan failed: %v", err)
+	}
+	<-executor.started
+
+	scanner.mu.RLock()
+	scan := scanner.activeScans[run.ID]
+	scanner.mu.RUnlock()
+	scan.mu.Lock()
+	pid := scan.process.Pid
+	scan.mu.Unlock()
+
+	if err := scanner.PauseScan(run.ID); err != nil {
+		t.Fatalf("PauseScan failed: %v", err)
+	}
+	waitForProcessStopped(t, pid, true)
+
+	if err := scanner.ResumeScan(run.ID); err != nil {
+		t.Fatalf("ResumeScan failed: %v", err)
+	}
+	waitForProcessStopped(t, pid, false)
+
+	// Cancelling a paused scan still stops it
+	scanner.PauseScan(run.ID)
+	scanner.CancelScan(run.ID)
+	if run = waitForScanRun(t, database, run.ID); run.Status != db.ScanRunStatusCancelled {
+		t.Errorf("status = %s, want cancelled", run.Status)
+	}
+}
+
 // blockingMockExecutor is a mock that blocks until signaled
 type blockingMockExecutor struct {
 	started chan struct{}
@@ -424,7 +658,7 @@ func TestExecuteAction(t *testing.T) {
 		groupOutput: &fclones.GroupOutput{
 			Header: fclones.Header{Stats: fclones.Stats{}},
 			Groups: []fclones.Group{
-				{FileLen: 1000, FileHash: "hash1", Files: []string{"/a", "/b", "/c"}},
+				{FileLen: 1000, FileHash: "hash1", Files: duplicateFiles(t, "a", "b", "c")},
 			},
 		},
 		linkOutput: "Linked 2 files",
@@ -450,10 +684,18 @@ func TestExecuteAction(t *testing.T) {
 	groupIDs := []int64{groups[0].ID}
 
 	// Execute hardlink action
+	var activeDuring bool
+	executor.onLink = func(input string) {
+		activeDuring = scanner.HasActiveActions()
+		linkInput(input)
+	}
 	result, err := scanner.ExecuteAction(context.Background(), run.ID, groupIDs, db.ActionTypeHardlink, false, "")
 	if err != nil {
 		t.Fatalf("ExecuteAction failed: %v", err)
 	}
+	if !activeDuring || scanner.HasActiveActions() {
+		t.Errorf("HasActiveActions() = %v during the action and %v after, want true then false", activeDuring, scanner.HasActiveActions())
+	}
 
 	if result == nil {
 		t.Fatal("ExecuteAction returned nil result")
@@ -465,8 +707,8 @@ func TestExecuteAction(t *testing.T) {
 	if !strings.HasPrefix(result.Output, "$ fclones link\n# Input:") {
 		t.Errorf("result.Output should start with command and input summary, got %q", result.Output)
 	}
-	if !strings.HasSuffix(result.Output, "Linked 2 files") {
-		t.Errorf("result.Output should end with fclones output, got %q", result.Output)
+	if !strings.Contains(result.Output, "Linked 2 files\n# Result: 2 files changed, 0 failed") {
+		t.Errorf("result.Output should end with fclones output and the result, got %q", result.Output)
 	}
 
 	// Verify executor was called
@@ -479,13 +721,309 @@ func TestExecuteAction(t *testing.T) {
 	}
 }
 
+func TestExecuteAction_PartialFailure(t *testing.T) {
+	database := testDB(t)
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if err := os.WriteFile(path(name), []byte("12345"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	executor := &mockExecutor{
+		groupOutput: &fclones.GroupOutput{
+			Groups: []fclones.Group{
+				{FileLen: 5, FileHash: "hash1", Files: []string{path("a"), path("b"), path("c")}},
+				{FileLen: 5, FileHash: "hash2", Files: []string{path("d"), path("e")}},
+			},
+		},
+		linkOutput: "[2026-10-18 10:00:00.000] fclones: error: Failed to link " + path("e") + ": Permission denied",
+		// Only b gets linked; c is left alone without fclones reporting it
+		onLink: func(string) {
+			os.Remove(path("b"))
+			os.Link(path("a"), path("b"))
+		},
+	}
+	scanner := NewScanner(database, executor, 5*time.Minute, false)
+
+	run, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{dir}}, nil)
+	if err != nil {
+		t.Fatalf("StartScan failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for scanner.IsActive(run.ID) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	groups, _ := database.ListDuplicateGroups(run.ID, "")
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	groupIDs := []int64{groups[0].ID, groups[1].ID}
+
+	result, err := scanner.ExecuteAction(context.Background(), run.ID, groupIDs, db.ActionTypeHardlink, false, "")
+	if err != nil {
+		t.Fatalf("ExecuteAction failed: %v", err)
+	}
+	if result.Failed != 2 {
+		t.Errorf("result.Failed = %d, want 2", result.Failed)
+	}
+
+	action, _ := database.GetAction(result.Action.ID)
+	if action.Status != db.ActionStatusCompleted {
+		t.Errorf("action.Status = %s, want %s", action.Status, db.ActionStatusCompleted)
+	}
+	if action.FilesProcessed != 1 || action.BytesSaved != 5 || action.GroupsProcessed != 1 {
+		t.Errorf("action processed %d files, %d bytes, %d groups; want 1, 5, 1",
+			action.FilesProcessed, action.BytesSaved, action.GroupsProcessed)
+	}
+	if runtime.GOOS != "windows" && action.BytesMeasured == nil {
+		t.Error("action.BytesMeasured should be set")
+	}
+	if action.ErrorMessage == nil || !strings.Contains(*action.ErrorMessage, "2 of 3 files failed") {
+		t.Errorf("action.ErrorMessage = %v, want failed file count", action.ErrorMessage)
+	}
+
+	wantStatus := map[string]db.DuplicateGroupStatus{
+		"hash1": db.DuplicateGroupStatusPartial,
+		"hash2": db.DuplicateGroupStatusFailed,
+	}
+	for _, id := range groupIDs {
+		g, _ := database.GetDuplicateGroup(id)
+		if g.Status != wantStatus[g.FileHash] {
+			t.Errorf("group %s status = %s, want %s", g.FileHash, g.Status, wantStatus[g.FileHash])
+		}
+	}
+
+	files, err := database.ListActionFiles(action.ID)
+	if err != nil {
+		t.Fatalf("ListActionFiles failed: %v", err)
+	}
+	got := make(map[string]*db.ActionFile)
+	for _, f := range files {
+		got[filepath.Base(f.Path)] = f
+	}
+	if got["a"].Status != db.FileActionNone || got["b"].Status != db.FileActionDone {
+		t.Errorf("a, b statuses = %q, %q; want none, done", got["a"].Status, got["b"].Status)
+	}
+	if got["c"].Status != db.FileActionFailed || !strings.Contains(got["c"].Error, "not linked") {
+		t.Errorf("c = %+v, want failed as not linked", got["c"])
+	}
+	if got["e"].Status != db.FileActionFailed || !strings.Contains(got["e"].Error, "Permission denied") {
+		t.Errorf("e = %+v, want failed with fclones' error", got["e"])
+	}
+
+	groupFiles, _ := database.ListGroupFiles(groups[0].ID)
+	for _, f := range groupFiles {
+		if filepath.Base(f.Path) == "b" && f.ActionStatus != db.FileActionDone {
+			t.Errorf("group file b action status = %q, want done", f.ActionStatus)
+		}
+	}
+}
+
+func TestScanAndAction_LinkedFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes aren't reported on Windows")
+	}
+
+	database := testDB(t)
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for _, name := range []string{"a", "c", "x"} {
+		if err := os.WriteFile(path(name), []byte("12345"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b is a link to a, and y to x, so only c takes up more space
+	os.Link(path("a"), path("b"))
+	os.Link(path("x"), path("y"))
+
+	executor := &mockExecutor{
+		groupOutput: &fclones.GroupOutput{
+			Header: fclones.Header{Stats: fclones.Stats{GroupCount: 2, RedundantFileCount: 3, RedundantFileSize: 15}},
+			Groups: []fclones.Group{
+				{FileLen: 5, FileHash: "partly", Files: []string{path("a"), path("b"), path("c")}},
+				{FileLen: 5, FileHash: "fully", Files: []string{path("x"), path("y")}},
+			},
+		},
+	}
+	scanner := NewScanner(database, executor, 5*time.Minute, false)
+
+	run, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{dir}}, nil)
+	if err != nil {
+		t.Fatalf("StartScan failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for scanner.IsActive(run.ID) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	updated, _ := database.GetScanRun(run.ID)
+	if updated.DuplicateFiles != 1 || updated.WastedBytes != 5 {
+		t.Errorf("run has %d redundant files, %d wasted; want 1, 5", updated.DuplicateFiles, updated.WastedBytes)
+	}
+	groups, _ := database.ListDuplicateGroups(run.ID, "")
+	byHash := make(map[string]*db.DuplicateGroup)
+	for _, g := range groups {
+		byHash[g.FileHash] = g
+	}
+	if g := byHash["partly"]; g.WastedBytes != 5 || g.LinkedFiles() != 1 {
+		t.Errorf("partly linked group wastes %d with %d linked, want 5 with 1", g.WastedBytes, g.LinkedFiles())
+	}
+	if g := byHash["fully"]; g.WastedBytes != 0 || g.LinkedFiles() != 1 {
+		t.Errorf("fully linked group wastes %d with %d linked, want 0 with 1", g.WastedBytes, g.LinkedFiles())
+	}
+
+	// Acting on only the fully linked group leaves fclones out of it
+	result, err := scanner.ExecuteAction(context.Background(), run.ID, []int64{byHash["fully"].ID}, db.ActionTypeHardlink, false, "")
+	if err != nil {
+		t.Fatalf("ExecuteAction failed: %v", err)
+	}
+	if executor.linkCalls != 0 {
+		t.Errorf("executor.Link called %d times, want 0", executor.linkCalls)
+	}
+	if !strings.Contains(result.Output, "Skipped 1 groups already hardlinked") {
+		t.Errorf("output should note the skipped group, got %q", result.Output)
+	}
+	if g, _ := database.GetDuplicateGroup(byHash["fully"].ID); g.Status != db.DuplicateGroupStatusProcessed {
+		t.Errorf("fully linked group status = %s, want %s", g.Status, db.DuplicateGroupStatusProcessed)
+	}
+
+	// Removing still removes the extra paths of a fully linked group
+	database.UpdateDuplicateGroupStatus([]int64{byHash["fully"].ID}, db.DuplicateGroupStatusPending)
+	result, err = scanner.ExecuteAction(context.Background(), run.ID, []int64{byHash["fully"].ID}, db.ActionTypeRemove, false, "")
+	if err != nil {
+		t.Fatalf("ExecuteAction(remove) failed: %v", err)
+	}
+	if executor.removeCalls != 1 {
+		t.Errorf("executor.Remove called %d times, want 1", executor.removeCalls)
+	}
+	if strings.Contains(result.Output, "Skipped") {
+		t.Errorf("remove shouldn't skip linked groups, got %q", result.Output)
+	}
+}
+
+func TestScanStoresGroupsInBatches(t *testing.T) {
+	database := testDB(t)
+
+	// More groups than fit in one batch, plus a lone file that isn't a duplicate
+	count := groupBatchSize*2 + 5
+	output := &fclones.GroupOutput{Header: fclones.Header{Stats: fclones.Stats{GroupCount: int64(count)}}}
+	for i := 0; i < count; i++ {
+		output.Groups = append(output.Groups, fclones.Group{
+			FileLen:  100,
+			FileHash: fmt.Sprintf("hash%d", i),
+			Files:    []string{fmt.Sprintf("/a/%d", i), fmt.Sprintf("/b/%d", i)},
+		})
+	}
+	output.Groups = append(output.Groups, fclones.Group{FileLen: 100, FileHash: "lone", Files: []string{"/a/lone"}})
+
+	scanner := NewScanner(database, &mockExecutor{groupOutput: output}, 5*time.Minute, false)
+	run, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{"/a", "/b"}}, nil)
+	if err != nil {
+		t.Fatalf("StartScan failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for scanner.IsActive(run.ID) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	updated, _ := database.GetScanRun(run.ID)
+	if updated.Status != db.ScanRunStatusCompleted {
+		t.Fatalf("run.Status = %s, want %s", updated.Status, db.ScanRunStatusCompleted)
+	}
+	total, err := database.CountDuplicateGroups(run.ID, db.DuplicateGroupFilter{})
+	if err != nil {
+		t.Fatalf("CountDuplicateGroups failed: %v", err)
+	}
+	if total != count {
+		t.Errorf("stored %d groups, want %d", total, count)
+	}
+}
+
+func TestAuditScan(t *testing.T) {
+	database := testDB(t)
+	executor := &mockExecutor{
+		groupOutput: &fclones.GroupOutput{
+			Header: fclones.Header{Stats: fclones.Stats{}},
+			Groups: []fclones.Group{
+				{FileLen: 1000, FileHash: "hash1", Files: []string{"/a/only"}},
+				{FileLen: 500, FileHash: "hash2", Files: []string{"/a/x", "/b/x"}},
+			},
+		},
+	}
+	scanner := NewScanner(database, executor, 5*time.Minute, false)
+
+	cfg := &ScanConfig{Paths: []string{"/a", "/b"}, RFUnder: 3}
+	run, err := scanner.StartScan(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatalf("StartScan failed: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	updated, err := database.GetScanRun(run.ID)
+	if err != nil {
+		t.Fatalf("GetScanRun failed: %v", err)
+	}
+	if updated.Status != db.ScanRunStatusCompleted {
+		t.Fatalf("run.Status = %s, want %s", updated.Status, db.ScanRunStatusCompleted)
+	}
+	if !updated.IsAudit() {
+		t.Error("run should be an audit scan")
+	}
+	if updated.DuplicateGroups != 2 || updated.DuplicateFiles != 3 || updated.WastedBytes != 0 {
+		t.Errorf("stats = %d groups, %d files, %d wasted; want 2, 3, 0",
+			updated.DuplicateGroups, updated.DuplicateFiles, updated.WastedBytes)
+	}
+
+	// Single-copy files are kept, since they're the most at risk
+	groups, _ := database.ListDuplicateGroups(run.ID, "")
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+
+	_, err = scanner.ExecuteAction(context.Background(), run.ID, []int64{groups[0].ID}, db.ActionTypeHardlink, false, "")
+	if !errors.Is(err, ErrAuditScan) {
+		t.Errorf("ExecuteAction error = %v, want %v", err, ErrAuditScan)
+	}
+	executor.mu.Lock()
+	linkCalls := executor.linkCalls
+	executor.mu.Unlock()
+	if linkCalls != 0 {
+		t.Errorf("executor.Link called %d times, want 0", linkCalls)
+	}
+}
+
+func TestCustomTransformRequiresHooks(t *testing.T) {
+	database := testDB(t)
+	executor := &mockExecutor{groupOutput: &fclones.GroupOutput{}}
+	scanner := NewScanner(database, executor, 5*time.Minute, false)
+
+	if _, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{"/tmp"}, Transform: "cat $IN"}, nil); err == nil {
+		t.Error("custom transform should be rejected while hooks are disabled")
+	}
+
+	// Presets are always allowed
+	preset, _ := fclones.TransformPresetCommand("images")
+	run, err := scanner.StartScan(context.Background(), &ScanConfig{Paths: []string{"/tmp"}, Transform: preset}, nil)
+	if err != nil {
+		t.Fatalf("StartScan with preset failed: %v", err)
+	}
+	if run.Transform != preset {
+		t.Errorf("run.Transform = %q, want %q", run.Transform, preset)
+	}
+	time.Sleep(100 * time.Millisecond)
+}
+
 func TestExecuteActionDedupe(t *testing.T) {
 	database := testDB(t)
 	executor := &mockExecutor{
 		groupOutput: &fclones.GroupOutput{
 			Header: fclones.Header{Stats: fclones.Stats{}},
 			Groups: []fclones.Group{
-				{FileLen: 1000, FileHash: "hash1", Files: []string{"/a", "/b"}},
+				{FileLen: 1000, FileHash: "hash1", Files: duplicateFiles(t, "a", "b")},
 			},
 		},
 		dedupeOut: "Deduped 1 file",
@@ -512,8 +1050,8 @@ func TestExecuteActionDedupe(t *testing.T) {
 	if !strings.HasPrefix(result.Output, "$ fclones dedupe\n# Input:") {
 		t.Errorf("result.Output should start with command and input summary, got %q", result.Output)
 	}
-	if !strings.HasSuffix(result.Output, "Deduped 1 file") {
-		t.Errorf("result.Output should end with fclones output, got %q", result.Output)
+	if !strings.Contains(result.Output, "Deduped 1 file\n# Result: 1 files changed, 0 failed") {
+		t.Errorf("result.Output should end with fclones output and the result, got %q", result.Output)
 	}
 
 	executor.mu.Lock()
@@ -666,6 +1204,9 @@ func TestScanConfigOptions(t *testing.T) {
 		NoIgnore:        true,
 		IgnoreCase:      true,
 		MaxDepth:        &maxDepth,
+		Threads:         4,
+		Nice:            10,
+		IOClass:         "idle",
 	}
 
 	_, err := scanner.StartScan(context.Background(), cfg, nil)
@@ -710,6 +1251,9 @@ func TestScanConfigOptions(t *testing.T) {
 	if capturedOpts.MaxDepth == nil || *capturedOpts.MaxDepth != 5 {
 		t.Errorf("MaxDepth = %v, want 5", capturedOpts.MaxDepth)
 	}
+	if capturedOpts.Threads != 4 || capturedOpts.Nice != 10 || capturedOpts.IOClass != "idle" {
+		t.Errorf("resource limits = %d/%d/%q, want 4/10/\"idle\"", capturedOpts.Threads, capturedOpts.Nice, capturedOpts.IOClass)
+	}
 	// Cache option comes from Scanner, not ScanConfig
 	if capturedOpts.UseCache {
 		t.Error("UseCache should be false (set on Scanner)")
@@ -767,3 +1311,39 @@ func (c *capturingMockExecutor) Group(ctx context.Context, opts fclones.ScanOpti
 	}
 	return c.mockExecutor.Group(ctx, opts, progressChan)
 }
+
+func TestJobScanConfig_CopiesEveryOption(t *testing.T) {
+	maxSize, depth := int64(100), 2
+	job := &db.ScheduledJob{
+		Paths:           []string{"/data"},
+		MinSize:         1,
+		MaxSize:         &maxSize,
+		IncludePatterns: []string{"*.jpg"},
+		ExcludePatterns: []string{"*.tmp"},
+		IncludeHidden:   true,
+		FollowLinks:     true,
+		OneFileSystem:   true,
+		NoIgnore:        true,
+		IgnoreCase:      true,
+		MaxDepth:        &depth,
+		NamePatterns:    []string{"IMG_*"},
+		MatchName:       true,
+		Isolate:         true,
+		MatchLinks:      true,
+		RFOver:          2,
+		RFUnder:         3,
+		Transform:       "exif",
+		Threads:         4,
+		Nice:            10,
+		IOClass:         db.IOClassIdle,
+		PreScanHook:     "true",
+	}
+
+	// Every option must be carried over, so a new one can't be left out
+	v := reflect.ValueOf(*JobScanConfig(job))
+	for i := range v.NumField() {
+		if v.Field(i).IsZero() {
+			t.Errorf("JobScanConfig didn't set %s", v.Type().Field(i).Name)
+		}
+	}
+}
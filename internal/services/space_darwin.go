@@ -0,0 +1,19 @@
+//go:build darwin
+
+package services
+
+import "syscall"
+
+// freeSpace returns the bytes available on the filesystem holding path
+func freeSpace(path string) (int64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false
+	}
+	return int64(st.Bavail) * int64(st.Bsize), true
+}
+
+// sharesExtents is not supported on macOS, which doesn't report shared extents
+func sharesExtents(path string) (shared, known bool) {
+	return false, false
+}
@@ -0,0 +1,83 @@
+//go:build linux
+
+package services
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// freeSpace returns the bytes available on the filesystem holding path
+func freeSpace(path string) (int64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false
+	}
+	return int64(st.Bavail) * int64(st.Bsize), true
+}
+
+// FIEMAP ioctl, from linux/fiemap.h and linux/fs.h
+const (
+	fsIocFiemap        = 0xC020660B
+	fiemapFlagSync     = 0x1
+	fiemapExtentLast   = 0x1
+	fiemapExtentShared = 0x2000
+	fiemapBatch        = 64
+)
+
+type fiemapExtent struct {
+	Logical  uint64
+	Physical uint64
+	Length   uint64
+	_        [2]uint64
+	Flags    uint32
+	_        [3]uint32
+}
+
+type fiemapRequest struct {
+	Start         uint64
+	Length        uint64
+	Flags         uint32
+	MappedExtents uint32
+	ExtentCount   uint32
+	_             uint32
+	Extents       [fiemapBatch]fiemapExtent
+}
+
+// sharesExtents reports whether all of a file's data is in extents shared
+// with other files, as it is for a reflinked copy. known is false where the
+// filesystem can't map extents.
+func sharesExtents(path string) (shared, known bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, false
+	}
+	defer f.Close()
+
+	var start uint64
+	for {
+		req := fiemapRequest{
+			Start:       start,
+			Length:      ^uint64(0) - start,
+			Flags:       fiemapFlagSync,
+			ExtentCount: fiemapBatch,
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&req)))
+		if errno != 0 {
+			return false, false
+		}
+		if req.MappedExtents == 0 {
+			return true, true
+		}
+		for _, e := range req.Extents[:req.MappedExtents] {
+			if e.Flags&fiemapExtentShared == 0 {
+				return false, true
+			}
+			if e.Flags&fiemapExtentLast != 0 {
+				return true, true
+			}
+			start = e.Logical + e.Length
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package services
+
+// freeSpace is not supported on this platform
+func freeSpace(path string) (int64, bool) {
+	return 0, false
+}
+
+// sharesExtents is not supported on this platform
+func sharesExtents(path string) (shared, known bool) {
+	return false, false
+}